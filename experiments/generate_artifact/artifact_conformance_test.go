@@ -0,0 +1,269 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+const (
+	testApp  = "test_app"
+	testUser = "test_user"
+)
+
+// artifactCases are what every artifact.Service must do, as
+// artifact.InMemoryService does it.
+var artifactCases = []struct {
+	name string
+	run  func(t *testing.T, s *artifactStore)
+}{
+	{"save numbers versions from 1", func(t *testing.T, s *artifactStore) {
+		for want := int64(1); want <= 3; want++ {
+			if got := s.save("s1", "report.md", genai.NewPartFromText("draft")); got != want {
+				t.Errorf("got version %d, want %d", got, want)
+			}
+		}
+		s.wantVersions("s1", "report.md", 3, 2, 1)
+	}},
+	{"load returns the latest version unless asked for another", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "report.md", genai.NewPartFromText("first"))
+		s.save("s1", "report.md", genai.NewPartFromText("second"))
+		s.wantText("s1", "report.md", 0, "second")
+		s.wantText("s1", "report.md", 1, "first")
+		s.wantText("s1", "report.md", 2, "second")
+		s.wantMissing("s1", "report.md", 3)
+	}},
+	{"text and bytes load back as they were saved", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "notes.md", genai.NewPartFromText("# Notes"))
+		s.save("s1", "chart.png", genai.NewPartFromBytes([]byte("\x89PNG\r\n\x1a\n..."), "image/png"))
+		s.wantText("s1", "notes.md", 0, "# Notes")
+		p := s.load("s1", "chart.png", 0)
+		if p.InlineData == nil || p.InlineData.MIMEType != "image/png" || string(p.InlineData.Data) != "\x89PNG\r\n\x1a\n..." {
+			t.Errorf("got part %+v, want the PNG bytes", p)
+		}
+	}},
+	{"a missing artifact is not found", func(t *testing.T, s *artifactStore) {
+		s.wantMissing("s1", "nothing.md", 0)
+		_, err := s.Versions(s.ctx, &artifact.VersionsRequest{AppName: testApp, UserID: testUser, SessionID: "s1", FileName: "nothing.md"})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("versions of a missing artifact: got error %v, want fs.ErrNotExist", err)
+		}
+		s.wantList("s1")
+	}},
+	{"sessions, users and apps are kept apart", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "report.md", genai.NewPartFromText("mine"))
+		s.wantList("s2")
+		s.wantMissing("s2", "report.md", 0)
+		list, err := s.List(s.ctx, &artifact.ListRequest{AppName: testApp, UserID: "someone_else", SessionID: "s1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.FileNames) > 0 {
+			t.Errorf("another user lists %q, want nothing", list.FileNames)
+		}
+		list, err = s.List(s.ctx, &artifact.ListRequest{AppName: "another_app", UserID: testUser, SessionID: "s1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.FileNames) > 0 {
+			t.Errorf("another app lists %q, want nothing", list.FileNames)
+		}
+	}},
+	{"user-scoped artifacts are shared by the user's sessions", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "user:profile.txt", genai.NewPartFromText("likes goldfish"))
+		s.save("s2", "user:profile.txt", genai.NewPartFromText("likes koi"))
+		s.save("s1", "report.md", genai.NewPartFromText("report"))
+		s.wantVersions("s3", "user:profile.txt", 2, 1)
+		s.wantText("s3", "user:profile.txt", 0, "likes koi")
+		s.wantText("s3", "user:profile.txt", 1, "likes goldfish")
+		s.wantList("s1", "report.md", "user:profile.txt")
+		s.wantList("s3", "user:profile.txt")
+	}},
+	{"list is sorted and names each file once", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "b.md", genai.NewPartFromText("b"))
+		s.save("s1", "a.md", genai.NewPartFromText("a"))
+		s.save("s1", "a.md", genai.NewPartFromText("a again"))
+		s.save("s1", "user:c.md", genai.NewPartFromText("c"))
+		s.wantList("s1", "a.md", "b.md", "user:c.md")
+	}},
+	{"deleting a version keeps the others", func(t *testing.T, s *artifactStore) {
+		for _, text := range []string{"one", "two", "three"} {
+			s.save("s1", "report.md", genai.NewPartFromText(text))
+		}
+		s.delete("s1", "report.md", 2)
+		s.wantVersions("s1", "report.md", 3, 1)
+		s.wantMissing("s1", "report.md", 2)
+		s.wantText("s1", "report.md", 0, "three")
+		s.delete("s1", "report.md", 3)
+		s.wantText("s1", "report.md", 0, "one")
+		s.wantList("s1", "report.md")
+	}},
+	{"list drops a file once its last version is deleted", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "report.md", genai.NewPartFromText("one"))
+		s.save("s1", "report.md", genai.NewPartFromText("two"))
+		s.save("s1", "user:profile.txt", genai.NewPartFromText("profile"))
+		s.delete("s1", "report.md", 1)
+		s.delete("s1", "report.md", 2)
+		s.delete("s1", "user:profile.txt", 1)
+		s.wantList("s1")
+		s.wantMissing("s1", "report.md", 0)
+	}},
+	{"deleting without a version deletes every version", func(t *testing.T, s *artifactStore) {
+		s.save("s1", "report.md", genai.NewPartFromText("one"))
+		s.save("s1", "report.md", genai.NewPartFromText("two"))
+		s.save("s1", "user:profile.txt", genai.NewPartFromText("profile"))
+		s.delete("s1", "report.md", 0)
+		s.delete("s2", "user:profile.txt", 0)
+		s.wantMissing("s1", "report.md", 0)
+		s.wantMissing("s1", "report.md", 1)
+		s.wantMissing("s1", "user:profile.txt", 0)
+		s.wantList("s1")
+	}},
+}
+
+// testArtifactService runs artifactCases against a new service from open
+// for each case.
+func testArtifactService(t *testing.T, open func(t *testing.T) artifact.Service) {
+	for _, tc := range artifactCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, &artifactStore{Service: open(t), t: t, ctx: t.Context()})
+		})
+	}
+}
+
+func TestArtifactConformance(t *testing.T) {
+	t.Run("inmemory", func(t *testing.T) {
+		testArtifactService(t, func(*testing.T) artifact.Service { return artifact.InMemoryService() })
+	})
+	t.Run("filesystem", func(t *testing.T) {
+		testArtifactService(t, func(t *testing.T) artifact.Service {
+			s, err := NewFileArtifactService(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
+
+// artifactStore wraps a service under test with helpers that fail the test
+// on unexpected errors.
+type artifactStore struct {
+	artifact.Service
+	t   *testing.T
+	ctx context.Context
+}
+
+func (s *artifactStore) save(sessionID, fileName string, part *genai.Part) int64 {
+	s.t.Helper()
+	resp, err := s.Save(s.ctx, &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: fileName, Part: part})
+	if err != nil {
+		s.t.Fatalf("saving %s: %v", fileName, err)
+	}
+	return resp.Version
+}
+
+func (s *artifactStore) load(sessionID, fileName string, version int64) *genai.Part {
+	s.t.Helper()
+	resp, err := s.Load(s.ctx, &artifact.LoadRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: fileName, Version: version})
+	if err != nil {
+		s.t.Fatalf("loading %s version %d: %v", fileName, version, err)
+	}
+	return resp.Part
+}
+
+func (s *artifactStore) delete(sessionID, fileName string, version int64) {
+	s.t.Helper()
+	if err := s.Delete(s.ctx, &artifact.DeleteRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: fileName, Version: version}); err != nil {
+		s.t.Fatalf("deleting %s version %d: %v", fileName, version, err)
+	}
+}
+
+func (s *artifactStore) wantText(sessionID, fileName string, version int64, want string) {
+	s.t.Helper()
+	if got := s.load(sessionID, fileName, version); got.Text != want {
+		s.t.Errorf("%s version %d: got %q, want %q", fileName, version, got.Text, want)
+	}
+}
+
+func (s *artifactStore) wantMissing(sessionID, fileName string, version int64) {
+	s.t.Helper()
+	_, err := s.Load(s.ctx, &artifact.LoadRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: fileName, Version: version})
+	if !errors.Is(err, fs.ErrNotExist) {
+		s.t.Errorf("loading %s version %d in session %s: got error %v, want fs.ErrNotExist", fileName, version, sessionID, err)
+	}
+}
+
+func (s *artifactStore) wantVersions(sessionID, fileName string, want ...int64) {
+	s.t.Helper()
+	resp, err := s.Versions(s.ctx, &artifact.VersionsRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: fileName})
+	if err != nil {
+		s.t.Fatalf("versions of %s: %v", fileName, err)
+	}
+	if !slices.Equal(resp.Versions, want) {
+		s.t.Errorf("versions of %s: got %d, want %d", fileName, resp.Versions, want)
+	}
+}
+
+func (s *artifactStore) wantList(sessionID string, want ...string) {
+	s.t.Helper()
+	resp, err := s.List(s.ctx, &artifact.ListRequest{AppName: testApp, UserID: testUser, SessionID: sessionID})
+	if err != nil {
+		s.t.Fatalf("listing session %s: %v", sessionID, err)
+	}
+	if len(resp.FileNames) != len(want) || (len(want) > 0 && !slices.Equal(resp.FileNames, want)) {
+		s.t.Errorf("listing session %s: got %q, want %q", sessionID, resp.FileNames, want)
+	}
+}
+
+// testUserScopeIsNotASession checks that a store keeps user-scoped
+// artifacts apart from every session, including one named "user", and
+// rejects session IDs that could name the user scope.
+// artifact.InMemoryService keeps them as a session named "user", so it is
+// not checked.
+func testUserScopeIsNotASession(t *testing.T, svc artifact.Service) {
+	s := &artifactStore{Service: svc, t: t, ctx: t.Context()}
+	s.save("s1", "user:profile.txt", genai.NewPartFromText("profile"))
+	s.save("user", "report.md", genai.NewPartFromText("a session's own file"))
+	s.wantList("user", "report.md", "user:profile.txt")
+	s.wantList("s2", "user:profile.txt")
+	s.wantMissing("s2", "report.md", 0)
+
+	for _, sessionID := range []string{userScopeDir, reservedPrefix + "other"} {
+		_, err := svc.Save(s.ctx, &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: sessionID, FileName: "report.md", Part: genai.NewPartFromText("x")})
+		if err == nil {
+			t.Errorf("saved into session %q, want it rejected as reserved", sessionID)
+		}
+		if _, err := svc.List(s.ctx, &artifact.ListRequest{AppName: testApp, UserID: testUser, SessionID: sessionID}); err == nil {
+			t.Errorf("listed session %q, want it rejected as reserved", sessionID)
+		}
+	}
+	s.wantList("s2", "user:profile.txt")
+}
+
+func TestFileArtifactUserScopeIsNotASession(t *testing.T) {
+	svc, err := NewFileArtifactService(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testUserScopeIsNotASession(t, svc)
+}
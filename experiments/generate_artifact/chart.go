@@ -0,0 +1,231 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// ChartSeries is one named row of values, one per chart label.
+type ChartSeries struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values"`
+}
+
+// ChartSpec describes a simple bar or line chart.
+type ChartSpec struct {
+	Title  string        `json:"title,omitempty"`
+	Kind   string        `json:"kind" jsonschema:"bar or line"`
+	Labels []string      `json:"labels" jsonschema:"the category for each value, shown on the x axis"`
+	Series []ChartSeries `json:"series"`
+}
+
+const chartWidth, chartHeight = 800, 500
+
+var (
+	chartPalette = []color.RGBA{
+		{0x42, 0x85, 0xf4, 0xff}, {0xea, 0x43, 0x35, 0xff}, {0xfb, 0xbc, 0x05, 0xff},
+		{0x34, 0xa8, 0x53, 0xff}, {0x9c, 0x27, 0xb0, 0xff}, {0x00, 0xac, 0xc1, 0xff},
+	}
+	chartInk  = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartGrid = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+)
+
+// renderChart draws spec as a PNG.
+func renderChart(spec ChartSpec) ([]byte, error) {
+	if len(spec.Labels) == 0 || len(spec.Series) == 0 {
+		return nil, fmt.Errorf("a chart needs at least one label and one series")
+	}
+	for _, s := range spec.Series {
+		if len(s.Values) != len(spec.Labels) {
+			return nil, fmt.Errorf("series %q has %d values for %d labels", s.Name, len(s.Values), len(spec.Labels))
+		}
+	}
+	if spec.Kind != "bar" && spec.Kind != "line" {
+		return nil, fmt.Errorf("unknown chart kind %q; use bar or line", spec.Kind)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	top, bottom := 50, chartHeight-50
+	if len(spec.Series) > 1 {
+		bottom -= 20 // room for the legend
+	}
+	left, right := 70, chartWidth-20
+	plot := image.Rect(left, top, right, bottom)
+	drawText(img, spec.Title, chartWidth/2, 28, chartInk, true)
+
+	// Y axis: always include 0 so bars have a baseline.
+	lo, hi := 0.0, 0.0
+	for _, s := range spec.Series {
+		for _, v := range s.Values {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	step := niceStep((hi - lo) / 5)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	yOf := func(v float64) int {
+		return bottom - int(math.Round((v-lo)/(hi-lo)*float64(plot.Dy())))
+	}
+	for v := lo; v <= hi+step/2; v += step {
+		y := yOf(v)
+		fillRect(img, image.Rect(left, y, right, y+1), chartGrid)
+		label := strconv.FormatFloat(v, 'g', 6, 64)
+		drawText(img, label, left-8-textLen(label), y+4, chartInk, false)
+	}
+	zero := yOf(0)
+	fillRect(img, image.Rect(left, zero, right, zero+1), chartInk)
+	fillRect(img, image.Rect(left, top, left+1, bottom), chartInk)
+
+	// X axis: one slot per label.
+	slot := float64(plot.Dx()) / float64(len(spec.Labels))
+	for i, label := range spec.Labels {
+		cx := left + int(slot*(float64(i)+0.5))
+		maxChars := max(int(slot)/7, 1)
+		if r := []rune(label); len(r) > maxChars {
+			label = string(r[:max(maxChars-1, 1)]) + "."
+		}
+		drawText(img, label, cx, bottom+18, chartInk, true)
+	}
+
+	switch spec.Kind {
+	case "bar":
+		groupWidth := slot * 0.8
+		barWidth := groupWidth / float64(len(spec.Series))
+		for si, s := range spec.Series {
+			c := chartPalette[si%len(chartPalette)]
+			for i, v := range s.Values {
+				x0 := left + int(slot*float64(i)+slot*0.1+barWidth*float64(si))
+				x1 := x0 + max(int(barWidth)-2, 1)
+				y0, y1 := yOf(v), zero
+				if y0 > y1 {
+					y0, y1 = y1, y0
+				}
+				fillRect(img, image.Rect(x0, y0, x1, y1), c)
+			}
+		}
+	case "line":
+		for si, s := range spec.Series {
+			c := chartPalette[si%len(chartPalette)]
+			var px, py int
+			for i, v := range s.Values {
+				x, y := left+int(slot*(float64(i)+0.5)), yOf(v)
+				if i > 0 {
+					drawLine(img, px, py, x, y, c)
+				}
+				fillRect(img, image.Rect(x-3, y-3, x+4, y+4), c)
+				px, py = x, y
+			}
+		}
+	}
+
+	if len(spec.Series) > 1 {
+		x := left
+		for si, s := range spec.Series {
+			fillRect(img, image.Rect(x, chartHeight-26, x+12, chartHeight-14), chartPalette[si%len(chartPalette)])
+			drawText(img, s.Name, x+18, chartHeight-15, chartInk, false)
+			x += 18 + textLen(s.Name) + 24
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// niceStep rounds a raw axis step up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine draws a 2px-wide line with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	for e := dx + dy; ; {
+		fillRect(img, image.Rect(x0, y0, x0+2, y0+2), c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// textLen is the width of s in pixels in the 7x13 font.
+func textLen(s string) int {
+	return len([]rune(s)) * basicfont.Face7x13.Advance
+}
+
+// drawText draws s with its baseline at y, starting at x or centred on it.
+func drawText(img *image.RGBA, s string, x, y int, c color.Color, center bool) {
+	if center {
+		x -= textLen(s) / 2
+	}
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderChart(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec ChartSpec
+	}{
+		{"bar", ChartSpec{Title: "Revenue", Kind: "bar", Labels: []string{"Q1", "Q2", "Q3"}, Series: []ChartSeries{{Name: "2025", Values: []float64{10, 25, 17}}}}},
+		{"line with legend", ChartSpec{Kind: "line", Labels: []string{"Jan", "Feb"}, Series: []ChartSeries{{Name: "a", Values: []float64{1, 2}}, {Name: "b", Values: []float64{3, 1}}}}},
+		{"negative values", ChartSpec{Kind: "bar", Labels: []string{"x", "y"}, Series: []ChartSeries{{Name: "delta", Values: []float64{-5, 3}}}}},
+		{"all equal", ChartSpec{Kind: "line", Labels: []string{"x", "y"}, Series: []ChartSeries{{Name: "flat", Values: []float64{0, 0}}}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := renderChart(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("not a PNG: %v", err)
+			}
+			if got, want := img.Bounds(), image.Rect(0, 0, chartWidth, chartHeight); got != want {
+				t.Errorf("got bounds %v, want %v", got, want)
+			}
+			// The first series is drawn in the first palette colour.
+			if !hasColor(img, chartPalette[0]) {
+				t.Error("the first series is not drawn")
+			}
+		})
+	}
+}
+
+func TestRenderChartErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec ChartSpec
+		want string
+	}{
+		{"no labels", ChartSpec{Kind: "bar", Series: []ChartSeries{{Name: "a"}}}, "at least one label"},
+		{"no series", ChartSpec{Kind: "bar", Labels: []string{"x"}}, "at least one label and one series"},
+		{"value count", ChartSpec{Kind: "bar", Labels: []string{"x", "y"}, Series: []ChartSeries{{Name: "a", Values: []float64{1}}}}, `series "a" has 1 values for 2 labels`},
+		{"kind", ChartSpec{Kind: "pie", Labels: []string{"x"}, Series: []ChartSeries{{Name: "a", Values: []float64{1}}}}, `unknown chart kind "pie"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := renderChart(tc.spec); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func hasColor(img image.Image, c color.RGBA) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.RGBAModel.Convert(img.At(x, y)) == c {
+				return true
+			}
+		}
+	}
+	return false
+}
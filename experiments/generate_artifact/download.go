@@ -0,0 +1,298 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/cmd/launcher/adk"
+	"google.golang.org/adk/cmd/launcher/web"
+	"google.golang.org/adk/session"
+)
+
+// downloadLauncher is a web sublauncher that lets a browser fetch the
+// artifacts of a session:
+//
+//	GET /download/apps/{app}/users/{user}/sessions/{session}/artifacts
+//	GET /download/apps/{app}/users/{user}/sessions/{session}/artifacts/{name}?version=N
+//
+// The first lists the artifacts and their versions as JSON, the second
+// returns one version (the latest if version is omitted) as a file.
+//
+// ADK's web server has no notion of a logged-in user, so every request must
+// carry a token, as ?token= or an "Authorization: Bearer" header. A token is
+// an HMAC over the app, the user and an expiry time. It grants access to
+// that user's sessions only, and the session must exist for that user.
+//
+// downloadLauncher is also an artifactLinker: once the server is running it
+// signs links for the tools to return. Before that, such as in console mode,
+// it defers to fallback.
+type downloadLauncher struct {
+	flags     *flag.FlagSet
+	publicURL string
+	linkTTL   time.Duration
+
+	fallback artifactLinker
+	secret   []byte
+	sessions session.Service
+	store    artifact.Service
+	// baseURL is set by UserMessage once the server starts, and read by
+	// tools running in other goroutines.
+	baseURL atomic.Pointer[string]
+}
+
+var _ web.Sublauncher = (*downloadLauncher)(nil)
+
+// newDownloadLauncher creates the sublauncher. Tokens are signed with
+// $DOWNLOAD_SECRET, or with a random key if it is unset, in which case
+// links stop working when the program restarts.
+func newDownloadLauncher(fallback artifactLinker) (*downloadLauncher, error) {
+	d := &downloadLauncher{fallback: fallback}
+	if s := os.Getenv("DOWNLOAD_SECRET"); s != "" {
+		d.secret = []byte(s)
+	} else {
+		d.secret = make([]byte, 32)
+		if _, err := rand.Read(d.secret); err != nil {
+			return nil, err
+		}
+	}
+	d.flags = flag.NewFlagSet("downloads", flag.ContinueOnError)
+	d.flags.StringVar(&d.publicURL, "public_url", "", "Base URL of the server as seen from the user's browser. Defaults to the local web server address.")
+	d.flags.DurationVar(&d.linkTTL, "link_ttl", 24*time.Hour, "How long download links stay valid.")
+	return d, nil
+}
+
+func (d *downloadLauncher) Keyword() string {
+	return "downloads"
+}
+
+func (d *downloadLauncher) Parse(args []string) ([]string, error) {
+	if err := d.flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse downloads flags: %v", err)
+	}
+	return d.flags.Args(), nil
+}
+
+func (d *downloadLauncher) CommandLineSyntax() string {
+	var b strings.Builder
+	d.flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&b, "  -%s\n    \t%s (default %q)\n", f.Name, f.Usage, f.DefValue)
+	})
+	return b.String()
+}
+
+func (d *downloadLauncher) SimpleDescription() string {
+	return "serves signed download links for session artifacts"
+}
+
+func (d *downloadLauncher) SetupSubrouters(router *mux.Router, config *adk.Config) error {
+	if config.ArtifactService == nil {
+		return fmt.Errorf("downloads need an ArtifactService")
+	}
+	d.sessions = config.SessionService
+	d.store = config.ArtifactService
+	r := router.Methods(http.MethodGet).PathPrefix("/download/apps/{app_name}/users/{user_id}/sessions/{session_id}/artifacts").Subrouter()
+	r.HandleFunc("", d.list)
+	r.HandleFunc("/{artifact_name:.+}", d.download)
+	return nil
+}
+
+func (d *downloadLauncher) UserMessage(webURL string, printer func(v ...any)) {
+	base := strings.TrimSuffix(webURL, "/")
+	if d.publicURL != "" {
+		base = strings.TrimSuffix(d.publicURL, "/")
+	}
+	d.baseURL.Store(&base)
+	printer(fmt.Sprintf(" downloads:  artifact links are served from %s/download/", base))
+}
+
+// DownloadURL returns a signed link to one artifact version.
+func (d *downloadLauncher) DownloadURL(ctx context.Context, appName, userID, sessionID, fileName string, version int64) (string, error) {
+	base := d.baseURL.Load()
+	if base == nil {
+		if d.fallback == nil {
+			return "", nil
+		}
+		return d.fallback.DownloadURL(ctx, appName, userID, sessionID, fileName, version)
+	}
+	q := url.Values{}
+	q.Set("version", strconv.FormatInt(version, 10))
+	q.Set("token", d.token(appName, userID, time.Now().Add(d.linkTTL)))
+	return artifactsURL(*base, appName, userID, sessionID) + "/" + url.PathEscape(fileName) + "?" + q.Encode(), nil
+}
+
+func artifactsURL(base, appName, userID, sessionID string) string {
+	return fmt.Sprintf("%s/download/apps/%s/users/%s/sessions/%s/artifacts", base,
+		url.PathEscape(appName), url.PathEscape(userID), url.PathEscape(sessionID))
+}
+
+// token signs appName and userID until expires, as "<unix time>.<hex mac>".
+func (d *downloadLauncher) token(appName, userID string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(d.mac(appName, userID, exp))
+}
+
+func (d *downloadLauncher) mac(appName, userID, exp string) []byte {
+	m := hmac.New(sha256.New, d.secret)
+	// Length prefixes stop "a"+"bc" and "ab"+"c" signing the same.
+	fmt.Fprintf(m, "%d:%s%d:%s%s", len(appName), appName, len(userID), userID, exp)
+	return m.Sum(nil)
+}
+
+// authorize checks the request's token and that the session belongs to the
+// user in the path. On failure it writes the error and returns false.
+func (d *downloadLauncher) authorize(rw http.ResponseWriter, req *http.Request) (appName, userID, sessionID string, ok bool) {
+	vars := mux.Vars(req)
+	appName, userID, sessionID = vars["app_name"], vars["user_id"], vars["session_id"]
+
+	tok := req.URL.Query().Get("token")
+	if tok == "" {
+		tok, _ = strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	exp, sig, _ := strings.Cut(tok, ".")
+	want := hex.EncodeToString(d.mac(appName, userID, exp))
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if tok == "" || err != nil || !hmac.Equal([]byte(sig), []byte(want)) {
+		http.Error(rw, "missing or invalid token", http.StatusUnauthorized)
+		return "", "", "", false
+	}
+	if time.Now().Unix() > expUnix {
+		http.Error(rw, "link has expired", http.StatusUnauthorized)
+		return "", "", "", false
+	}
+
+	// The token is for the user; the session must also be theirs. Report a
+	// missing session and someone else's the same way.
+	if _, err := d.sessions.Get(req.Context(), &session.GetRequest{AppName: appName, UserID: userID, SessionID: sessionID, NumRecentEvents: 1}); err != nil {
+		http.Error(rw, "session not found", http.StatusNotFound)
+		return "", "", "", false
+	}
+	return appName, userID, sessionID, true
+}
+
+type artifactListing struct {
+	Name     string  `json:"name"`
+	Versions []int64 `json:"versions"`
+	// URL downloads the latest version with the same token.
+	URL string `json:"url"`
+}
+
+func (d *downloadLauncher) list(rw http.ResponseWriter, req *http.Request) {
+	appName, userID, sessionID, ok := d.authorize(rw, req)
+	if !ok {
+		return
+	}
+	ctx := req.Context()
+	resp, err := d.store.List(ctx, &artifact.ListRequest{AppName: appName, UserID: userID, SessionID: sessionID})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Without a base URL yet, the links are relative to this server.
+	base := ""
+	if b := d.baseURL.Load(); b != nil {
+		base = *b
+	}
+	listing := []artifactListing{}
+	for _, name := range resp.FileNames {
+		vs, err := d.store.Versions(ctx, &artifact.VersionsRequest{AppName: appName, UserID: userID, SessionID: sessionID, FileName: name})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u := artifactsURL(base, appName, userID, sessionID) + "/" + url.PathEscape(name)
+		if tok := req.URL.Query().Get("token"); tok != "" {
+			u += "?token=" + url.QueryEscape(tok)
+		}
+		listing = append(listing, artifactListing{Name: name, Versions: vs.Versions, URL: u})
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(listing); err != nil {
+		log.Printf("Error writing artifact listing: %v", err)
+	}
+}
+
+func (d *downloadLauncher) download(rw http.ResponseWriter, req *http.Request) {
+	appName, userID, sessionID, ok := d.authorize(rw, req)
+	if !ok {
+		return
+	}
+	name := mux.Vars(req)["artifact_name"]
+	var version int64
+	if v := req.URL.Query().Get("version"); v != "" {
+		var err error
+		if version, err = strconv.ParseInt(v, 10, 64); err != nil || version < 1 {
+			http.Error(rw, "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := d.store.Load(req.Context(), &artifact.LoadRequest{
+		AppName: appName, UserID: userID, SessionID: sessionID, FileName: name, Version: version,
+	})
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(rw, "artifact not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	case resp.Part == nil:
+		http.Error(rw, "artifact is empty", http.StatusNotFound)
+		return
+	}
+
+	contentType, data := "text/plain; charset=utf-8", []byte(resp.Part.Text)
+	if resp.Part.InlineData != nil {
+		contentType, data = resp.Part.InlineData.MIMEType, resp.Part.InlineData.Data
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// Always download rather than display, so an HTML report can't run
+	// script on this origin.
+	base := path.Base(strings.TrimPrefix(name, "user:"))
+	rw.Header().Set("Content-Type", contentType)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": base})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	rw.Header().Set("Content-Disposition", disposition)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.Header().Set("Cache-Control", "private, no-store")
+	rw.Write(data)
+}
@@ -0,0 +1,235 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/cmd/launcher/adk"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+const otherUser = "other-user"
+
+// newTestDownloads serves a downloadLauncher over a session s1 of testUser,
+// holding two versions of report.md and one of user:chart.png, and a
+// session s2 of otherUser holding secret.md.
+func newTestDownloads(t *testing.T) (*downloadLauncher, *httptest.Server) {
+	t.Helper()
+	t.Setenv("DOWNLOAD_SECRET", "test-secret")
+	d, err := newDownloadLauncher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := t.Context()
+	sessions := session.InMemoryService()
+	store := artifact.InMemoryService()
+	for _, s := range []struct{ user, id string }{{testUser, "s1"}, {otherUser, "s2"}} {
+		if _, err := sessions.Create(ctx, &session.CreateRequest{AppName: testApp, UserID: s.user, SessionID: s.id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, a := range []struct {
+		user, session, name string
+		part                *genai.Part
+	}{
+		{testUser, "s1", "report.md", genai.NewPartFromBytes([]byte("# v1"), "text/markdown")},
+		{testUser, "s1", "report.md", genai.NewPartFromBytes([]byte("# v2"), "text/markdown")},
+		{testUser, "s1", "user:chart.png", genai.NewPartFromBytes([]byte("\x89PNG"), "image/png")},
+		{otherUser, "s2", "secret.md", genai.NewPartFromText("secret")},
+	} {
+		if _, err := store.Save(ctx, &artifact.SaveRequest{AppName: testApp, UserID: a.user, SessionID: a.session, FileName: a.name, Part: a.part}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := mux.NewRouter()
+	if err := d.SetupSubrouters(router, &adk.Config{SessionService: sessions, ArtifactService: store}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	d.UserMessage(srv.URL+"/", func(...any) {})
+	return d, srv
+}
+
+// get fetches u, with a bearer token if one is given, and returns the
+// response with its body read.
+func get(t *testing.T, u, bearer string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestDownloadLinks(t *testing.T) {
+	d, srv := newTestDownloads(t)
+
+	for _, tc := range []struct {
+		name        string
+		version     int64
+		body        string
+		contentType string
+		disposition string
+	}{
+		{"report.md", 1, "# v1", "text/markdown", "attachment; filename=report.md"},
+		{"report.md", 2, "# v2", "text/markdown", "attachment; filename=report.md"},
+		{"user:chart.png", 1, "\x89PNG", "image/png", "attachment; filename=chart.png"},
+	} {
+		link, err := d.DownloadURL(t.Context(), testApp, testUser, "s1", tc.name, tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(link, srv.URL+"/download/apps/") {
+			t.Errorf("got link %s, want one on %s", link, srv.URL)
+		}
+		resp, body := get(t, link, "")
+		if resp.StatusCode != http.StatusOK || body != tc.body {
+			t.Errorf("%s v%d: got %d %q, want 200 %q", tc.name, tc.version, resp.StatusCode, body, tc.body)
+			continue
+		}
+		for header, want := range map[string]string{
+			"Content-Type":           tc.contentType,
+			"Content-Disposition":    tc.disposition,
+			"X-Content-Type-Options": "nosniff",
+			"Cache-Control":          "private, no-store",
+		} {
+			if got := resp.Header.Get(header); got != want {
+				t.Errorf("%s v%d: got %s %q, want %q", tc.name, tc.version, header, got, want)
+			}
+		}
+	}
+}
+
+func TestDownloadBearerTokenAndLatestVersion(t *testing.T) {
+	d, srv := newTestDownloads(t)
+	tok := d.token(testApp, testUser, time.Now().Add(time.Hour))
+	resp, body := get(t, artifactsURL(srv.URL, testApp, testUser, "s1")+"/report.md", tok)
+	if resp.StatusCode != http.StatusOK || body != "# v2" {
+		t.Errorf("got %d %q, want 200 with the latest version", resp.StatusCode, body)
+	}
+}
+
+func TestDownloadListing(t *testing.T) {
+	d, srv := newTestDownloads(t)
+	tok := d.token(testApp, testUser, time.Now().Add(time.Hour))
+	resp, body := get(t, artifactsURL(srv.URL, testApp, testUser, "s1")+"?token="+url.QueryEscape(tok), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %d %q, want 200", resp.StatusCode, body)
+	}
+	var listing []artifactListing
+	if err := json.Unmarshal([]byte(body), &listing); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]artifactListing{}
+	for _, l := range listing {
+		got[l.Name] = l
+	}
+	if len(got) != 2 || len(got["report.md"].Versions) != 2 || len(got["user:chart.png"].Versions) != 1 {
+		t.Fatalf("got listing %+v, want report.md with 2 versions and user:chart.png with 1", listing)
+	}
+	if resp, body := get(t, got["report.md"].URL, ""); resp.StatusCode != http.StatusOK || body != "# v2" {
+		t.Errorf("listed URL: got %d %q, want the latest report", resp.StatusCode, body)
+	}
+}
+
+func TestDownloadRejects(t *testing.T) {
+	d, srv := newTestDownloads(t)
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Minute)
+	valid := d.token(testApp, testUser, future)
+	exp, sig, _ := strings.Cut(valid, ".")
+	later := d.token(testApp, testUser, future.Add(time.Hour))
+	laterExp, _, _ := strings.Cut(later, ".")
+
+	own := artifactsURL(srv.URL, testApp, testUser, "s1")
+	withToken := func(u, tok string) string { return u + "?token=" + url.QueryEscape(tok) }
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{"no token", own + "/report.md", http.StatusUnauthorized, "missing or invalid token"},
+		{"garbage token", withToken(own+"/report.md", "nonsense"), http.StatusUnauthorized, "missing or invalid token"},
+		{"tampered signature", withToken(own+"/report.md", exp+"."+flipLastHexDigit(sig)), http.StatusUnauthorized, "missing or invalid token"},
+		{"tampered expiry", withToken(own+"/report.md", laterExp+"."+sig), http.StatusUnauthorized, "missing or invalid token"},
+		{"expired", withToken(own+"/report.md", d.token(testApp, testUser, past)), http.StatusUnauthorized, "link has expired"},
+		{"another app's token", withToken(own+"/report.md", d.token("other-app", testUser, future)), http.StatusUnauthorized, "missing or invalid token"},
+		{"another user's token", withToken(own+"/report.md", d.token(testApp, otherUser, future)), http.StatusUnauthorized, "missing or invalid token"},
+		{"another app in the path", withToken(artifactsURL(srv.URL, "other-app", testUser, "s1")+"/report.md", valid), http.StatusUnauthorized, "missing or invalid token"},
+		{"another user in the path", withToken(artifactsURL(srv.URL, testApp, otherUser, "s2")+"/secret.md", valid), http.StatusUnauthorized, "missing or invalid token"},
+		{"another user's session", withToken(artifactsURL(srv.URL, testApp, testUser, "s2")+"/secret.md", valid), http.StatusNotFound, "session not found"},
+		{"another user's session listing", withToken(artifactsURL(srv.URL, testApp, testUser, "s2"), valid), http.StatusNotFound, "session not found"},
+		{"missing session", withToken(artifactsURL(srv.URL, testApp, testUser, "nope")+"/report.md", valid), http.StatusNotFound, "session not found"},
+		{"other filename", withToken(own+"/secret.md", valid), http.StatusNotFound, "artifact not found"},
+		{"missing version", withToken(own+"/report.md", valid) + "&version=3", http.StatusNotFound, "artifact not found"},
+		{"zero version", withToken(own+"/report.md", valid) + "&version=0", http.StatusBadRequest, "version must be a positive integer"},
+		{"negative version", withToken(own+"/report.md", valid) + "&version=-1", http.StatusBadRequest, "version must be a positive integer"},
+		{"non-numeric version", withToken(own+"/report.md", valid) + "&version=latest", http.StatusBadRequest, "version must be a positive integer"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := get(t, tc.url, "")
+			if resp.StatusCode != tc.status || !strings.Contains(body, tc.body) {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, tc.status, tc.body)
+			}
+		})
+	}
+}
+
+func TestDownloadURLBeforeServing(t *testing.T) {
+	t.Setenv("DOWNLOAD_SECRET", "test-secret")
+	d, err := newDownloadLauncher(fakeLinker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := d.DownloadURL(t.Context(), testApp, testUser, "s1", "report.md", 1)
+	if err != nil || link != "https://example.com/report.md" {
+		t.Errorf("got %q, %v, want the fallback's link", link, err)
+	}
+
+	d, err = newDownloadLauncher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, err := d.DownloadURL(t.Context(), testApp, testUser, "s1", "report.md", 1); link != "" || err != nil {
+		t.Errorf("got %q, %v, want no link without a server or fallback", link, err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is an in-memory stand-in for an S3 server, covering only what
+// S3ArtifactService uses: path-style PUT, GET, HEAD and DELETE of objects,
+// and ListObjectsV2. Requests must carry a valid Signature Version 4 for
+// its credentials, in the Authorization header or as a presigned URL.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject // "bucket/key" -> object
+
+	// signer holds the credentials and region requests must be signed
+	// with. Signatures are recomputed with S3ArtifactService's signing
+	// code, which TestS3SignatureVectors checks against AWS's published
+	// examples, so the fake doesn't just agree with whatever it signs.
+	signer *S3ArtifactService
+	// now is the server's clock, for checking expiry.
+	now func() time.Time
+}
+
+// fakeS3Region is the region a fakeS3 expects requests to be signed for.
+const fakeS3Region = "us-east-1"
+
+// maxClockSkew is how far the time a request was signed at may be from the
+// server's clock, as in S3.
+const maxClockSkew = 15 * time.Minute
+
+func newFakeS3(accessKeyID, secretAccessKey string) *fakeS3 {
+	return &fakeS3{
+		objects: map[string]fakeObject{},
+		signer:  &S3ArtifactService{cfg: S3Config{Region: fakeS3Region, AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}},
+		now:     time.Now,
+	}
+}
+
+type fakeObject struct {
+	data   []byte
+	header http.Header // Content-Type and x-amz-meta-*
+}
+
+// startFakeS3 serves a fakeS3 that accepts the given credentials on a
+// local port and returns its endpoint. The server lives until the process
+// exits.
+func startFakeS3(accessKeyID, secretAccessKey string) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go http.Serve(l, newFakeS3(accessKeyID, secretAccessKey))
+	return "http://" + l.Addr().String(), nil
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fakeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, msg := f.authenticate(r, body); code != "" {
+		fakeS3Error(w, http.StatusForbidden, code, msg)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		fakeS3Error(w, http.StatusBadRequest, "InvalidRequest", "path-style bucket required")
+		return
+	}
+	if key == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			f.list(w, bucket, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+			return
+		}
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", "unsupported bucket operation")
+		return
+	}
+
+	name := bucket + "/" + key
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		header := http.Header{}
+		for k, v := range r.Header {
+			if k == "Content-Type" || strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		f.objects[name] = fakeObject{data: body, header: header}
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[name]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		for k, v := range obj.header {
+			w.Header()[k] = v
+		}
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// authenticate checks the request's signature, either from the
+// Authorization header or from a presigned URL's query. It returns an S3
+// error code and message if the request must be refused.
+func (f *fakeS3) authenticate(r *http.Request, body []byte) (code, message string) {
+	query := r.URL.Query()
+	var (
+		credential, signedHeaders, signature, date, payloadHash string
+		expires                                                 time.Duration
+	)
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		fields, ok := strings.CutPrefix(auth, "AWS4-HMAC-SHA256 ")
+		if !ok {
+			return "AccessDenied", "unsupported authorization type"
+		}
+		for _, field := range strings.Split(fields, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				signature = v
+			}
+		}
+		date = r.Header.Get("X-Amz-Date")
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash != sha256Hex(body) {
+			return "XAmzContentSHA256Mismatch", "the body does not match x-amz-content-sha256"
+		}
+	} else if signature = query.Get("X-Amz-Signature"); signature != "" {
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		date = query.Get("X-Amz-Date")
+		payloadHash = "UNSIGNED-PAYLOAD"
+		seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || seconds <= 0 {
+			return "AuthorizationQueryParametersError", "X-Amz-Expires must be a positive number of seconds"
+		}
+		expires = time.Duration(seconds) * time.Second
+	} else {
+		return "AccessDenied", "request is not signed"
+	}
+
+	t, err := time.Parse(amzDateFormat, date)
+	if err != nil {
+		return "AccessDenied", "missing or invalid X-Amz-Date"
+	}
+	f.mu.Lock()
+	now := f.now()
+	f.mu.Unlock()
+	if expires > 0 {
+		if now.After(t.Add(expires)) {
+			return "AccessDenied", "Request has expired"
+		}
+	} else if d := now.Sub(t); d > maxClockSkew || d < -maxClockSkew {
+		return "RequestTimeTooSkewed", "the request time is too far from the server's time"
+	}
+	if want := f.signer.cfg.AccessKeyID + "/" + f.signer.scope(t); credential != want {
+		return "InvalidAccessKeyId", "unknown credential " + credential
+	}
+
+	headers := map[string]string{}
+	for _, name := range strings.Split(signedHeaders, ";") {
+		if name == "host" {
+			headers[name] = r.Host
+		} else {
+			headers[name] = r.Header.Get(name)
+		}
+	}
+	// A presigned URL signs its query without the signature itself.
+	delete(query, "X-Amz-Signature")
+	flat := map[string]string{}
+	for k, v := range query {
+		flat[k] = v[0]
+	}
+	u := &url.URL{RawPath: r.URL.EscapedPath(), RawQuery: canonicalQuery(flat)}
+	want := f.signer.signature(r.Method, u, headers, payloadHash, t)
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return "SignatureDoesNotMatch", "the request signature does not match"
+	}
+	return "", ""
+}
+
+// setNow replaces the server's clock.
+func (f *fakeS3) setNow(now func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// list returns every matching key in one page.
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix, delimiter string) {
+	f.mu.Lock()
+	var result listBucketResult
+	seen := map[string]bool{}
+	for name := range f.objects {
+		key, ok := strings.CutPrefix(name, bucket+"/")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				p := key[:len(prefix)+i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					result.CommonPrefixes = append(result.CommonPrefixes, struct {
+						Prefix string `xml:"Prefix"`
+					}{p})
+				}
+				continue
+			}
+		}
+		result.Contents = append(result.Contents, s3Object{Key: key, Size: int64(len(f.objects[name].data))})
+	}
+	f.mu.Unlock()
+
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	sort.Slice(result.CommonPrefixes, func(i, j int) bool { return result.CommonPrefixes[i].Prefix < result.CommonPrefixes[j].Prefix })
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listBucketResult
+	}{listBucketResult: result})
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		s3Error
+	}{s3Error: s3Error{Code: code, Message: message}})
+}
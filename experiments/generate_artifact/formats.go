@@ -0,0 +1,121 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// mimeTypes maps the extensions the reporter can produce to their MIME
+// types. We keep our own table because mime.TypeByExtension depends on
+// the host's mime.types and misses Markdown and XLSX on many systems.
+var mimeTypes = map[string]string{
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".html": "text/html",
+	".htm":  "text/html",
+	".pdf":  "application/pdf",
+	".csv":  "text/csv",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".png":  "image/png",
+}
+
+// mimeTypeFor infers a MIME type from a filename's extension.
+func mimeTypeFor(filename string) (string, bool) {
+	mt, ok := mimeTypes[strings.ToLower(path.Ext(filename))]
+	return mt, ok
+}
+
+// renderDocument turns Markdown into the format named by the filename's
+// extension. Plain text (or no extension) keeps the old behaviour of a text
+// part; everything else is stored as inline data with its MIME type.
+func renderDocument(filename, markdown string) (*genai.Part, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	var data []byte
+	switch ext {
+	case "", ".txt":
+		return genai.NewPartFromText(markdown), nil
+	case ".md":
+		data = []byte(markdown)
+	case ".html", ".htm":
+		data = []byte(markdownToHTML(markdown, strings.TrimSuffix(path.Base(filename), path.Ext(filename))))
+	case ".pdf":
+		data = markdownToPDF(markdown)
+	default:
+		return nil, fmt.Errorf("cannot write a report as %q; use .txt, .md, .html or .pdf", ext)
+	}
+	mt, _ := mimeTypeFor(filename)
+	return genai.NewPartFromBytes(data, mt), nil
+}
+
+// renderTable writes tabular data as CSV or XLSX, chosen by extension.
+func renderTable(filename string, columns []string, rows [][]string) (*genai.Part, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("a table needs at least one column")
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d cells for %d columns", i+1, len(row), len(columns))
+		}
+	}
+
+	ext := strings.ToLower(path.Ext(filename))
+	var data []byte
+	switch ext {
+	case ".csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(columns)
+		w.WriteAll(rows) // flushes
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	case ".xlsx":
+		var err error
+		if data, err = buildXLSX(columns, rows); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cannot write a table as %q; use .csv or .xlsx", ext)
+	}
+	mt, _ := mimeTypeFor(filename)
+	return genai.NewPartFromBytes(data, mt), nil
+}
+
+// renderChartPart draws a chart; only PNG is supported.
+func renderChartPart(filename string, spec ChartSpec) (*genai.Part, error) {
+	if ext := strings.ToLower(path.Ext(filename)); ext != ".png" {
+		return nil, fmt.Errorf("cannot draw a chart as %q; use .png", ext)
+	}
+	data, err := renderChart(spec)
+	if err != nil {
+		return nil, err
+	}
+	return genai.NewPartFromBytes(data, "image/png"), nil
+}
+
+// isTextMIME reports whether an artifact of this type is readable text, so
+// load_artifact can return its content to the model.
+func isTextMIME(mt string) bool {
+	mt, _, _ = strings.Cut(mt, ";")
+	return strings.HasPrefix(mt, "text/") || mt == "application/json"
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMIMETypeFor(t *testing.T) {
+	for name, want := range map[string]string{
+		"notes.txt":       "text/plain",
+		"README.MD":       "text/markdown",
+		"page.htm":        "text/html",
+		"q3.report.pdf":   "application/pdf",
+		"data.csv":        "text/csv",
+		"data.XLSX":       "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"user:chart.png":  "image/png",
+		"archive.tar.gz":  "",
+		"no_extension":    "",
+		"dir.pdf/file.sh": "",
+	} {
+		got, ok := mimeTypeFor(name)
+		if got != want || ok != (want != "") {
+			t.Errorf("mimeTypeFor(%q) = %q, %t, want %q", name, got, ok, want)
+		}
+	}
+}
+
+func TestRenderDocument(t *testing.T) {
+	const src = "# Title\n\nBody"
+	for _, tc := range []struct {
+		filename string
+		mimeType string // empty for a text part
+		prefix   string
+	}{
+		{"report", "", src},
+		{"report.txt", "", src},
+		{"report.md", "text/markdown", src},
+		{"report.HTML", "text/html", "<!DOCTYPE html>"},
+		{"report.htm", "text/html", "<!DOCTYPE html>"},
+		{"report.pdf", "application/pdf", "%PDF-1.4"},
+	} {
+		t.Run(tc.filename, func(t *testing.T) {
+			part, err := renderDocument(tc.filename, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.mimeType == "" {
+				if part.Text != src || part.InlineData != nil {
+					t.Errorf("got %+v, want a text part", part)
+				}
+				return
+			}
+			if part.InlineData == nil || part.InlineData.MIMEType != tc.mimeType {
+				t.Fatalf("got %+v, want inline %s data", part, tc.mimeType)
+			}
+			if !bytes.HasPrefix(part.InlineData.Data, []byte(tc.prefix)) {
+				t.Errorf("data starts with %q, want %q", part.InlineData.Data[:min(20, len(part.InlineData.Data))], tc.prefix)
+			}
+		})
+	}
+
+	for _, name := range []string{"report.docx", "report.csv", "report.png"} {
+		if _, err := renderDocument(name, src); err == nil || !strings.Contains(err.Error(), "use .txt, .md, .html or .pdf") {
+			t.Errorf("renderDocument(%q): got error %v, want the supported formats", name, err)
+		}
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	columns := []string{"name", "note"}
+	rows := [][]string{{"ACME", `says "hi", twice`}, {"Globex", "line\nbreak"}}
+
+	t.Run("csv", func(t *testing.T) {
+		part, err := renderTable("data.csv", columns, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "name,note\nACME,\"says \"\"hi\"\", twice\"\nGlobex,\"line\nbreak\"\n"
+		if part.InlineData.MIMEType != "text/csv" || string(part.InlineData.Data) != want {
+			t.Errorf("got %s %q, want text/csv %q", part.InlineData.MIMEType, part.InlineData.Data, want)
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		part, err := renderTable("data.xlsx", columns, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mt, _ := mimeTypeFor("data.xlsx"); part.InlineData.MIMEType != mt {
+			t.Errorf("got MIME type %s, want %s", part.InlineData.MIMEType, mt)
+		}
+		if sheet := readXLSX(t, part.InlineData.Data); len(sheet.Rows) != 3 {
+			t.Errorf("got %d rows, want a header and 2 rows", len(sheet.Rows))
+		}
+	})
+
+	for _, tc := range []struct {
+		name     string
+		filename string
+		columns  []string
+		rows     [][]string
+		want     string
+	}{
+		{"format", "data.json", columns, rows, "use .csv or .xlsx"},
+		{"no columns", "data.csv", nil, nil, "at least one column"},
+		{"short row", "data.csv", columns, [][]string{{"a", "b"}, {"c"}}, "row 2 has 1 cells for 2 columns"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := renderTable(tc.filename, tc.columns, tc.rows); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderChartPart(t *testing.T) {
+	spec := ChartSpec{Kind: "bar", Labels: []string{"x"}, Series: []ChartSeries{{Name: "a", Values: []float64{1}}}}
+	part, err := renderChartPart("chart.PNG", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part.InlineData.MIMEType != "image/png" {
+		t.Errorf("got MIME type %s, want image/png", part.InlineData.MIMEType)
+	}
+	if _, err := renderChartPart("chart.jpg", spec); err == nil || !strings.Contains(err.Error(), "use .png") {
+		t.Errorf("got error %v for a JPEG, want only PNG supported", err)
+	}
+}
+
+func TestIsTextMIME(t *testing.T) {
+	for mt, want := range map[string]bool{
+		"text/plain": true, "text/markdown; charset=utf-8": true, "text/csv": true, "application/json": true,
+		"application/pdf": false, "image/png": false, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": false,
+	} {
+		if got := isTextMIME(mt); got != want {
+			t.Errorf("isTextMIME(%q) = %t, want %t", mt, got, want)
+		}
+	}
+}
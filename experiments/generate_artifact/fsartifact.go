@@ -0,0 +1,441 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+// userScopeDir is the directory that holds user-scoped artifacts (filenames
+// starting with "user:") next to the session directories. Session IDs
+// starting with reservedPrefix are rejected, so no session can share it.
+const (
+	userScopeDir   = "_user"
+	reservedPrefix = "_"
+)
+
+// Files inside a version directory. The data file is written last, so a
+// version only becomes visible once it is complete.
+const (
+	dataFile = "data"
+	metaFile = "meta.json"
+)
+
+// fileMeta is the sidecar stored next to each artifact version.
+type fileMeta struct {
+	MIMEType string `json:"mime_type"`
+	// Text records that the artifact was saved as a text part, so that it
+	// is loaded back as one rather than as inline bytes.
+	Text    bool      `json:"text,omitempty"`
+	Size    int       `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+type fsService struct {
+	root string
+	// mu serializes saves within this process. Across processes, version
+	// numbers are reserved with an exclusive mkdir.
+	mu sync.Mutex
+}
+
+// NewFileArtifactService returns an artifact.Service that stores artifacts
+// on local disk under root, one directory per version:
+//
+//	root/app/user/session/filename/version/{data,meta.json}
+//
+// User-scoped artifacts ("user:" filenames) are stored with "_user" in place
+// of the session ID and are listed in every session of that user. Path
+// components are escaped, so filenames may contain any characters, but
+// session IDs starting with "_" are reserved.
+func NewFileArtifactService(root string) (artifact.Service, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+	return &fsService{root: root}, nil
+}
+
+func (s *fsService) Save(ctx context.Context, req *artifact.SaveRequest) (*artifact.SaveResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	dir, err := s.fileDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := fileMeta{MIMEType: "text/plain", Text: true, Created: time.Now().UTC()}
+	data := []byte(req.Part.Text)
+	if req.Part.InlineData != nil {
+		meta.MIMEType, meta.Text = req.Part.InlineData.MIMEType, false
+		data = req.Part.InlineData.Data
+	}
+	meta.Size = len(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another save may have held the lock past the caller's deadline.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+	version, versionDir, err := reserveVersion(dir, req.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(versionDir, metaFile), metaJSON); err != nil {
+		os.RemoveAll(versionDir)
+		return nil, fmt.Errorf("writing artifact metadata: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(versionDir, dataFile), data); err != nil {
+		os.RemoveAll(versionDir)
+		return nil, fmt.Errorf("writing artifact: %w", err)
+	}
+	return &artifact.SaveResponse{Version: version}, nil
+}
+
+// reserveVersion creates the directory for the requested version, or for
+// the next free one if version is 0. Mkdir fails if the directory exists,
+// so two writers can never claim the same version.
+func reserveVersion(dir string, version int64) (int64, string, error) {
+	if version > 0 {
+		versionDir := filepath.Join(dir, strconv.FormatInt(version, 10))
+		if err := os.Mkdir(versionDir, 0o755); err != nil {
+			return 0, "", fmt.Errorf("reserving artifact version %d: %w", version, err)
+		}
+		return version, versionDir, nil
+	}
+	for {
+		// Count every version directory, complete or not, so a version
+		// number is never reused after a failed write.
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return 0, "", err
+		}
+		next := int64(1)
+		for _, e := range entries {
+			if v, err := strconv.ParseInt(e.Name(), 10, 64); err == nil && v >= next {
+				next = v + 1
+			}
+		}
+		versionDir := filepath.Join(dir, strconv.FormatInt(next, 10))
+		err = os.Mkdir(versionDir, 0o755)
+		if errors.Is(err, fs.ErrExist) {
+			continue // another process got there first
+		}
+		if err != nil {
+			return 0, "", fmt.Errorf("reserving artifact version: %w", err)
+		}
+		return next, versionDir, nil
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory and
+// renames it into place, so readers never see a partial file.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func (s *fsService) Load(ctx context.Context, req *artifact.LoadRequest) (*artifact.LoadResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, err := s.fileDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	version := req.Version
+	if version == 0 {
+		versions, err := completeVersions(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+		}
+		version = versions[0]
+	}
+
+	versionDir := filepath.Join(dir, strconv.FormatInt(version, 10))
+	data, err := os.ReadFile(filepath.Join(versionDir, dataFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("artifact %q version %d not found: %w", req.FileName, version, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading artifact: %w", err)
+	}
+	var meta fileMeta
+	metaJSON, err := os.ReadFile(filepath.Join(versionDir, metaFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading artifact metadata: %w", err)
+	}
+	if err := json.Unmarshal(metaJSON, &meta); err != nil {
+		return nil, fmt.Errorf("decoding artifact metadata: %w", err)
+	}
+
+	if meta.Text {
+		return &artifact.LoadResponse{Part: genai.NewPartFromText(string(data))}, nil
+	}
+	return &artifact.LoadResponse{Part: genai.NewPartFromBytes(data, meta.MIMEType)}, nil
+}
+
+func (s *fsService) Delete(ctx context.Context, req *artifact.DeleteRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dir, err := s.fileDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Version == 0 {
+		return os.RemoveAll(dir)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, strconv.FormatInt(req.Version, 10))); err != nil {
+		return err
+	}
+	// Drop the file's directory once its last version is gone, so that List
+	// no longer reports it.
+	if versions, err := completeVersions(dir); err == nil && len(versions) == 0 {
+		return os.RemoveAll(dir)
+	}
+	return nil
+}
+
+func (s *fsService) List(ctx context.Context, req *artifact.ListRequest) (*artifact.ListResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	userDir, err := s.dir(req.AppName, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSessionID(req.SessionID); err != nil {
+		return nil, err
+	}
+	sessionDir, err := s.dir(req.AppName, req.UserID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, dir := range []string{sessionDir, filepath.Join(userDir, userScopeDir)} {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing artifacts: %w", err)
+		}
+		for _, e := range entries {
+			name, err := url.PathUnescape(e.Name())
+			if err != nil || !e.IsDir() {
+				continue
+			}
+			if versions, err := completeVersions(filepath.Join(dir, e.Name())); err == nil && len(versions) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return &artifact.ListResponse{FileNames: slices.Compact(names)}, nil
+}
+
+// Versions returns the versions of an artifact, newest first, like the
+// in-memory service.
+func (s *fsService) Versions(ctx context.Context, req *artifact.VersionsRequest) (*artifact.VersionsResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	dir, err := s.fileDir(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := completeVersions(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+	}
+	return &artifact.VersionsResponse{Versions: versions}, nil
+}
+
+// completeVersions returns the versions in dir whose data file has been
+// written, newest first. A missing dir has no versions.
+func completeVersions(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing artifact versions: %w", err)
+	}
+	var versions []int64
+	for _, e := range entries {
+		v, err := strconv.ParseInt(e.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), dataFile)); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// fileDir returns the directory holding every version of an artifact.
+func (s *fsService) fileDir(appName, userID, sessionID, fileName string) (string, error) {
+	if strings.HasPrefix(fileName, "user:") {
+		return s.dir(appName, userID, userScopeDir, fileName)
+	}
+	if err := checkSessionID(sessionID); err != nil {
+		return "", err
+	}
+	return s.dir(appName, userID, sessionID, fileName)
+}
+
+// checkSessionID rejects session IDs that could name the user scope.
+func checkSessionID(sessionID string) error {
+	if strings.HasPrefix(sessionID, reservedPrefix) {
+		return fmt.Errorf("invalid session ID %q: IDs starting with %q are reserved", sessionID, reservedPrefix)
+	}
+	return nil
+}
+
+// dir joins escaped path components under the root. Escaping keeps "/" in
+// IDs and filenames from creating extra directories; "." and ".." are
+// rejected so no request can leave the root.
+func (s *fsService) dir(components ...string) (string, error) {
+	parts := []string{s.root}
+	for _, c := range components {
+		if c == "." || c == ".." {
+			return "", fmt.Errorf("invalid artifact path component %q", c)
+		}
+		parts = append(parts, url.PathEscape(c))
+	}
+	return filepath.Join(parts...), nil
+}
+
+// Usage reports the size of every complete version of every artifact of a
+// user from the file system, without reading any data.
+func (s *fsService) Usage(ctx context.Context, appName, userID string) (map[string]fileVersions, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	userDir, err := s.dir(appName, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]fileVersions{}
+	sessions, err := os.ReadDir(userDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	for _, sd := range sessions {
+		sessionID, err := url.PathUnescape(sd.Name())
+		if err != nil || !sd.IsDir() {
+			continue
+		}
+		if sd.Name() == userScopeDir {
+			sessionID = ""
+		}
+		files, err := os.ReadDir(filepath.Join(userDir, sd.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("listing artifacts: %w", err)
+		}
+		for _, fd := range files {
+			name, err := url.PathUnescape(fd.Name())
+			if err != nil || !fd.IsDir() {
+				continue
+			}
+			fileDir := filepath.Join(userDir, sd.Name(), fd.Name())
+			versions, err := completeVersions(fileDir)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range versions {
+				info, err := os.Stat(filepath.Join(fileDir, strconv.FormatInt(v, 10), dataFile))
+				if err != nil {
+					continue // deleted since it was listed
+				}
+				usage[sessionID] = usage[sessionID].add(name, v, info.Size())
+			}
+		}
+	}
+	return usage, nil
+}
+
+var (
+	_ artifact.Service = (*fsService)(nil)
+	_ usageReporter    = (*fsService)(nil)
+)
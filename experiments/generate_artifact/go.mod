@@ -3,6 +3,8 @@ module generate_artifact
 go 1.25.2
 
 require (
+	github.com/gorilla/mux v1.8.1
+	golang.org/x/image v0.25.0
 	google.golang.org/adk v0.1.0
 	google.golang.org/genai v1.34.0
 )
@@ -22,7 +24,6 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.6 // indirect
 	github.com/googleapis/gax-go/v2 v2.15.0 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
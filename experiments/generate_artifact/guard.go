@@ -0,0 +1,428 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+// ArtifactPolicy configures NewGuardedArtifactService. Zero values disable
+// the corresponding limit; the filename rules always apply.
+type ArtifactPolicy struct {
+	// MaxFilenameLength caps the filename, not counting a "user:" prefix.
+	// Defaults to 100.
+	MaxFilenameLength int
+	// MaxBytes caps the size of a single artifact version.
+	MaxBytes int64
+	// MaxSessionBytes caps all versions of all artifacts in a session.
+	MaxSessionBytes int64
+	// MaxUserBytes caps all versions of all artifacts of a user, across
+	// sessions. Stores that report their usage, such as the file and S3
+	// stores, are counted across all of the user's sessions. Otherwise,
+	// as artifact.Service cannot list sessions, only the sessions this
+	// process has seen since it started are counted.
+	MaxUserBytes int64
+	// AllowedMIMETypes lists the MIME types that may be saved. Text parts
+	// count as text/plain.
+	AllowedMIMETypes []string
+}
+
+// Codes of a PolicyError.
+const (
+	errInvalidFilename = "invalid_filename"
+	errTooLarge        = "too_large"
+	errQuotaExceeded   = "quota_exceeded"
+	errMIMENotAllowed  = "mime_type_not_allowed"
+	errBadContent      = "bad_content"
+)
+
+// PolicyError is returned when a save breaks an ArtifactPolicy rule. Code
+// is stable and Hint tells the model how to fix the request, so the tools
+// pass both on rather than just the message.
+type PolicyError struct {
+	Code    string
+	Message string
+	Hint    string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// usageReporter is implemented by stores that can report the sizes of what
+// they hold from their metadata, without loading any data.
+type usageReporter interface {
+	// Usage returns the sizes of all versions of all artifacts of a user,
+	// by session ID. User-scoped files are under an empty session ID.
+	Usage(ctx context.Context, appName, userID string) (map[string]fileVersions, error)
+}
+
+// fileVersions holds the size of each version of each file. Version 0 holds
+// the bytes reserved by saves still in progress.
+type fileVersions map[string]map[int64]int64
+
+// add adds size bytes to a version of a file, dropping entries that reach
+// zero, and returns f, which is allocated if nil.
+func (f fileVersions) add(name string, version, size int64) fileVersions {
+	if f == nil {
+		f = fileVersions{}
+	}
+	if f[name] == nil {
+		f[name] = map[int64]int64{}
+	}
+	f[name][version] += size
+	if f[name][version] == 0 {
+		delete(f[name], version)
+	}
+	if len(f[name]) == 0 {
+		delete(f, name)
+	}
+	return f
+}
+
+// guardedService enforces an ArtifactPolicy in front of another store.
+type guardedService struct {
+	artifact.Service
+	policy ArtifactPolicy
+
+	// mu guards the maps below. It is never held while calling the store.
+	mu sync.Mutex
+	// usage holds the bytes stored per file version. User-scoped files are
+	// kept under an empty session ID.
+	usage map[usageKey]fileVersions
+	// seeded records the buckets whose stored usage has been counted, and
+	// seededUsers the users counted in full by a usageReporter.
+	seeded      map[usageKey]bool
+	seededUsers map[usageKey]bool // sessionID is always empty
+}
+
+type usageKey struct {
+	appName, userID, sessionID string
+}
+
+// NewGuardedArtifactService wraps inner so that every save is checked
+// against policy first. Loads, lists and deletes are passed through.
+func NewGuardedArtifactService(inner artifact.Service, policy ArtifactPolicy) artifact.Service {
+	if policy.MaxFilenameLength <= 0 {
+		policy.MaxFilenameLength = 100
+	}
+	return &guardedService{
+		Service:     inner,
+		policy:      policy,
+		usage:       make(map[usageKey]fileVersions),
+		seeded:      make(map[usageKey]bool),
+		seededUsers: make(map[usageKey]bool),
+	}
+}
+
+func (s *guardedService) Save(ctx context.Context, req *artifact.SaveRequest) (*artifact.SaveResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := s.checkFilename(req.FileName); err != nil {
+		return nil, err
+	}
+	mimeType, data := partContent(req.Part)
+	if err := s.checkContent(req.FileName, mimeType, data, req.Part.InlineData == nil); err != nil {
+		return nil, err
+	}
+	size := int64(len(data))
+	if s.policy.MaxBytes > 0 && size > s.policy.MaxBytes {
+		return nil, &PolicyError{
+			Code:    errTooLarge,
+			Message: fmt.Sprintf("%s is %d bytes, over the limit of %d bytes per artifact", req.FileName, size, s.policy.MaxBytes),
+			Hint:    "shorten the content or split it into several files",
+		}
+	}
+
+	// Charge the quota before saving so concurrent saves can't both fit in
+	// the same space, and refund it if the save fails.
+	key := s.scope(req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err := s.reserve(ctx, key, req.SessionID, req.FileName, size); err != nil {
+		return nil, err
+	}
+	resp, err := s.Service.Save(ctx, req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[key] = s.usage[key].add(req.FileName, 0, -size)
+	if err != nil {
+		return nil, err
+	}
+	// Saving an existing version replaces it.
+	if old := s.usage[key][req.FileName][resp.Version]; old != 0 {
+		s.usage[key] = s.usage[key].add(req.FileName, resp.Version, -old)
+	}
+	s.usage[key] = s.usage[key].add(req.FileName, resp.Version, size)
+	return resp, nil
+}
+
+func (s *guardedService) Delete(ctx context.Context, req *artifact.DeleteRequest) error {
+	if err := s.Service.Delete(ctx, req); err != nil {
+		return err
+	}
+
+	// Usage is kept per version, so deleting one frees exactly its bytes.
+	// If the bucket hasn't been counted yet, seeding will find what is
+	// left.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := s.usage[s.scope(req.AppName, req.UserID, req.SessionID, req.FileName)]
+	for v, size := range files[req.FileName] {
+		// Version 0 holds saves in progress, which deleting can't undo.
+		if v != 0 && (req.Version == 0 || req.Version == v) {
+			files.add(req.FileName, v, -size)
+		}
+	}
+	return nil
+}
+
+// scope returns the usage bucket a file is counted in.
+func (s *guardedService) scope(appName, userID, sessionID, fileName string) usageKey {
+	if strings.HasPrefix(fileName, "user:") {
+		sessionID = ""
+	}
+	return usageKey{appName, userID, sessionID}
+}
+
+// checkFilename allows a short name of letters, digits, '.', '-', '_' and
+// spaces, starting with a letter or digit, so it can't name a path, a
+// hidden file or anything a shell or browser would treat specially.
+func (s *guardedService) checkFilename(name string) error {
+	base := strings.TrimPrefix(name, "user:")
+	fail := func(reason string) error {
+		return &PolicyError{
+			Code:    errInvalidFilename,
+			Message: fmt.Sprintf("invalid filename %q: %s", name, reason),
+			Hint:    "use a plain name such as goldfish_report.md, with only letters, digits, '.', '-', '_' and spaces",
+		}
+	}
+	switch {
+	case base == "":
+		return fail("it is empty")
+	case len(base) > s.policy.MaxFilenameLength:
+		return fail(fmt.Sprintf("it is longer than %d characters", s.policy.MaxFilenameLength))
+	case !isAlnum(base[0]):
+		return fail("it must start with a letter or digit")
+	case strings.Contains(base, ".."):
+		return fail(`it must not contain ".."`)
+	}
+	for i := 0; i < len(base); i++ {
+		if c := base[i]; !isAlnum(c) && !strings.ContainsRune("._- ", rune(c)) {
+			return fail(fmt.Sprintf("it must not contain %q", c))
+		}
+	}
+	return nil
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// magic holds the leading bytes of the binary formats the reporter writes.
+var magic = map[string][]byte{
+	"application/pdf": []byte("%PDF-"),
+	"image/png":       []byte("\x89PNG\r\n\x1a\n"),
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": []byte("PK\x03\x04"),
+}
+
+// checkContent checks that the MIME type is allowed and matches both the
+// filename's extension and the data.
+func (s *guardedService) checkContent(name, mimeType string, data []byte, isText bool) error {
+	if len(s.policy.AllowedMIMETypes) > 0 && !slices.Contains(s.policy.AllowedMIMETypes, mimeType) {
+		return &PolicyError{
+			Code:    errMIMENotAllowed,
+			Message: fmt.Sprintf("artifacts of type %s are not allowed", mimeType),
+			Hint:    "save as one of: " + strings.Join(s.policy.AllowedMIMETypes, ", "),
+		}
+	}
+	// A text part can go under any text extension, such as notes.md; inline
+	// data must match its extension exactly.
+	if want, ok := mimeTypeFor(name); ok && want != mimeType && !(isText && isTextMIME(want)) {
+		return &PolicyError{
+			Code:    errBadContent,
+			Message: fmt.Sprintf("%s has type %s, but its extension means %s", name, mimeType, want),
+			Hint:    fmt.Sprintf("rename the file to match its content, or use the tool that writes %s files", path.Ext(name)),
+		}
+	}
+	bad := func(reason string) error {
+		hint := "regenerate the content with the save tools rather than writing the file format by hand"
+		if isTextMIME(mimeType) {
+			hint = "send plain UTF-8 text without control characters"
+		}
+		return &PolicyError{
+			Code:    errBadContent,
+			Message: fmt.Sprintf("%s is not valid %s: %s", name, mimeType, reason),
+			Hint:    hint,
+		}
+	}
+	if isTextMIME(mimeType) {
+		if !utf8.Valid(data) {
+			return bad("it is not UTF-8 text")
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return bad("it contains NUL bytes")
+		}
+	}
+	if m, ok := magic[mimeType]; ok && !bytes.HasPrefix(data, m) {
+		return bad("the data does not start with the format's signature")
+	}
+	return nil
+}
+
+// reserve adds size bytes to fileName's pending usage if it fits the
+// quotas. sessionID is the session the file is saved from.
+func (s *guardedService) reserve(ctx context.Context, key usageKey, sessionID, fileName string, size int64) error {
+	if err := s.seed(ctx, key.appName, key.userID, sessionID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key.sessionID != "" && s.policy.MaxSessionBytes > 0 {
+		if used := s.total(func(k usageKey) bool { return k == key }); used+size > s.policy.MaxSessionBytes {
+			return quotaError("session", used, size, s.policy.MaxSessionBytes)
+		}
+	}
+	if s.policy.MaxUserBytes > 0 {
+		if used := s.total(func(k usageKey) bool { return k.appName == key.appName && k.userID == key.userID }); used+size > s.policy.MaxUserBytes {
+			return quotaError("user", used, size, s.policy.MaxUserBytes)
+		}
+	}
+	s.usage[key] = s.usage[key].add(fileName, 0, size)
+	return nil
+}
+
+func quotaError(scope string, used, size, limit int64) error {
+	return &PolicyError{
+		Code:    errQuotaExceeded,
+		Message: fmt.Sprintf("saving %d bytes would bring this %s to %d bytes, over its quota of %d bytes", size, scope, used+size, limit),
+		Hint:    "tell the user the storage quota is full; shorter content may still fit",
+	}
+}
+
+func (s *guardedService) total(match func(usageKey) bool) int64 {
+	var n int64
+	for k, files := range s.usage {
+		if !match(k) {
+			continue
+		}
+		for _, versions := range files {
+			for _, size := range versions {
+				n += size
+			}
+		}
+	}
+	return n
+}
+
+// seed counts what the store already holds for a session, and for the
+// user's user-scoped files, the first time each is seen, so quotas survive
+// a restart of a persistent store. A usageReporter counts all of the
+// user's sessions at once.
+//
+// The store is read without holding s.mu, so one slow store call doesn't
+// hold up every other save. Concurrent first saves may both read it; the
+// first to finish records the counts, and later ones leave them alone, as
+// saves may have been reserved against them since.
+func (s *guardedService) seed(ctx context.Context, appName, userID, sessionID string) error {
+	userKey := usageKey{appName, userID, ""}
+	sessionKey := usageKey{appName, userID, sessionID}
+	s.mu.Lock()
+	done := s.seededUsers[userKey] || s.seeded[userKey] && s.seeded[sessionKey]
+	s.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	if r, ok := s.Service.(usageReporter); ok {
+		usage, err := r.Usage(ctx, appName, userID)
+		if err != nil {
+			return fmt.Errorf("counting stored artifacts: %w", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.seededUsers[userKey] {
+			for id, files := range usage {
+				s.usage[usageKey{appName, userID, id}] = files
+			}
+			s.seededUsers[userKey] = true
+		}
+		return nil
+	}
+
+	// Listing a session also returns the user-scoped files, so it seeds
+	// both buckets.
+	counted := map[usageKey]fileVersions{userKey: nil, sessionKey: nil}
+	list, err := s.Service.List(ctx, &artifact.ListRequest{AppName: appName, UserID: userID, SessionID: sessionID})
+	if err != nil {
+		return fmt.Errorf("counting stored artifacts: %w", err)
+	}
+	for _, name := range list.FileNames {
+		versions, err := s.Service.Versions(ctx, &artifact.VersionsRequest{AppName: appName, UserID: userID, SessionID: sessionID, FileName: name})
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			return fmt.Errorf("counting stored artifacts: %w", err)
+		}
+		k := s.scope(appName, userID, sessionID, name)
+		for _, v := range versions.Versions {
+			// The store has no sizes to report, so load the data.
+			resp, err := s.Service.Load(ctx, &artifact.LoadRequest{AppName: appName, UserID: userID, SessionID: sessionID, FileName: name, Version: v})
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("counting stored artifacts: %w", err)
+			}
+			_, data := partContent(resp.Part)
+			counted[k] = counted[k].add(name, v, int64(len(data)))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, files := range counted {
+		if !s.seeded[k] {
+			s.usage[k] = files
+			s.seeded[k] = true
+		}
+	}
+	return nil
+}
+
+// partContent returns a part's MIME type and bytes; text parts are
+// text/plain.
+func partContent(p *genai.Part) (string, []byte) {
+	if p == nil {
+		return "", nil
+	}
+	if p.InlineData != nil {
+		return p.InlineData.MIMEType, p.InlineData.Data
+	}
+	return "text/plain", []byte(p.Text)
+}
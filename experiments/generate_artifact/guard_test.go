@@ -0,0 +1,280 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+// guardStores opens each kind of store the guard runs in front of: the
+// in-memory one, which it has to load to measure, and the file and S3
+// ones, which report their usage.
+var guardStores = []struct {
+	name string
+	open func(t *testing.T) artifact.Service
+}{
+	{"inmemory", func(*testing.T) artifact.Service { return artifact.InMemoryService() }},
+	{"filesystem", func(t *testing.T) artifact.Service {
+		s, err := NewFileArtifactService(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+	{"s3", func(t *testing.T) artifact.Service {
+		s, _ := newTestS3(t, S3Config{})
+		return s
+	}},
+}
+
+// wantPolicyError checks that saving part as fileName in session s1 fails
+// with code, or succeeds if code is empty.
+func wantPolicyError(t *testing.T, svc artifact.Service, fileName string, part *genai.Part, code string) {
+	t.Helper()
+	_, err := svc.Save(t.Context(), &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: "s1", FileName: fileName, Part: part})
+	var pe *PolicyError
+	switch {
+	case code == "" && err != nil:
+		t.Errorf("saving %s: got error %v, want none", fileName, err)
+	case code != "" && (!errors.As(err, &pe) || pe.Code != code):
+		t.Errorf("saving %s: got error %v, want %s", fileName, err, code)
+	case pe != nil && pe.Hint == "":
+		t.Errorf("saving %s: error %v has no hint", fileName, err)
+	}
+}
+
+func TestGuardFilenames(t *testing.T) {
+	svc := NewGuardedArtifactService(artifact.InMemoryService(), ArtifactPolicy{MaxFilenameLength: 20})
+	text := genai.NewPartFromText("x")
+	for name, ok := range map[string]bool{
+		"report.md":              true,
+		"Q3 report v2.txt":       true,
+		"user:notes.txt":         true,
+		"12345678901234567890":   true,
+		"123456789012345678901":  false,
+		"user:":                  false,
+		"../report.md":           false,
+		"user:../report.md":      false,
+		"a/../../etc/passwd.txt": false,
+		"a..b.txt":               false,
+		"dir/report.md":          false,
+		`dir\report.md`:          false,
+		"/etc/passwd":            false,
+		".hidden.txt":            false,
+		"-rf.txt":                false,
+		"report.md\x00.txt":      false,
+		"report\n.md":            false,
+		"rapport-été.md":         false,
+		"<script>.md":            false,
+	} {
+		code := errInvalidFilename
+		if ok {
+			code = ""
+		}
+		wantPolicyError(t, svc, name, text, code)
+	}
+}
+
+func TestGuardContent(t *testing.T) {
+	pdf := genai.NewPartFromBytes([]byte("%PDF-1.4\n..."), "application/pdf")
+	png := genai.NewPartFromBytes([]byte("\x89PNG\r\n\x1a\n..."), "image/png")
+	for _, tc := range []struct {
+		name     string
+		policy   ArtifactPolicy
+		fileName string
+		part     *genai.Part
+		code     string
+	}{
+		{"at MaxBytes", ArtifactPolicy{MaxBytes: 5}, "a.txt", genai.NewPartFromText("12345"), ""},
+		{"over MaxBytes", ArtifactPolicy{MaxBytes: 5}, "a.txt", genai.NewPartFromText("123456"), errTooLarge},
+		{"over MaxBytes inline", ArtifactPolicy{MaxBytes: 5}, "a.pdf", pdf, errTooLarge},
+		{"allowed type", ArtifactPolicy{AllowedMIMETypes: []string{"text/plain", "application/pdf"}}, "a.pdf", pdf, ""},
+		{"allowed text", ArtifactPolicy{AllowedMIMETypes: []string{"text/plain"}}, "a.txt", genai.NewPartFromText("x"), ""},
+		{"type not allowed", ArtifactPolicy{AllowedMIMETypes: []string{"text/plain", "application/pdf"}}, "a.png", png, errMIMENotAllowed},
+		{"text not allowed", ArtifactPolicy{AllowedMIMETypes: []string{"image/png"}}, "a.txt", genai.NewPartFromText("x"), errMIMENotAllowed},
+		{"PDF signature", ArtifactPolicy{}, "a.pdf", pdf, ""},
+		{"PNG signature", ArtifactPolicy{}, "a.png", png, ""},
+		{"fake PDF", ArtifactPolicy{}, "a.pdf", genai.NewPartFromBytes([]byte("<html>"), "application/pdf"), errBadContent},
+		{"fake PNG", ArtifactPolicy{}, "a.png", genai.NewPartFromBytes([]byte("GIF89a"), "image/png"), errBadContent},
+		{"fake XLSX", ArtifactPolicy{}, "a.xlsx", genai.NewPartFromBytes([]byte("a,b"), mimeTypes[".xlsx"]), errBadContent},
+		{"type unlike extension", ArtifactPolicy{}, "a.png", pdf, errBadContent},
+		{"HTML as text", ArtifactPolicy{}, "a.html", genai.NewPartFromBytes([]byte("<p>"), "text/plain"), errBadContent},
+		{"text part as Markdown", ArtifactPolicy{}, "notes.md", genai.NewPartFromText("# Notes"), ""},
+		{"text part as PDF", ArtifactPolicy{}, "a.pdf", genai.NewPartFromText("%PDF-1.4"), errBadContent},
+		{"invalid UTF-8", ArtifactPolicy{}, "a.txt", genai.NewPartFromText("caf\xe9"), errBadContent},
+		{"NUL byte", ArtifactPolicy{}, "a.csv", genai.NewPartFromBytes([]byte("a,\x00"), "text/csv"), errBadContent},
+		{"unknown extension", ArtifactPolicy{}, "a.bin", genai.NewPartFromBytes([]byte{0, 1}, "application/octet-stream"), ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wantPolicyError(t, NewGuardedArtifactService(artifact.InMemoryService(), tc.policy), tc.fileName, tc.part, tc.code)
+		})
+	}
+}
+
+func TestGuardQuotaAfterDelete(t *testing.T) {
+	for _, store := range guardStores {
+		t.Run(store.name, func(t *testing.T) {
+			svc := NewGuardedArtifactService(store.open(t), ArtifactPolicy{MaxSessionBytes: 10})
+			s := &artifactStore{Service: svc, t: t, ctx: t.Context()}
+			wantQuotaError := func(fileName, text string) {
+				t.Helper()
+				wantPolicyError(t, svc, fileName, genai.NewPartFromText(text), errQuotaExceeded)
+			}
+
+			s.save("s1", "a.txt", genai.NewPartFromText("123456"))
+			s.save("s1", "a.txt", genai.NewPartFromText("1234"))
+			wantQuotaError("b.txt", "1")
+
+			// Deleting version 1 frees its 6 bytes, and only those.
+			s.delete("s1", "a.txt", 1)
+			s.save("s1", "b.txt", genai.NewPartFromText("123456"))
+			wantQuotaError("b.txt", "1")
+
+			// Deleting every version frees the rest.
+			s.delete("s1", "a.txt", 0)
+			s.save("s1", "c.txt", genai.NewPartFromText("1234"))
+			wantQuotaError("c.txt", "1")
+		})
+	}
+}
+
+func TestGuardQuotasAfterReopen(t *testing.T) {
+	for _, store := range guardStores {
+		t.Run(store.name, func(t *testing.T) {
+			inner := store.open(t)
+			policy := ArtifactPolicy{MaxSessionBytes: 8, MaxUserBytes: 12}
+			first := &artifactStore{Service: NewGuardedArtifactService(inner, policy), t: t, ctx: t.Context()}
+			first.save("s1", "a.txt", genai.NewPartFromText("123456"))
+			first.save("s2", "user:b.txt", genai.NewPartFromText("12"))
+			first.save("s2", "c.txt", genai.NewPartFromText("123"))
+
+			// A new guard over the same store, as after a restart, counts
+			// what the store holds: 6 bytes in s1, 3 in s2 and 2 for the
+			// user, 11 in all.
+			reopened := NewGuardedArtifactService(inner, policy)
+			wantPolicyError(t, reopened, "d.txt", genai.NewPartFromText("123"), errQuotaExceeded)
+
+			_, err := reopened.Save(t.Context(), &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: "s3", FileName: "e.txt", Part: genai.NewPartFromText("12")})
+			var pe *PolicyError
+			if _, ok := inner.(usageReporter); ok {
+				// s2, which this guard has not seen, still counts.
+				if !errors.As(err, &pe) || pe.Code != errQuotaExceeded {
+					t.Errorf("got error %v, want the user quota to count s2", err)
+				}
+			} else if err != nil {
+				// Other stores only count the sessions seen, as
+				// MaxUserBytes documents.
+				t.Errorf("got error %v, want s2 not counted", err)
+			}
+		})
+	}
+}
+
+// blockingList is an in-memory store whose List for one session waits
+// until release is closed.
+type blockingList struct {
+	artifact.Service
+	session string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingList) List(ctx context.Context, req *artifact.ListRequest) (*artifact.ListResponse, error) {
+	if req.SessionID == s.session {
+		close(s.started)
+		<-s.release
+	}
+	return s.Service.List(ctx, req)
+}
+
+func TestGuardSeedingDoesNotBlockOtherSaves(t *testing.T) {
+	inner := &blockingList{Service: artifact.InMemoryService(), session: "slow", started: make(chan struct{}), release: make(chan struct{})}
+	svc := NewGuardedArtifactService(inner, ArtifactPolicy{MaxSessionBytes: 100})
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := svc.Save(t.Context(), &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: "slow", FileName: "a.txt", Part: genai.NewPartFromText("x")})
+		slow <- err
+	}()
+	<-inner.started
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.Save(t.Context(), &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: "fast", FileName: "a.txt", Part: genai.NewPartFromText("x")})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a save in another session waited for the slow session to be counted")
+	}
+
+	close(inner.release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreUsage(t *testing.T) {
+	for _, store := range guardStores[1:] {
+		t.Run(store.name, func(t *testing.T) {
+			inner := store.open(t)
+			s := &artifactStore{Service: inner, t: t, ctx: t.Context()}
+			s.save("s1", "a.txt", genai.NewPartFromText("123"))
+			s.save("s1", "a.txt", genai.NewPartFromText("12345"))
+			s.save("s1/x", "dir/b.png", genai.NewPartFromBytes([]byte("\x89PNG"), "image/png"))
+			s.save("s2", "user:c.md", genai.NewPartFromText("12"))
+			other := &artifact.SaveRequest{AppName: testApp, UserID: "someone-else", SessionID: "s1", FileName: "d.txt", Part: genai.NewPartFromText("1")}
+			if _, err := inner.Save(t.Context(), other); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := inner.(usageReporter).Usage(t.Context(), testApp, testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]fileVersions{
+				"s1":   {"a.txt": {1: 3, 2: 5}},
+				"s1/x": {"dir/b.png": {1: 4}},
+				"":     {"user:c.md": {1: 2}},
+			}
+			if !maps.EqualFunc(got, want, func(a, b fileVersions) bool {
+				return maps.EqualFunc(a, b, maps.Equal)
+			}) {
+				t.Errorf("got usage %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGuardHintsNameTheRules(t *testing.T) {
+	svc := NewGuardedArtifactService(artifact.InMemoryService(), ArtifactPolicy{AllowedMIMETypes: []string{"text/plain", "text/markdown"}})
+	_, err := svc.Save(t.Context(), &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: "s1", FileName: "a.png", Part: genai.NewPartFromBytes([]byte("\x89PNG\r\n\x1a\n"), "image/png")})
+	var pe *PolicyError
+	if !errors.As(err, &pe) || !strings.Contains(pe.Hint, "text/plain, text/markdown") {
+		t.Errorf("got %v, want a hint listing the allowed types", err)
+	}
+}
@@ -18,40 +18,26 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"slices"
+	"time"
 
+	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
 	"google.golang.org/adk/artifact"
 	"google.golang.org/adk/cmd/launcher/adk"
-	"google.golang.org/adk/cmd/launcher/full"
+	"google.golang.org/adk/cmd/launcher/console"
+	"google.golang.org/adk/cmd/launcher/universal"
+	"google.golang.org/adk/cmd/launcher/web"
+	"google.golang.org/adk/cmd/launcher/web/a2a"
+	"google.golang.org/adk/cmd/launcher/web/api"
+	"google.golang.org/adk/cmd/launcher/web/webui"
 	"google.golang.org/adk/model/gemini"
 	"google.golang.org/adk/server/restapi/services"
-	"google.golang.org/adk/tool"
-	"google.golang.org/adk/tool/functiontool"
 	"google.golang.org/genai"
 )
 
-type SaveReportInput struct {
-	Filename string `json:"filename"`
-	Content  string `json:"content"`
-}
-
-type SaveReportOutput struct {
-	Success bool `json:"success"`
-}
-
-func saveReportHandler(ctx tool.Context, input SaveReportInput) SaveReportOutput {
-	// We use the Artifacts service from the context.
-	// It automatically handles AppName, UserID, and SessionID.
-	_, err := ctx.Artifacts().Save(context.Background(), input.Filename, genai.NewPartFromText(input.Content))
-	if err != nil {
-		log.Printf("Error saving artifact: %v", err)
-		return SaveReportOutput{Success: false}
-	}
-	fmt.Printf("\n[SYSTEM] Saved artifact '%s' (Content length: %d)\n", input.Filename, len(input.Content))
-	return SaveReportOutput{Success: true}
-}
-
 func main() {
 	ctx := context.Background()
 	model, err := gemini.NewModel(ctx, "gemini-2.5-flash", &genai.ClientConfig{
@@ -63,31 +49,65 @@ func main() {
 		log.Fatal(err)
 	}
 
-	saveTool, err := functiontool.New(functiontool.Config{
-		Name:        "save_report",
-		Description: "Saves a text report to the user's session artifacts.",
-	}, saveReportHandler)
+	// We MUST provide an ArtifactService to the launcher.
+	store, err := newArtifactService()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The model picks filenames and writes the content, so check both
+	// before anything reaches the store.
+	artifacts := NewGuardedArtifactService(store, ArtifactPolicy{
+		MaxBytes:         10 << 20,
+		MaxSessionBytes:  50 << 20,
+		MaxUserBytes:     200 << 20,
+		AllowedMIMETypes: slices.Compact(slices.Sorted(maps.Values(mimeTypes))),
+	})
+
+	// In web mode the downloads sublauncher serves links to saved files.
+	// Otherwise, stores that can hand out their own links (S3) are used.
+	storeLinks, _ := store.(artifactLinker)
+	downloads, err := newDownloadLauncher(storeLinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Each storage call gets $TOOL_TIMEOUT (default 30s), so a hung store
+	// can't stall the agent forever.
+	timeout := 30 * time.Second
+	if v := os.Getenv("TOOL_TIMEOUT"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid TOOL_TIMEOUT: %v", err)
+		}
+	}
+	artifactTools := newArtifactTools(downloads, timeout)
+	tools, err := artifactTools.tools()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	agent, err := llmagent.New(llmagent.Config{
-		Name:        "reporter",
-		Model:       model,
-		Instruction: "You are a researcher. When asked to write a report, generate the content and then ALWAYS save it using the save_report tool.",
-		Tools:       []tool.Tool{saveTool},
+		Name:  "reporter",
+		Model: model,
+		Instruction: "You are a researcher. When asked to write a report, generate the content in Markdown and then ALWAYS save it using the save_report tool. " +
+			"Pick the filename extension for the format the user wants: .md by default, .html for a web page, .pdf for a printable document. " +
+			"Save tabular data with save_table (.csv or .xlsx) and charts with save_chart (.png). " +
+			"When you save a PDF, also save the Markdown source as .md so it can be revised later. " +
+			"When asked to change an existing report, use list_artifacts and load_artifact to find and read it, " +
+			"then save the full new text with revise_report. Tell the user which version you saved, and give them any download_url a tool returns.",
+		Tools:                tools,
+		BeforeAgentCallbacks: []agent.BeforeAgentCallback{artifactTools.trackDownloads},
+		AfterAgentCallbacks:  []agent.AfterAgentCallback{artifactTools.announceDownloads},
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// We MUST provide an ArtifactService to the launcher.
-	// InMemoryService is good for testing.
 	config := &adk.Config{
 		AgentLoader:     services.NewSingleAgentLoader(agent),
-		ArtifactService: artifact.InMemoryService(),
+		ArtifactService: artifacts,
 	}
-	l := full.NewLauncher()
+	// This is full.NewLauncher() with the downloads sublauncher added.
+	l := universal.NewLauncher(console.NewLauncher(),
+		web.NewLauncher(api.NewLauncher(), a2a.NewLauncher(), webui.NewLauncher(), downloads))
 
 	args := os.Args[1:]
 	if len(args) == 0 {
@@ -98,3 +118,54 @@ func main() {
 		log.Fatalf("run failed: %v", err)
 	}
 }
+
+// newArtifactService picks the artifact store from $ARTIFACT_STORE:
+//
+//	memory   InMemoryService, good for testing (the default)
+//	file     files under $ARTIFACT_DIR, which survive a restart
+//	s3       an S3-compatible bucket, configured by the S3_* variables
+//	fake-s3  S3ArtifactService against an in-process fake S3 server
+//
+// For backward compatibility, setting only $ARTIFACT_DIR selects "file".
+func newArtifactService() (artifact.Service, error) {
+	store := os.Getenv("ARTIFACT_STORE")
+	if store == "" && os.Getenv("ARTIFACT_DIR") != "" {
+		store = "file"
+	}
+	switch store {
+	case "", "memory":
+		return artifact.InMemoryService(), nil
+	case "file":
+		dir := os.Getenv("ARTIFACT_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("ARTIFACT_STORE=file requires ARTIFACT_DIR")
+		}
+		return NewFileArtifactService(dir)
+	case "s3":
+		return NewS3ArtifactService(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	case "fake-s3":
+		endpoint, err := startFakeS3("fake", "fake")
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Serving a fake S3 bucket at %s", endpoint)
+		return NewS3ArtifactService(S3Config{
+			Endpoint:        endpoint,
+			Bucket:          "artifacts",
+			PathStyle:       true,
+			AccessKeyID:     "fake",
+			SecretAccessKey: "fake",
+		})
+	default:
+		return nil, fmt.Errorf("unknown ARTIFACT_STORE %q", store)
+	}
+}
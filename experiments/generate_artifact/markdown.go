@@ -0,0 +1,264 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// This file parses the subset of Markdown that models reliably produce:
+// ATX headings, paragraphs, bullet and numbered lists, fenced code blocks,
+// block quotes, horizontal rules and pipe tables, with **bold**, *italic*,
+// `code` and [links](url) inline. The result is rendered to HTML here and
+// to PDF in pdf.go.
+
+type mdKind int
+
+const (
+	mdParagraph mdKind = iota
+	mdHeading
+	mdBullet
+	mdOrdered
+	mdCode
+	mdQuote
+	mdRule
+	mdTable
+)
+
+type mdBlock struct {
+	kind  mdKind
+	level int // heading level, 1-6
+	// lines holds the paragraph or quote text, one list item per line, the
+	// code lines, or the table rows (header first) with cells split by
+	// splitTableRow.
+	lines []string
+}
+
+var (
+	headingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletRe  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRe = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	ruleRe    = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	tableSep  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+func parseMarkdown(src string) []mdBlock {
+	var blocks []mdBlock
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	// open is the block that following lines may continue, if any.
+	var open *mdBlock
+	push := func(b mdBlock) {
+		blocks = append(blocks, b)
+		open = &blocks[len(blocks)-1]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			code := mdBlock{kind: mdCode}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code.lines = append(code.lines, lines[i])
+			}
+			blocks = append(blocks, code)
+			open = nil
+		case trimmed == "":
+			open = nil
+		case headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			blocks = append(blocks, mdBlock{kind: mdHeading, level: len(m[1]), lines: []string{m[2]}})
+			open = nil
+		case ruleRe.MatchString(line):
+			blocks = append(blocks, mdBlock{kind: mdRule})
+			open = nil
+		case bulletRe.MatchString(line):
+			item := bulletRe.FindStringSubmatch(line)[1]
+			if open != nil && open.kind == mdBullet {
+				open.lines = append(open.lines, item)
+			} else {
+				push(mdBlock{kind: mdBullet, lines: []string{item}})
+			}
+		case orderedRe.MatchString(line):
+			item := orderedRe.FindStringSubmatch(line)[1]
+			if open != nil && open.kind == mdOrdered {
+				open.lines = append(open.lines, item)
+			} else {
+				push(mdBlock{kind: mdOrdered, lines: []string{item}})
+			}
+		case strings.HasPrefix(trimmed, ">"):
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			if open != nil && open.kind == mdQuote {
+				open.lines[0] += " " + text
+			} else {
+				push(mdBlock{kind: mdQuote, lines: []string{text}})
+			}
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && tableSep.MatchString(lines[i+1]):
+			table := mdBlock{kind: mdTable, lines: []string{trimmed}}
+			for i += 2; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				table.lines = append(table.lines, strings.TrimSpace(lines[i]))
+			}
+			i--
+			blocks = append(blocks, table)
+			open = nil
+		case open != nil && (open.kind == mdBullet || open.kind == mdOrdered) && line != trimmed:
+			// An indented line continues the last list item.
+			open.lines[len(open.lines)-1] += " " + trimmed
+		case open != nil && (open.kind == mdParagraph || open.kind == mdQuote):
+			open.lines[0] += " " + trimmed
+		default:
+			push(mdBlock{kind: mdParagraph, lines: []string{trimmed}})
+		}
+	}
+	return blocks
+}
+
+// splitTableRow splits "| a | b |" into its trimmed cells.
+func splitTableRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cells := strings.Split(row, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(c)
+	}
+	return cells
+}
+
+var (
+	boldRe   = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	italicRe = regexp.MustCompile(`\*([^*\s][^*]*?)\*|\b_([^_\s][^_]*?)_\b`)
+	linkRe   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// inlineHTML renders inline markup to HTML. Code spans are split out first
+// so that nothing inside them is interpreted.
+func inlineHTML(s string) string {
+	var b strings.Builder
+	for i, seg := range strings.Split(s, "`") {
+		if i%2 == 1 {
+			b.WriteString("<code>" + html.EscapeString(seg) + "</code>")
+			continue
+		}
+		seg = html.EscapeString(seg)
+		seg = linkRe.ReplaceAllStringFunc(seg, func(m string) string {
+			parts := linkRe.FindStringSubmatch(m)
+			href := html.UnescapeString(parts[2])
+			if !safeLink(href) {
+				return parts[1]
+			}
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), parts[1])
+		})
+		seg = boldRe.ReplaceAllString(seg, "<strong>$1$2</strong>")
+		seg = italicRe.ReplaceAllString(seg, "<em>$1$2</em>")
+		b.WriteString(seg)
+	}
+	return b.String()
+}
+
+// inlineText strips inline markup, keeping link targets in parentheses.
+func inlineText(s string) string {
+	var b strings.Builder
+	for i, seg := range strings.Split(s, "`") {
+		if i%2 == 1 {
+			b.WriteString(seg)
+			continue
+		}
+		seg = linkRe.ReplaceAllString(seg, "$1 ($2)")
+		seg = boldRe.ReplaceAllString(seg, "$1$2")
+		seg = italicRe.ReplaceAllString(seg, "$1$2")
+		b.WriteString(seg)
+	}
+	return b.String()
+}
+
+// safeLink rejects javascript: and other active URL schemes.
+func safeLink(href string) bool {
+	scheme, _, ok := strings.Cut(href, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		return true // relative link
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+const htmlStyle = `body{font-family:system-ui,sans-serif;max-width:46em;margin:2em auto;padding:0 1em;line-height:1.5;color:#222}
+pre{background:#f4f4f4;padding:.8em;overflow-x:auto}code{background:#f4f4f4;padding:0 .2em}
+blockquote{border-left:4px solid #ddd;margin-left:0;padding-left:1em;color:#555}
+table{border-collapse:collapse}th,td{border:1px solid #ccc;padding:.3em .6em}th{background:#f4f4f4}`
+
+// markdownToHTML renders a complete HTML document. The title is the first
+// heading, or fallback if there is none.
+func markdownToHTML(src, fallback string) string {
+	blocks := parseMarkdown(src)
+	title := fallback
+	for _, b := range blocks {
+		if b.kind == mdHeading {
+			title = inlineText(b.lines[0])
+			break
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n",
+		html.EscapeString(title), htmlStyle)
+	for _, block := range blocks {
+		switch block.kind {
+		case mdHeading:
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", block.level, inlineHTML(block.lines[0]), block.level)
+		case mdParagraph:
+			fmt.Fprintf(&b, "<p>%s</p>\n", inlineHTML(block.lines[0]))
+		case mdQuote:
+			fmt.Fprintf(&b, "<blockquote><p>%s</p></blockquote>\n", inlineHTML(block.lines[0]))
+		case mdBullet, mdOrdered:
+			tag := "ul"
+			if block.kind == mdOrdered {
+				tag = "ol"
+			}
+			fmt.Fprintf(&b, "<%s>\n", tag)
+			for _, item := range block.lines {
+				fmt.Fprintf(&b, "<li>%s</li>\n", inlineHTML(item))
+			}
+			fmt.Fprintf(&b, "</%s>\n", tag)
+		case mdCode:
+			fmt.Fprintf(&b, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(block.lines, "\n")))
+		case mdRule:
+			b.WriteString("<hr>\n")
+		case mdTable:
+			b.WriteString("<table>\n")
+			for i, row := range block.lines {
+				cell := "td"
+				if i == 0 {
+					cell = "th"
+				}
+				b.WriteString("<tr>")
+				for _, c := range splitTableRow(row) {
+					fmt.Fprintf(&b, "<%s>%s</%s>", cell, inlineHTML(c), cell)
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	src := strings.Join([]string{
+		"# Title #",
+		"First line",
+		"continued.",
+		"",
+		"- one",
+		"  more of one",
+		"* two",
+		"1. first",
+		"2) second",
+		"> quoted",
+		"> still quoted",
+		"---",
+		"```go",
+		"# not a heading",
+		"```",
+		"| a | b |",
+		"|---|:-:|",
+		"| 1 | 2 |",
+	}, "\r\n")
+
+	var kinds []mdKind
+	var lines [][]string
+	for _, b := range parseMarkdown(src) {
+		kinds = append(kinds, b.kind)
+		lines = append(lines, b.lines)
+	}
+	wantKinds := []mdKind{mdHeading, mdParagraph, mdBullet, mdOrdered, mdQuote, mdRule, mdCode, mdTable}
+	if !slices.Equal(kinds, wantKinds) {
+		t.Fatalf("got blocks %v, want %v", kinds, wantKinds)
+	}
+	wantLines := [][]string{
+		{"Title"},
+		{"First line continued."},
+		{"one more of one", "two"},
+		{"first", "second"},
+		{"quoted still quoted"},
+		nil,
+		{"# not a heading"},
+		{"| a | b |", "| 1 | 2 |"},
+	}
+	for i, want := range wantLines {
+		if !slices.Equal(lines[i], want) {
+			t.Errorf("block %d: got lines %q, want %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		src     string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "title from the first heading",
+			src:     "intro\n\n## Q3 <Report> & **more**",
+			want:    []string{"<title>Q3 &lt;Report&gt; &amp; more</title>", "<h2>Q3 &lt;Report&gt; &amp; <strong>more</strong></h2>"},
+			notWant: []string{"<Report>"},
+		},
+		{
+			name:    "title fallback",
+			src:     "no heading",
+			want:    []string{"<title>fallback &lt;name&gt;</title>"},
+			notWant: []string{"<name>"},
+		},
+		{
+			name:    "raw HTML is escaped",
+			src:     "<script>alert('x')</script> <img src=x onerror=alert(1)>",
+			want:    []string{"<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &lt;img src=x onerror=alert(1)&gt;</p>"},
+			notWant: []string{"<script>", "<img"},
+		},
+		{
+			name: "inline markup",
+			src:  "**bold**, *italic*, __also bold__ and `**code** <b>`",
+			want: []string{"<strong>bold</strong>, <em>italic</em>, <strong>also bold</strong> and <code>**code** &lt;b&gt;</code>"},
+		},
+		{
+			name: "safe links",
+			src:  "[site](https://example.com/?a=1&b=2) [mail](mailto:a@example.com) [page](/docs/x.html) [anchor](#top)",
+			want: []string{
+				`<a href="https://example.com/?a=1&amp;b=2">site</a>`,
+				`<a href="mailto:a@example.com">mail</a>`,
+				`<a href="/docs/x.html">page</a>`,
+				`<a href="#top">anchor</a>`,
+			},
+		},
+		{
+			name:    "active schemes are dropped",
+			src:     "[a](javascript:alert(1)) [b](JavaScript:alert(1)) [c](data:text/html;base64,PHNjcmlwdD4=) [d](vbscript:x)",
+			want:    []string{"<p>a) b) c d</p>"},
+			notWant: []string{"href", "javascript:", "data:"},
+		},
+		{
+			name:    "quotes cannot break out of href",
+			src:     `[x](https://example.com/"onclick="alert)`,
+			want:    []string{`<a href="https://example.com/&#34;onclick=&#34;alert">x</a>`},
+			notWant: []string{`"onclick`},
+		},
+		{
+			name:    "code blocks are escaped verbatim",
+			src:     "```\n<b>**x**</b>\n[a](javascript:x)\n```",
+			want:    []string{"<pre><code>&lt;b&gt;**x**&lt;/b&gt;\n[a](javascript:x)</code></pre>"},
+			notWant: []string{"<b>", "<strong>"},
+		},
+		{
+			name: "tables",
+			src:  "| Name | Note |\n|---|---|\n| <i>a</i> | *b* |",
+			want: []string{"<tr><th>Name</th><th>Note</th></tr>", "<tr><td>&lt;i&gt;a&lt;/i&gt;</td><td><em>b</em></td></tr>"},
+		},
+		{
+			name: "lists, quotes and rules",
+			src:  "- a\n- b\n\n1. c\n\n> d\n\n***",
+			want: []string{"<ul>\n<li>a</li>\n<li>b</li>\n</ul>", "<ol>\n<li>c</li>\n</ol>", "<blockquote><p>d</p></blockquote>", "<hr>"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := markdownToHTML(tc.src, "fallback <name>")
+			if !strings.HasPrefix(got, "<!DOCTYPE html>") || !strings.HasSuffix(got, "</html>\n") {
+				t.Errorf("not a complete document:\n%s", got)
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("missing %q in:\n%s", w, got)
+				}
+			}
+			body := got[strings.Index(got, "<body>"):]
+			for _, nw := range tc.notWant {
+				if strings.Contains(body, nw) {
+					t.Errorf("unexpected %q in:\n%s", nw, body)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineText(t *testing.T) {
+	got := inlineText("**Sales** rose *10%*, see [the data](https://example.com) and `a*b*c`")
+	want := "Sales rose 10%, see the data (https://example.com) and a*b*c"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// markdownToPDF lays out Markdown as an A4 PDF using the standard Helvetica
+// and Courier fonts, which every PDF viewer provides, so nothing needs to
+// be embedded. Text outside the Windows-1252 character set is replaced
+// with "?".
+func markdownToPDF(src string) []byte {
+	d := newPDFDoc()
+	for _, block := range parseMarkdown(src) {
+		switch block.kind {
+		case mdHeading:
+			size := [...]float64{0, 20, 16, 13.5, 12, 11, 11}[block.level]
+			d.space(size * 0.8)
+			d.paragraph(inlineText(block.lines[0]), fontBold, size, 0, "")
+			d.space(size * 0.3)
+		case mdParagraph:
+			d.paragraph(inlineText(block.lines[0]), fontRegular, 11, 0, "")
+			d.space(6)
+		case mdQuote:
+			d.paragraph(inlineText(block.lines[0]), fontItalic, 11, 18, "")
+			d.space(6)
+		case mdBullet, mdOrdered:
+			for i, item := range block.lines {
+				marker := "•"
+				if block.kind == mdOrdered {
+					marker = fmt.Sprintf("%d.", i+1)
+				}
+				d.paragraph(inlineText(item), fontRegular, 11, 18, marker)
+				d.space(2)
+			}
+			d.space(4)
+		case mdCode:
+			for _, line := range block.lines {
+				d.paragraph(line, fontMono, 9, 10, "")
+			}
+			d.space(6)
+		case mdRule:
+			d.space(6)
+			d.rule()
+			d.space(8)
+		case mdTable:
+			d.table(block.lines)
+			d.space(6)
+		}
+	}
+	return d.bytes()
+}
+
+const (
+	pageWidth, pageHeight = 595.0, 842.0 // A4 in points
+	margin                = 56.0
+	contentWidth          = pageWidth - 2*margin
+)
+
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+	fontItalic
+	fontMono
+)
+
+// Resource names and base fonts, indexed by pdfFont.
+var pdfFontNames = [...][2]string{
+	{"F1", "Helvetica"},
+	{"F2", "Helvetica-Bold"},
+	{"F3", "Helvetica-Oblique"},
+	{"F4", "Courier"},
+}
+
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64 // baseline of the next line, from the bottom of the page
+}
+
+func newPDFDoc() *pdfDoc {
+	d := &pdfDoc{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+func (d *pdfDoc) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// space adds vertical space, ignored at the top of a page.
+func (d *pdfDoc) space(h float64) {
+	if d.y < pageHeight-margin {
+		d.y -= h
+	}
+}
+
+// line moves down by leading, starting a new page if needed, and returns
+// the baseline to draw at.
+func (d *pdfDoc) line(leading float64) float64 {
+	if d.y-leading < margin {
+		d.newPage()
+	}
+	d.y -= leading
+	return d.y
+}
+
+func (d *pdfDoc) text(font pdfFont, size, x, y float64, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", pdfFontNames[font][0], size, x, y, pdfString(s))
+}
+
+// paragraph wraps s to the content width minus indent. A marker, such as a
+// list bullet, is drawn in the indent of the first line.
+func (d *pdfDoc) paragraph(s string, font pdfFont, size, indent float64, marker string) {
+	x := margin + indent
+	for i, l := range wrapText(s, font, size, contentWidth-indent) {
+		y := d.line(size * 1.3)
+		if i == 0 && marker != "" {
+			d.text(font, size, x-12, y, marker)
+		}
+		d.text(font, size, x, y, l)
+	}
+}
+
+func (d *pdfDoc) rule() {
+	y := d.line(1)
+	fmt.Fprintf(d.page(), "0.7 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, y, pageWidth-margin, y)
+}
+
+// table draws a pipe table in Courier, padding every column to its widest
+// cell, with a rule under the header.
+func (d *pdfDoc) table(rows []string) {
+	var cells [][]string
+	var widths []int
+	for _, row := range rows {
+		r := splitTableRow(row)
+		for i, c := range r {
+			r[i] = inlineText(c)
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], len([]rune(r[i])))
+		}
+		cells = append(cells, r)
+	}
+	for i, r := range cells {
+		var b strings.Builder
+		for j, c := range r {
+			b.WriteString(c + strings.Repeat(" ", widths[j]-len([]rune(c))+2))
+		}
+		d.paragraph(strings.TrimRight(b.String(), " "), fontMono, 8.5, 0, "")
+		if i == 0 {
+			d.rule()
+			d.space(2)
+		}
+	}
+}
+
+// bytes assembles the document: catalog, page tree, fonts, then each page
+// and its content stream, followed by the cross-reference table.
+func (d *pdfDoc) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	const firstFont = 3
+	firstPage := firstFont + len(pdfFontNames)
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPage+2*i))
+	}
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var fonts []string
+	for i, f := range pdfFontNames {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f[1]))
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", f[0], firstFont+i))
+	}
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, strings.Join(fonts, " "), firstPage+2*i+1))
+		content := strings.TrimSuffix(p.String(), "\n")
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString encodes s in Windows-1252 and escapes it for a PDF literal
+// string.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		c, ok := winAnsi(r)
+		if !ok {
+			c = '?'
+		}
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x80 {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// winAnsiExtras maps the printable characters Windows-1252 places in
+// 0x80-0x9F that models commonly emit.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '•': 0x95, '–': 0x96, '—': 0x97,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '™': 0x99,
+}
+
+func winAnsi(r rune) (byte, bool) {
+	switch {
+	case r == '\t':
+		return ' ', true
+	case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+		return byte(r), true
+	}
+	c, ok := winAnsiExtras[r]
+	return c, ok
+}
+
+// wrapText breaks s into lines no wider than width.
+func wrapText(s string, font pdfFont, size, width float64) []string {
+	words := strings.Fields(s)
+	if font == fontMono {
+		// Keep code indentation; break long lines at the width.
+		perLine := max(int(width/(0.6*size)), 1)
+		r := []rune(strings.TrimRight(s, " "))
+		var lines []string
+		for len(r) > perLine {
+			lines = append(lines, string(r[:perLine]))
+			r = r[perLine:]
+		}
+		return append(lines, string(r))
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	var lines []string
+	cur := words[0]
+	for _, w := range words[1:] {
+		if textWidth(cur+" "+w, font, size) > width {
+			lines = append(lines, cur)
+			cur = w
+			continue
+		}
+		cur += " " + w
+	}
+	return append(lines, cur)
+}
+
+// helveticaWidths are the Helvetica advance widths, in 1/1000 em, of the
+// printable ASCII characters from ' ' to '~'.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+func textWidth(s string, font pdfFont, size float64) float64 {
+	if font == fontMono {
+		return float64(len([]rune(s))) * 0.6 * size
+	}
+	units := 0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			units += helveticaWidths[r-' ']
+		} else {
+			units += 556
+		}
+	}
+	w := float64(units) / 1000 * size
+	if font == fontBold {
+		w *= 1.1 // Helvetica-Bold is slightly wider; err on the side of wrapping.
+	}
+	return w
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parsedPDF is what checkPDF reads back from a document.
+type parsedPDF struct {
+	objects []string // object bodies, by object number - 1
+	pages   int
+	content string // every page's content stream, concatenated
+}
+
+var (
+	trailerRe = regexp.MustCompile(`trailer\n<< /Size (\d+) /Root 1 0 R >>\nstartxref\n(\d+)\n%%EOF\n$`)
+	lengthRe  = regexp.MustCompile(`^<< /Length (\d+) >>\nstream\n`)
+	countRe   = regexp.MustCompile(`/Count (\d+)`)
+)
+
+// checkPDF checks the structure a reader relies on: the header, the
+// trailer, a cross-reference table whose offsets point at each object, and
+// stream lengths that match their data.
+func checkPDF(t *testing.T, data []byte) parsedPDF {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Fatalf("missing PDF header: %q", data[:min(len(data), 20)])
+	}
+	m := trailerRe.FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("missing or malformed trailer: %q", data[max(0, len(data)-100):])
+	}
+	size, _ := strconv.Atoi(string(m[1]))
+	xref, _ := strconv.Atoi(string(m[2]))
+
+	table, ok := bytes.CutPrefix(data[xref:], fmt.Appendf(nil, "xref\n0 %d\n0000000000 65535 f \n", size))
+	if !ok {
+		t.Fatalf("startxref %d does not point at an xref table for %d objects", xref, size)
+	}
+	var p parsedPDF
+	for n := 1; n < size; n++ {
+		entry := string(table[(n-1)*20 : n*20])
+		if !strings.HasSuffix(entry, " 00000 n \n") {
+			t.Fatalf("xref entry %d is malformed: %q", n, entry)
+		}
+		off, _ := strconv.Atoi(entry[:10])
+		body, ok := bytes.CutPrefix(data[off:], fmt.Appendf(nil, "%d 0 obj\n", n))
+		if !ok {
+			t.Fatalf("xref offset %d of object %d points at %q", off, n, data[off:min(len(data), off+20)])
+		}
+		end := bytes.Index(body, []byte("\nendobj\n"))
+		if end < 0 {
+			t.Fatalf("object %d has no endobj", n)
+		}
+		obj := string(body[:end])
+		p.objects = append(p.objects, obj)
+
+		if lm := lengthRe.FindStringSubmatch(obj); lm != nil {
+			length, _ := strconv.Atoi(lm[1])
+			stream := obj[len(lm[0]):]
+			if !strings.HasSuffix(stream, "\nendstream") || len(stream)-len("\nendstream") != length {
+				t.Errorf("object %d: /Length %d does not match its stream of %d bytes", n, length, len(stream)-len("\nendstream"))
+			}
+			p.content += strings.TrimSuffix(stream, "\nendstream") + "\n"
+		}
+		if strings.HasPrefix(obj, "<< /Type /Page ") {
+			p.pages++
+		}
+	}
+	if c := countRe.FindStringSubmatch(p.objects[1]); c == nil || c[1] != strconv.Itoa(p.pages) {
+		t.Errorf("page tree %q does not count the %d pages", p.objects[1], p.pages)
+	}
+	return p
+}
+
+func TestMarkdownToPDF(t *testing.T) {
+	t.Run("structure", func(t *testing.T) {
+		src := "# Report\n\nSome *text* with (parentheses) and a \\ backslash.\n\n" +
+			"- item\n1. step\n\n> quote\n\n---\n\n```\ncode()\n```\n\n| a | bb |\n|---|---|\n| ccc | d |\n"
+		p := checkPDF(t, markdownToPDF(src))
+		if p.pages != 1 {
+			t.Errorf("got %d pages, want 1", p.pages)
+		}
+		for _, want := range []string{
+			"/F2 20.0 Tf", "(Report) Tj",
+			`(Some text with \(parentheses\) and a \\ backslash.) Tj`,
+			`(\225) Tj`, "(item) Tj", "(1.) Tj", "(step) Tj",
+			"/F3 11.0 Tf", "(quote) Tj",
+			" m ", "/F4 9.0 Tf", "(code\\(\\)) Tj",
+			"(a    bb) Tj", "(ccc  d) Tj",
+		} {
+			if !strings.Contains(p.content, want) {
+				t.Errorf("missing %q in content:\n%s", want, p.content)
+			}
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		src := strings.Repeat("A paragraph long enough to wrap across more than one line of the page, "+
+			"so that the document needs several pages.\n\n", 100)
+		p := checkPDF(t, markdownToPDF(src))
+		if p.pages < 3 {
+			t.Errorf("got %d pages, want the text to flow onto several", p.pages)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if p := checkPDF(t, markdownToPDF("")); p.pages != 1 {
+			t.Errorf("got %d pages, want 1", p.pages)
+		}
+	})
+}
+
+func TestPDFString(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":       "plain",
+		`(a) \ b`:     `\(a\) \\ b`,
+		"café – “ok”": `caf\351 \226 \223ok\224`,
+		"tab\there":   "tab here",
+		"emoji 😀 中":   "emoji ? ?",
+		"line\nbreak": "line?break",
+	} {
+		if got := pdfString(in); got != want {
+			t.Errorf("pdfString(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText(strings.Repeat("word ", 60), fontRegular, 11, 200)
+	if len(lines) < 2 {
+		t.Fatalf("got %d lines, want the text wrapped", len(lines))
+	}
+	for _, l := range lines {
+		if w := textWidth(l, fontRegular, 11); w > 200 {
+			t.Errorf("line %q is %.1f wide, want at most 200", l, w)
+		}
+	}
+	if got := strings.Join(lines, " "); got != strings.TrimSpace(strings.Repeat("word ", 60)) {
+		t.Errorf("wrapping lost words: %q", got)
+	}
+}
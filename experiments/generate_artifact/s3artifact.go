@@ -0,0 +1,597 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/adk/artifact"
+	"google.golang.org/genai"
+)
+
+// S3Config configures an S3ArtifactService. Any S3-compatible store works:
+// AWS S3, MinIO, or Cloud Storage through its XML API with HMAC keys.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. "http://localhost:9000" for MinIO
+	// or "https://storage.googleapis.com" for Cloud Storage. Defaults to
+	// AWS S3 in Region.
+	Endpoint string
+	// Region is used for request signing. Defaults to "us-east-1".
+	Region string
+	Bucket string
+	// Prefix is prepended to every object key, to share a bucket.
+	Prefix string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most S3-compatible servers need it.
+	PathStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PresignExpiry is how long download URLs stay valid. Defaults to 15m.
+	PresignExpiry time.Duration
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3ArtifactService stores artifacts in an S3-compatible bucket, one object
+// per version under the key
+//
+//	prefix/app/user/session/filename/version
+//
+// User-scoped artifacts ("user:" filenames) use "_user" in place of the
+// session ID, as in the filesystem service, and session IDs starting with
+// "_" are rejected so that no session can share its keys. Requests are signed with AWS Signature
+// Version 4 using only the standard library.
+type S3ArtifactService struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+// textMetaHeader marks objects that were saved as text parts, so they are
+// loaded back as text rather than as inline bytes.
+const textMetaHeader = "X-Amz-Meta-Adk-Text"
+
+// NewS3ArtifactService returns an artifact.Service backed by the bucket in
+// cfg. It does not contact the server.
+func NewS3ArtifactService(cfg S3Config) (*S3ArtifactService, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 artifact service: Bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.PresignExpiry <= 0 {
+		cfg.PresignExpiry = 15 * time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3 artifact service: invalid endpoint: %w", err)
+	}
+	return &S3ArtifactService{cfg: cfg, endpoint: endpoint}, nil
+}
+
+func (s *S3ArtifactService) Save(ctx context.Context, req *artifact.SaveRequest) (*artifact.SaveResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	version := req.Version
+	if version == 0 {
+		// Like the GCS service, this is not atomic: two concurrent saves of
+		// the same file can pick the same version, and the later one wins.
+		versions, err := s.versions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+		if err != nil {
+			return nil, err
+		}
+		version = 1
+		if len(versions) > 0 {
+			version = versions[0] + 1
+		}
+	}
+
+	header := http.Header{}
+	var body []byte
+	if req.Part.InlineData != nil {
+		header.Set("Content-Type", req.Part.InlineData.MIMEType)
+		body = req.Part.InlineData.Data
+	} else {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set(textMetaHeader, "true")
+		body = []byte(req.Part.Text)
+	}
+	key, err := s.objectKey(req.AppName, req.UserID, req.SessionID, req.FileName, version)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return nil, fmt.Errorf("saving artifact: %w", err)
+	}
+	resp.Body.Close()
+	return &artifact.SaveResponse{Version: version}, nil
+}
+
+func (s *S3ArtifactService) Load(ctx context.Context, req *artifact.LoadRequest) (*artifact.LoadResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	version, err := s.resolveVersion(ctx, req.AppName, req.UserID, req.SessionID, req.FileName, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.objectKey(req.AppName, req.UserID, req.SessionID, req.FileName, version)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("loading artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("loading artifact: %w", err)
+	}
+
+	if resp.Header.Get(textMetaHeader) == "true" {
+		return &artifact.LoadResponse{Part: genai.NewPartFromText(string(data))}, nil
+	}
+	return &artifact.LoadResponse{Part: genai.NewPartFromBytes(data, resp.Header.Get("Content-Type"))}, nil
+}
+
+func (s *S3ArtifactService) Delete(ctx context.Context, req *artifact.DeleteRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("request validation failed: %w", err)
+	}
+	versions := []int64{req.Version}
+	if req.Version == 0 {
+		var err error
+		if versions, err = s.versions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName); err != nil {
+			return err
+		}
+	}
+	for _, v := range versions {
+		key, err := s.objectKey(req.AppName, req.UserID, req.SessionID, req.FileName, v)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+		if err != nil {
+			return fmt.Errorf("deleting artifact: %w", err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *S3ArtifactService) List(ctx context.Context, req *artifact.ListRequest) (*artifact.ListResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	if err := checkSessionID(req.SessionID); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, sessionID := range []string{req.SessionID, userScopeDir} {
+		prefix := s.keyPrefix(req.AppName, req.UserID, sessionID)
+		_, dirs, err := s.list(ctx, prefix, "/")
+		if err != nil {
+			return nil, fmt.Errorf("listing artifacts: %w", err)
+		}
+		for _, d := range dirs {
+			name, err := url.PathUnescape(strings.TrimSuffix(strings.TrimPrefix(d, prefix), "/"))
+			if err == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return &artifact.ListResponse{FileNames: slices.Compact(names)}, nil
+}
+
+// Versions returns the versions of an artifact, newest first, like the
+// in-memory service.
+func (s *S3ArtifactService) Versions(ctx context.Context, req *artifact.VersionsRequest) (*artifact.VersionsResponse, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("request validation failed: %w", err)
+	}
+	versions, err := s.versions(ctx, req.AppName, req.UserID, req.SessionID, req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+	}
+	return &artifact.VersionsResponse{Versions: versions}, nil
+}
+
+// Usage reports the size of every version of every artifact of a user from
+// one listing, which carries object sizes, without loading any data.
+func (s *S3ArtifactService) Usage(ctx context.Context, appName, userID string) (map[string]fileVersions, error) {
+	prefix := s.keyPrefix(appName, userID)
+	objects, _, err := s.list(ctx, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing artifacts: %w", err)
+	}
+	usage := map[string]fileVersions{}
+	for _, o := range objects {
+		// Keys below the user are session/filename/version, escaped.
+		parts := strings.Split(strings.TrimPrefix(o.Key, prefix), "/")
+		if len(parts) != 3 {
+			continue
+		}
+		sessionID, err1 := url.PathUnescape(parts[0])
+		name, err2 := url.PathUnescape(parts[1])
+		version, err3 := strconv.ParseInt(parts[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		if sessionID == userScopeDir {
+			sessionID = ""
+		}
+		usage[sessionID] = usage[sessionID].add(name, version, o.Size)
+	}
+	return usage, nil
+}
+
+// DownloadURL returns a presigned GET URL for an artifact version (0 for
+// the latest), valid for cfg.PresignExpiry. Anyone holding the URL can
+// download the object without credentials.
+func (s *S3ArtifactService) DownloadURL(ctx context.Context, appName, userID, sessionID, fileName string, version int64) (string, error) {
+	version, err := s.resolveVersion(ctx, appName, userID, sessionID, fileName, version)
+	if err != nil {
+		return "", err
+	}
+	key, err := s.objectKey(appName, userID, sessionID, fileName, version)
+	if err != nil {
+		return "", err
+	}
+	u := s.objectURL(key)
+	now := time.Now().UTC()
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.cfg.AccessKeyID + "/" + s.scope(now),
+		"X-Amz-Date":          now.Format(amzDateFormat),
+		"X-Amz-Expires":       strconv.Itoa(int(s.cfg.PresignExpiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if s.cfg.SessionToken != "" {
+		query["X-Amz-Security-Token"] = s.cfg.SessionToken
+	}
+	u.RawQuery = canonicalQuery(query)
+	sig := s.signature(http.MethodGet, u, map[string]string{"host": u.Host}, "UNSIGNED-PAYLOAD", now)
+	u.RawQuery += "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
+
+func (s *S3ArtifactService) resolveVersion(ctx context.Context, appName, userID, sessionID, fileName string, version int64) (int64, error) {
+	if version != 0 {
+		return version, nil
+	}
+	versions, err := s.versions(ctx, appName, userID, sessionID, fileName)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("artifact not found: %w", fs.ErrNotExist)
+	}
+	return versions[0], nil
+}
+
+// versions lists the stored versions of a file, newest first.
+func (s *S3ArtifactService) versions(ctx context.Context, appName, userID, sessionID, fileName string) ([]int64, error) {
+	prefix, err := s.fileKeyPrefix(appName, userID, sessionID, fileName)
+	if err != nil {
+		return nil, err
+	}
+	objects, _, err := s.list(ctx, prefix, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing artifact versions: %w", err)
+	}
+	var versions []int64
+	for _, o := range objects {
+		if v, err := strconv.ParseInt(strings.TrimPrefix(o.Key, prefix), 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	slices.Sort(versions)
+	slices.Reverse(versions)
+	return versions, nil
+}
+
+// Object keys. Components are escaped like the filesystem service, so a
+// "/" in a filename cannot add a level to the key hierarchy.
+
+func (s *S3ArtifactService) keyPrefix(components ...string) string {
+	var b strings.Builder
+	b.WriteString(s.cfg.Prefix)
+	if s.cfg.Prefix != "" && !strings.HasSuffix(s.cfg.Prefix, "/") {
+		b.WriteByte('/')
+	}
+	for _, c := range components {
+		b.WriteString(url.PathEscape(c))
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+func (s *S3ArtifactService) fileKeyPrefix(appName, userID, sessionID, fileName string) (string, error) {
+	if strings.HasPrefix(fileName, "user:") {
+		return s.keyPrefix(appName, userID, userScopeDir, fileName), nil
+	}
+	if err := checkSessionID(sessionID); err != nil {
+		return "", err
+	}
+	return s.keyPrefix(appName, userID, sessionID, fileName), nil
+}
+
+func (s *S3ArtifactService) objectKey(appName, userID, sessionID, fileName string, version int64) (string, error) {
+	prefix, err := s.fileKeyPrefix(appName, userID, sessionID, fileName)
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatInt(version, 10), nil
+}
+
+// S3 REST calls.
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type listBucketResult struct {
+	Contents       []s3Object `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type s3Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// list returns the objects and, if delimiter is set, the common prefixes
+// under prefix, following continuation tokens.
+func (s *S3ArtifactService) list(ctx context.Context, prefix, delimiter string) (objects []s3Object, prefixes []string, err error) {
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if delimiter != "" {
+			query["delimiter"] = delimiter
+		}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding list response: %w", err)
+		}
+		objects = append(objects, result.Contents...)
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key (or the bucket, if key is empty) and
+// returns the response if its status is 2xx. A 404 wraps fs.ErrNotExist.
+func (s *S3ArtifactService) do(ctx context.Context, method, key string, query map[string]string, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// Keep our escaping: the signature covers the exact path.
+	req.URL = u
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(body)
+	signed := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(amzDateFormat),
+	}
+	if s.cfg.SessionToken != "" {
+		signed["x-amz-security-token"] = s.cfg.SessionToken
+	}
+	for k, v := range header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			signed[lk] = strings.Join(v, ",")
+		}
+	}
+	for k, v := range signed {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+	sig := s.signature(method, u, signed, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, s.scope(now), signedHeaderNames(signed), sig))
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e s3Error
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+	if e.Code == "" {
+		e.Code = resp.Status
+	}
+	err = fmt.Errorf("s3 %s %q: %s %s", method, key, e.Code, e.Message)
+	if resp.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w: %w", err, fs.ErrNotExist)
+	}
+	return nil, err
+}
+
+// objectURL returns the URL of key, with the path escaped the way SigV4
+// expects.
+func (s *S3ArtifactService) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		path += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	path += "/" + key
+	u.Path, u.RawPath = path, awsEscape(path, false)
+	return &u
+}
+
+// AWS Signature Version 4, as described in
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const amzDateFormat = "20060102T150405Z"
+
+func (s *S3ArtifactService) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3ArtifactService) signature(method string, u *url.URL, headers map[string]string, payloadHash string, t time.Time) string {
+	var canonicalHeaders strings.Builder
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, strings.TrimSpace(headers[k]))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.RawPath,
+		u.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateFormat),
+		s.scope(t),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func signedHeaderNames(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+// canonicalQuery encodes query sorted by key, as SigV4 requires. The result
+// is also used as the request's raw query so the two always match.
+func canonicalQuery(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = awsEscape(k, true) + "=" + awsEscape(query[k], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and "/"
+// unless encodeSlash is set.
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+var (
+	_ artifact.Service = (*S3ArtifactService)(nil)
+	_ usageReporter    = (*S3ArtifactService)(nil)
+)
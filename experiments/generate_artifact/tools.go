@@ -0,0 +1,374 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+// artifactLinker is implemented by artifact stores that can give the user
+// a direct download link, such as S3ArtifactService.
+type artifactLinker interface {
+	DownloadURL(ctx context.Context, appName, userID, sessionID, fileName string, version int64) (string, error)
+}
+
+// artifactTools holds what the tool handlers share. links may be nil.
+type artifactTools struct {
+	links artifactLinker
+	// timeout bounds each call to a tool that touches storage; 0 means no
+	// limit beyond the run's own.
+	timeout time.Duration
+
+	mu sync.Mutex
+	// downloads holds, by session ID, the links handed out in the session's
+	// running invocation, for announceDownloads to repeat at the end.
+	downloads map[string]*invocationDownloads
+}
+
+// invocationDownloads is the list of links handed out in one invocation.
+type invocationDownloads struct {
+	invocationID string
+	lines        []string
+	// stop unregisters the cleanup that runs if the invocation's context
+	// is cancelled.
+	stop func() bool
+}
+
+// SaveArtifactOutput is returned by every tool that saves a file.
+type SaveArtifactOutput struct {
+	// Version is the version number the file was saved as, starting at 1.
+	Version     int64  `json:"version,omitempty"`
+	MIMEType    string `json:"mime_type,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// ErrorCode and Hint are set when the artifact policy refused the file.
+	ErrorCode string `json:"error_code,omitempty"`
+	Hint      string `json:"hint,omitempty"`
+}
+
+// save stores part under filename and reports the new version.
+func (t *artifactTools) save(ctx tool.Context, filename string, part *genai.Part) SaveArtifactOutput {
+	// We use the Artifacts service from the context.
+	// It automatically handles AppName, UserID, and SessionID.
+	// ctx is also a context.Context, so cancelling the run (or the tool's
+	// timeout) aborts the save.
+	resp, err := ctx.Artifacts().Save(ctx, filename, part)
+	if err != nil {
+		log.Printf("Error saving artifact: %v", err)
+		out := SaveArtifactOutput{Error: err.Error()}
+		var pe *PolicyError
+		if errors.As(err, &pe) {
+			out.ErrorCode, out.Hint = pe.Code, pe.Hint
+		}
+		return out
+	}
+	mimeType, size := "text/plain", len(part.Text)
+	if part.InlineData != nil {
+		mimeType, size = part.InlineData.MIMEType, len(part.InlineData.Data)
+	}
+	fmt.Printf("\n[SYSTEM] Saved artifact '%s' version %d (%s, %d bytes)\n", filename, resp.Version, mimeType, size)
+	link := t.downloadURL(ctx, filename, resp.Version)
+	if link != "" {
+		t.mu.Lock()
+		if d := t.downloads[ctx.SessionID()]; d != nil && d.invocationID == ctx.InvocationID() {
+			d.lines = append(d.lines, fmt.Sprintf("- %s (version %d): %s", filename, resp.Version, link))
+		}
+		t.mu.Unlock()
+	}
+	return SaveArtifactOutput{
+		Version:     resp.Version,
+		MIMEType:    mimeType,
+		DownloadURL: link,
+	}
+}
+
+// trackDownloads is a BeforeAgentCallback. It starts collecting the links
+// handed out in this invocation for announceDownloads.
+//
+// announceDownloads does not run when an invocation fails or is cancelled,
+// so the links are also dropped when the invocation's context is done, and
+// when the next invocation in the session starts.
+func (t *artifactTools) trackDownloads(ctx agent.CallbackContext) (*genai.Content, error) {
+	sessionID := ctx.SessionID()
+	d := &invocationDownloads{invocationID: ctx.InvocationID()}
+	d.stop = context.AfterFunc(ctx, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.downloads[sessionID] == d {
+			delete(t.downloads, sessionID)
+		}
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if old := t.downloads[sessionID]; old != nil {
+		old.stop()
+	}
+	t.downloads[sessionID] = d
+	return nil, nil
+}
+
+// announceDownloads is an AfterAgentCallback. It ends the agent's response
+// with a link to every file saved in this invocation, so the user gets them
+// even if the model leaves them out of its answer.
+func (t *artifactTools) announceDownloads(ctx agent.CallbackContext) (*genai.Content, error) {
+	t.mu.Lock()
+	d := t.downloads[ctx.SessionID()]
+	if d == nil || d.invocationID != ctx.InvocationID() {
+		t.mu.Unlock()
+		return nil, nil
+	}
+	d.stop()
+	delete(t.downloads, ctx.SessionID())
+	t.mu.Unlock()
+	if len(d.lines) == 0 {
+		return nil, nil
+	}
+	return genai.NewContentFromText("Downloads:\n"+strings.Join(d.lines, "\n"), genai.RoleModel), nil
+}
+
+// downloadURL returns a link to a saved artifact version, or "" if there is
+// no linker or it fails; a missing link should not fail the save.
+func (t *artifactTools) downloadURL(ctx tool.Context, fileName string, version int64) string {
+	if t.links == nil {
+		return ""
+	}
+	u, err := t.links.DownloadURL(ctx, ctx.AppName(), ctx.UserID(), ctx.SessionID(), fileName, version)
+	if err != nil {
+		log.Printf("Error creating download link for %s: %v", fileName, err)
+		return ""
+	}
+	return u
+}
+
+type SaveReportInput struct {
+	Filename string `json:"filename" jsonschema:"the extension picks the format: .txt, .md, .html or .pdf"`
+	Content  string `json:"content" jsonschema:"the report in Markdown"`
+}
+
+func (t *artifactTools) saveReport(ctx tool.Context, input SaveReportInput) SaveArtifactOutput {
+	part, err := renderDocument(input.Filename, input.Content)
+	if err != nil {
+		return SaveArtifactOutput{Error: err.Error()}
+	}
+	return t.save(ctx, input.Filename, part)
+}
+
+type SaveTableInput struct {
+	Filename string     `json:"filename" jsonschema:"the extension picks the format: .csv or .xlsx"`
+	Columns  []string   `json:"columns"`
+	Rows     [][]string `json:"rows" jsonschema:"one list of cells per row, in column order"`
+}
+
+func (t *artifactTools) saveTable(ctx tool.Context, input SaveTableInput) SaveArtifactOutput {
+	part, err := renderTable(input.Filename, input.Columns, input.Rows)
+	if err != nil {
+		return SaveArtifactOutput{Error: err.Error()}
+	}
+	return t.save(ctx, input.Filename, part)
+}
+
+type SaveChartInput struct {
+	Filename string    `json:"filename" jsonschema:"must end in .png"`
+	Chart    ChartSpec `json:"chart"`
+}
+
+func (t *artifactTools) saveChart(ctx tool.Context, input SaveChartInput) SaveArtifactOutput {
+	part, err := renderChartPart(input.Filename, input.Chart)
+	if err != nil {
+		return SaveArtifactOutput{Error: err.Error()}
+	}
+	return t.save(ctx, input.Filename, part)
+}
+
+type ListArtifactsInput struct{}
+
+type ListArtifactsOutput struct {
+	Filenames []string `json:"filenames,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func (t *artifactTools) listArtifacts(ctx tool.Context, _ ListArtifactsInput) ListArtifactsOutput {
+	resp, err := ctx.Artifacts().List(ctx)
+	if err != nil {
+		return ListArtifactsOutput{Error: err.Error()}
+	}
+	return ListArtifactsOutput{Filenames: resp.FileNames}
+}
+
+type LoadArtifactInput struct {
+	Filename string `json:"filename"`
+	Version  int    `json:"version,omitempty" jsonschema:"version to load; omit or 0 for the latest"`
+}
+
+type LoadArtifactOutput struct {
+	Content  string `json:"content,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (t *artifactTools) loadArtifact(ctx tool.Context, input LoadArtifactInput) LoadArtifactOutput {
+	resp, err := ctx.Artifacts().LoadVersion(ctx, input.Filename, input.Version)
+	if err != nil {
+		return LoadArtifactOutput{Error: err.Error()}
+	}
+	return describePart(resp.Part)
+}
+
+// describePart returns the content of a text artifact, or a short
+// description of a binary one, which the model could not read anyway.
+func describePart(p *genai.Part) LoadArtifactOutput {
+	switch {
+	case p == nil:
+		return LoadArtifactOutput{Error: "artifact is empty"}
+	case p.InlineData != nil && isTextMIME(p.InlineData.MIMEType):
+		return LoadArtifactOutput{Content: string(p.InlineData.Data), MIMEType: p.InlineData.MIMEType}
+	case p.InlineData != nil:
+		return LoadArtifactOutput{
+			Content:  fmt.Sprintf("(binary artifact, %d bytes)", len(p.InlineData.Data)),
+			MIMEType: p.InlineData.MIMEType,
+		}
+	default:
+		return LoadArtifactOutput{Content: p.Text, MIMEType: "text/plain"}
+	}
+}
+
+type ReviseReportInput struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content" jsonschema:"the full revised report in Markdown, not a diff"`
+}
+
+type ReviseReportOutput struct {
+	PreviousVersion int64  `json:"previous_version,omitempty"`
+	Version         int64  `json:"version,omitempty"`
+	MIMEType        string `json:"mime_type,omitempty"`
+	DownloadURL     string `json:"download_url,omitempty"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+	Hint            string `json:"hint,omitempty"`
+}
+
+// reviseReport saves a new version of an existing report. Unlike
+// save_report it refuses to create a file, so a typo in the filename cannot
+// silently start a second report.
+func (t *artifactTools) reviseReport(ctx tool.Context, input ReviseReportInput) ReviseReportOutput {
+	if _, err := ctx.Artifacts().Load(ctx, input.Filename); err != nil {
+		return ReviseReportOutput{Error: fmt.Sprintf("no report named %q to revise; use list_artifacts to find it or save_report to create it", input.Filename)}
+	}
+	part, err := renderDocument(input.Filename, input.Content)
+	if err != nil {
+		return ReviseReportOutput{Error: err.Error()}
+	}
+	saved := t.save(ctx, input.Filename, part)
+	if saved.Error != "" {
+		return ReviseReportOutput{Error: saved.Error, ErrorCode: saved.ErrorCode, Hint: saved.Hint}
+	}
+	return ReviseReportOutput{
+		// Artifact services number versions consecutively.
+		PreviousVersion: saved.Version - 1,
+		Version:         saved.Version,
+		MIMEType:        saved.MIMEType,
+		DownloadURL:     saved.DownloadURL,
+	}
+}
+
+// newArtifactTools creates the handlers for the reporter's file tools. If
+// links is not nil, saving a file also returns a download link.
+func newArtifactTools(links artifactLinker, timeout time.Duration) *artifactTools {
+	return &artifactTools{links: links, timeout: timeout, downloads: make(map[string]*invocationDownloads)}
+}
+
+// tools returns the tools the reporter uses to manage its files.
+func (t *artifactTools) tools() ([]tool.Tool, error) {
+	saveTool, err := newFunctionTool(functiontool.Config{
+		Name:        "save_report",
+		Description: "Renders a Markdown report to the format given by the filename extension (.txt, .md, .html or .pdf), saves it to the user's session artifacts and returns its version number.",
+	}, t.timeout, t.saveReport)
+	if err != nil {
+		return nil, err
+	}
+	tableTool, err := newFunctionTool(functiontool.Config{
+		Name:        "save_table",
+		Description: "Saves tabular data as a .csv or .xlsx file, depending on the filename extension.",
+	}, t.timeout, t.saveTable)
+	if err != nil {
+		return nil, err
+	}
+	chartTool, err := newFunctionTool(functiontool.Config{
+		Name:        "save_chart",
+		Description: "Draws a bar or line chart and saves it as a .png image.",
+	}, t.timeout, t.saveChart)
+	if err != nil {
+		return nil, err
+	}
+	listTool, err := newFunctionTool(functiontool.Config{
+		Name:        "list_artifacts",
+		Description: "Lists the filenames of the artifacts saved in this session.",
+	}, t.timeout, t.listArtifacts)
+	if err != nil {
+		return nil, err
+	}
+	loadTool, err := newFunctionTool(functiontool.Config{
+		Name:        "load_artifact",
+		Description: "Loads an artifact by filename, optionally at a specific version. Binary files such as PDFs are only described.",
+	}, t.timeout, t.loadArtifact)
+	if err != nil {
+		return nil, err
+	}
+	reviseTool, err := newFunctionTool(functiontool.Config{
+		Name:        "revise_report",
+		Description: "Saves a revised version of an existing report. Load the report first, then pass the full new Markdown.",
+	}, t.timeout, t.reviseReport)
+	if err != nil {
+		return nil, err
+	}
+	return []tool.Tool{saveTool, tableTool, chartTool, listTool, loadTool, reviseTool}, nil
+}
+
+// newFunctionTool is functiontool.New with a deadline on each call. The
+// handler's ctx is done when the timeout passes or the run is cancelled,
+// whichever comes first.
+func newFunctionTool[TArgs, TResults any](cfg functiontool.Config, timeout time.Duration, handler functiontool.Func[TArgs, TResults]) (tool.Tool, error) {
+	if timeout <= 0 {
+		return functiontool.New(cfg, handler)
+	}
+	return functiontool.New(cfg, func(ctx tool.Context, args TArgs) TResults {
+		deadline, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(timeoutContext{Context: ctx, deadline: deadline}, args)
+	})
+}
+
+// timeoutContext is a tool.Context whose cancellation comes from deadline.
+type timeoutContext struct {
+	tool.Context
+	deadline context.Context
+}
+
+func (c timeoutContext) Deadline() (time.Time, bool) { return c.deadline.Deadline() }
+func (c timeoutContext) Done() <-chan struct{}       { return c.deadline.Done() }
+func (c timeoutContext) Err() error                  { return c.deadline.Err() }
+func (c timeoutContext) Value(key any) any           { return c.deadline.Value(key) }
@@ -0,0 +1,247 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/artifact"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+// fakeToolContext is the part of a tool.Context the artifact tools use,
+// for one invocation in one session, with svc as the artifact store.
+type fakeToolContext struct {
+	tool.Context // nil; calling anything not overridden panics
+	ctx          context.Context
+	invocationID string
+	sessionID    string
+	svc          artifact.Service
+}
+
+func (c *fakeToolContext) Deadline() (time.Time, bool) { return c.ctx.Deadline() }
+func (c *fakeToolContext) Done() <-chan struct{}       { return c.ctx.Done() }
+func (c *fakeToolContext) Err() error                  { return c.ctx.Err() }
+func (c *fakeToolContext) Value(key any) any           { return c.ctx.Value(key) }
+func (c *fakeToolContext) InvocationID() string        { return c.invocationID }
+func (c *fakeToolContext) AppName() string             { return testApp }
+func (c *fakeToolContext) UserID() string              { return testUser }
+func (c *fakeToolContext) SessionID() string           { return c.sessionID }
+func (c *fakeToolContext) FunctionCallID() string      { return "call_1" }
+func (c *fakeToolContext) Artifacts() agent.Artifacts  { return sessionArtifacts{c} }
+
+// sessionArtifacts is agent.Artifacts over a fakeToolContext's store.
+type sessionArtifacts struct{ c *fakeToolContext }
+
+func (a sessionArtifacts) Save(ctx context.Context, name string, data *genai.Part) (*artifact.SaveResponse, error) {
+	return a.c.svc.Save(ctx, &artifact.SaveRequest{AppName: testApp, UserID: testUser, SessionID: a.c.sessionID, FileName: name, Part: data})
+}
+
+func (a sessionArtifacts) List(ctx context.Context) (*artifact.ListResponse, error) {
+	return a.c.svc.List(ctx, &artifact.ListRequest{AppName: testApp, UserID: testUser, SessionID: a.c.sessionID})
+}
+
+func (a sessionArtifacts) Load(ctx context.Context, name string) (*artifact.LoadResponse, error) {
+	return a.LoadVersion(ctx, name, 0)
+}
+
+func (a sessionArtifacts) LoadVersion(ctx context.Context, name string, version int) (*artifact.LoadResponse, error) {
+	return a.c.svc.Load(ctx, &artifact.LoadRequest{AppName: testApp, UserID: testUser, SessionID: a.c.sessionID, FileName: name, Version: int64(version)})
+}
+
+// fakeLinker links to every artifact version.
+type fakeLinker struct{}
+
+func (fakeLinker) DownloadURL(ctx context.Context, appName, userID, sessionID, fileName string, version int64) (string, error) {
+	return "https://example.com/" + fileName, nil
+}
+
+func TestAnnounceDownloads(t *testing.T) {
+	tools := newArtifactTools(fakeLinker{}, 0)
+	c := &fakeToolContext{ctx: t.Context(), invocationID: "inv1", sessionID: "s1", svc: artifact.InMemoryService()}
+	tools.trackDownloads(c)
+	if out := tools.saveReport(c, SaveReportInput{Filename: "report.md", Content: "# Report"}); out.DownloadURL == "" {
+		t.Fatalf("got %+v, want a download link", out)
+	}
+
+	content, err := tools.announceDownloads(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contentText(content); !strings.Contains(got, "report.md (version 1): https://example.com/report.md") {
+		t.Errorf("got %q, want the link to report.md", got)
+	}
+	if content, _ := tools.announceDownloads(c); content != nil {
+		t.Errorf("announced %q again, want nothing", contentText(content))
+	}
+	if n := tracked(tools); n != 0 {
+		t.Errorf("%d invocations still tracked, want none", n)
+	}
+}
+
+func TestDownloadsOfFailedInvocationsAreDropped(t *testing.T) {
+	tools := newArtifactTools(fakeLinker{}, 0)
+	svc := artifact.InMemoryService()
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		c := &fakeToolContext{ctx: ctx, invocationID: "inv1", sessionID: "s1", svc: svc}
+		tools.trackDownloads(c)
+		tools.saveReport(c, SaveReportInput{Filename: "report.md", Content: "# Report"})
+		cancel()
+		deadline := time.Now().Add(time.Second)
+		for tracked(tools) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("the cancelled invocation's links are still tracked")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("never announced", func(t *testing.T) {
+		failed := &fakeToolContext{ctx: t.Context(), invocationID: "inv2", sessionID: "s2", svc: svc}
+		tools.trackDownloads(failed)
+		tools.saveReport(failed, SaveReportInput{Filename: "draft.md", Content: "# Draft"})
+
+		next := &fakeToolContext{ctx: t.Context(), invocationID: "inv3", sessionID: "s2", svc: svc}
+		tools.trackDownloads(next)
+		tools.saveReport(next, SaveReportInput{Filename: "final.md", Content: "# Final"})
+		content, err := tools.announceDownloads(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := contentText(content); strings.Contains(got, "draft.md") || !strings.Contains(got, "final.md") {
+			t.Errorf("got %q, want only this invocation's final.md", got)
+		}
+		if n := tracked(tools); n != 0 {
+			t.Errorf("%d invocations still tracked, want none", n)
+		}
+	})
+}
+
+// blockingService is an artifact store that hangs until the request's
+// context is done, and records the error it returned.
+type blockingService struct {
+	artifact.Service // nil
+	errs             chan error
+}
+
+func (s *blockingService) block(ctx context.Context) error {
+	<-ctx.Done()
+	s.errs <- ctx.Err()
+	return ctx.Err()
+}
+
+func (s *blockingService) Save(ctx context.Context, _ *artifact.SaveRequest) (*artifact.SaveResponse, error) {
+	return nil, s.block(ctx)
+}
+
+func (s *blockingService) Load(ctx context.Context, _ *artifact.LoadRequest) (*artifact.LoadResponse, error) {
+	return nil, s.block(ctx)
+}
+
+func (s *blockingService) List(ctx context.Context, _ *artifact.ListRequest) (*artifact.ListResponse, error) {
+	return nil, s.block(ctx)
+}
+
+func TestToolsGiveUpOnAHungStore(t *testing.T) {
+	for _, tc := range []struct {
+		tool string
+		args map[string]any
+	}{
+		{"save_report", map[string]any{"filename": "report.md", "content": "# Report"}},
+		{"list_artifacts", map[string]any{}},
+		{"load_artifact", map[string]any{"filename": "report.md"}},
+	} {
+		t.Run(tc.tool, func(t *testing.T) {
+			t.Run("run cancelled", func(t *testing.T) {
+				ctx, cancel := context.WithCancel(t.Context())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				runHungTool(t, time.Minute, ctx, tc.tool, tc.args, context.Canceled)
+			})
+			t.Run("timeout", func(t *testing.T) {
+				runHungTool(t, 20*time.Millisecond, t.Context(), tc.tool, tc.args, context.DeadlineExceeded)
+			})
+		})
+	}
+}
+
+// runHungTool calls the named tool, with the given per-tool timeout, on a
+// store that never answers, and checks that it returns promptly with want.
+func runHungTool(t *testing.T, timeout time.Duration, ctx context.Context, name string, args map[string]any, want error) {
+	t.Helper()
+	tools, err := newArtifactTools(nil, timeout).tools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var run interface {
+		Run(tool.Context, any) (map[string]any, error)
+	}
+	for _, tl := range tools {
+		if tl.Name() == name {
+			run = tl.(interface {
+				Run(tool.Context, any) (map[string]any, error)
+			})
+		}
+	}
+	if run == nil {
+		t.Fatalf("no tool named %s", name)
+	}
+
+	svc := &blockingService{errs: make(chan error, 1)}
+	c := &fakeToolContext{ctx: ctx, invocationID: "inv1", sessionID: "s1", svc: svc}
+	start := time.Now()
+	out, err := run.Run(c, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("took %s, want the tool to give up at once", d)
+	}
+	select {
+	case got := <-svc.errs:
+		if !errors.Is(got, want) {
+			t.Errorf("store call ended with %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("the store was never called")
+	}
+	if out["error"] != want.Error() {
+		t.Errorf("got output %v, want error %q", out, want)
+	}
+}
+
+func tracked(t *artifactTools) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.downloads)
+}
+
+func contentText(c *genai.Content) string {
+	if c == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range c.Parts {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
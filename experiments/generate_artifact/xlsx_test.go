@@ -0,0 +1,138 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"slices"
+	"testing"
+)
+
+// xlsxSheet is the part of sheet1.xml the tests read back.
+type xlsxSheet struct {
+	XMLName xml.Name `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
+	Rows    []struct {
+		R     string `xml:"r,attr"`
+		Cells []struct {
+			Ref    string  `xml:"r,attr"`
+			Type   string  `xml:"t,attr"`
+			Style  string  `xml:"s,attr"`
+			Value  *string `xml:"v"`
+			Inline *string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX unzips a workbook, checks that every part is well-formed XML,
+// and returns the sheet.
+func readXLSX(t *testing.T, data []byte) xlsxSheet {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var sheet xlsxSheet
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+			}
+		}
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			if err := xml.Unmarshal(body, &sheet); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("got parts %q, want %q", names, want)
+	}
+	return sheet
+}
+
+func TestBuildXLSX(t *testing.T) {
+	data, err := buildXLSX(
+		[]string{"Name", "Amount", "Note"},
+		[][]string{
+			{"<b>ACME</b> & Co", "1250.5", "  spaced  "},
+			{"Globex", "-3e2", "NaN"},
+			{"Initech", "0x1p3", "]]> \"quoted\""},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet := readXLSX(t, data)
+
+	type cell struct{ ref, typ, style, value string }
+	var got []cell
+	for _, row := range sheet.Rows {
+		for _, c := range row.Cells {
+			v := ""
+			switch {
+			case c.Value != nil:
+				v = *c.Value
+			case c.Inline != nil:
+				v = *c.Inline
+			}
+			got = append(got, cell{c.Ref, c.Type, c.Style, v})
+		}
+	}
+	want := []cell{
+		{"A1", "inlineStr", "1", "Name"}, {"B1", "inlineStr", "1", "Amount"}, {"C1", "inlineStr", "1", "Note"},
+		{"A2", "inlineStr", "", "<b>ACME</b> & Co"}, {"B2", "", "", "1250.5"}, {"C2", "inlineStr", "", "  spaced  "},
+		{"A3", "inlineStr", "", "Globex"}, {"B3", "", "", "-3e2"}, {"C3", "inlineStr", "", "NaN"},
+		{"A4", "inlineStr", "", "Initech"}, {"B4", "inlineStr", "", "0x1p3"}, {"C4", "inlineStr", "", `]]> "quoted"`},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got cells\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestIsNumber(t *testing.T) {
+	for v, want := range map[string]bool{
+		"42": true, "-1.5": true, "1e6": true, "0.0": true,
+		"": false, "NaN": false, "Inf": false, "-Infinity": false, "0x10": false, "1p3": false, "12 apples": false,
+	} {
+		if got := isNumber(v); got != want {
+			t.Errorf("isNumber(%q) = %t, want %t", v, got, want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
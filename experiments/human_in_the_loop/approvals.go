@@ -0,0 +1,549 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/genai"
+)
+
+// This file implements asynchronous human approval. Instead of blocking on
+// stdin, ask_human is a long-running tool: it records the question as a
+// pending Approval in session state and returns at once, and the agent
+// tells the user what it is waiting for. The invocation then ends.
+//
+// The answer arrives with a later message, either as plain text typed by
+// the user or as a FunctionResponse for the ask_human call sent through the
+// API. resumeApprovals sees it before the next model call, marks the
+// Approval answered, and rewrites the pending tool response so the model
+// sees the answer where it asked for it.
+//
+// Approvals live in session state, so they are stored by the session
+// service and survive a restart if it is persistent.
+//
+// With a HumanChannel other than the terminal, the question is also sent
+// there once it is stored, and an answer that comes back is written to the
+// session, so the next message resumes with it. Questions still pending
+// when the program stops are sent again when it starts.
+//
+// A question nobody answers by its deadline gets the policy's default
+// answer, with an Outcome saying so, which the model sees as well.
+//
+// A question can ask for a type of answer, such as yes/no or one of a few
+// choices. A reply that doesn't fit leaves the question pending, and the
+// model is told why so it can ask again; one that fits reaches the model as
+// a typed value.
+
+const (
+	askHumanToolName = "ask_human"
+	// approvalKeyPrefix prefixes the state key of each Approval, followed by
+	// the ID of the ask_human function call.
+	approvalKeyPrefix = "approval:"
+
+	statusPending  = "pending"
+	statusAnswered = "answered"
+)
+
+// Approval is a question put to the human, kept in session state.
+type Approval struct {
+	ID       string `json:"id"`
+	Question string `json:"question"`
+	AnswerSpec
+	// InvocationID is the invocation that asked. Only a later message can
+	// answer, so the request that triggered the question is not taken as
+	// its answer.
+	InvocationID string `json:"invocation_id"`
+	Status       string `json:"status"`
+	// Answer is the reply as given, and Value the typed answer parsed from
+	// it.
+	Answer string `json:"answer,omitempty"`
+	Value  any    `json:"value,omitzero"`
+	// Rejected says why the last reply to a pending question was not
+	// accepted.
+	Rejected   string    `json:"rejected,omitempty"`
+	AskedAt    time.Time `json:"asked_at"`
+	AnsweredAt time.Time `json:"answered_at,omitzero"`
+	// AnsweredBy says who answered and how, as in HumanAnswer.By.
+	AnsweredBy string `json:"answered_by,omitempty"`
+	// Deadline is when the default answer applies, if there is one.
+	Deadline time.Time `json:"deadline,omitzero"`
+	// Outcome says how the answer came about, such as "timed out after
+	// 10m0s, defaulted to \"no\"".
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// decodeApproval converts a state value back into an Approval. Values read
+// back from a persistent session service are generic JSON maps rather than
+// the struct that was stored, so both go through JSON.
+func decodeApproval(v any) (Approval, bool) {
+	var a Approval
+	b, err := json.Marshal(v)
+	if err != nil || json.Unmarshal(b, &a) != nil || a.ID == "" {
+		return Approval{}, false
+	}
+	return a, true
+}
+
+// pendingApprovals returns the unanswered approvals, oldest first.
+func pendingApprovals(state session.ReadonlyState) []Approval {
+	var pending []Approval
+	for k, v := range state.All() {
+		if !strings.HasPrefix(k, approvalKeyPrefix) {
+			continue
+		}
+		if a, ok := decodeApproval(v); ok && a.Status == statusPending {
+			pending = append(pending, a)
+		}
+	}
+	slices.SortFunc(pending, func(a, b Approval) int { return a.AskedAt.Compare(b.AskedAt) })
+	return pending
+}
+
+type AskHumanInput struct {
+	Question string     `json:"question"`
+	Type     AnswerType `json:"type,omitempty" jsonschema:"the answer wanted: text (the default), yes_no, single_choice, multi_choice or number"`
+	Choices  []string   `json:"choices,omitempty" jsonschema:"the options, for single_choice and multi_choice"`
+	Min      *float64   `json:"min,omitempty" jsonschema:"the smallest number allowed, for number"`
+	Max      *float64   `json:"max,omitempty" jsonschema:"the largest number allowed, for number"`
+}
+
+func (in AskHumanInput) spec() AnswerSpec {
+	return AnswerSpec{Type: in.Type, Choices: in.Choices, Min: in.Min, Max: in.Max}
+}
+
+type AskHumanOutput struct {
+	// Status is "pending" until the human answers, then "answered".
+	Status     string `json:"status"`
+	ApprovalID string `json:"approval_id,omitempty"`
+	// Answer is typed: a string, a bool for yes_no, a list of strings for
+	// multi_choice or a number.
+	Answer  any    `json:"answer,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// askHuman implements the ask_human tool.
+type askHuman struct {
+	// channel, if not nil, is sent each question. In a terminal the user
+	// answers in the chat, so there it is nil.
+	channel  HumanChannel
+	sessions session.Service
+	// policy sets the deadline of each question.
+	policy AnswerPolicy
+	// audit records every answer.
+	audit *AuditLog
+
+	// ctx is cancelled by Close, which stops the questions being asked on
+	// the channel, and wg waits for them.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu guards the maps below, keyed by approval ID. asking holds a way
+	// to stop each question on the channel, so it is sent only once.
+	// settled holds the approvals an answer has been taken for, so that an
+	// answer on the channel and one in the chat can't both count; it only
+	// grows by the questions this process answers.
+	mu      sync.Mutex
+	asking  map[string]context.CancelFunc
+	settled map[string]bool
+}
+
+// newAskHuman returns the ask_human tool's implementation. channel may be
+// nil. Close stops it.
+func newAskHuman(channel HumanChannel, sessions session.Service, policy AnswerPolicy, audit *AuditLog) *askHuman {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &askHuman{
+		channel:  channel,
+		sessions: sessions,
+		policy:   policy,
+		audit:    audit,
+		ctx:      ctx,
+		cancel:   cancel,
+		asking:   make(map[string]context.CancelFunc),
+		settled:  make(map[string]bool),
+	}
+}
+
+// Close stops asking questions on the channel and waits for the questions
+// being asked to give up. They stay pending in their sessions, and
+// resendPending sends them again.
+func (h *askHuman) Close() {
+	h.cancel()
+	h.wg.Wait()
+}
+
+// handler records the question and returns without waiting. The
+// ApprovalID lets resumeApprovals find this response again, since ADK
+// strips its own function call IDs before sending history to the model.
+func (h *askHuman) handler(ctx tool.Context, input AskHumanInput) AskHumanOutput {
+	spec := input.spec()
+	if err := spec.validate(); err != nil {
+		return AskHumanOutput{Error: err.Error()}
+	}
+	a := Approval{
+		ID:           ctx.FunctionCallID(),
+		Question:     input.Question,
+		AnswerSpec:   spec,
+		InvocationID: ctx.InvocationID(),
+		Status:       statusPending,
+		AskedAt:      time.Now().UTC(),
+	}
+	if h.policy.Deadline > 0 {
+		a.Deadline = a.AskedAt.Add(h.policy.Deadline)
+	}
+	if err := ctx.State().Set(approvalKeyPrefix+a.ID, a); err != nil {
+		return AskHumanOutput{Error: err.Error()}
+	}
+	log.Printf("Approval %s pending: %s", a.ID, a.Question)
+	return AskHumanOutput{Status: statusPending, ApprovalID: a.ID}
+}
+
+// resendPending sends the questions still pending in appName's sessions to
+// the channel, as after a restart. Their deadlines still run from when
+// they were first asked.
+func (h *askHuman) resendPending(ctx context.Context, appName string) error {
+	if h.channel == nil {
+		return nil
+	}
+	resp, err := h.sessions.List(ctx, &session.ListRequest{AppName: appName})
+	if err != nil {
+		return fmt.Errorf("listing sessions: %w", err)
+	}
+	for _, sess := range resp.Sessions {
+		for _, a := range pendingApprovals(sess.State()) {
+			log.Printf("Approval %s still pending; asking again", a.ID)
+			h.send(a, sess.AppName(), sess.UserID(), sess.ID())
+		}
+	}
+	return nil
+}
+
+// send starts asking a's question on the channel, unless it is already
+// being asked or has been answered. a must be stored in its session, so
+// that the answer can be written next to it.
+func (h *askHuman) send(a Approval, appName, userID, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.channel == nil || h.asking[a.ID] != nil || h.settled[a.ID] || h.ctx.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(h.ctx)
+	h.asking[a.ID] = cancel
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer cancel()
+		h.forward(ctx, a, appName, userID, sessionID)
+		h.mu.Lock()
+		delete(h.asking, a.ID)
+		h.mu.Unlock()
+	}()
+}
+
+// settle claims the right to answer the approval id, and reports whether
+// it got it. Only the first answer taken for an approval counts.
+func (h *askHuman) settle(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.settled[id] {
+		return false
+	}
+	h.settled[id] = true
+	return true
+}
+
+// unsettle gives up a claim from settle when the answer was not recorded.
+func (h *askHuman) unsettle(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.settled, id)
+}
+
+// forward asks a's question on the channel and records the answer in the
+// session.
+func (h *askHuman) forward(ctx context.Context, a Approval, appName, userID, sessionID string) {
+	ans, err := h.channel.Ask(ctx, HumanQuestion{
+		ID:         a.ID,
+		Kind:       KindQuestion,
+		AppName:    appName,
+		UserID:     userID,
+		SessionID:  sessionID,
+		Text:       a.Question,
+		AskedAt:    a.AskedAt,
+		AnswerSpec: a.AnswerSpec,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Approval %s: no answer from the channel: %v", a.ID, err)
+		}
+		return
+	}
+
+	// Once settled, no reply in the chat can answer a as well. One that
+	// already has is either settled or stored.
+	if !h.settle(a.ID) {
+		return
+	}
+	resp, err := h.sessions.Get(ctx, &session.GetRequest{AppName: appName, UserID: userID, SessionID: sessionID})
+	if err != nil {
+		log.Printf("Approval %s: %v", a.ID, err)
+		h.unsettle(a.ID)
+		return
+	}
+	v, err := resp.Session.State().Get(approvalKeyPrefix + a.ID)
+	if err != nil {
+		log.Printf("Approval %s: not found in session %s", a.ID, sessionID)
+		h.unsettle(a.ID)
+		return
+	}
+	if cur, ok := decodeApproval(v); !ok || cur.Status != statusPending {
+		return // answered in the chat before this process started
+	}
+
+	// Channels only return answers the question accepts, except for the
+	// default answer, which is recorded as given.
+	value, _ := a.Parse(ans.Answer)
+	a = a.answered(ans.Answer, value, ans.By, ans.Outcome)
+	log.Printf("Approval %s answered on the channel by %s (%s): %s", a.ID, a.AnsweredBy, a.Outcome, a.Answer)
+	rec, err := h.audit.Append(a.auditEntry(appName, userID, sessionID))
+	if err != nil {
+		log.Printf("Approval %s: %v", a.ID, err)
+		h.unsettle(a.ID)
+		return
+	}
+
+	// An event with only a state change is kept in the session but never
+	// shown to the model.
+	ev := session.NewEvent(a.InvocationID)
+	ev.Author = "user"
+	ev.Actions.StateDelta = map[string]any{approvalKeyPrefix + a.ID: a, auditKeyPrefix + a.ID: rec}
+	if err := h.sessions.AppendEvent(ctx, resp.Session, ev); err != nil {
+		log.Printf("Approval %s: recording answer: %v", a.ID, err)
+	}
+}
+
+// resumeApprovals is a BeforeModelCallback. It records answers carried by
+// the current user message, then shows the model every answered approval
+// in place of its pending tool response, and every rejected reply to one
+// still pending.
+//
+// It also sends the pending questions to the channel. By the time the
+// model is called again after ask_human, the runner has stored the
+// approval, so an answer from the channel can't arrive before it.
+func (h *askHuman) resumeApprovals(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	if err := h.recordAnswers(ctx); err != nil {
+		return nil, err
+	}
+	for _, a := range pendingApprovals(ctx.ReadonlyState()) {
+		h.send(a, ctx.AppName(), ctx.UserID(), ctx.SessionID())
+	}
+	for _, c := range req.Contents {
+		for i, p := range c.Parts {
+			fr := p.FunctionResponse
+			if fr == nil || fr.Name != askHumanToolName {
+				continue
+			}
+			id, _ := fr.Response["approval_id"].(string)
+			v, err := ctx.ReadonlyState().Get(approvalKeyPrefix + id)
+			if err != nil {
+				continue
+			}
+			a, ok := decodeApproval(v)
+			if !ok || (a.Status == statusPending && a.Rejected == "") {
+				continue
+			}
+			resp := map[string]any{"status": a.Status, "approval_id": a.ID}
+			if a.Status == statusPending {
+				resp["error"] = a.Rejected
+			} else {
+				// A default answer the question doesn't accept is shown as given.
+				resp["answer"] = a.Value
+				if a.Value == nil {
+					resp["answer"] = a.Answer
+				}
+				if a.Outcome != "" {
+					resp["outcome"] = a.Outcome
+				}
+			}
+			c.Parts[i] = genai.NewPartFromFunctionResponse(fr.Name, resp)
+			c.Parts[i].FunctionResponse.ID = fr.ID
+		}
+	}
+	return nil, nil
+}
+
+// recordAnswers marks approvals answered by the message that started this
+// invocation. A FunctionResponse answers the call with its ID; otherwise
+// plain text answers the oldest pending question. Approvals past their
+// deadline are given the default answer first, so a late reply is not
+// taken for theirs.
+func (h *askHuman) recordAnswers(ctx agent.CallbackContext) error {
+	msg := ctx.UserContent()
+	if msg == nil {
+		return nil
+	}
+	// Approvals settled on the channel are answered, though the answer may
+	// not have reached this invocation's state yet.
+	pending := slices.DeleteFunc(pendingApprovals(ctx.ReadonlyState()), func(a Approval) bool {
+		return a.InvocationID == ctx.InvocationID() || h.isSettled(a.ID)
+	})
+	var err error
+	pending = slices.DeleteFunc(pending, func(a Approval) bool {
+		if a.Deadline.IsZero() || time.Now().Before(a.Deadline) || err != nil {
+			return false
+		}
+		outcome := fmt.Sprintf("timed out after %v, defaulted to %q", a.Deadline.Sub(a.AskedAt), h.policy.DefaultAnswer)
+		value, _ := a.Parse(h.policy.DefaultAnswer)
+		a = a.answered(h.policy.DefaultAnswer, value, "policy", outcome)
+		err = h.record(ctx, a)
+		return true
+	})
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	answered := false
+	for _, p := range msg.Parts {
+		fr := p.FunctionResponse
+		if fr == nil {
+			continue
+		}
+		i := slices.IndexFunc(pending, func(a Approval) bool { return a.ID == fr.ID })
+		if i < 0 {
+			continue
+		}
+		if err := h.reply(ctx, pending[i], responseAnswer(fr.Response), "api:"+ctx.UserID()); err != nil {
+			return err
+		}
+		answered = true
+	}
+	if answered {
+		return nil
+	}
+
+	var text strings.Builder
+	for _, p := range msg.Parts {
+		text.WriteString(p.Text)
+	}
+	if t := strings.TrimSpace(text.String()); t != "" {
+		return h.reply(ctx, pending[0], t, "chat:"+ctx.UserID())
+	}
+	return nil
+}
+
+// reply answers a with text from by, or, if a does not accept it, records
+// why and leaves a pending.
+func (h *askHuman) reply(ctx agent.CallbackContext, a Approval, text, by string) error {
+	value, err := a.Parse(text)
+	if err != nil {
+		a.Rejected = fmt.Sprintf("the reply %q is not a valid answer: %v", text, err)
+		if hint := a.Hint(); hint != "" {
+			a.Rejected += "; ask again for " + hint
+		}
+		log.Printf("Approval %s: %s", a.ID, a.Rejected)
+		return ctx.State().Set(approvalKeyPrefix+a.ID, a)
+	}
+	return h.record(ctx, a.answered(text, value, by, "answered"))
+}
+
+// record stores the answered approval a, and its audit record, in state.
+// If the answer can't be audited, it is not recorded either. If the channel
+// has just taken an answer for a, this one is dropped.
+func (h *askHuman) record(ctx agent.CallbackContext, a Approval) error {
+	if !h.settle(a.ID) {
+		return nil
+	}
+	log.Printf("Approval %s answered by %s (%s): %s", a.ID, a.AnsweredBy, a.Outcome, a.Answer)
+	rec, err := h.audit.Append(a.auditEntry(ctx.AppName(), ctx.UserID(), ctx.SessionID()))
+	if err == nil {
+		err = ctx.State().Set(auditKeyPrefix+a.ID, rec)
+	}
+	if err == nil {
+		err = ctx.State().Set(approvalKeyPrefix+a.ID, a)
+	}
+	if err != nil {
+		h.unsettle(a.ID)
+		return err
+	}
+	// Nobody needs to answer on the channel now.
+	h.mu.Lock()
+	if cancel := h.asking[a.ID]; cancel != nil {
+		cancel()
+	}
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *askHuman) isSettled(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.settled[id]
+}
+
+func (a Approval) answered(text string, value any, by, outcome string) Approval {
+	a.Status, a.Answer, a.Value, a.AnsweredAt = statusAnswered, text, value, time.Now().UTC()
+	a.AnsweredBy, a.Outcome, a.Rejected = by, outcome, ""
+	return a
+}
+
+func (a Approval) auditEntry(appName, userID, sessionID string) AuditEntry {
+	answer := a.Value
+	if answer == nil {
+		answer = a.Answer
+	}
+	return AuditEntry{
+		Time:       time.Now().UTC(),
+		Kind:       KindQuestion,
+		AppName:    appName,
+		UserID:     userID,
+		SessionID:  sessionID,
+		CallID:     a.ID,
+		Question:   a.Question,
+		AskedAt:    a.AskedAt,
+		AnsweredBy: a.AnsweredBy,
+		AnsweredAt: a.AnsweredAt,
+		Answer:     answer,
+		Outcome:    a.Outcome,
+	}
+}
+
+// responseAnswer extracts the answer from a FunctionResponse sent by a
+// client, which should look like {"answer": "yes"}. A typed answer, such as
+// {"answer": true} or {"answer": ["red", "blue"]}, is returned as JSON,
+// which AnswerSpec.Parse accepts too.
+func responseAnswer(resp map[string]any) string {
+	v, ok := resp["answer"]
+	if !ok {
+		v = resp
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,445 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+const (
+	testApp  = "test"
+	testUser = "user"
+)
+
+// scriptedModel replies with its responses in order, and then with "done".
+// It records every request.
+type scriptedModel struct {
+	mu        sync.Mutex
+	responses []*genai.Content
+	requests  []*model.LLMRequest
+}
+
+func (m *scriptedModel) Name() string { return "scripted" }
+
+func (m *scriptedModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		m.mu.Lock()
+		m.requests = append(m.requests, req)
+		resp := genai.NewContentFromText("done", genai.RoleModel)
+		if len(m.responses) > 0 {
+			resp, m.responses = m.responses[0], m.responses[1:]
+		}
+		m.mu.Unlock()
+		yield(&model.LLMResponse{Content: resp}, nil)
+	}
+}
+
+// script adds responses to the end of the script.
+func (m *scriptedModel) script(responses ...*genai.Content) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = append(m.responses, responses...)
+}
+
+// lastResponse returns the response to the tool called name in the last
+// request.
+func (m *scriptedModel) lastResponse(name string) map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var resp map[string]any
+	for _, c := range m.requests[len(m.requests)-1].Contents {
+		for _, p := range c.Parts {
+			if p.FunctionResponse != nil && p.FunctionResponse.Name == name {
+				resp = p.FunctionResponse.Response
+			}
+		}
+	}
+	return resp
+}
+
+func callTool(name string, args map[string]any) *genai.Content {
+	return &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{genai.NewPartFromFunctionCall(name, args)}}
+}
+
+func text(s string) *genai.Content {
+	return genai.NewContentFromText(s, genai.RoleModel)
+}
+
+// fakeChannel records the questions it is asked and answers them with
+// answer, or err. If release is set, it waits for it to be closed first.
+type fakeChannel struct {
+	answer  HumanAnswer
+	err     error
+	release chan struct{}
+	// asked receives every question, and gaveUp the ones whose context
+	// ended before they were answered.
+	asked  chan HumanQuestion
+	gaveUp chan HumanQuestion
+}
+
+func newFakeChannel(answer HumanAnswer) *fakeChannel {
+	return &fakeChannel{answer: answer, asked: make(chan HumanQuestion, 10), gaveUp: make(chan HumanQuestion, 10)}
+}
+
+func (c *fakeChannel) Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error) {
+	c.asked <- q
+	if c.release != nil {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			c.gaveUp <- q
+			return HumanAnswer{}, ctx.Err()
+		}
+	}
+	return c.answer, c.err
+}
+
+// openTestAuditLog opens an audit log in a temporary directory.
+func openTestAuditLog(t *testing.T) (*AuditLog, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := OpenAuditLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	return audit, path
+}
+
+// auditRecords reads the audit log at path.
+func auditRecords(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []AuditRecord
+	if err := readAuditLog(f, func(r AuditRecord) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// approvalEnv runs an agent with ask_human in one session.
+type approvalEnv struct {
+	t         *testing.T
+	ask       *askHuman
+	model     *scriptedModel
+	sessions  session.Service
+	runner    *runner.Runner
+	sessionID string
+	auditPath string
+}
+
+// newApprovalEnv creates a session in sessions, or in a new in-memory
+// service if it is nil, and an agent that asks on channel, which may be
+// nil. before runs ahead of resumeApprovals.
+func newApprovalEnv(t *testing.T, channel HumanChannel, policy AnswerPolicy, sessions session.Service, before ...llmagent.BeforeModelCallback) *approvalEnv {
+	t.Helper()
+	if sessions == nil {
+		sessions = session.InMemoryService()
+	}
+	audit, auditPath := openTestAuditLog(t)
+	e := &approvalEnv{
+		t:         t,
+		ask:       newAskHuman(channel, sessions, policy, audit),
+		model:     &scriptedModel{},
+		sessions:  sessions,
+		auditPath: auditPath,
+	}
+	t.Cleanup(e.ask.Close)
+
+	askTool, err := functiontool.New(functiontool.Config{Name: askHumanToolName, Description: "Asks the user.", IsLongRunning: true}, e.ask.handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := llmagent.New(llmagent.Config{
+		Name:                 "careful_agent",
+		Model:                e.model,
+		Tools:                []tool.Tool{askTool},
+		BeforeModelCallbacks: append(before, e.ask.resumeApprovals),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.runner, err = runner.New(runner.Config{AppName: testApp, Agent: a, SessionService: sessions}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := sessions.Create(t.Context(), &session.CreateRequest{AppName: testApp, UserID: testUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.sessionID = created.Session.ID()
+	return e
+}
+
+// turn sends msg and runs the agent to the end of its turn.
+func (e *approvalEnv) turn(msg *genai.Content) {
+	e.t.Helper()
+	for _, err := range e.runner.Run(e.t.Context(), testUser, e.sessionID, msg, agent.RunConfig{}) {
+		if err != nil {
+			e.t.Fatal(err)
+		}
+	}
+}
+
+func (e *approvalEnv) say(s string) {
+	e.t.Helper()
+	e.turn(genai.NewContentFromText(s, genai.RoleUser))
+}
+
+// approvals returns the approvals stored in the session.
+func (e *approvalEnv) approvals() []Approval {
+	e.t.Helper()
+	resp, err := e.sessions.Get(e.t.Context(), &session.GetRequest{AppName: testApp, UserID: testUser, SessionID: e.sessionID})
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	var all []Approval
+	for k, v := range resp.Session.State().All() {
+		if a, ok := decodeApproval(v); ok && strings.HasPrefix(k, approvalKeyPrefix) {
+			all = append(all, a)
+		}
+	}
+	return all
+}
+
+// approval returns the only approval in the session.
+func (e *approvalEnv) approval() Approval {
+	e.t.Helper()
+	all := e.approvals()
+	if len(all) != 1 {
+		e.t.Fatalf("got %d approvals, want 1: %+v", len(all), all)
+	}
+	return all[0]
+}
+
+// askColour is the model asking to pick red or blue, and then telling the
+// user so.
+func askColour() []*genai.Content {
+	return []*genai.Content{
+		callTool(askHumanToolName, map[string]any{"question": "Which colour?", "type": "single_choice", "choices": []any{"red", "blue"}}),
+		text("Red or blue?"),
+	}
+}
+
+func TestAskHumanResumesWithChatAnswer(t *testing.T) {
+	e := newApprovalEnv(t, nil, AnswerPolicy{}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+
+	a := e.approval()
+	if a.Status != statusPending || a.Question != "Which colour?" {
+		t.Fatalf("after asking: got %+v, want the question pending", a)
+	}
+	if got := e.model.lastResponse(askHumanToolName); got["status"] != statusPending || got["approval_id"] != a.ID {
+		t.Errorf("after asking: the model got %v, want the question pending", got)
+	}
+
+	e.say("blue")
+	if got := e.model.lastResponse(askHumanToolName); got["status"] != statusAnswered || got["answer"] != "blue" || got["outcome"] != "answered" {
+		t.Errorf("after answering: the model got %v, want the answer in place of the pending response", got)
+	}
+	a = e.approval()
+	if a.Status != statusAnswered || a.Value != "blue" || a.AnsweredBy != "chat:"+testUser {
+		t.Errorf("after answering: got %+v, want it answered in the chat", a)
+	}
+	if records := auditRecords(t, e.auditPath); len(records) != 1 {
+		t.Errorf("got %d audit records, want 1", len(records))
+	}
+}
+
+func TestAskHumanRejectsInvalidReply(t *testing.T) {
+	e := newApprovalEnv(t, nil, AnswerPolicy{}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+
+	e.say("green")
+	got := e.model.lastResponse(askHumanToolName)
+	if got["status"] != statusPending || !strings.Contains(got["error"].(string), `"green" is not a valid answer`) {
+		t.Errorf("the model got %v, want the reply rejected", got)
+	}
+	if a := e.approval(); a.Status != statusPending || a.Rejected == "" {
+		t.Errorf("got %+v, want it still pending, with the reason", a)
+	}
+
+	// A choice can be picked by its number.
+	e.say("2")
+	if a := e.approval(); a.Status != statusAnswered || a.Value != "blue" || a.Rejected != "" {
+		t.Errorf("got %+v, want blue", a)
+	}
+}
+
+func TestAskHumanAnswerThroughAPI(t *testing.T) {
+	e := newApprovalEnv(t, nil, AnswerPolicy{}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+
+	resp := genai.NewPartFromFunctionResponse(askHumanToolName, map[string]any{"answer": "red"})
+	resp.FunctionResponse.ID = e.approval().ID
+	e.turn(&genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{resp}})
+	if a := e.approval(); a.Status != statusAnswered || a.Value != "red" || a.AnsweredBy != "api:"+testUser {
+		t.Errorf("got %+v, want red, answered through the API", a)
+	}
+}
+
+func TestAskHumanAnswerFromChannel(t *testing.T) {
+	channel := newFakeChannel(HumanAnswer{Answer: "red", By: "fake:alice", Outcome: "answered"})
+	e := newApprovalEnv(t, channel, AnswerPolicy{}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+
+	q := <-channel.asked
+	if q.Kind != KindQuestion || q.Text != "Which colour?" || q.SessionID != e.sessionID || len(q.Choices) != 2 {
+		t.Errorf("the channel was asked %+v", q)
+	}
+	e.ask.wg.Wait()
+	if a := e.approval(); a.Status != statusAnswered || a.Value != "red" || a.AnsweredBy != "fake:alice" {
+		t.Fatalf("got %+v, want it answered on the channel", a)
+	}
+
+	// The next message resumes with the answer, and isn't taken for one.
+	e.say("blue")
+	if got := e.model.lastResponse(askHumanToolName); got["answer"] != "red" {
+		t.Errorf("the model got %v, want the channel's answer", got)
+	}
+	if a := e.approval(); a.Value != "red" {
+		t.Errorf("got %+v, want the channel's answer kept", a)
+	}
+	if records := auditRecords(t, e.auditPath); len(records) != 1 {
+		t.Errorf("got %d audit records, want 1", len(records))
+	}
+	if len(channel.asked) != 0 {
+		t.Errorf("the question was asked again")
+	}
+}
+
+func TestAskHumanChatAnswerStopsChannel(t *testing.T) {
+	channel := newFakeChannel(HumanAnswer{Answer: "red", By: "fake:alice"})
+	channel.release = make(chan struct{})
+	e := newApprovalEnv(t, channel, AnswerPolicy{}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+	<-channel.asked
+
+	e.say("blue")
+	<-channel.gaveUp
+	e.ask.wg.Wait()
+	if a := e.approval(); a.Value != "blue" || a.AnsweredBy != "chat:"+testUser {
+		t.Errorf("got %+v, want the chat's answer", a)
+	}
+}
+
+func TestAskHumanChannelAnswerWinsOverStaleChat(t *testing.T) {
+	// The channel answers after the second turn has read the session, but
+	// before it looks at the reply. The reply must not count as well.
+	channel := newFakeChannel(HumanAnswer{Answer: "red", By: "fake:alice", Outcome: "answered"})
+	channel.release = make(chan struct{})
+	var e *approvalEnv
+	answerOnChannel := func(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+		if ctx.UserContent() != nil && ctx.UserContent().Parts[0].Text == "blue" {
+			close(channel.release)
+			e.ask.wg.Wait()
+		}
+		return nil, nil
+	}
+	e = newApprovalEnv(t, channel, AnswerPolicy{}, nil, answerOnChannel)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+	<-channel.asked
+
+	e.say("blue")
+	if a := e.approval(); a.Value != "red" || a.AnsweredBy != "fake:alice" {
+		t.Errorf("got %+v, want only the channel's answer", a)
+	}
+	if records := auditRecords(t, e.auditPath); len(records) != 1 {
+		t.Errorf("got %d audit records, want 1", len(records))
+	}
+}
+
+func TestAskHumanResendsPendingAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	sessions, err := NewFileSessionService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nobody answers before the program stops.
+	silent := newFakeChannel(HumanAnswer{})
+	silent.release = make(chan struct{})
+	e := newApprovalEnv(t, silent, AnswerPolicy{}, sessions)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+	first := <-silent.asked
+	e.ask.Close()
+
+	sessions, err = NewFileSessionService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, _ := openTestAuditLog(t)
+	channel := newFakeChannel(HumanAnswer{Answer: "blue", By: "fake:alice", Outcome: "answered"})
+	ask := newAskHuman(channel, sessions, AnswerPolicy{}, audit)
+	defer ask.Close()
+	if err := ask.resendPending(t.Context(), testApp); err != nil {
+		t.Fatal(err)
+	}
+	q := <-channel.asked
+	if q.ID != first.ID || !q.AskedAt.Equal(first.AskedAt) || q.SessionID != e.sessionID {
+		t.Errorf("asked %+v again, want %+v", q, first)
+	}
+	ask.wg.Wait()
+
+	e.sessions = sessions
+	if a := e.approval(); a.Status != statusAnswered || a.Value != "blue" {
+		t.Errorf("got %+v, want the answer given after the restart", a)
+	}
+}
+
+func TestAskHumanDefaultsAfterDeadline(t *testing.T) {
+	e := newApprovalEnv(t, nil, AnswerPolicy{Deadline: time.Millisecond, DefaultAnswer: "red"}, nil)
+	e.model.script(askColour()...)
+	e.say("Paint the shed.")
+	time.Sleep(5 * time.Millisecond)
+
+	// The late reply is not taken for the answer.
+	e.say("blue")
+	a := e.approval()
+	if a.Status != statusAnswered || a.Value != "red" || a.AnsweredBy != "policy" || !strings.HasPrefix(a.Outcome, "timed out after 1ms") {
+		t.Errorf("got %+v, want the default answer", a)
+	}
+	if got := e.model.lastResponse(askHumanToolName); got["outcome"] != a.Outcome {
+		t.Errorf("the model got %v, want the outcome %q", got, a.Outcome)
+	}
+}
@@ -0,0 +1,441 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// auditKeyPrefix prefixes the state key under which each AuditRecord is
+// also kept in the session, followed by the function call ID.
+const auditKeyPrefix = "audit:"
+
+// AuditEntry is the record of one question a human was asked and how it
+// was answered.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	AppName   string    `json:"app_name"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	CallID    string    `json:"call_id"`
+	Question  string    `json:"question"`
+	AskedAt   time.Time `json:"asked_at"`
+
+	// The proposed action, for KindConfirm.
+	Tool string         `json:"tool,omitempty"`
+	Risk Risk           `json:"risk,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+
+	// AnsweredBy says who answered and how, such as "terminal:alice" or
+	// "policy" for a default.
+	AnsweredBy string    `json:"answered_by"`
+	AnsweredAt time.Time `json:"answered_at"`
+	Approved   *bool     `json:"approved,omitempty"`
+	Answer     any       `json:"answer,omitempty"`
+	Outcome    string    `json:"outcome"`
+}
+
+// AuditRecord is a line of the audit log. Hash covers Seq, PrevHash and
+// the Entry exactly as written, so changing, removing or reordering a line
+// breaks the chain. Signature, if the log has a key, is an HMAC of Hash,
+// so the chain can't simply be recomputed by whoever edits the file.
+type AuditRecord struct {
+	Seq       int64           `json:"seq"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+	Signature string          `json:"signature,omitempty"`
+	Entry     json.RawMessage `json:"entry"`
+}
+
+func recordHash(seq int64, prevHash string, entry []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", seq, prevHash)
+	h.Write(entry)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func signHash(key []byte, hash string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(hash))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// auditHead is the sequence number and hash of the last record, kept in
+// a file of its own next to the log and rewritten after each append. The
+// chain shows a record changed or dropped from the middle, but not records
+// cut from the end; a log that no longer reaches its head has lost them.
+type auditHead struct {
+	Seq       int64  `json:"seq"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// auditHeadPath is where the head of the log at path is kept.
+func auditHeadPath(path string) string {
+	return path + ".head"
+}
+
+func signHead(key []byte, seq int64, hash string) string {
+	return signHash(key, fmt.Sprintf("head %d %s", seq, hash))
+}
+
+// readAuditHead reads the head of the log at path, or returns nil if there
+// is none.
+func readAuditHead(path string) (*auditHead, error) {
+	b, err := os.ReadFile(auditHeadPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var h auditHead
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", auditHeadPath(path), err)
+	}
+	return &h, nil
+}
+
+// writeAuditHead replaces the head of the log at path.
+func writeAuditHead(path string, h auditHead) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	tmp := auditHeadPath(path) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, auditHeadPath(path))
+}
+
+// checkAuditHead checks that a log whose last record is last, and whose
+// record at the head's sequence number has hashAtHead, still reaches its
+// head h. The log may run past its head by a record whose head was not
+// written before a crash.
+func checkAuditHead(h *auditHead, last int64, hashAtHead string) error {
+	switch {
+	case h == nil && last > 0:
+		return errors.New("its head is missing, so records cut from the end would not show")
+	case h == nil:
+		return nil
+	case last < h.Seq:
+		return fmt.Errorf("it ends at record %d, but its head is record %d; records were cut from the end", last, h.Seq)
+	case hashAtHead != h.Hash:
+		return fmt.Errorf("record %d does not match the head", h.Seq)
+	}
+	return nil
+}
+
+// AuditLog appends AuditEntries to a hash-chained JSON lines file. The
+// file is only ever appended to, and each entry is synced before Append
+// returns.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	key  []byte
+	seq  int64
+	last string
+}
+
+// OpenAuditLog opens or creates the log at path. key, if not empty, signs
+// each new entry. It refuses a log that no longer reaches its head, rather
+// than carry on the chain from a log cut short.
+func OpenAuditLog(path string, key []byte) (*AuditLog, error) {
+	head, err := readAuditHead(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	l := &AuditLog{path: path, f: f, key: key}
+	// Carry on the chain from the last record. The chain is not checked
+	// here; that is what "audit verify" is for.
+	var hashAtHead string
+	err = readAuditLog(f, func(r AuditRecord) error {
+		l.seq, l.last = r.Seq, r.Hash
+		if head != nil && r.Seq == head.Seq {
+			hashAtHead = r.Hash
+		}
+		return nil
+	})
+	if err == nil {
+		err = checkAuditHead(head, l.seq, hashAtHead)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading audit log %s: %w", path, err)
+	}
+	// A last line that lost only its newline would run into the next one.
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, fi.Size()-1); err == nil && b[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("writing audit log: %w", err)
+			}
+		}
+	}
+	return l, nil
+}
+
+// Append adds e to the log and returns its record.
+func (l *AuditLog) Append(e AuditEntry) (AuditRecord, error) {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := AuditRecord{Seq: l.seq + 1, PrevHash: l.last, Entry: entry}
+	r.Hash = recordHash(r.Seq, r.PrevHash, entry)
+	if len(l.key) > 0 {
+		r.Signature = signHash(l.key, r.Hash)
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return AuditRecord{}, fmt.Errorf("writing audit log: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return AuditRecord{}, fmt.Errorf("writing audit log: %w", err)
+	}
+	l.seq, l.last = r.Seq, r.Hash
+	// The record is already in the log, so a head that can't be written
+	// only lags behind it, which verification allows for.
+	h := auditHead{Seq: r.Seq, Hash: r.Hash}
+	if len(l.key) > 0 {
+		h.Signature = signHead(l.key, h.Seq, h.Hash)
+	}
+	if err := writeAuditHead(l.path, h); err != nil {
+		log.Printf("Audit log %s: writing its head: %v", l.path, err)
+	}
+	return r, nil
+}
+
+func (l *AuditLog) Close() error {
+	return l.f.Close()
+}
+
+// readAuditLog calls fn with each record in r. Unlike the session journal,
+// a torn last line is an error: an audit log is not repaired silently.
+func readAuditLog(r io.Reader, fn func(AuditRecord) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if jerr := json.Unmarshal(line, &rec); jerr != nil {
+			return fmt.Errorf("line %d: %w", n, jerr)
+		}
+		if ferr := fn(rec); ferr != nil {
+			return ferr
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// AuditCheck is what VerifyAuditLog found.
+type AuditCheck struct {
+	Records int // records checked
+	Signed  int // records that carry a signature, checked or not
+}
+
+// VerifyAuditLog checks the chain in the log at path, that the log still
+// reaches its head, and the signatures if key is not empty.
+func VerifyAuditLog(path string, key []byte) (AuditCheck, error) {
+	var c AuditCheck
+	head, err := readAuditHead(path)
+	if err != nil {
+		return c, err
+	}
+	if head != nil && len(key) > 0 && !hmac.Equal([]byte(head.Signature), []byte(signHead(key, head.Seq, head.Hash))) {
+		return c, errors.New("the head has a missing or invalid signature")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	var prev, hashAtHead string
+	err = readAuditLog(f, func(r AuditRecord) error {
+		c.Records++
+		n := c.Records
+		switch {
+		case r.Seq != int64(n):
+			return fmt.Errorf("record %d has sequence number %d; records are missing or out of order", n, r.Seq)
+		case r.PrevHash != prev:
+			return fmt.Errorf("record %d does not follow the one before it", n)
+		case r.Hash != recordHash(r.Seq, r.PrevHash, r.Entry):
+			return fmt.Errorf("record %d has been changed: its hash does not match", n)
+		case len(key) > 0 && !hmac.Equal([]byte(r.Signature), []byte(signHash(key, r.Hash))):
+			return fmt.Errorf("record %d has a missing or invalid signature", n)
+		}
+		if r.Signature != "" {
+			c.Signed++
+		}
+		if head != nil && r.Seq == head.Seq {
+			hashAtHead = r.Hash
+		}
+		prev = r.Hash
+		return nil
+	})
+	if err != nil {
+		return c, err
+	}
+	return c, checkAuditHead(head, int64(c.Records), hashAtHead)
+}
+
+// runAuditCommand runs "audit verify" or "audit export".
+func runAuditCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "verify" && args[0] != "export") {
+		return errors.New("usage: audit verify|export [-file path] [-format jsonl|csv]")
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet("audit "+cmd, flag.ContinueOnError)
+	path := fs.String("file", auditLogPath(), "the audit log")
+	format := fs.String("format", "jsonl", "export format: jsonl or csv")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	key := []byte(os.Getenv("AUDIT_KEY"))
+
+	c, err := VerifyAuditLog(*path, key)
+	if err != nil {
+		return fmt.Errorf("%s: verification failed: %w", *path, err)
+	}
+	if cmd == "verify" {
+		// Without a key, whoever can write the log can recompute the
+		// chain and the head, so say so rather than just "intact".
+		var signed string
+		switch {
+		case len(key) > 0:
+			signed = "signatures valid"
+		case c.Signed > 0:
+			signed = "SIGNATURES NOT CHECKED: set AUDIT_KEY to check them"
+		default:
+			signed = "UNSIGNED: anyone who can write the log could have rewritten it; set AUDIT_KEY when writing it"
+		}
+		fmt.Fprintf(out, "%s: %d records, chain intact, %s\n", *path, c.Records, signed)
+		return nil
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch *format {
+	case "jsonl":
+		enc := json.NewEncoder(out)
+		return readAuditLog(f, func(r AuditRecord) error {
+			var e AuditEntry
+			if err := json.Unmarshal(r.Entry, &e); err != nil {
+				return err
+			}
+			return enc.Encode(struct {
+				Seq int64 `json:"seq"`
+				AuditEntry
+				Hash string `json:"hash"`
+			}{r.Seq, e, r.Hash})
+		})
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"seq", "time", "kind", "app_name", "user_id", "session_id", "call_id", "question", "asked_at",
+			"tool", "risk", "args", "answered_by", "answered_at", "approved", "answer", "outcome", "hash"})
+		err := readAuditLog(f, func(r AuditRecord) error {
+			var e AuditEntry
+			if err := json.Unmarshal(r.Entry, &e); err != nil {
+				return err
+			}
+			args, answer := "", ""
+			if e.Args != nil {
+				b, _ := json.Marshal(e.Args)
+				args = string(b)
+			}
+			if s, ok := e.Answer.(string); ok {
+				answer = s
+			} else if e.Answer != nil {
+				b, _ := json.Marshal(e.Answer)
+				answer = string(b)
+			}
+			approved := ""
+			if e.Approved != nil {
+				approved = strconv.FormatBool(*e.Approved)
+			}
+			return w.Write([]string{strconv.FormatInt(r.Seq, 10), e.Time.Format(time.RFC3339Nano), e.Kind, e.AppName, e.UserID, e.SessionID, e.CallID,
+				e.Question, e.AskedAt.Format(time.RFC3339Nano), e.Tool, string(e.Risk), args, e.AnsweredBy,
+				e.AnsweredAt.Format(time.RFC3339Nano), approved, answer, e.Outcome, r.Hash})
+		})
+		if err != nil {
+			return err
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unknown export format %q; want jsonl or csv", *format)
+	}
+}
+
+// auditLogPath is $AUDIT_LOG, or audit.jsonl.
+func auditLogPath() string {
+	if p := os.Getenv("AUDIT_LOG"); p != "" {
+		return p
+	}
+	return "audit.jsonl"
+}
@@ -0,0 +1,377 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAuditKey = []byte("audit-secret")
+
+// testAuditEntries are entries of every kind, with text that needs quoting
+// in CSV.
+func testAuditEntries() []AuditEntry {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	return []AuditEntry{
+		{
+			Time: at, Kind: KindConfirm, AppName: testApp, UserID: testUser, SessionID: "s1", CallID: "c1",
+			Question: "Allow delete_files?", AskedAt: at.Add(-time.Minute),
+			Tool: "delete_files", Risk: RiskHigh, Args: map[string]any{"paths": []any{"a.txt", "b, c.txt"}},
+			AnsweredBy: "terminal:alice", AnsweredAt: at, Approved: &yes, Outcome: "answered",
+		},
+		{
+			Time: at.Add(time.Second), Kind: KindQuestion, AppName: testApp, UserID: testUser, SessionID: "s1", CallID: "c2",
+			Question: "Which \"big\" one,\nthe first?", AskedAt: at,
+			AnsweredBy: "chat:user", AnsweredAt: at.Add(time.Second), Answer: "the second", Outcome: "answered",
+		},
+		{
+			Time: at.Add(2 * time.Second), Kind: KindQuestion, AppName: testApp, UserID: testUser, SessionID: "s2", CallID: "c3",
+			Question: "Which colours?", AskedAt: at,
+			AnsweredBy: "api:user", AnsweredAt: at.Add(2 * time.Second), Answer: []any{"red", "blue"}, Outcome: "answered",
+		},
+		{
+			Time: at.Add(3 * time.Second), Kind: KindConfirm, AppName: testApp, UserID: testUser, SessionID: "s2", CallID: "c4",
+			Question: "Allow launch?", AskedAt: at, Tool: "launch", Risk: RiskHigh,
+			AnsweredBy: "policy", AnsweredAt: at.Add(3 * time.Second), Approved: &no, Outcome: "timed out after 1m0s, defaulted to deny",
+		},
+	}
+}
+
+// writeTestAuditLog writes testAuditEntries to a new log and returns its
+// path.
+func writeTestAuditLog(t *testing.T, key []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := OpenAuditLog(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range testAuditEntries() {
+		if _, err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// editLines rewrites the lines of the file at path.
+func editLines(t *testing.T, path string, edit func([]string) []string) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"))
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		out += "\n"
+	}
+	if err := os.WriteFile(path, []byte(out), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rechain recomputes every hash in the log at path, and its head, as
+// someone without the key could.
+func rechain(t *testing.T, path string) {
+	t.Helper()
+	var prev string
+	editLines(t, path, func(lines []string) []string {
+		for i, line := range lines {
+			var r AuditRecord
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatal(err)
+			}
+			r.Seq, r.PrevHash = int64(i+1), prev
+			r.Hash = recordHash(r.Seq, r.PrevHash, r.Entry)
+			b, _ := json.Marshal(r)
+			lines[i], prev = string(b), r.Hash
+		}
+		if err := writeAuditHead(path, auditHead{Seq: int64(len(lines)), Hash: prev}); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	})
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	path := writeTestAuditLog(t, testAuditKey)
+	c, err := VerifyAuditLog(path, testAuditKey)
+	if err != nil || c != (AuditCheck{Records: 4, Signed: 4}) {
+		t.Errorf("got %+v, %v; want 4 signed records", c, err)
+	}
+	c, err = VerifyAuditLog(writeTestAuditLog(t, nil), nil)
+	if err != nil || c != (AuditCheck{Records: 4}) {
+		t.Errorf("unsigned: got %+v, %v; want 4 unsigned records", c, err)
+	}
+
+	// A crash after a record is written but before the head is leaves the
+	// log one record past its head.
+	records := auditRecords(t, path)
+	if err := writeAuditHead(path, auditHead{Seq: 3, Hash: records[2].Hash, Signature: signHead(testAuditKey, 3, records[2].Hash)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(path, testAuditKey); err != nil {
+		t.Errorf("head one record behind: %v", err)
+	}
+}
+
+func TestVerifyAuditLogTampered(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		key    []byte
+		tamper func(t *testing.T, path string)
+		want   string
+	}{
+		{"edited", nil, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "the second", "the first", 1)
+				return lines
+			})
+		}, "record 2 has been changed: its hash does not match"},
+		{"reordered", nil, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			})
+		}, "record 2 has sequence number 3; records are missing or out of order"},
+		{"deleted", nil, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			})
+		}, "record 2 has sequence number 3"},
+		{"relinked", nil, func(t *testing.T, path string) {
+			// Renumbered after a deletion, but still pointing at the
+			// deleted record.
+			editLines(t, path, func(lines []string) []string {
+				var r AuditRecord
+				json.Unmarshal([]byte(lines[2]), &r)
+				r.Seq = 2
+				b, _ := json.Marshal(r)
+				return []string{lines[0], string(b)}
+			})
+		}, "record 2 does not follow the one before it"},
+		{"truncated", nil, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string { return lines[:3] })
+		}, "it ends at record 3, but its head is record 4; records were cut from the end"},
+		{"emptied", nil, func(t *testing.T, path string) {
+			editLines(t, path, func([]string) []string { return nil })
+		}, "it ends at record 0, but its head is record 4"},
+		{"torn", nil, func(t *testing.T, path string) {
+			b, _ := os.ReadFile(path)
+			os.WriteFile(path, b[:len(b)-10], 0o600)
+		}, "line 4"},
+		{"head deleted", nil, func(t *testing.T, path string) {
+			os.Remove(auditHeadPath(path))
+		}, "its head is missing"},
+		{"last record rehashed", nil, func(t *testing.T, path string) {
+			// Nothing follows the last record to break the chain.
+			editLines(t, path, func(lines []string) []string {
+				var r AuditRecord
+				json.Unmarshal([]byte(lines[3]), &r)
+				r.Entry = json.RawMessage(strings.Replace(string(r.Entry), "defaulted to deny", "defaulted to allow", 1))
+				r.Hash = recordHash(r.Seq, r.PrevHash, r.Entry)
+				b, _ := json.Marshal(r)
+				lines[3] = string(b)
+				return lines
+			})
+		}, "record 4 does not match the head"},
+		{"rechained without the key", testAuditKey, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "the second", "the first", 1)
+				return lines
+			})
+			rechain(t, path)
+		}, "the head has a missing or invalid signature"},
+		{"record rechained without the key", testAuditKey, func(t *testing.T, path string) {
+			editLines(t, path, func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "the second", "the first", 1)
+				return lines
+			})
+			h, _ := readAuditHead(path)
+			rechain(t, path)
+			// Even with the old, signed head back in place.
+			writeAuditHead(path, *h)
+		}, "record 2 has a missing or invalid signature"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, tc.key)
+			tc.tamper(t, path)
+			_, err := VerifyAuditLog(path, tc.key)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOpenAuditLogRefusesTruncatedLog(t *testing.T) {
+	path := writeTestAuditLog(t, nil)
+	editLines(t, path, func(lines []string) []string { return lines[:2] })
+	if l, err := OpenAuditLog(path, nil); err == nil || !strings.Contains(err.Error(), "records were cut from the end") {
+		if l != nil {
+			l.Close()
+		}
+		t.Fatalf("got %v, want the log refused", err)
+	}
+
+	// The log carries on from where it was.
+	path = writeTestAuditLog(t, nil)
+	l, err := OpenAuditLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	r, err := l.Append(testAuditEntries()[0])
+	if err != nil || r.Seq != 5 {
+		t.Fatalf("got record %d, %v; want record 5", r.Seq, err)
+	}
+	if _, err := VerifyAuditLog(path, nil); err != nil {
+		t.Errorf("after reopening: %v", err)
+	}
+}
+
+func TestAuditVerifyCommand(t *testing.T) {
+	signed := writeTestAuditLog(t, testAuditKey)
+	for _, tc := range []struct {
+		name, path, key, want string
+	}{
+		{"signed", signed, string(testAuditKey), "4 records, chain intact, signatures valid"},
+		{"signed without key", signed, "", "SIGNATURES NOT CHECKED: set AUDIT_KEY"},
+		{"unsigned", writeTestAuditLog(t, nil), "", "UNSIGNED: anyone who can write the log could have rewritten it"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AUDIT_KEY", tc.key)
+			var out bytes.Buffer
+			if err := runAuditCommand([]string{"verify", "-file", tc.path}, &out); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("got %q, want it to contain %q", out.String(), tc.want)
+			}
+		})
+	}
+
+	t.Setenv("AUDIT_KEY", "wrong")
+	if err := runAuditCommand([]string{"verify", "-file", signed}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Errorf("wrong key: got %v", err)
+	}
+	for _, args := range [][]string{nil, {"repair"}, {"export", "-file", signed, "-format", "xml"}} {
+		if err := runAuditCommand(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("audit %v: got no error", args)
+		}
+	}
+}
+
+func TestAuditExportJSONL(t *testing.T) {
+	path := writeTestAuditLog(t, nil)
+	var out bytes.Buffer
+	if err := runAuditCommand([]string{"export", "-file", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	records := auditRecords(t, path)
+	var got []AuditEntry
+	sc := bufio.NewScanner(&out)
+	for i := 0; sc.Scan(); i++ {
+		var line struct {
+			Seq int64 `json:"seq"`
+			AuditEntry
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if line.Seq != records[i].Seq || line.Hash != records[i].Hash {
+			t.Errorf("line %d: got seq %d, hash %s; want record %d", i+1, line.Seq, line.Hash, records[i].Seq)
+		}
+		got = append(got, line.AuditEntry)
+	}
+	if want := testAuditEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAuditExportCSV(t *testing.T) {
+	path := writeTestAuditLog(t, nil)
+	var out bytes.Buffer
+	if err := runAuditCommand([]string{"export", "-file", path, "-format", "csv"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := rows[0]
+	records := auditRecords(t, path)
+	var got []AuditEntry
+	for i, row := range rows[1:] {
+		col := make(map[string]string)
+		for j, name := range header {
+			col[name] = row[j]
+		}
+		if col["seq"] != strconv.FormatInt(records[i].Seq, 10) || col["hash"] != records[i].Hash {
+			t.Errorf("row %d: got seq %s, hash %s; want record %d", i+1, col["seq"], col["hash"], records[i].Seq)
+		}
+		parseTime := func(s string) time.Time {
+			v, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+		e := AuditEntry{
+			Time: parseTime(col["time"]), Kind: col["kind"], AppName: col["app_name"], UserID: col["user_id"],
+			SessionID: col["session_id"], CallID: col["call_id"], Question: col["question"], AskedAt: parseTime(col["asked_at"]),
+			Tool: col["tool"], Risk: Risk(col["risk"]), AnsweredBy: col["answered_by"], AnsweredAt: parseTime(col["answered_at"]),
+			Outcome: col["outcome"],
+		}
+		if s := col["args"]; s != "" {
+			if err := json.Unmarshal([]byte(s), &e.Args); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s := col["approved"]; s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.Approved = &b
+		}
+		// A string answer is written as is, anything else as JSON.
+		if s := col["answer"]; s != "" {
+			if err := json.Unmarshal([]byte(s), &e.Answer); err != nil {
+				e.Answer = s
+			}
+		}
+		got = append(got, e)
+	}
+	if want := testAuditEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries\n%+v\nwant\n%+v", got, want)
+	}
+}
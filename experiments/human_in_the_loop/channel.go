@@ -0,0 +1,221 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of HumanQuestion.
+const (
+	// KindConfirm asks to approve or deny a held tool call.
+	KindConfirm = "confirm"
+	// KindQuestion is a question from ask_human, answered with text that
+	// its AnswerSpec accepts.
+	KindQuestion = "question"
+)
+
+// HumanQuestion is something the agent needs a human to answer.
+type HumanQuestion struct {
+	// ID is the ID of the function call that asked.
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	AppName   string    `json:"app_name"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	Text      string    `json:"text"`
+	AskedAt   time.Time `json:"asked_at"`
+	// Escalated marks a question passed on to the secondary approver
+	// because the first did not answer in time.
+	Escalated bool `json:"escalated,omitempty"`
+	// Reminders counts the reminders sent so far.
+	Reminders int `json:"reminders,omitempty"`
+
+	// The held call, for KindConfirm.
+	Tool string         `json:"tool,omitempty"`
+	Risk Risk           `json:"risk,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+
+	// The answer wanted, for KindQuestion.
+	AnswerSpec
+}
+
+// HumanAnswer is a human's answer to a HumanQuestion.
+type HumanAnswer struct {
+	// Approved is the decision on a KindConfirm question.
+	Approved bool `json:"approved,omitempty"`
+	// Answer is the answer to a KindQuestion, or the reason for a decision.
+	Answer string `json:"answer,omitempty"`
+	// By says who answered. Channels prefix it with how they were reached,
+	// as in "http:alice"; a name sent over HTTP is only as trustworthy as
+	// the token that came with it.
+	By string `json:"by,omitempty"`
+	// Outcome says how the answer came about, such as "timed out after
+	// 10m0s, defaulted to deny". Only deadlineChannel sets it.
+	Outcome string `json:"-"`
+	// Defaulted is true when nobody answered and the policy's default
+	// was used.
+	Defaulted bool `json:"-"`
+}
+
+// HumanChannel is a way to reach a human. Ask delivers q and blocks until
+// the human answers or ctx is done.
+//
+// The channel is picked with $HUMAN_CHANNEL, and the secondary approver's
+// with $ESCALATION_CHANNEL:
+//
+//	terminal  the terminal the agent runs in (the default)
+//	http      the human sublauncher's endpoints, by polling or SSE
+//	webhook   a POST to a URL, answered by a POST to a callback URL
+type HumanChannel interface {
+	Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error)
+}
+
+// reminder is implemented by channels that can remind a human of a
+// question they are still being asked.
+type reminder interface {
+	Remind(ctx context.Context, q HumanQuestion) error
+}
+
+// newHumanChannel returns the channel named kind. The http and webhook
+// channels need the web server, and web must be one of its sublaunchers.
+// webhookURL is used by the webhook channel.
+func newHumanChannel(kind, webhookURL string, web *humanLauncher) (HumanChannel, error) {
+	switch kind {
+	case "", "terminal":
+		return newTerminalChannel(), nil
+	case "http":
+		return web, nil
+	case "webhook":
+		return newWebhookChannel(webhookURL, web)
+	default:
+		return nil, fmt.Errorf("unknown human channel %q; want terminal, http or webhook", kind)
+	}
+}
+
+// terminalChannel asks on the terminal, one question at a time.
+type terminalChannel struct {
+	mu  sync.Mutex
+	in  *bufio.Reader
+	out io.Writer
+	// read carries the result of a read from in. Reads can't be
+	// interrupted, so a read that outlives its question is kept for the
+	// next one, unless a line has arrived by then.
+	read chan readResult
+	// by is who answers on this terminal.
+	by string
+}
+
+type readResult struct {
+	line string
+	err  error
+}
+
+func newTerminalChannel() *terminalChannel {
+	by := "terminal"
+	if u, err := user.Current(); err == nil {
+		by += ":" + u.Username
+	}
+	return &terminalChannel{in: bufio.NewReader(os.Stdin), out: os.Stdout, by: by}
+}
+
+func (c *terminalChannel) Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return HumanAnswer{}, err
+	}
+	if c.read != nil {
+		// Drop a line typed after its question was given up on.
+		select {
+		case <-c.read:
+			c.read = nil
+		default:
+		}
+	}
+
+	if q.Kind == KindConfirm {
+		args, _ := json.Marshal(q.Args)
+		fmt.Fprintf(c.out, "\n[CONFIRM] %s wants to run %s %s (risk %q).\nAllow? [y/N] > ", q.UserID, q.Tool, args, q.Risk)
+	} else {
+		fmt.Fprintf(c.out, "\n[AGENT ASKS]: %s\n", q.Text)
+		if hint := q.Hint(); hint != "" {
+			fmt.Fprintf(c.out, "[ANSWER WITH] %s\n", hint)
+		}
+		fmt.Fprint(c.out, "[YOU ANSWER] > ")
+	}
+	// Ask again until the answer is one the question accepts.
+	for {
+		line, err := c.readLine(ctx)
+		if err != nil {
+			return HumanAnswer{}, err
+		}
+		if q.Kind != KindConfirm {
+			if _, err := q.Parse(line); err != nil {
+				fmt.Fprintf(c.out, "[INVALID] %v. Try again > ", err)
+				continue
+			}
+			return HumanAnswer{Answer: line, By: c.by}, nil
+		}
+		if line == "" {
+			return HumanAnswer{Answer: "denied on the terminal", By: c.by}, nil
+		}
+		approved, err := parseYesNo(line)
+		if err != nil {
+			fmt.Fprintf(c.out, "[INVALID] %v. Allow? [y/N] > ", err)
+			continue
+		}
+		if !approved {
+			return HumanAnswer{Answer: "denied on the terminal", By: c.by}, nil
+		}
+		return HumanAnswer{Approved: true, By: c.by}, nil
+	}
+}
+
+// readLine reads a line, or gives up when ctx is done.
+func (c *terminalChannel) readLine(ctx context.Context) (string, error) {
+	if c.read == nil {
+		c.read = make(chan readResult, 1)
+		go func(read chan<- readResult) {
+			line, err := c.in.ReadString('\n')
+			read <- readResult{line, err}
+		}(c.read)
+	}
+	select {
+	case r := <-c.read:
+		c.read = nil
+		if r.err != nil && r.line == "" {
+			return "", fmt.Errorf("reading answer: %w", r.err)
+		}
+		return strings.TrimSpace(r.line), nil
+	case <-ctx.Done():
+		fmt.Fprintln(c.out, "\n[NO LONGER WAITING] Press Enter to continue.")
+		return "", ctx.Err()
+	}
+}
+
+func (c *terminalChannel) Remind(ctx context.Context, q HumanQuestion) error {
+	fmt.Fprintf(c.out, "\n[REMINDER] Still waiting for your answer. > ")
+	return nil
+}
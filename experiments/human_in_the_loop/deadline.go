@@ -0,0 +1,158 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// deadlineChannel applies an AnswerPolicy to the questions asked on the
+// primary channel. While it waits it sends reminders, if the channel can;
+// after EscalateAfter it also asks the secondary approver, if there is
+// one, and takes whichever answer comes first; and at the Deadline it
+// gives up and returns the default answer.
+//
+// The answer's Outcome says which of these happened, so the gate and
+// ask_human can tell the model and record it in the session.
+type deadlineChannel struct {
+	primary   HumanChannel
+	secondary HumanChannel // may be nil
+	policy    AnswerPolicy
+}
+
+var _ HumanChannel = (*deadlineChannel)(nil)
+
+func newDeadlineChannel(primary, secondary HumanChannel, policy AnswerPolicy) *deadlineChannel {
+	return &deadlineChannel{primary: primary, secondary: secondary, policy: policy}
+}
+
+type channelResult struct {
+	answer    HumanAnswer
+	err       error
+	escalated bool
+}
+
+// Ask asks q. The deadline and escalation run from q.AskedAt, so a
+// question asked again after a restart keeps its original deadline.
+func (c *deadlineChannel) Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error) {
+	asked := q.AskedAt
+	if asked.IsZero() {
+		asked = time.Now()
+	}
+	if c.policy.Deadline > 0 && !time.Now().Before(asked.Add(c.policy.Deadline)) {
+		return c.defaultAnswer(q), nil
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	if c.policy.Deadline > 0 {
+		cancel()
+		waitCtx, cancel = context.WithDeadline(ctx, asked.Add(c.policy.Deadline))
+	}
+	// Stops whichever channel is still waiting once one answers.
+	defer cancel()
+
+	results := make(chan channelResult, 2)
+	ask := func(ch HumanChannel, q HumanQuestion) {
+		a, err := ch.Ask(waitCtx, q)
+		results <- channelResult{a, err, q.Escalated}
+	}
+	go ask(c.primary, q)
+	waiting := 1
+
+	var remind, escalate <-chan time.Time
+	if c.policy.RemindEvery > 0 {
+		t := time.NewTicker(c.policy.RemindEvery)
+		defer t.Stop()
+		remind = t.C
+	}
+	if c.secondary != nil && c.policy.EscalateAfter > 0 {
+		t := time.NewTimer(time.Until(asked.Add(c.policy.EscalateAfter)))
+		defer t.Stop()
+		escalate = t.C
+	}
+	escalated := q
+	escalated.ID += "-escalated"
+	escalated.Escalated = true
+
+	for {
+		select {
+		case r := <-results:
+			waiting--
+			if r.err == nil {
+				r.answer.Outcome = "answered"
+				if r.escalated {
+					r.answer.Outcome = "answered by the secondary approver"
+				}
+				return r.answer, nil
+			}
+			if waitCtx.Err() != nil {
+				continue // the select picks up waitCtx.Done
+			}
+			log.Printf("Asking about %s: %v", q.ID, r.err)
+			if waiting == 0 && escalate == nil {
+				return HumanAnswer{}, r.err
+			}
+		case <-remind:
+			q.Reminders++
+			escalated.Reminders++
+			c.remind(waitCtx, c.primary, q)
+			if escalate == nil && c.secondary != nil && c.policy.EscalateAfter > 0 {
+				c.remind(waitCtx, c.secondary, escalated)
+			}
+		case <-escalate:
+			escalate = nil
+			log.Printf("No answer about %s after %v; asking the secondary approver", q.ID, c.policy.EscalateAfter)
+			go ask(c.secondary, escalated)
+			waiting++
+		case <-waitCtx.Done():
+			if ctx.Err() != nil || !errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+				return HumanAnswer{}, ctx.Err()
+			}
+			return c.defaultAnswer(q), nil
+		}
+	}
+}
+
+func (c *deadlineChannel) remind(ctx context.Context, ch HumanChannel, q HumanQuestion) {
+	r, ok := ch.(reminder)
+	if !ok {
+		return
+	}
+	if err := r.Remind(ctx, q); err != nil {
+		log.Printf("Reminding about %s: %v", q.ID, err)
+	}
+}
+
+// defaultAnswer is the answer to q when nobody answered by the deadline.
+func (c *deadlineChannel) defaultAnswer(q HumanQuestion) HumanAnswer {
+	if q.Kind == KindConfirm {
+		return HumanAnswer{
+			Approved:  c.policy.DefaultConfirm == ActionAllow,
+			Answer:    "no one answered in time",
+			By:        "policy",
+			Defaulted: true,
+			Outcome:   fmt.Sprintf("timed out after %v, defaulted to %s", c.policy.Deadline, c.policy.DefaultConfirm),
+		}
+	}
+	return HumanAnswer{
+		Answer:    c.policy.DefaultAnswer,
+		By:        "policy",
+		Defaulted: true,
+		Outcome:   fmt.Sprintf("timed out after %v, defaulted to %q", c.policy.Deadline, c.policy.DefaultAnswer),
+	}
+}
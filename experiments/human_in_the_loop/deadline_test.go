@@ -0,0 +1,238 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// remindingChannel is a fakeChannel that can be reminded.
+type remindingChannel struct {
+	*fakeChannel
+	reminded chan HumanQuestion
+}
+
+func newRemindingChannel(answer HumanAnswer) *remindingChannel {
+	return &remindingChannel{fakeChannel: newFakeChannel(answer), reminded: make(chan HumanQuestion, 100)}
+}
+
+func (c *remindingChannel) Remind(ctx context.Context, q HumanQuestion) error {
+	c.reminded <- q
+	return nil
+}
+
+// silentChannel never answers.
+func silentChannel() *remindingChannel {
+	c := newRemindingChannel(HumanAnswer{})
+	c.release = make(chan struct{})
+	return c
+}
+
+func question(kind string) HumanQuestion {
+	return HumanQuestion{ID: "q1", Kind: kind, Text: "Sure?", AskedAt: time.Now()}
+}
+
+func TestDeadlineChannelAnswered(t *testing.T) {
+	primary := newRemindingChannel(HumanAnswer{Approved: true, By: "fake:alice"})
+	c := newDeadlineChannel(primary, nil, AnswerPolicy{Deadline: time.Minute, DefaultConfirm: ActionDeny})
+	a, err := c.Ask(t.Context(), question(KindConfirm))
+	if err != nil || !a.Approved || a.Defaulted || a.Outcome != "answered" || a.By != "fake:alice" {
+		t.Errorf("got %+v, %v; want the answer, with outcome \"answered\"", a, err)
+	}
+}
+
+func TestDeadlineChannelReminds(t *testing.T) {
+	primary := newRemindingChannel(HumanAnswer{Answer: "yes", By: "fake:alice"})
+	primary.release = make(chan struct{})
+	c := newDeadlineChannel(primary, nil, AnswerPolicy{Deadline: time.Minute, RemindEvery: 5 * time.Millisecond, DefaultConfirm: ActionDeny})
+
+	done := make(chan askResult, 1)
+	go func() {
+		a, err := c.Ask(t.Context(), question(KindQuestion))
+		done <- askResult{a, err}
+	}()
+	for want := 1; want <= 3; want++ {
+		if q := <-primary.reminded; q.ID != "q1" || q.Reminders != want {
+			t.Errorf("got reminder %+v, want reminder %d of q1", q, want)
+		}
+	}
+	close(primary.release)
+	if r := <-done; r.err != nil || r.answer.Answer != "yes" || r.answer.Outcome != "answered" {
+		t.Errorf("got %+v, want the answer after the reminders", r)
+	}
+}
+
+func TestDeadlineChannelEscalates(t *testing.T) {
+	policy := AnswerPolicy{Deadline: time.Minute, EscalateAfter: 10 * time.Millisecond, RemindEvery: 5 * time.Millisecond, DefaultConfirm: ActionDeny}
+
+	t.Run("secondary answers", func(t *testing.T) {
+		primary := silentChannel()
+		secondary := newRemindingChannel(HumanAnswer{Approved: true, By: "fake:bob"})
+		a, err := newDeadlineChannel(primary, secondary, policy).Ask(t.Context(), question(KindConfirm))
+		if err != nil || !a.Approved || a.By != "fake:bob" || a.Outcome != "answered by the secondary approver" {
+			t.Errorf("got %+v, %v; want the secondary's answer", a, err)
+		}
+		if q := <-secondary.asked; q.ID != "q1-escalated" || !q.Escalated {
+			t.Errorf("the secondary was asked %+v, want the escalated question", q)
+		}
+		// The primary is no longer asked.
+		if q := <-primary.gaveUp; q.ID != "q1" {
+			t.Errorf("the primary gave up on %+v", q)
+		}
+	})
+
+	t.Run("primary answers first", func(t *testing.T) {
+		primary := newRemindingChannel(HumanAnswer{Approved: false, Answer: "no", By: "fake:alice"})
+		primary.release = make(chan struct{})
+		secondary := silentChannel()
+		c := newDeadlineChannel(primary, secondary, policy)
+		done := make(chan askResult, 1)
+		go func() {
+			a, err := c.Ask(t.Context(), question(KindConfirm))
+			done <- askResult{a, err}
+		}()
+		<-secondary.asked
+		// Both are reminded once the question is escalated.
+		<-secondary.reminded
+		close(primary.release)
+		if r := <-done; r.err != nil || r.answer.Approved || r.answer.By != "fake:alice" || r.answer.Outcome != "answered" {
+			t.Errorf("got %+v, want the primary's answer", r)
+		}
+		<-secondary.gaveUp
+	})
+
+	t.Run("from when it was asked", func(t *testing.T) {
+		// Asked long enough ago, as after a restart, the question goes to
+		// both at once.
+		primary := silentChannel()
+		secondary := newRemindingChannel(HumanAnswer{Approved: true, By: "fake:bob"})
+		q := question(KindConfirm)
+		q.AskedAt = time.Now().Add(-30 * time.Second)
+		a, err := newDeadlineChannel(primary, secondary, AnswerPolicy{Deadline: time.Minute, EscalateAfter: 20 * time.Second, DefaultConfirm: ActionDeny}).Ask(t.Context(), q)
+		if err != nil || a.Outcome != "answered by the secondary approver" {
+			t.Errorf("got %+v, %v; want the secondary's answer", a, err)
+		}
+	})
+}
+
+func TestDeadlineChannelDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		kind     string
+		policy   AnswerPolicy
+		approved bool
+		answer   string
+		outcome  string
+	}{
+		{"deny", KindConfirm, AnswerPolicy{Deadline: 20 * time.Millisecond, DefaultConfirm: ActionDeny}, false, "no one answered in time", "timed out after 20ms, defaulted to deny"},
+		{"allow", KindConfirm, AnswerPolicy{Deadline: 20 * time.Millisecond, DefaultConfirm: ActionAllow}, true, "no one answered in time", "timed out after 20ms, defaulted to allow"},
+		{"question", KindQuestion, AnswerPolicy{Deadline: 20 * time.Millisecond, DefaultConfirm: ActionDeny, DefaultAnswer: "no"}, false, "no", `timed out after 20ms, defaulted to "no"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := silentChannel()
+			a, err := newDeadlineChannel(primary, nil, tc.policy).Ask(t.Context(), question(tc.kind))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := HumanAnswer{Approved: tc.approved, Answer: tc.answer, By: "policy", Defaulted: true, Outcome: tc.outcome}
+			if a != want {
+				t.Errorf("got %+v, want %+v", a, want)
+			}
+			<-primary.gaveUp
+		})
+	}
+
+	t.Run("already past", func(t *testing.T) {
+		primary := silentChannel()
+		q := question(KindConfirm)
+		q.AskedAt = time.Now().Add(-time.Hour)
+		a, err := newDeadlineChannel(primary, nil, AnswerPolicy{Deadline: time.Minute, DefaultConfirm: ActionDeny}).Ask(t.Context(), q)
+		if err != nil || !a.Defaulted || a.Outcome != "timed out after 1m0s, defaulted to deny" {
+			t.Errorf("got %+v, %v; want the default", a, err)
+		}
+		if len(primary.asked) != 0 {
+			t.Errorf("the question was asked, want it defaulted at once")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := newDeadlineChannel(silentChannel(), nil, AnswerPolicy{Deadline: time.Minute, DefaultConfirm: ActionAllow}).Ask(ctx, question(KindConfirm))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled rather than the default", err)
+		}
+	})
+}
+
+func TestDeadlineChannelFailures(t *testing.T) {
+	down := errors.New("channel down")
+	failing := func() *remindingChannel {
+		c := newRemindingChannel(HumanAnswer{})
+		c.err = down
+		return c
+	}
+	policy := AnswerPolicy{Deadline: time.Minute, EscalateAfter: 10 * time.Millisecond, DefaultConfirm: ActionAllow}
+
+	t.Run("no secondary", func(t *testing.T) {
+		_, err := newDeadlineChannel(failing(), nil, policy).Ask(t.Context(), question(KindConfirm))
+		if !errors.Is(err, down) {
+			t.Errorf("got %v, want the channel's error", err)
+		}
+	})
+
+	t.Run("both fail", func(t *testing.T) {
+		secondary := failing()
+		start := time.Now()
+		_, err := newDeadlineChannel(failing(), secondary, policy).Ask(t.Context(), question(KindConfirm))
+		if !errors.Is(err, down) {
+			t.Errorf("got %v, want the channels' error, not the default", err)
+		}
+		if len(secondary.asked) != 1 {
+			t.Errorf("the secondary was asked %d times, want 1", len(secondary.asked))
+		}
+		if d := time.Since(start); d > 30*time.Second {
+			t.Errorf("took %v, want no wait for the deadline", d)
+		}
+	})
+
+	t.Run("secondary answers", func(t *testing.T) {
+		secondary := newRemindingChannel(HumanAnswer{Approved: true, By: "fake:bob"})
+		a, err := newDeadlineChannel(failing(), secondary, policy).Ask(t.Context(), question(KindConfirm))
+		if err != nil || a.Outcome != "answered by the secondary approver" {
+			t.Errorf("got %+v, %v; want the secondary's answer", a, err)
+		}
+	})
+}
+
+func TestGateToldOfDefault(t *testing.T) {
+	// What the model is told when a held call runs out of time.
+	channel := newDeadlineChannel(silentChannel(), nil, AnswerPolicy{Deadline: 20 * time.Millisecond, DefaultConfirm: ActionDeny})
+	audit, _ := openTestAuditLog(t)
+	run := runGate(t, "delete_files", channel, audit)
+	want := "call to delete_files was not run: no one approved it; timed out after 20ms, defaulted to deny"
+	if run.ran != 0 || run.response["error"] != want {
+		t.Errorf("ran %d times, the model got %v; want {error: %q}", run.ran, run.response, want)
+	}
+
+	channel = newDeadlineChannel(silentChannel(), nil, AnswerPolicy{Deadline: 20 * time.Millisecond, DefaultConfirm: ActionAllow})
+	run = runGate(t, "delete_files", channel, audit)
+	if want := "timed out after 20ms, defaulted to allow"; run.ran != 1 || run.response["confirmation"] != want {
+		t.Errorf("ran %d times, the model got %v; want it run, with the confirmation %q", run.ran, run.response, want)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+
+	"google.golang.org/adk/session"
+)
+
+// Journal operations.
+const (
+	opCreate = "create"
+	opAppend = "append"
+	opDelete = "delete"
+)
+
+// journalEntry is one line of the session journal.
+type journalEntry struct {
+	Op        string         `json:"op"`
+	AppName   string         `json:"app_name"`
+	UserID    string         `json:"user_id"`
+	SessionID string         `json:"session_id"`
+	State     map[string]any `json:"state,omitempty"`
+	Event     *session.Event `json:"event,omitempty"`
+}
+
+// fileSessionService keeps sessions in memory and records every change in
+// an append-only JSON lines file. On startup the file is replayed, so
+// sessions, their events and their state (including pending approvals)
+// survive a restart.
+type fileSessionService struct {
+	session.Service // the in-memory service holding the live sessions
+
+	mu      sync.Mutex
+	journal *os.File
+}
+
+// NewFileSessionService returns a session.Service persisted to path,
+// loading any sessions already recorded there.
+func NewFileSessionService(path string) (session.Service, error) {
+	s := &fileSessionService{Service: session.InMemoryService()}
+	if err := s.replay(path); err != nil {
+		return nil, fmt.Errorf("loading sessions from %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening session journal: %w", err)
+	}
+	s.journal = f
+	return s, nil
+}
+
+// replay applies the journal to the in-memory service. A torn final line,
+// left by a crash mid-write, is ignored; damage anywhere else is an error.
+func (s *fileSessionService) replay(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("Ignoring incomplete last line %d of session journal", n)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		if err := s.apply(ctx, &e); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+}
+
+func (s *fileSessionService) apply(ctx context.Context, e *journalEntry) error {
+	switch e.Op {
+	case opCreate:
+		_, err := s.Service.Create(ctx, &session.CreateRequest{AppName: e.AppName, UserID: e.UserID, SessionID: e.SessionID, State: e.State})
+		return err
+	case opAppend:
+		resp, err := s.Service.Get(ctx, &session.GetRequest{AppName: e.AppName, UserID: e.UserID, SessionID: e.SessionID})
+		if err != nil {
+			return err
+		}
+		return s.Service.AppendEvent(ctx, resp.Session, e.Event)
+	case opDelete:
+		return s.Service.Delete(ctx, &session.DeleteRequest{AppName: e.AppName, UserID: e.UserID, SessionID: e.SessionID})
+	default:
+		return fmt.Errorf("unknown journal operation %q", e.Op)
+	}
+}
+
+// record appends e to the journal and syncs it to disk.
+func (s *fileSessionService) record(e *journalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding session journal entry: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.journal.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("writing session journal: %w", err)
+	}
+	return s.journal.Sync()
+}
+
+func (s *fileSessionService) Create(ctx context.Context, req *session.CreateRequest) (*session.CreateResponse, error) {
+	resp, err := s.Service.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// Record the generated ID, so replay recreates the same session.
+	err = s.record(&journalEntry{Op: opCreate, AppName: req.AppName, UserID: req.UserID, SessionID: resp.Session.ID(), State: req.State})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *fileSessionService) AppendEvent(ctx context.Context, sess session.Session, event *session.Event) error {
+	if err := s.Service.AppendEvent(ctx, sess, event); err != nil {
+		return err
+	}
+	if event.Partial {
+		return nil // not stored
+	}
+	return s.record(&journalEntry{Op: opAppend, AppName: sess.AppName(), UserID: sess.UserID(), SessionID: sess.ID(), Event: event})
+}
+
+func (s *fileSessionService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	if err := s.Service.Delete(ctx, req); err != nil {
+		return err
+	}
+	return s.record(&journalEntry{Op: opDelete, AppName: req.AppName, UserID: req.UserID, SessionID: req.SessionID})
+}
+
+var _ session.Service = (*fileSessionService)(nil)
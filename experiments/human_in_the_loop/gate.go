@@ -0,0 +1,204 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	"google.golang.org/adk/tool"
+)
+
+// confirmationGate enforces a Policy on tool calls. It runs as a
+// BeforeToolCallback, so a call the policy holds never reaches the tool
+// unless a human approves it, whatever the model was told.
+//
+// A refused call is not run. The model gets {"error": "..."} as the tool's
+// result instead, and can tell the user why.
+//
+// Each decision the gate makes is recorded in session state as a Decision,
+// under "confirmation:" and the function call ID, so it is kept with the
+// tool's response event. Each one a human was asked for is also written to
+// the audit log, and its AuditRecord kept in state under "audit:".
+type confirmationGate struct {
+	policy  *Policy
+	channel HumanChannel
+	audit   *AuditLog
+	risks   map[string]Risk
+}
+
+// decisionKeyPrefix prefixes the state key of each Decision.
+const decisionKeyPrefix = "confirmation:"
+
+// Decision records what the gate did with a call it did not simply allow.
+type Decision struct {
+	Tool     string `json:"tool"`
+	Risk     Risk   `json:"risk,omitempty"`
+	Action   Action `json:"action"`
+	Approved bool   `json:"approved"`
+	// Outcome says how the decision was made, such as "answered" or
+	// "timed out after 10m0s, defaulted to deny".
+	Outcome string `json:"outcome"`
+	// DecidedBy says who decided, as in HumanAnswer.By.
+	DecidedBy string    `json:"decided_by,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Defaulted bool      `json:"defaulted,omitempty"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+func newConfirmationGate(policy *Policy, channel HumanChannel, audit *AuditLog) *confirmationGate {
+	return &confirmationGate{policy: policy, channel: channel, audit: audit, risks: make(map[string]Risk)}
+}
+
+// tag records the risk level of t and returns t, so tools can be tagged
+// where the agent's tool list is built.
+func (g *confirmationGate) tag(t tool.Tool, risk Risk) tool.Tool {
+	g.risks[t.Name()] = risk
+	return t
+}
+
+func (g *confirmationGate) beforeTool(ctx tool.Context, t tool.Tool, args map[string]any) (map[string]any, error) {
+	risk := g.risks[t.Name()]
+	d := Decision{Tool: t.Name(), Risk: risk, Action: g.policy.Decide(t.Name(), risk)}
+	switch d.Action {
+	case ActionAllow:
+		return nil, nil
+	case ActionDeny:
+		log.Printf("Policy denied %s (risk %q)", t.Name(), risk)
+		d.Outcome, d.DecidedBy, d.Reason = "denied by the policy", "policy", "the policy does not allow this tool"
+		return g.decided(ctx, d, nil)
+	}
+
+	q := HumanQuestion{
+		ID:        ctx.FunctionCallID(),
+		Kind:      KindConfirm,
+		AppName:   ctx.AppName(),
+		UserID:    ctx.UserID(),
+		SessionID: ctx.SessionID(),
+		Text:      fmt.Sprintf("Allow %s to run %s?", ctx.UserID(), t.Name()),
+		AskedAt:   time.Now().UTC(),
+		Tool:      t.Name(),
+		Risk:      risk,
+		Args:      args,
+	}
+	log.Printf("Holding %s (risk %q) for confirmation", t.Name(), risk)
+	ans, err := g.channel.Ask(ctx, q)
+	d.DecidedBy = ans.By
+	switch {
+	case err != nil:
+		log.Printf("No decision on %s: %v", t.Name(), err)
+		d.Outcome, d.Reason = "no decision", "no one approved it: "+err.Error()
+	case ans.Defaulted:
+		log.Printf("No decision on %s: %s", t.Name(), ans.Outcome)
+		d.Approved, d.Defaulted, d.Outcome = ans.Approved, true, ans.Outcome
+		if !d.Approved {
+			d.Reason = "no one approved it; " + ans.Outcome
+		}
+	case !ans.Approved:
+		log.Printf("Human denied %s: %s", t.Name(), ans.Answer)
+		d.Outcome, d.Reason = ans.Outcome, "the user denied it"
+		if ans.Answer != "" {
+			d.Reason += ": " + ans.Answer
+		}
+	default:
+		log.Printf("Human approved %s", t.Name())
+		d.Approved, d.Outcome = true, ans.Outcome
+	}
+	return g.decided(ctx, d, &q)
+}
+
+// decided records d, and audits it if q was asked, and returns the tool
+// result for it: nil to run the call, or a denial. A decision that can't
+// be audited is a denial. The audit record is written last, so the log
+// never holds a decision that was not acted on.
+func (g *confirmationGate) decided(ctx tool.Context, d Decision, q *HumanQuestion) (map[string]any, error) {
+	d.DecidedAt = time.Now().UTC()
+	key := decisionKeyPrefix + ctx.FunctionCallID()
+	if err := ctx.State().Set(key, d); err != nil {
+		return nil, err
+	}
+	if q != nil {
+		rec, err := g.audit.Append(d.auditEntry(*q))
+		if err != nil {
+			log.Printf("Auditing %s: %v", d.Tool, err)
+			d.Approved, d.Reason = false, "the decision could not be recorded: "+err.Error()
+			if err := ctx.State().Set(key, d); err != nil {
+				return nil, err
+			}
+			return deniedResult(d.Tool, d.Reason), nil
+		}
+		// The session only keeps a copy of the record; the log has it.
+		if err := ctx.State().Set(auditKeyPrefix+q.ID, rec); err != nil {
+			log.Printf("Keeping the audit record of %s in the session: %v", d.Tool, err)
+		}
+	}
+	if !d.Approved {
+		return deniedResult(d.Tool, d.Reason), nil
+	}
+	return nil, nil
+}
+
+// afterTool is an AfterToolCallback. When a call ran only because nobody
+// answered and the policy's default allowed it, it tells the model so
+// alongside the tool's result.
+func (g *confirmationGate) afterTool(ctx tool.Context, t tool.Tool, args, result map[string]any, err error) (map[string]any, error) {
+	v, getErr := ctx.State().Get(decisionKeyPrefix + ctx.FunctionCallID())
+	if getErr != nil {
+		return nil, nil
+	}
+	d, ok := v.(Decision)
+	if !ok || !d.Approved || !d.Defaulted {
+		return nil, nil
+	}
+	annotated := maps.Clone(result)
+	if annotated == nil {
+		annotated = make(map[string]any)
+	}
+	annotated["confirmation"] = d.Outcome
+	return annotated, nil
+}
+
+func (d Decision) auditEntry(q HumanQuestion) AuditEntry {
+	answer := ""
+	if !d.Approved {
+		answer = d.Reason
+	}
+	return AuditEntry{
+		Time:       time.Now().UTC(),
+		Kind:       KindConfirm,
+		AppName:    q.AppName,
+		UserID:     q.UserID,
+		SessionID:  q.SessionID,
+		CallID:     q.ID,
+		Question:   q.Text,
+		AskedAt:    q.AskedAt,
+		Tool:       q.Tool,
+		Risk:       q.Risk,
+		Args:       q.Args,
+		AnsweredBy: d.DecidedBy,
+		AnsweredAt: d.DecidedAt,
+		Approved:   &d.Approved,
+		Answer:     answer,
+		Outcome:    d.Outcome,
+	}
+}
+
+// deniedResult is the tool result for a refused call. ADK reports errors
+// under "error"; it must be a string, as an error value encodes as {}.
+func deniedResult(toolName, reason string) map[string]any {
+	return map[string]any{"error": fmt.Sprintf("call to %s was not run: %s", toolName, reason)}
+}
@@ -0,0 +1,243 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+const testPolicy = `
+rules:
+  - tools: [launch_missiles]
+    action: deny
+  - risks: [high]
+    action: confirm
+  - risks: [low]
+    action: allow
+`
+
+// gateRun is what happened when the model called a tool through the gate.
+type gateRun struct {
+	ran      int            // times the tool ran
+	response map[string]any // what the model got back
+	state    map[string]any // the session state afterwards
+}
+
+// runGate has the model call toolName once, with channel answering and
+// audit recording. The tools are delete_files (high risk), list_files
+// (low risk) and launch_missiles (denied by name).
+func runGate(t *testing.T, toolName string, channel HumanChannel, audit *AuditLog) gateRun {
+	t.Helper()
+	policy, err := parsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := newConfirmationGate(policy, channel, audit)
+
+	var run gateRun
+	var tools []tool.Tool
+	for name, risk := range map[string]Risk{"delete_files": RiskHigh, "list_files": RiskLow, "launch_missiles": RiskHigh} {
+		tl, err := functiontool.New(functiontool.Config{Name: name, Description: name}, func(tool.Context, struct{}) ActionOutput {
+			run.ran++
+			return ActionOutput{Result: "done"}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tools = append(tools, gate.tag(tl, risk))
+	}
+	llm := &scriptedModel{}
+	llm.script(callTool(toolName, map[string]any{}), text("Done."))
+	a, err := llmagent.New(llmagent.Config{
+		Name:                "careful_agent",
+		Model:               llm,
+		Tools:               tools,
+		BeforeToolCallbacks: []llmagent.BeforeToolCallback{gate.beforeTool},
+		AfterToolCallbacks:  []llmagent.AfterToolCallback{gate.afterTool},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := t.Context()
+	sessions := session.InMemoryService()
+	created, err := sessions.Create(ctx, &session.CreateRequest{AppName: testApp, UserID: testUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(runner.Config{AppName: testApp, Agent: a, SessionService: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := genai.NewContentFromText("Go ahead.", genai.RoleUser)
+	for _, err := range r.Run(ctx, testUser, created.Session.ID(), msg, agent.RunConfig{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run.response = llm.lastResponse(toolName)
+	got, err := sessions.Get(ctx, &session.GetRequest{AppName: testApp, UserID: testUser, SessionID: created.Session.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.state = make(map[string]any)
+	for k, v := range got.Session.State().All() {
+		run.state[k] = v
+	}
+	return run
+}
+
+// decision returns the only Decision in state, or nil.
+func (r gateRun) decision(t *testing.T) *Decision {
+	t.Helper()
+	var found []Decision
+	for k, v := range r.state {
+		if !strings.HasPrefix(k, decisionKeyPrefix) {
+			continue
+		}
+		b, _ := json.Marshal(v)
+		var d Decision
+		if err := json.Unmarshal(b, &d); err != nil {
+			t.Fatal(err)
+		}
+		found = append(found, d)
+	}
+	switch len(found) {
+	case 0:
+		return nil
+	case 1:
+		return &found[0]
+	}
+	t.Fatalf("got %d decisions, want 1", len(found))
+	return nil
+}
+
+func TestGateApproved(t *testing.T) {
+	audit, path := openTestAuditLog(t)
+	channel := newFakeChannel(HumanAnswer{Approved: true, By: "fake:alice", Outcome: "answered"})
+	run := runGate(t, "delete_files", channel, audit)
+
+	if run.ran != 1 || run.response["result"] != "done" {
+		t.Errorf("ran %d times, the model got %v; want it run once", run.ran, run.response)
+	}
+	if _, ok := run.response["confirmation"]; ok {
+		t.Errorf("the model got %v, want no confirmation note for an answer", run.response)
+	}
+	q := <-channel.asked
+	if q.Kind != KindConfirm || q.Tool != "delete_files" || q.Risk != RiskHigh {
+		t.Errorf("the channel was asked %+v", q)
+	}
+	if d := run.decision(t); d == nil || !d.Approved || d.DecidedBy != "fake:alice" {
+		t.Errorf("got decision %+v, want approved by fake:alice", d)
+	}
+	records := auditRecords(t, path)
+	if len(records) != 1 || !strings.Contains(string(records[0].Entry), `"approved":true`) {
+		t.Fatalf("got audit records %v, want one approval", records)
+	}
+	if _, ok := run.state[auditKeyPrefix+q.ID]; !ok {
+		t.Errorf("the audit record is not kept in the session")
+	}
+}
+
+func TestGateDenied(t *testing.T) {
+	audit, path := openTestAuditLog(t)
+	run := runGate(t, "delete_files", newFakeChannel(HumanAnswer{Answer: "not today", By: "fake:alice", Outcome: "answered"}), audit)
+
+	if run.ran != 0 {
+		t.Errorf("the tool ran %d times, want none", run.ran)
+	}
+	want := "call to delete_files was not run: the user denied it: not today"
+	if len(run.response) != 1 || run.response["error"] != want {
+		t.Errorf("the model got %v, want {error: %q}", run.response, want)
+	}
+	if d := run.decision(t); d == nil || d.Approved || d.Reason != "the user denied it: not today" {
+		t.Errorf("got decision %+v, want denied", d)
+	}
+	if records := auditRecords(t, path); len(records) != 1 || !strings.Contains(string(records[0].Entry), `"approved":false`) {
+		t.Errorf("got audit records %v, want one denial", records)
+	}
+}
+
+func TestGateDefaultedAllow(t *testing.T) {
+	audit, _ := openTestAuditLog(t)
+	outcome := "timed out after 1s, defaulted to allow"
+	run := runGate(t, "delete_files", newFakeChannel(HumanAnswer{Approved: true, By: "policy", Defaulted: true, Outcome: outcome}), audit)
+
+	if run.ran != 1 || run.response["result"] != "done" || run.response["confirmation"] != outcome {
+		t.Errorf("ran %d times, the model got %v; want it run, with the confirmation %q", run.ran, run.response, outcome)
+	}
+	if d := run.decision(t); d == nil || !d.Approved || !d.Defaulted {
+		t.Errorf("got decision %+v, want approved by default", d)
+	}
+}
+
+func TestGateAuditFailureDenies(t *testing.T) {
+	audit, path := openTestAuditLog(t)
+	audit.Close()
+	run := runGate(t, "delete_files", newFakeChannel(HumanAnswer{Approved: true, By: "fake:alice"}), audit)
+
+	if run.ran != 0 {
+		t.Errorf("the tool ran %d times, want none", run.ran)
+	}
+	if msg, _ := run.response["error"].(string); !strings.Contains(msg, "was not run: the decision could not be recorded") {
+		t.Errorf("the model got %v, want a denial", run.response)
+	}
+	if d := run.decision(t); d == nil || d.Approved {
+		t.Errorf("got decision %+v, want denied", d)
+	}
+	if records := auditRecords(t, path); len(records) != 0 {
+		t.Errorf("got %d audit records, want none", len(records))
+	}
+}
+
+func TestGatePolicyWithoutAsking(t *testing.T) {
+	for _, tc := range []struct {
+		tool         string
+		wantRan      int
+		wantDecision bool
+	}{
+		{"list_files", 1, false},
+		{"launch_missiles", 0, true},
+	} {
+		t.Run(tc.tool, func(t *testing.T) {
+			audit, path := openTestAuditLog(t)
+			channel := newFakeChannel(HumanAnswer{Approved: true})
+			run := runGate(t, tc.tool, channel, audit)
+			if run.ran != tc.wantRan {
+				t.Errorf("the tool ran %d times, want %d", run.ran, tc.wantRan)
+			}
+			if d := run.decision(t); (d != nil) != tc.wantDecision || (d != nil && d.DecidedBy != "policy") {
+				t.Errorf("got decision %+v, want one: %t", d, tc.wantDecision)
+			}
+			if len(channel.asked) != 0 {
+				t.Errorf("the channel was asked")
+			}
+			if records := auditRecords(t, path); len(records) != 0 {
+				t.Errorf("got %d audit records, want none: nobody was asked", len(records))
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/adk/cmd/launcher/adk"
+	"google.golang.org/adk/cmd/launcher/web"
+)
+
+// maxPollWait caps how long a long-poll request is held open.
+const maxPollWait = time.Minute
+
+// humanLauncher is a web sublauncher through which humans answer the
+// agent's questions over HTTP:
+//
+//	GET  /human/questions              lists the open questions
+//	GET  /human/questions?wait=30s     the same, but waits for one if none is open
+//	GET  /human/events                 streams questions as server-sent events
+//	POST /human/questions/{id}/answer  answers one, with a HumanAnswer as JSON body
+//	POST /human/callback/{id}?token=…  the same, for webhook receivers
+//
+// Anyone who can answer can make the agent delete files, so the first four
+// need the token $HUMAN_TOKEN (or a random one printed when the server
+// starts), as an "Authorization: Bearer" header or ?token=. A callback URL
+// carries its own token, which only answers that one question.
+//
+// humanLauncher is the http HumanChannel, and the webhook channel uses it
+// to receive callbacks.
+type humanLauncher struct {
+	flags     *flag.FlagSet
+	publicURL string
+
+	token   string
+	secret  []byte // signs callback tokens
+	serving atomic.Bool
+	baseURL string // set once the server starts
+
+	mu   sync.Mutex
+	open map[string]*openQuestion
+	// changed is closed and replaced whenever open changes, to wake up
+	// long-poll and SSE requests.
+	changed chan struct{}
+}
+
+// openQuestion is a question waiting for its answer.
+type openQuestion struct {
+	q      HumanQuestion
+	answer chan HumanAnswer
+}
+
+var (
+	_ web.Sublauncher = (*humanLauncher)(nil)
+	_ HumanChannel    = (*humanLauncher)(nil)
+	_ reminder        = (*humanLauncher)(nil)
+)
+
+func newHumanLauncher() (*humanLauncher, error) {
+	h := &humanLauncher{
+		token:   os.Getenv("HUMAN_TOKEN"),
+		secret:  make([]byte, 32),
+		open:    make(map[string]*openQuestion),
+		changed: make(chan struct{}),
+	}
+	if _, err := rand.Read(h.secret); err != nil {
+		return nil, err
+	}
+	if h.token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h.token = hex.EncodeToString(b)
+	}
+	h.flags = flag.NewFlagSet("human", flag.ContinueOnError)
+	h.flags.StringVar(&h.publicURL, "public_url", "", "Base URL of the server as seen by webhook receivers. Defaults to the local web server address.")
+	return h, nil
+}
+
+func (h *humanLauncher) Keyword() string {
+	return "human"
+}
+
+func (h *humanLauncher) Parse(args []string) ([]string, error) {
+	if err := h.flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse human flags: %v", err)
+	}
+	return h.flags.Args(), nil
+}
+
+func (h *humanLauncher) CommandLineSyntax() string {
+	var b strings.Builder
+	h.flags.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&b, "  -%s\n    \t%s (default %q)\n", f.Name, f.Usage, f.DefValue)
+	})
+	return b.String()
+}
+
+func (h *humanLauncher) SimpleDescription() string {
+	return "lets humans answer the agent's questions and approve tool calls over HTTP"
+}
+
+func (h *humanLauncher) SetupSubrouters(router *mux.Router, config *adk.Config) error {
+	r := router.PathPrefix("/human").Subrouter()
+	r.HandleFunc("/callback/{id}", h.callback).Methods(http.MethodPost)
+
+	authed := r.NewRoute().Subrouter()
+	authed.Use(h.authorize)
+	authed.HandleFunc("/questions", h.list).Methods(http.MethodGet)
+	authed.HandleFunc("/events", h.events).Methods(http.MethodGet)
+	authed.HandleFunc("/questions/{id}/answer", h.answerQuestion).Methods(http.MethodPost)
+	h.serving.Store(true)
+	return nil
+}
+
+func (h *humanLauncher) UserMessage(webURL string, printer func(v ...any)) {
+	h.baseURL = strings.TrimSuffix(webURL, "/")
+	if h.publicURL != "" {
+		h.baseURL = strings.TrimSuffix(h.publicURL, "/")
+	}
+	printer(fmt.Sprintf(" human:  answer the agent's questions at %s/human/questions", strings.TrimSuffix(webURL, "/")))
+	if os.Getenv("HUMAN_TOKEN") == "" {
+		printer(fmt.Sprintf("       with header \"Authorization: Bearer %s\"", h.token))
+	}
+}
+
+// Ask posts q on the board and waits for an answer.
+func (h *humanLauncher) Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error) {
+	return h.ask(ctx, q, nil)
+}
+
+// ask posts q, calls notify with its callback URL, if notify is not nil,
+// and waits for an answer or for ctx to be done.
+func (h *humanLauncher) ask(ctx context.Context, q HumanQuestion, notify func(ctx context.Context, callbackURL string) error) (HumanAnswer, error) {
+	if !h.serving.Load() {
+		return HumanAnswer{}, fmt.Errorf("the human channel needs the web server; start it with \"web ... human\"")
+	}
+	oq := &openQuestion{q: q, answer: make(chan HumanAnswer, 1)}
+	h.mu.Lock()
+	h.open[q.ID] = oq
+	h.notifyLocked()
+	h.mu.Unlock()
+	defer h.close(q.ID)
+
+	if notify != nil {
+		if err := notify(ctx, h.callbackURL(q.ID)); err != nil {
+			return HumanAnswer{}, err
+		}
+	}
+	select {
+	case a := <-oq.answer:
+		return a, nil
+	case <-ctx.Done():
+		return HumanAnswer{}, ctx.Err()
+	}
+}
+
+// Remind marks the open question q as reminded, which long-poll and SSE
+// clients see.
+func (h *humanLauncher) Remind(ctx context.Context, q HumanQuestion) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if oq, ok := h.open[q.ID]; ok {
+		oq.q.Reminders = q.Reminders
+		h.notifyLocked()
+	}
+	return nil
+}
+
+// close removes a question and returns it, or nil if it was not open.
+func (h *humanLauncher) close(id string) *openQuestion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	oq, ok := h.open[id]
+	if !ok {
+		return nil
+	}
+	delete(h.open, id)
+	h.notifyLocked()
+	return oq
+}
+
+func (h *humanLauncher) notifyLocked() {
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// snapshot returns the open questions, oldest first, and a channel that is
+// closed when they change.
+func (h *humanLauncher) snapshot() ([]HumanQuestion, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	qs := []HumanQuestion{}
+	for _, oq := range h.open {
+		qs = append(qs, oq.q)
+	}
+	slices.SortFunc(qs, func(a, b HumanQuestion) int { return a.AskedAt.Compare(b.AskedAt) })
+	return qs, h.changed
+}
+
+func (h *humanLauncher) callbackURL(id string) string {
+	return fmt.Sprintf("%s/human/callback/%s?token=%s", h.baseURL, url.PathEscape(id), h.callbackToken(id))
+}
+
+func (h *humanLauncher) callbackToken(id string) string {
+	m := hmac.New(sha256.New, h.secret)
+	m.Write([]byte(id))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func (h *humanLauncher) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		tok := req.URL.Query().Get("token")
+		if tok == "" {
+			tok, _ = strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(h.token)) != 1 {
+			http.Error(rw, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// list returns the open questions. With ?wait=, it holds the request until
+// one is open or the wait is over, so clients can long-poll.
+func (h *humanLauncher) list(rw http.ResponseWriter, req *http.Request) {
+	var wait time.Duration
+	if w := req.URL.Query().Get("wait"); w != "" {
+		var err error
+		if wait, err = time.ParseDuration(w); err != nil || wait < 0 {
+			http.Error(rw, "wait must be a duration, such as 30s", http.StatusBadRequest)
+			return
+		}
+	}
+	timeout := time.After(min(wait, maxPollWait))
+	qs, changed := h.snapshot()
+	for len(qs) == 0 && wait > 0 {
+		select {
+		case <-changed:
+			qs, changed = h.snapshot()
+		case <-timeout:
+			wait = 0
+		case <-req.Context().Done():
+			return
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(qs); err != nil {
+		log.Printf("Error writing question list: %v", err)
+	}
+}
+
+// events streams a "question" event when a question opens, a "reminder"
+// event when the human is reminded of it, and a "closed" event, with its
+// ID, when it is answered or withdrawn.
+func (h *humanLauncher) events(rw http.ResponseWriter, req *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-store")
+
+	// sent maps the questions sent to their reminder count.
+	sent := map[string]int{}
+	for {
+		qs, changed := h.snapshot()
+		open := map[string]bool{}
+		for _, q := range qs {
+			open[q.ID] = true
+			n, ok := sent[q.ID]
+			if ok && q.Reminders == n {
+				continue
+			}
+			event := "question"
+			if ok {
+				event = "reminder"
+			}
+			data, _ := json.Marshal(q)
+			fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event, data)
+			sent[q.ID] = q.Reminders
+		}
+		for id := range sent {
+			if !open[id] {
+				data, _ := json.Marshal(id)
+				fmt.Fprintf(rw, "event: closed\ndata: %s\n\n", data)
+				delete(sent, id)
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *humanLauncher) answerQuestion(rw http.ResponseWriter, req *http.Request) {
+	h.deliver(rw, req, mux.Vars(req)["id"], "http")
+}
+
+func (h *humanLauncher) callback(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	if !hmac.Equal([]byte(req.URL.Query().Get("token")), []byte(h.callbackToken(id))) {
+		http.Error(rw, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	h.deliver(rw, req, id, "webhook")
+}
+
+// deliver reads a HumanAnswer from the request and hands it to the waiting
+// Ask. Only the first answer counts, and an answer to a question must be
+// one it accepts. via, the route it came by, prefixes its By.
+func (h *humanLauncher) deliver(rw http.ResponseWriter, req *http.Request, id, via string) {
+	var a HumanAnswer
+	if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 1<<16)).Decode(&a); err != nil {
+		http.Error(rw, "body must be a JSON answer, such as {\"approved\": true} or {\"answer\": \"yes\"}", http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	oq := h.open[id]
+	h.mu.Unlock()
+	if oq == nil {
+		http.Error(rw, "no open question with that ID", http.StatusNotFound)
+		return
+	}
+	// The question stays open, so a rejected answer can be corrected.
+	if oq.q.Kind == KindQuestion {
+		if _, err := oq.q.Parse(a.Answer); err != nil {
+			msg := "invalid answer: " + err.Error()
+			if hint := oq.q.Hint(); hint != "" {
+				msg += "; answer with " + hint
+			}
+			http.Error(rw, msg, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	if h.close(id) == nil {
+		http.Error(rw, "no open question with that ID", http.StatusNotFound)
+		return
+	}
+	if a.By != "" {
+		a.By = via + ":" + a.By
+	} else {
+		a.By = via
+	}
+	oq.answer <- a
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,398 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const testToken = "secret"
+
+// newTestHuman serves a humanLauncher whose token is testToken.
+func newTestHuman(t *testing.T) (*humanLauncher, *httptest.Server) {
+	t.Helper()
+	t.Setenv("HUMAN_TOKEN", testToken)
+	h, err := newHumanLauncher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	if err := h.SetupSubrouters(router, nil); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	h.UserMessage(srv.URL, func(...any) {})
+	return h, srv
+}
+
+// call sends a request with the bearer token, if not empty, and returns
+// the status and body. It may be called from any goroutine.
+func call(t *testing.T, method, url, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, url, strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0, ""
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+type askResult struct {
+	answer HumanAnswer
+	err    error
+}
+
+// askAsync asks q on ch and returns where the result will arrive. It
+// returns once q is open, if ch is h.
+func askAsync(ctx context.Context, h *humanLauncher, ch HumanChannel, q HumanQuestion) <-chan askResult {
+	_, changed := h.snapshot()
+	done := make(chan askResult, 1)
+	go func() {
+		a, err := ch.Ask(ctx, q)
+		done <- askResult{a, err}
+	}()
+	<-changed
+	return done
+}
+
+func confirmQuestion(id string) HumanQuestion {
+	return HumanQuestion{ID: id, Kind: KindConfirm, Text: "Allow delete_files?", Tool: "delete_files", Risk: RiskHigh, AskedAt: time.Now()}
+}
+
+func TestHumanWebRequiresToken(t *testing.T) {
+	_, srv := newTestHuman(t)
+	for _, path := range []string{"/human/questions", "/human/events", "/human/questions/q1/answer"} {
+		method := http.MethodGet
+		if strings.HasSuffix(path, "/answer") {
+			method = http.MethodPost
+		}
+		for _, token := range []string{"", "wrong", testToken + "x"} {
+			if status, _ := call(t, method, srv.URL+path, token, "{}"); status != http.StatusUnauthorized {
+				t.Errorf("%s %s with token %q: got status %d, want 401", method, path, token, status)
+			}
+		}
+	}
+	if status, _ := call(t, http.MethodGet, srv.URL+"/human/questions", testToken, ""); status != http.StatusOK {
+		t.Errorf("with the bearer token: got status %d, want 200", status)
+	}
+	if status, _ := call(t, http.MethodGet, srv.URL+"/human/questions?token="+testToken, "", ""); status != http.StatusOK {
+		t.Errorf("with ?token=: got status %d, want 200", status)
+	}
+}
+
+func TestHumanWebLongPoll(t *testing.T) {
+	h, srv := newTestHuman(t)
+
+	if status, body := call(t, http.MethodGet, srv.URL+"/human/questions?wait=10ms", testToken, ""); status != http.StatusOK || strings.TrimSpace(body) != "[]" {
+		t.Errorf("nothing open: got %d %s, want an empty list after the wait", status, body)
+	}
+	if status, _ := call(t, http.MethodGet, srv.URL+"/human/questions?wait=soon", testToken, ""); status != http.StatusBadRequest {
+		t.Errorf("bad wait: got status %d, want 400", status)
+	}
+
+	// A waiting poll returns as soon as a question opens.
+	polled := make(chan string, 1)
+	go func() {
+		_, body := call(t, http.MethodGet, srv.URL+"/human/questions?wait=30s", testToken, "")
+		polled <- body
+	}()
+	time.Sleep(20 * time.Millisecond)
+	askAsync(t.Context(), h, h, confirmQuestion("q1"))
+	select {
+	case body := <-polled:
+		var qs []HumanQuestion
+		if err := json.Unmarshal([]byte(body), &qs); err != nil || len(qs) != 1 || qs[0].ID != "q1" || qs[0].Tool != "delete_files" {
+			t.Errorf("got %s, want q1", body)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the poll did not return when a question opened")
+	}
+}
+
+// sseEvent is a server-sent event.
+type sseEvent struct {
+	name, data string
+}
+
+// readEvents reads server-sent events from r until it ends.
+func readEvents(r io.Reader, events chan<- sseEvent) {
+	defer close(events)
+	var ev sseEvent
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events <- ev
+			ev = sseEvent{}
+		}
+	}
+}
+
+func TestHumanWebEvents(t *testing.T) {
+	h, srv := newTestHuman(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/human/events?token="+testToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got Content-Type %q", ct)
+	}
+	events := make(chan sseEvent, 10)
+	go readEvents(resp.Body, events)
+	next := func() sseEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(10 * time.Second):
+			t.Fatal("no event")
+			return sseEvent{}
+		}
+	}
+	q := confirmQuestion("q1")
+	done := askAsync(t.Context(), h, h, q)
+	ev := next()
+	var got HumanQuestion
+	if ev.name != "question" || json.Unmarshal([]byte(ev.data), &got) != nil || got.ID != "q1" {
+		t.Errorf("got %+v, want a question event for q1", ev)
+	}
+
+	q.Reminders = 1
+	h.Remind(t.Context(), q)
+	if ev := next(); ev.name != "reminder" || !strings.Contains(ev.data, `"reminders":1`) {
+		t.Errorf("got %+v, want a reminder event", ev)
+	}
+
+	if status, body := call(t, http.MethodPost, srv.URL+"/human/questions/q1/answer", testToken, `{"approved": true}`); status != http.StatusNoContent {
+		t.Fatalf("answering: got %d %s", status, body)
+	}
+	<-done
+	if ev := next(); ev.name != "closed" || ev.data != `"q1"` {
+		t.Errorf("got %+v, want a closed event for q1", ev)
+	}
+}
+
+func TestHumanWebAnswer(t *testing.T) {
+	h, srv := newTestHuman(t)
+	done := askAsync(t.Context(), h, h, confirmQuestion("q1"))
+	answerURL := srv.URL + "/human/questions/q1/answer"
+
+	if status, _ := call(t, http.MethodPost, answerURL, testToken, "yes"); status != http.StatusBadRequest {
+		t.Errorf("not JSON: got status %d, want 400", status)
+	}
+	if status, _ := call(t, http.MethodPost, srv.URL+"/human/questions/q2/answer", testToken, `{"approved": true}`); status != http.StatusNotFound {
+		t.Errorf("unknown question: got status %d, want 404", status)
+	}
+	if status, body := call(t, http.MethodPost, answerURL, testToken, `{"approved": false, "answer": "not today", "by": "alice"}`); status != http.StatusNoContent {
+		t.Fatalf("got %d %s, want 204", status, body)
+	}
+	r := <-done
+	if r.err != nil || r.answer.Approved || r.answer.Answer != "not today" || r.answer.By != "http:alice" {
+		t.Errorf("got %+v, want the denial by http:alice", r)
+	}
+
+	// Only the first answer counts.
+	if status, _ := call(t, http.MethodPost, answerURL, testToken, `{"approved": true}`); status != http.StatusNotFound {
+		t.Errorf("second answer: got status %d, want 404", status)
+	}
+}
+
+func TestHumanWebRejectsInvalidAnswer(t *testing.T) {
+	h, srv := newTestHuman(t)
+	q := HumanQuestion{ID: "q1", Kind: KindQuestion, Text: "Sure?", AnswerSpec: AnswerSpec{Type: AnswerYesNo}}
+	done := askAsync(t.Context(), h, h, q)
+	answerURL := srv.URL + "/human/questions/q1/answer"
+
+	status, body := call(t, http.MethodPost, answerURL, testToken, `{"answer": "perhaps"}`)
+	if status != http.StatusUnprocessableEntity || !strings.Contains(body, "answer with yes or no") {
+		t.Errorf("got %d %s, want 422 with a hint", status, body)
+	}
+	// The question is still open, so the answer can be corrected.
+	if status, _ := call(t, http.MethodPost, answerURL, testToken, `{"answer": "Yes!"}`); status != http.StatusNoContent {
+		t.Fatalf("corrected answer: got status %d, want 204", status)
+	}
+	if r := <-done; r.err != nil || r.answer.Answer != "Yes!" || r.answer.By != "http" {
+		t.Errorf("got %+v, want the corrected answer", r)
+	}
+}
+
+func TestHumanWebGivesUp(t *testing.T) {
+	h, srv := newTestHuman(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := askAsync(ctx, h, h, confirmQuestion("q1"))
+	cancel()
+	if r := <-done; r.err == nil {
+		t.Errorf("got %+v, want the context's error", r)
+	}
+	if _, body := call(t, http.MethodGet, srv.URL+"/human/questions", testToken, ""); strings.TrimSpace(body) != "[]" {
+		t.Errorf("got %s, want the question withdrawn", body)
+	}
+}
+
+func TestWebhookCallback(t *testing.T) {
+	h, _ := newTestHuman(t)
+	payloads := make(chan webhookPayload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payloads <- p
+	}))
+	defer receiver.Close()
+	wh, err := newWebhookChannel(receiver.URL, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := HumanQuestion{ID: "q1", Kind: KindQuestion, Text: "How many?", AnswerSpec: AnswerSpec{Type: AnswerNumber}}
+	done := askAsync(t.Context(), h, wh, q)
+	p := <-payloads
+	if p.Question.ID != "q1" || p.Question.Text != "How many?" {
+		t.Errorf("the webhook got %+v", p.Question)
+	}
+	other := askAsync(t.Context(), h, wh, HumanQuestion{ID: "q2", Kind: KindQuestion, Text: "Why?"})
+	otherURL := (<-payloads).CallbackURL
+
+	q.Reminders = 1
+	if err := wh.Remind(t.Context(), q); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-payloads; r.Question.Reminders != 1 || r.CallbackURL != p.CallbackURL {
+		t.Errorf("the reminder was %+v, want the question again with 1 reminder", r)
+	}
+
+	base, _, _ := strings.Cut(p.CallbackURL, "?")
+	_, otherToken, _ := strings.Cut(otherURL, "?")
+	for _, u := range []string{
+		base,                    // no token
+		base + "?token=bad",     // wrong token
+		base + "?" + otherToken, // q2's token
+	} {
+		if status, _ := call(t, http.MethodPost, u, "", `{"answer": "3"}`); status != http.StatusUnauthorized {
+			t.Errorf("POST %s: got status %d, want 401", u, status)
+		}
+	}
+	// The human token is not a callback token.
+	if status, _ := call(t, http.MethodPost, base+"?token="+testToken, "", `{"answer": "3"}`); status != http.StatusUnauthorized {
+		t.Errorf("with the human token: got status %d, want 401", status)
+	}
+
+	if status, _ := call(t, http.MethodPost, p.CallbackURL, "", `{"answer": "three"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("invalid answer: got status %d, want 422", status)
+	}
+	if status, body := call(t, http.MethodPost, p.CallbackURL, "", `{"answer": "3", "by": "bob"}`); status != http.StatusNoContent {
+		t.Fatalf("got %d %s, want 204", status, body)
+	}
+	if r := <-done; r.err != nil || r.answer.Answer != "3" || r.answer.By != "webhook:bob" {
+		t.Errorf("got %+v, want 3 from webhook:bob", r)
+	}
+	if status, _ := call(t, http.MethodPost, p.CallbackURL, "", `{"answer": "4"}`); status != http.StatusNotFound {
+		t.Errorf("second answer: got status %d, want 404", status)
+	}
+
+	// q2 is still open, and its own token answers it.
+	if status, _ := call(t, http.MethodPost, otherURL, "", `{"answer": "because"}`); status != http.StatusNoContent {
+		t.Errorf("answering q2: got status %d, want 204", status)
+	}
+	<-other
+}
+
+func TestWebhookFailure(t *testing.T) {
+	h, _ := newTestHuman(t)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Error(rw, "down", http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+	wh, err := newWebhookChannel(receiver.URL, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wh.Ask(t.Context(), confirmQuestion("q1"))
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("got error %v, want the webhook's status", err)
+	}
+	if qs, _ := h.snapshot(); len(qs) != 0 {
+		t.Errorf("got %d open questions, want the question withdrawn", len(qs))
+	}
+}
+
+func TestHumanWebConcurrentAnswers(t *testing.T) {
+	h, srv := newTestHuman(t)
+	done := askAsync(t.Context(), h, h, confirmQuestion("q1"))
+
+	statuses := make(chan int, 10)
+	for i := range cap(statuses) {
+		go func() {
+			status, _ := call(t, http.MethodPost, srv.URL+"/human/questions/q1/answer", testToken, fmt.Sprintf(`{"approved": true, "by": "reviewer%d"}`, i))
+			statuses <- status
+		}()
+	}
+	accepted := 0
+	for range cap(statuses) {
+		switch status := <-statuses; status {
+		case http.StatusNoContent:
+			accepted++
+		case http.StatusNotFound:
+		default:
+			t.Errorf("got status %d", status)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d answers were accepted, want 1", accepted)
+	}
+	if r := <-done; !r.answer.Approved || !strings.HasPrefix(r.answer.By, "http:reviewer") {
+		t.Errorf("got %+v", r)
+	}
+}
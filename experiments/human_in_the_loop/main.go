@@ -15,41 +15,34 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"google.golang.org/adk/agent/llmagent"
 	"google.golang.org/adk/cmd/launcher/adk"
-	"google.golang.org/adk/cmd/launcher/full"
+	"google.golang.org/adk/cmd/launcher/console"
+	"google.golang.org/adk/cmd/launcher/universal"
+	"google.golang.org/adk/cmd/launcher/web"
+	"google.golang.org/adk/cmd/launcher/web/a2a"
+	"google.golang.org/adk/cmd/launcher/web/api"
+	"google.golang.org/adk/cmd/launcher/web/webui"
 	"google.golang.org/adk/model/gemini"
 	"google.golang.org/adk/server/restapi/services"
-	"google.golang.org/adk/tool"
+	"google.golang.org/adk/session"
 	"google.golang.org/adk/tool/functiontool"
 	"google.golang.org/genai"
 )
 
-type AskHumanInput struct {
-	Question string `json:"question"`
-}
-
-type AskHumanOutput struct {
-	Answer string `json:"answer"`
-}
-
-// askHumanHandler pauses execution until the user types an answer in the console.
-// This is a simple way to implement HITL for CLI agents.
-func askHumanHandler(ctx tool.Context, input AskHumanInput) AskHumanOutput {
-	fmt.Printf("\n[AGENT ASKS]: %s\n[YOU ANSWER] > ", input.Question)
-	reader := bufio.NewReader(os.Stdin)
-	answer, _ := reader.ReadString('\n')
-	return AskHumanOutput{Answer: strings.TrimSpace(answer)}
-}
-
 func main() {
+	// "audit verify" and "audit export" check and dump the audit log.
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := runAuditCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	model, err := gemini.NewModel(ctx, "gemini-2.5-flash", &genai.ClientConfig{
 		Backend:  genai.BackendVertexAI,
@@ -60,31 +53,110 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Approvals are kept in session state. With SESSION_FILE set, sessions
+	// are journaled to that file, so a pending approval can still be answered
+	// after a restart of the web server.
+	sessions := session.InMemoryService()
+	if path := os.Getenv("SESSION_FILE"); path != "" {
+		if sessions, err = NewFileSessionService(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// policy.yaml (or $POLICY_FILE) says which tool calls need a human's
+	// approval, and how long humans have to answer.
+	policy, err := LoadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Every answer a human gives is written to a hash-chained audit log,
+	// AUDIT_LOG or audit.jsonl, signed with AUDIT_KEY if it is set.
+	audit, err := OpenAuditLog(auditLogPath(), []byte(os.Getenv("AUDIT_KEY")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer audit.Close()
+
+	// HUMAN_CHANNEL picks how a human is reached: on the terminal, or, with
+	// the web server and its human sublauncher, over HTTP or a webhook.
+	// ESCALATION_CHANNEL, if set, picks how to reach the secondary approver
+	// when the first is slow to answer.
+	human, err := newHumanLauncher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	primary, err := newHumanChannel(os.Getenv("HUMAN_CHANNEL"), os.Getenv("WEBHOOK_URL"), human)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var secondary HumanChannel
+	if kind := os.Getenv("ESCALATION_CHANNEL"); kind != "" {
+		if secondary, err = newHumanChannel(kind, os.Getenv("ESCALATION_WEBHOOK_URL"), human); err != nil {
+			log.Fatal(err)
+		}
+	}
+	channel := newDeadlineChannel(primary, secondary, policy.Answers)
+
+	// In a terminal the user answers ask_human in the chat; elsewhere the
+	// question is also sent to the channel.
+	var askChannel HumanChannel
+	if _, ok := primary.(*terminalChannel); !ok {
+		askChannel = channel
+	}
+	ask := newAskHuman(askChannel, sessions, policy.Answers, audit)
+	defer ask.Close()
 	askTool, err := functiontool.New(functiontool.Config{
-		Name:        "ask_human",
-		Description: "Asks the human user a question and waits for their response. Use this before taking any 'dangerous' action.",
-	}, askHumanHandler)
+		Name:          askHumanToolName,
+		Description:   "Asks the human user a question. Set type to get a typed answer: yes_no (a bool), single_choice or multi_choice with choices (a string or a list of strings), number (with optional min and max) or text. The answer arrives in a later turn; until then the tool reports a pending status. Use this when you need the user to clarify a request.",
+		IsLongRunning: true,
+	}, ask.handler)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The gate holds risky tool calls until a human approves them on the
+	// channel, or the deadline passes.
+	gate := newConfirmationGate(policy, channel, audit)
+	tools, err := newActionTools(gate)
 	if err != nil {
 		log.Fatal(err)
 	}
+	tools = append(tools, gate.tag(askTool, RiskLow))
 
 	agent, err := llmagent.New(llmagent.Config{
 		Name:  "careful_agent",
 		Model: model,
-		Instruction: `You are a helpful assistant.
-If the user asks you to do something "dangerous" (like deleting files, launching missiles, or eating the last cookie),
-	you MUST first use the 'ask_human' tool to get explicit confirmation.
-If they say "yes", pretend to do it. If they say "no", do not do it.`,
-		Tools: []tool.Tool{askTool},
+		Instruction: `You are a helpful assistant. You can list and delete the user's files, launch missiles and eat the last cookie.
+Dangerous actions are checked with the user before they run, so just call the tool.
+If a tool returns an error saying the call was not run, tell the user why and do not try again.
+If a request is unclear, use the 'ask_human' tool to ask the user. Prefer yes_no or choices over free text when the possible answers are known.
+While its status is "pending", repeat the question to the user, with the choices if any, and stop; do not act yet.
+If it is still "pending" with an error, the user's reply did not fit; say why and ask again.
+Once its status is "answered", act on the answer.
+If a result says no one answered in time and a default was used, tell the user.`,
+		Tools:                tools,
+		BeforeModelCallbacks: []llmagent.BeforeModelCallback{ask.resumeApprovals},
+		BeforeToolCallbacks:  []llmagent.BeforeToolCallback{gate.beforeTool},
+		AfterToolCallbacks:   []llmagent.AfterToolCallback{gate.afterTool},
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// The web server names the app after the agent. Questions left pending
+	// by an earlier run are asked again.
+	if err := ask.resendPending(ctx, agent.Name()); err != nil {
+		log.Fatal(err)
+	}
+
 	config := &adk.Config{
-		AgentLoader: services.NewSingleAgentLoader(agent),
+		AgentLoader:    services.NewSingleAgentLoader(agent),
+		SessionService: sessions,
 	}
-	l := full.NewLauncher()
+	// This is full.NewLauncher() with the human sublauncher added.
+	l := universal.NewLauncher(console.NewLauncher(),
+		web.NewLauncher(api.NewLauncher(), a2a.NewLauncher(), webui.NewLauncher(), human))
 
 	// Default prompt if none provided
 	args := os.Args[1:]
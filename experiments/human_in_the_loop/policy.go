@@ -0,0 +1,149 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Risk is the risk level a tool is tagged with.
+type Risk string
+
+const (
+	RiskLow    Risk = "low"
+	RiskMedium Risk = "medium"
+	RiskHigh   Risk = "high"
+)
+
+// Action is what the policy does with a tool call.
+type Action string
+
+const (
+	// ActionAllow runs the call.
+	ActionAllow Action = "allow"
+	// ActionConfirm holds the call until a human approves or denies it.
+	ActionConfirm Action = "confirm"
+	// ActionDeny refuses the call without asking.
+	ActionDeny Action = "deny"
+)
+
+// PolicyRule matches tool calls by tool name or by risk. A rule with both
+// lists matches a call that is in either.
+type PolicyRule struct {
+	Tools  []string `yaml:"tools"`
+	Risks  []Risk   `yaml:"risks"`
+	Action Action   `yaml:"action"`
+}
+
+// AnswerPolicy says how long humans have to answer, and what happens if
+// they don't. Zero durations turn the step off.
+type AnswerPolicy struct {
+	// Deadline is how long to wait before the default applies.
+	Deadline time.Duration `yaml:"deadline"`
+	// RemindEvery is how often to remind the human while waiting.
+	RemindEvery time.Duration `yaml:"remind_every"`
+	// EscalateAfter is when to also ask the secondary approver.
+	EscalateAfter time.Duration `yaml:"escalate_after"`
+	// DefaultConfirm decides held calls nobody answered: allow or deny.
+	DefaultConfirm Action `yaml:"default_confirm"`
+	// DefaultAnswer answers ask_human questions nobody answered.
+	DefaultAnswer string `yaml:"default_answer"`
+}
+
+// Policy decides which tool calls need a human's approval. Rules are tried
+// in order and the first match wins; calls no rule matches get Default.
+type Policy struct {
+	Rules   []PolicyRule `yaml:"rules"`
+	Default Action       `yaml:"default"`
+	Answers AnswerPolicy `yaml:"answers"`
+}
+
+//go:embed policy.yaml
+var defaultPolicy []byte
+
+// LoadPolicy reads a policy from a YAML file, or returns the built-in
+// policy.yaml if path is empty.
+func LoadPolicy(path string) (*Policy, error) {
+	data := defaultPolicy
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading policy: %w", err)
+		}
+	}
+	return parsePolicy(data)
+}
+
+func parsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{Default: ActionConfirm, Answers: AnswerPolicy{DefaultConfirm: ActionDeny}}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	if !validAction(p.Default) {
+		return fmt.Errorf("default: unknown action %q", p.Default)
+	}
+	a := p.Answers
+	if a.DefaultConfirm != ActionAllow && a.DefaultConfirm != ActionDeny {
+		return fmt.Errorf("answers.default_confirm: want allow or deny, not %q", a.DefaultConfirm)
+	}
+	if a.Deadline < 0 || a.RemindEvery < 0 || a.EscalateAfter < 0 {
+		return fmt.Errorf("answers: durations must not be negative")
+	}
+	if a.Deadline > 0 && a.EscalateAfter >= a.Deadline {
+		return fmt.Errorf("answers.escalate_after must be before the deadline")
+	}
+	for i, r := range p.Rules {
+		if !validAction(r.Action) {
+			return fmt.Errorf("rule %d: unknown action %q", i+1, r.Action)
+		}
+		if len(r.Tools) == 0 && len(r.Risks) == 0 {
+			return fmt.Errorf("rule %d: needs tools or risks to match", i+1)
+		}
+		for _, risk := range r.Risks {
+			if risk != RiskLow && risk != RiskMedium && risk != RiskHigh {
+				return fmt.Errorf("rule %d: unknown risk %q", i+1, risk)
+			}
+		}
+	}
+	return nil
+}
+
+func validAction(a Action) bool {
+	return a == ActionAllow || a == ActionConfirm || a == ActionDeny
+}
+
+// Decide returns the action for a call to toolName, tagged with risk. An
+// untagged tool has an empty risk and only matches rules by name.
+func (p *Policy) Decide(toolName string, risk Risk) Action {
+	for _, r := range p.Rules {
+		if slices.Contains(r.Tools, toolName) || (risk != "" && slices.Contains(r.Risks, risk)) {
+			return r.Action
+		}
+	}
+	return p.Default
+}
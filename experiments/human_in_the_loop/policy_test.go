@@ -0,0 +1,127 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePolicy writes a policy file and returns its path.
+func writePolicy(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy(writePolicy(t, `
+rules:
+  - tools: [eat_cookie]
+    action: allow
+  - risks: [high]
+    action: deny
+default: allow
+answers:
+  deadline: 1h30m
+  remind_every: 90s
+  escalate_after: 45m
+  default_confirm: allow
+  default_answer: "maybe"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AnswerPolicy{
+		Deadline:       90 * time.Minute,
+		RemindEvery:    90 * time.Second,
+		EscalateAfter:  45 * time.Minute,
+		DefaultConfirm: ActionAllow,
+		DefaultAnswer:  "maybe",
+	}
+	if p.Answers != want {
+		t.Errorf("got answers %+v, want %+v", p.Answers, want)
+	}
+	for _, tc := range []struct {
+		tool string
+		risk Risk
+		want Action
+	}{
+		{"eat_cookie", RiskHigh, ActionAllow}, // the first rule wins
+		{"delete_files", RiskHigh, ActionDeny},
+		{"list_files", RiskLow, ActionAllow}, // the default
+		{"untagged", "", ActionAllow},
+	} {
+		if got := p.Decide(tc.tool, tc.risk); got != tc.want {
+			t.Errorf("Decide(%q, %q) = %q, want %q", tc.tool, tc.risk, got, tc.want)
+		}
+	}
+}
+
+func TestLoadPolicyDefaults(t *testing.T) {
+	p, err := LoadPolicy(writePolicy(t, "rules: []\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != ActionConfirm || p.Answers != (AnswerPolicy{DefaultConfirm: ActionDeny}) {
+		t.Errorf("got %+v, want confirm by default, and no deadline", p)
+	}
+
+	// The built-in policy.
+	p, err = LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Decide("launch_missiles", RiskHigh); got != ActionDeny {
+		t.Errorf("built-in policy: got %q for launch_missiles, want deny", got)
+	}
+	if p.Answers.Deadline != 10*time.Minute {
+		t.Errorf("built-in policy: got deadline %v, want 10m", p.Answers.Deadline)
+	}
+}
+
+func TestLoadPolicyRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name, yaml, want string
+	}{
+		{"unknown action", "rules:\n  - tools: [x]\n    action: maybe\n", `rule 1: unknown action "maybe"`},
+		{"missing action", "rules:\n  - tools: [x]\n", `rule 1: unknown action ""`},
+		{"unknown risk", "rules:\n  - risks: [low, extreme]\n    action: deny\n", `rule 1: unknown risk "extreme"`},
+		{"empty rule", "rules:\n  - action: deny\n", "rule 1: needs tools or risks"},
+		{"unknown default", "default: ask\n", `default: unknown action "ask"`},
+		{"default confirm", "answers:\n  default_confirm: confirm\n", "answers.default_confirm: want allow or deny"},
+		{"bad duration", "answers:\n  deadline: soon\n", "parsing policy"},
+		{"duration without unit", "answers:\n  deadline: 10\n", "parsing policy"},
+		{"negative duration", "answers:\n  remind_every: -1m\n", "must not be negative"},
+		{"late escalation", "answers:\n  deadline: 5m\n  escalate_after: 5m\n", "escalate_after must be before the deadline"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadPolicy(writePolicy(t, tc.yaml))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "reading policy") {
+		t.Errorf("missing file: got error %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AnswerType is the kind of answer a question wants.
+type AnswerType string
+
+const (
+	// AnswerText is any non-empty text. It is the default.
+	AnswerText AnswerType = "text"
+	// AnswerYesNo is yes or no, answered with a bool.
+	AnswerYesNo AnswerType = "yes_no"
+	// AnswerSingleChoice is one of the choices.
+	AnswerSingleChoice AnswerType = "single_choice"
+	// AnswerMultiChoice is one or more of the choices, as a list.
+	AnswerMultiChoice AnswerType = "multi_choice"
+	// AnswerNumber is a number, optionally between Min and Max.
+	AnswerNumber AnswerType = "number"
+)
+
+// AnswerSpec describes the answer a question wants. Humans answer with
+// text; Parse checks it and turns it into a typed value for the model, so
+// "y", "Yes!" and "yes" all become true.
+type AnswerSpec struct {
+	Type    AnswerType `json:"type,omitempty"`
+	Choices []string   `json:"choices,omitempty"`
+	Min     *float64   `json:"min,omitempty"`
+	Max     *float64   `json:"max,omitempty"`
+}
+
+func (s AnswerSpec) validate() error {
+	switch s.Type {
+	case "", AnswerText, AnswerYesNo, AnswerNumber:
+		if len(s.Choices) > 0 {
+			return fmt.Errorf("choices are only for %s and %s questions", AnswerSingleChoice, AnswerMultiChoice)
+		}
+	case AnswerSingleChoice, AnswerMultiChoice:
+		if len(s.Choices) < 2 {
+			return fmt.Errorf("a %s question needs at least two choices", s.Type)
+		}
+		for i, c := range s.Choices {
+			if strings.TrimSpace(c) == "" {
+				return fmt.Errorf("choice %d is empty", i+1)
+			}
+			if slices.IndexFunc(s.Choices[:i], func(d string) bool { return strings.EqualFold(c, d) }) >= 0 {
+				return fmt.Errorf("choice %q is listed twice", c)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown question type %q; want %s, %s, %s, %s or %s",
+			s.Type, AnswerText, AnswerYesNo, AnswerSingleChoice, AnswerMultiChoice, AnswerNumber)
+	}
+	if (s.Min != nil || s.Max != nil) && s.Type != AnswerNumber {
+		return fmt.Errorf("min and max are only for %s questions", AnswerNumber)
+	}
+	if s.Min != nil && s.Max != nil && *s.Min > *s.Max {
+		return fmt.Errorf("min is greater than max")
+	}
+	return nil
+}
+
+// Parse checks text against s and returns the typed answer: a string for
+// text and single choice, a bool for yes/no, a []string for multi choice
+// and a float64 for numbers. Choices can be picked by name, in any case, or
+// by number; multi-choice answers are separated by commas, or given as a
+// JSON list.
+func (s AnswerSpec) Parse(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("the answer is empty")
+	}
+	switch s.Type {
+	case AnswerYesNo:
+		return parseYesNo(text)
+	case AnswerSingleChoice:
+		return s.choice(text)
+	case AnswerMultiChoice:
+		var parts []string
+		if json.Unmarshal([]byte(text), &parts) != nil {
+			parts = strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' })
+		}
+		var picked []string
+		for _, p := range parts {
+			c, err := s.choice(p)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(picked, c) {
+				picked = append(picked, c)
+			}
+		}
+		if len(picked) == 0 {
+			return nil, errors.New("pick at least one choice")
+		}
+		return picked, nil
+	case AnswerNumber:
+		n, err := strconv.ParseFloat(strings.TrimRight(text, ".!"), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("%q is not a number", text)
+		}
+		if (s.Min != nil && n < *s.Min) || (s.Max != nil && n > *s.Max) {
+			return nil, fmt.Errorf("%v is not %s", n, s.Hint())
+		}
+		return n, nil
+	default:
+		return text, nil
+	}
+}
+
+// choice returns the choice text names, or numbers from 1.
+func (s AnswerSpec) choice(text string) (string, error) {
+	text = strings.TrimSpace(strings.TrimRight(text, ".!"))
+	for _, c := range s.Choices {
+		if strings.EqualFold(text, strings.TrimSpace(c)) {
+			return c, nil
+		}
+	}
+	if i, err := strconv.Atoi(text); err == nil && i >= 1 && i <= len(s.Choices) {
+		return s.Choices[i-1], nil
+	}
+	return "", fmt.Errorf("%q is not one of the choices: %s", text, strings.Join(s.Choices, ", "))
+}
+
+// Hint describes the answer s wants, for showing with the question.
+func (s AnswerSpec) Hint() string {
+	switch s.Type {
+	case AnswerYesNo:
+		return "yes or no"
+	case AnswerSingleChoice:
+		return "one of " + s.numbered()
+	case AnswerMultiChoice:
+		return "one or more of " + s.numbered() + ", separated by commas"
+	case AnswerNumber:
+		switch {
+		case s.Min != nil && s.Max != nil:
+			return fmt.Sprintf("a number from %v to %v", *s.Min, *s.Max)
+		case s.Min != nil:
+			return fmt.Sprintf("a number of at least %v", *s.Min)
+		case s.Max != nil:
+			return fmt.Sprintf("a number of at most %v", *s.Max)
+		}
+		return "a number"
+	default:
+		return ""
+	}
+}
+
+func (s AnswerSpec) numbered() string {
+	cs := make([]string, len(s.Choices))
+	for i, c := range s.Choices {
+		cs[i] = fmt.Sprintf("%d) %s", i+1, c)
+	}
+	return strings.Join(cs, ", ")
+}
+
+var (
+	yesWords = []string{"y", "yes", "yeah", "yep", "sure", "ok", "okay", "true", "approve", "approved", "allow"}
+	noWords  = []string{"n", "no", "nope", "false", "deny", "denied", "reject"}
+)
+
+// parseYesNo reads a yes or no, ignoring case and trailing punctuation.
+func parseYesNo(text string) (bool, error) {
+	word := strings.ToLower(strings.TrimRight(strings.TrimSpace(text), ".!"))
+	switch {
+	case slices.Contains(yesWords, word):
+		return true, nil
+	case slices.Contains(noWords, word):
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not yes or no", text)
+}
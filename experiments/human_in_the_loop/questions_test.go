@@ -0,0 +1,157 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestAnswerSpecParse(t *testing.T) {
+	colours := []string{"red", "Blue", "green"}
+	numbers := []string{"3", "1", "20"}
+	for _, tc := range []struct {
+		name string
+		spec AnswerSpec
+		text string
+		want any
+		err  string // part of the error, if the text is rejected
+	}{
+		{"text", AnswerSpec{}, "  the big one ", "the big one", ""},
+		{"empty", AnswerSpec{}, "  ", nil, "the answer is empty"},
+
+		{"yes", AnswerSpec{Type: AnswerYesNo}, "yes", true, ""},
+		{"Yes!", AnswerSpec{Type: AnswerYesNo}, " Yes! ", true, ""},
+		{"yep", AnswerSpec{Type: AnswerYesNo}, "yep", true, ""},
+		{"OK.", AnswerSpec{Type: AnswerYesNo}, "OK.", true, ""},
+		{"approve", AnswerSpec{Type: AnswerYesNo}, "approve", true, ""},
+		{"no", AnswerSpec{Type: AnswerYesNo}, "no", false, ""},
+		{"N", AnswerSpec{Type: AnswerYesNo}, "N", false, ""},
+		{"Nope!", AnswerSpec{Type: AnswerYesNo}, "Nope!", false, ""},
+		{"deny", AnswerSpec{Type: AnswerYesNo}, "deny", false, ""},
+		{"maybe", AnswerSpec{Type: AnswerYesNo}, "maybe", nil, `"maybe" is not yes or no`},
+		{"yes please", AnswerSpec{Type: AnswerYesNo}, "yes please", nil, "is not yes or no"},
+
+		{"choice by name", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "blue", "Blue", ""},
+		{"choice by number", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "3", "green", ""},
+		{"choice by number with punctuation", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "1.", "red", ""},
+		{"choice out of range", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "4", nil, `"4" is not one of the choices: red, Blue, green`},
+		{"choice zero", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "0", nil, "is not one of the choices"},
+		{"not a choice", AnswerSpec{Type: AnswerSingleChoice, Choices: colours}, "purple", nil, "is not one of the choices"},
+		// A numeric choice is taken by name before by number.
+		{"numeric choice by name", AnswerSpec{Type: AnswerSingleChoice, Choices: numbers}, "1", "1", ""},
+		{"numeric choice by number", AnswerSpec{Type: AnswerSingleChoice, Choices: numbers}, "2", "1", ""},
+		{"numeric choice name only", AnswerSpec{Type: AnswerSingleChoice, Choices: numbers}, "20", "20", ""},
+
+		{"multi comma", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, "red, green", []string{"red", "green"}, ""},
+		{"multi semicolon", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, "2; 1", []string{"Blue", "red"}, ""},
+		{"multi JSON", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, `["green", "BLUE"]`, []string{"green", "Blue"}, ""},
+		{"multi JSON with commas", AnswerSpec{Type: AnswerMultiChoice, Choices: []string{"a, b", "c"}}, `["a, b"]`, []string{"a, b"}, ""},
+		{"multi duplicates", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, "red, RED, 1, green", []string{"red", "green"}, ""},
+		{"multi JSON duplicates", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, `["red", "1"]`, []string{"red"}, ""},
+		{"multi bad choice", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, "red, purple", nil, `"purple" is not one of the choices`},
+		{"multi none", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, ",,", nil, "pick at least one choice"},
+		{"multi empty JSON", AnswerSpec{Type: AnswerMultiChoice, Choices: colours}, "[]", nil, "pick at least one choice"},
+
+		{"number", AnswerSpec{Type: AnswerNumber}, "42", 42.0, ""},
+		{"number negative", AnswerSpec{Type: AnswerNumber}, "-1.5", -1.5, ""},
+		{"number with punctuation", AnswerSpec{Type: AnswerNumber}, "3.", 3.0, ""},
+		{"number exponent", AnswerSpec{Type: AnswerNumber}, "1e3", 1000.0, ""},
+		{"number words", AnswerSpec{Type: AnswerNumber}, "three", nil, `"three" is not a number`},
+		{"NaN", AnswerSpec{Type: AnswerNumber}, "NaN", nil, "is not a number"},
+		{"Inf", AnswerSpec{Type: AnswerNumber}, "+Inf", nil, "is not a number"},
+		{"infinity", AnswerSpec{Type: AnswerNumber}, "-infinity", nil, "is not a number"},
+		{"overflow", AnswerSpec{Type: AnswerNumber}, "1e400", nil, "is not a number"},
+		{"at min", AnswerSpec{Type: AnswerNumber, Min: ptr(1), Max: ptr(10)}, "1", 1.0, ""},
+		{"at max", AnswerSpec{Type: AnswerNumber, Min: ptr(1), Max: ptr(10)}, "10", 10.0, ""},
+		{"below min", AnswerSpec{Type: AnswerNumber, Min: ptr(1), Max: ptr(10)}, "0.5", nil, "0.5 is not a number from 1 to 10"},
+		{"above max", AnswerSpec{Type: AnswerNumber, Min: ptr(1), Max: ptr(10)}, "11", nil, "11 is not a number from 1 to 10"},
+		{"min only", AnswerSpec{Type: AnswerNumber, Min: ptr(0)}, "-1", nil, "is not a number of at least 0"},
+		{"max only", AnswerSpec{Type: AnswerNumber, Max: ptr(0)}, "1", nil, "is not a number of at most 0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.spec.Parse(tc.text)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Parse(%q) = %v, %v; want an error containing %q", tc.text, got, err, tc.err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q) = %#v, %v; want %#v", tc.text, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnswerSpecValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec AnswerSpec
+		err  string // part of the error, or empty if valid
+	}{
+		{"default", AnswerSpec{}, ""},
+		{"text", AnswerSpec{Type: AnswerText}, ""},
+		{"yes/no", AnswerSpec{Type: AnswerYesNo}, ""},
+		{"single choice", AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"a", "b"}}, ""},
+		{"multi choice", AnswerSpec{Type: AnswerMultiChoice, Choices: []string{"a", "b", "c"}}, ""},
+		{"number", AnswerSpec{Type: AnswerNumber, Min: ptr(1), Max: ptr(1)}, ""},
+		{"unknown type", AnswerSpec{Type: "date"}, `unknown question type "date"`},
+		{"choices on text", AnswerSpec{Choices: []string{"a", "b"}}, "choices are only for single_choice and multi_choice questions"},
+		{"choices on yes/no", AnswerSpec{Type: AnswerYesNo, Choices: []string{"yes", "no"}}, "choices are only for"},
+		{"choices on number", AnswerSpec{Type: AnswerNumber, Choices: []string{"1", "2"}}, "choices are only for"},
+		{"one choice", AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"a"}}, "needs at least two choices"},
+		{"no choices", AnswerSpec{Type: AnswerMultiChoice}, "needs at least two choices"},
+		{"empty choice", AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"a", " "}}, "choice 2 is empty"},
+		{"duplicate choice", AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"Red", "blue", "red"}}, `choice "red" is listed twice`},
+		{"min on text", AnswerSpec{Min: ptr(1)}, "min and max are only for number questions"},
+		{"max on choice", AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"a", "b"}, Max: ptr(1)}, "min and max are only for"},
+		{"min above max", AnswerSpec{Type: AnswerNumber, Min: ptr(2), Max: ptr(1)}, "min is greater than max"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.spec.validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want it valid", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("got %v, want an error containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestAnswerSpecHint(t *testing.T) {
+	for _, tc := range []struct {
+		spec AnswerSpec
+		want string
+	}{
+		{AnswerSpec{}, ""},
+		{AnswerSpec{Type: AnswerYesNo}, "yes or no"},
+		{AnswerSpec{Type: AnswerSingleChoice, Choices: []string{"red", "blue"}}, "one of 1) red, 2) blue"},
+		{AnswerSpec{Type: AnswerMultiChoice, Choices: []string{"red", "blue"}}, "one or more of 1) red, 2) blue, separated by commas"},
+		{AnswerSpec{Type: AnswerNumber}, "a number"},
+		{AnswerSpec{Type: AnswerNumber, Min: ptr(0.5), Max: ptr(2)}, "a number from 0.5 to 2"},
+	} {
+		if got := tc.spec.Hint(); got != tc.want {
+			t.Errorf("%+v: got hint %q, want %q", tc.spec, got, tc.want)
+		}
+	}
+}
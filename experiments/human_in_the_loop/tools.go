@@ -0,0 +1,102 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+)
+
+// The actions below only pretend. They exist so the confirmation gate has
+// something to guard.
+
+type ListFilesInput struct{}
+
+type ListFilesOutput struct {
+	Files []string `json:"files"`
+}
+
+type DeleteFilesInput struct {
+	Paths []string `json:"paths"`
+}
+
+type LaunchMissilesInput struct {
+	Target string `json:"target"`
+}
+
+type EatCookieInput struct{}
+
+type ActionOutput struct {
+	Result string `json:"result"`
+}
+
+func listFilesHandler(ctx tool.Context, input ListFilesInput) ListFilesOutput {
+	return ListFilesOutput{Files: []string{"notes.txt", "photos/cat.jpg", "taxes-2024.pdf"}}
+}
+
+func deleteFilesHandler(ctx tool.Context, input DeleteFilesInput) ActionOutput {
+	log.Printf("Pretending to delete %v", input.Paths)
+	return ActionOutput{Result: fmt.Sprintf("deleted %d files", len(input.Paths))}
+}
+
+func launchMissilesHandler(ctx tool.Context, input LaunchMissilesInput) ActionOutput {
+	log.Printf("Pretending to launch missiles at %q", input.Target)
+	return ActionOutput{Result: "missiles launched at " + input.Target}
+}
+
+func eatCookieHandler(ctx tool.Context, input EatCookieInput) ActionOutput {
+	return ActionOutput{Result: "the last cookie has been eaten"}
+}
+
+// newActionTools creates the pretend actions, tagged with their risk.
+func newActionTools(gate *confirmationGate) ([]tool.Tool, error) {
+	listFiles, err := functiontool.New(functiontool.Config{
+		Name:        "list_files",
+		Description: "Lists the user's files.",
+	}, listFilesHandler)
+	if err != nil {
+		return nil, err
+	}
+	deleteFiles, err := functiontool.New(functiontool.Config{
+		Name:        "delete_files",
+		Description: "Deletes the given files. Pass every path to delete in one call.",
+	}, deleteFilesHandler)
+	if err != nil {
+		return nil, err
+	}
+	launchMissiles, err := functiontool.New(functiontool.Config{
+		Name:        "launch_missiles",
+		Description: "Launches missiles at a target.",
+	}, launchMissilesHandler)
+	if err != nil {
+		return nil, err
+	}
+	eatCookie, err := functiontool.New(functiontool.Config{
+		Name:        "eat_cookie",
+		Description: "Eats the last cookie.",
+	}, eatCookieHandler)
+	if err != nil {
+		return nil, err
+	}
+	return []tool.Tool{
+		gate.tag(listFiles, RiskLow),
+		gate.tag(eatCookie, RiskMedium),
+		gate.tag(deleteFiles, RiskHigh),
+		gate.tag(launchMissiles, RiskHigh),
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookPayload is the JSON body POSTed to the webhook. A reminder is
+// the same question again, with its Reminders count raised.
+type webhookPayload struct {
+	Question HumanQuestion `json:"question"`
+	// CallbackURL is where the receiver POSTs the HumanAnswer.
+	CallbackURL string `json:"callback_url"`
+}
+
+// webhookChannel POSTs each question to a URL, such as a chat bot that
+// shows it to a person, and waits for the answer to come back on the
+// question's callback URL, served by the human sublauncher.
+type webhookChannel struct {
+	url    string
+	web    *humanLauncher
+	client *http.Client
+}
+
+var (
+	_ HumanChannel = (*webhookChannel)(nil)
+	_ reminder     = (*webhookChannel)(nil)
+)
+
+func newWebhookChannel(url string, web *humanLauncher) (*webhookChannel, error) {
+	if url == "" {
+		return nil, fmt.Errorf("the webhook channel needs a URL, in $WEBHOOK_URL or $ESCALATION_WEBHOOK_URL")
+	}
+	return &webhookChannel{url: url, web: web, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (c *webhookChannel) Ask(ctx context.Context, q HumanQuestion) (HumanAnswer, error) {
+	return c.web.ask(ctx, q, func(ctx context.Context, callbackURL string) error {
+		return c.post(ctx, webhookPayload{Question: q, CallbackURL: callbackURL})
+	})
+}
+
+func (c *webhookChannel) Remind(ctx context.Context, q HumanQuestion) error {
+	return c.post(ctx, webhookPayload{Question: q, CallbackURL: c.web.callbackURL(q.ID)})
+}
+
+func (c *webhookChannel) post(ctx context.Context, p webhookPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"google.golang.org/genai"
+)
+
+// EmbedTask says what texts are embedded for. Some models embed a
+// question differently from the documents that answer it.
+type EmbedTask string
+
+const (
+	EmbedDocument EmbedTask = "RETRIEVAL_DOCUMENT"
+	EmbedQuery    EmbedTask = "RETRIEVAL_QUERY"
+)
+
+// Embedder turns texts into vectors whose cosine similarity says how
+// close their meanings are.
+type Embedder interface {
+	// Name identifies the embedder and its settings. Vectors from
+	// embedders with different names can't be compared.
+	Name() string
+	// Embed returns one vector for each text, in order.
+	Embed(ctx context.Context, task EmbedTask, texts []string) ([][]float32, error)
+}
+
+// HashingEmbedder embeds text without a model, by hashing its words and
+// their three-letter pieces into Dim buckets. It is deterministic and
+// works offline, which makes it good for tests, but it only finds texts
+// that share words or parts of words: "hue" is nowhere near "color".
+type HashingEmbedder struct {
+	Dim int
+}
+
+func (e HashingEmbedder) Name() string {
+	return fmt.Sprintf("hashing-%d", e.Dim)
+}
+
+func (e HashingEmbedder) Embed(ctx context.Context, task EmbedTask, texts []string) ([][]float32, error) {
+	if e.Dim <= 0 {
+		return nil, fmt.Errorf("hashing embedder: dimension %d is not positive", e.Dim)
+	}
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, e.Dim)
+		for _, w := range splitWords(text) {
+			e.add(v, w, 1)
+			// Pieces of the word make "colour" a little like "color".
+			padded := []rune("<" + w + ">")
+			for j := 0; j+3 <= len(padded); j++ {
+				e.add(v, string(padded[j:j+3]), 0.5)
+			}
+		}
+		vecs[i] = normalize(v)
+	}
+	return vecs, nil
+}
+
+// add adds weight to feature's bucket. The sign comes from the hash too,
+// so features that share a bucket tend to cancel out rather than pile up.
+func (e HashingEmbedder) add(v []float32, feature string, weight float32) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	v[sum%uint64(e.Dim)] += weight
+}
+
+// GeminiEmbedder embeds text with a Gemini embedding model.
+type GeminiEmbedder struct {
+	Client *genai.Client
+	Model  string
+}
+
+// geminiBatch is the most texts sent in one request.
+const geminiBatch = 100
+
+func (e GeminiEmbedder) Name() string {
+	return "gemini:" + e.Model
+}
+
+func (e GeminiEmbedder) Embed(ctx context.Context, task EmbedTask, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiBatch {
+		batch := texts[start:min(start+geminiBatch, len(texts))]
+		contents := make([]*genai.Content, len(batch))
+		for i, t := range batch {
+			contents[i] = genai.NewContentFromText(t, genai.RoleUser)
+		}
+		resp, err := e.Client.Models.EmbedContent(ctx, e.Model, contents, &genai.EmbedContentConfig{TaskType: string(task)})
+		if err != nil {
+			return nil, fmt.Errorf("embedding with %s: %w", e.Model, err)
+		}
+		if len(resp.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("embedding with %s: got %d embeddings for %d texts", e.Model, len(resp.Embeddings), len(batch))
+		}
+		for _, emb := range resp.Embeddings {
+			vecs = append(vecs, normalize(emb.Values))
+		}
+	}
+	return vecs, nil
+}
+
+// normalize scales v to length 1, so that cosine similarity is just the
+// dot product.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= n
+	}
+	return v
+}
+
+// dot is the dot product of two vectors of the same length.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
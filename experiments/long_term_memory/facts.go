@@ -0,0 +1,524 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// factsSessionID is the session under which a user's facts are added to
+// the memory service that searches them.
+const factsSessionID = "user-facts"
+
+// Fact is one thing learned about a user, such as that their favorite
+// color is blue.
+type Fact struct {
+	ID      string `json:"id"`
+	AppName string `json:"app_name"`
+	UserID  string `json:"user_id"`
+	// Key is what the fact is about, such as "favorite color". A user has
+	// at most one fact for each key.
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Confidence is how sure the extractor was, from 0 to 1.
+	Confidence float64 `json:"confidence"`
+	// Sources are the IDs of the events that state the fact, and
+	// SessionID the session they are in.
+	Sources   []string `json:"sources"`
+	SessionID string   `json:"session_id"`
+	// StatedAt is when the fact was last stated; UpdatedAt when it was
+	// last changed here.
+	StatedAt  time.Time `json:"stated_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Replaced lists the values this fact had before, oldest first.
+	Replaced []string `json:"replaced,omitempty"`
+}
+
+// Text is how the fact is remembered and searched for. It has no
+// punctuation next to the key or value, because memory.InMemoryService
+// only splits words at spaces.
+func (f *Fact) Text() string {
+	return fmt.Sprintf("user's %s is %s", f.Key, f.Value)
+}
+
+// extractedFact is a fact as the extractor reports it.
+type extractedFact struct {
+	Key        string   `json:"key"`
+	Value      string   `json:"value"`
+	Confidence float64  `json:"confidence"`
+	Sources    []string `json:"sources"`
+}
+
+// FactExtractor runs an agent that reads a conversation and lists the
+// facts it states about the user.
+type FactExtractor struct {
+	runner   *runner.Runner
+	sessions session.Service
+}
+
+const extractorApp = "fact_extractor"
+
+const extractorInstruction = `You read a conversation between a user and an assistant and list the facts it states about the user that are worth remembering in later conversations: their preferences, personal details, plans and circumstances.
+
+Each line of the conversation starts with the event ID in square brackets, then who spoke.
+
+Rules:
+- Only list facts the user stated or clearly confirmed. Ignore greetings, acknowledgements and anything only the assistant said.
+- key is a short, lower-case name for what the fact is about, such as "favorite color" or "home city". If one of the known facts is about the same thing, use its key exactly.
+- value is the fact itself, as short as possible, such as "blue".
+- If the user says something that changes a known fact, list the new value under the same key.
+- confidence is from 0 to 1: how sure you are that the user meant it and that it still holds.
+- sources are the IDs of the events that state the fact.
+- If there are no facts, return an empty list.`
+
+var extractorSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"facts": {
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"key":        {Type: genai.TypeString},
+					"value":      {Type: genai.TypeString},
+					"confidence": {Type: genai.TypeNumber},
+					"sources":    {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+				},
+				Required: []string{"key", "value", "confidence", "sources"},
+			},
+		},
+	},
+	Required: []string{"facts"},
+}
+
+// NewFactExtractor returns an extractor that uses m.
+func NewFactExtractor(m model.LLM) (*FactExtractor, error) {
+	a, err := llmagent.New(llmagent.Config{
+		Name:         "fact_extractor",
+		Model:        m,
+		Instruction:  extractorInstruction,
+		OutputSchema: extractorSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sessions := session.InMemoryService()
+	r, err := runner.New(runner.Config{AppName: extractorApp, Agent: a, SessionService: sessions})
+	if err != nil {
+		return nil, err
+	}
+	return &FactExtractor{runner: r, sessions: sessions}, nil
+}
+
+// Extract returns the facts s states about its user. known are the facts
+// already known, so the extractor can reuse their keys.
+func (e *FactExtractor) Extract(ctx context.Context, s session.Session, known []*Fact) ([]extractedFact, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Known facts:\n")
+	if len(known) == 0 {
+		prompt.WriteString("(none)\n")
+	}
+	for _, f := range known {
+		fmt.Fprintf(&prompt, "- %s: %s\n", f.Key, f.Value)
+	}
+	prompt.WriteString("\nConversation:\n")
+	lines := 0
+	for ev := range s.Events().All() {
+		if text := eventText(ev); text != "" {
+			fmt.Fprintf(&prompt, "[%s] %s: %s\n", ev.ID, ev.Author, text)
+			lines++
+		}
+	}
+	if lines == 0 {
+		return nil, nil
+	}
+
+	// Each extraction is a conversation of its own.
+	userID := s.AppName() + "/" + s.UserID()
+	created, err := e.sessions.Create(ctx, &session.CreateRequest{AppName: extractorApp, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	sessionID := created.Session.ID()
+	defer e.sessions.Delete(ctx, &session.DeleteRequest{AppName: extractorApp, UserID: userID, SessionID: sessionID})
+
+	var out string
+	msg := genai.NewContentFromText(prompt.String(), genai.RoleUser)
+	for ev, err := range e.runner.Run(ctx, userID, sessionID, msg, agent.RunConfig{}) {
+		if err != nil {
+			return nil, fmt.Errorf("extracting facts: %w", err)
+		}
+		if ev.IsFinalResponse() {
+			out = eventText(ev)
+		}
+	}
+	var result struct {
+		Facts []extractedFact `json:"facts"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return nil, fmt.Errorf("extracting facts: reading %q: %w", out, err)
+	}
+	return result.Facts, nil
+}
+
+// eventText is the text of ev's parts.
+func eventText(ev *session.Event) string {
+	if ev.LLMResponse.Content == nil {
+		return ""
+	}
+	var text []string
+	for _, p := range ev.LLMResponse.Content.Parts {
+		if p.Text != "" {
+			text = append(text, p.Text)
+		}
+	}
+	return strings.Join(text, " ")
+}
+
+// FactMemory is a memory.Service that remembers facts about the user
+// rather than the conversation itself. When a session is added, it has the
+// extractor list the session's facts and reconciles them with the facts it
+// already knows; searches then find facts such as "user's favorite color is
+// blue" instead of the "Got it!" around them.
+//
+// The facts are kept, with their confidence and sources, in a file. They
+// are searched with another memory.Service, to which each user's facts are
+// added as a session of their own.
+type FactMemory struct {
+	extractor *FactExtractor
+	store     memory.Service
+	path      string
+	// minConfidence is the confidence a fact needs to be kept.
+	minConfidence float64
+
+	mu    sync.Mutex
+	facts map[textKey][]*Fact
+	edits memoryEdits
+	// sessions builds the sessions facts are added to store in.
+	sessions session.Service
+}
+
+var _ ManagedMemory = (*FactMemory)(nil)
+
+// factFile is the file a FactMemory is saved in.
+type factFile struct {
+	Facts []*Fact `json:"facts"`
+	// Edits.Forgotten holds the source events of forgotten facts.
+	Edits memoryEdits `json:"edits"`
+}
+
+// OpenFactMemory opens the facts saved at path, or starts with none if
+// there is no file there yet, and adds them to store for searching. An
+// empty path keeps them in memory only.
+// Extracted facts less certain than minConfidence are dropped.
+func OpenFactMemory(ctx context.Context, path string, extractor *FactExtractor, store memory.Service, minConfidence float64) (*FactMemory, error) {
+	m := &FactMemory{
+		extractor:     extractor,
+		store:         store,
+		path:          path,
+		minConfidence: minConfidence,
+		facts:         make(map[textKey][]*Fact),
+		sessions:      session.InMemoryService(),
+	}
+	if path == "" {
+		return m, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening facts: %w", err)
+	}
+	var file factFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("reading facts %s: %w", path, err)
+	}
+	for _, f := range file.Facts {
+		k := textKey{f.AppName, f.UserID}
+		m.facts[k] = append(m.facts[k], f)
+	}
+	m.edits = file.Edits
+	for k := range m.facts {
+		if err := m.publish(ctx, k); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// AddSession extracts the facts s states and reconciles them with the
+// user's known facts:
+//
+//   - a fact with a new key is added;
+//   - a fact with the same key and value confirms the known one, which
+//     gains its sources and keeps the higher confidence;
+//   - a fact with the same key and another value contradicts the known
+//     one. The value stated last wins, and the one it replaces is kept in
+//     Replaced.
+//
+// Adding a session again extracts it again, which only confirms what it
+// already said.
+func (m *FactMemory) AddSession(ctx context.Context, s session.Session) error {
+	if m.extractor == nil {
+		return errors.New("adding a session to fact memory: there is no fact extractor")
+	}
+	k := textKey{s.AppName(), s.UserID()}
+	m.mu.Lock()
+	known := slices.Clone(m.facts[k])
+	m.mu.Unlock()
+
+	extracted, err := m.extractor.Extract(ctx, s, known)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Events the user had forgotten, or said before a wipe, can't be the
+	// source of a fact.
+	stated := make(map[string]time.Time)
+	for ev := range s.Events().All() {
+		if _, ok := m.edits.apply(k.appName, k.userID, ev.ID, ev.Timestamp, ""); ok {
+			stated[ev.ID] = ev.Timestamp
+		}
+	}
+	facts := slices.Clone(m.facts[k])
+	for _, x := range extracted {
+		key := normalizeKey(x.Key)
+		value := strings.TrimSpace(x.Value)
+		if key == "" || value == "" || x.Confidence < m.minConfidence {
+			continue
+		}
+		// Only sources in this session count, and the fact was stated when
+		// the last of them was.
+		var sources []string
+		var statedAt time.Time
+		for _, id := range x.Sources {
+			t, ok := stated[id]
+			if !ok || slices.Contains(sources, id) {
+				continue
+			}
+			sources = append(sources, id)
+			if t.After(statedAt) {
+				statedAt = t
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		now := time.Now()
+
+		i := slices.IndexFunc(facts, func(f *Fact) bool { return f.Key == key })
+		if i < 0 {
+			facts = append(facts, &Fact{
+				ID:         uuid.NewString(),
+				AppName:    k.appName,
+				UserID:     k.userID,
+				Key:        key,
+				Value:      value,
+				Confidence: x.Confidence,
+				Sources:    sources,
+				SessionID:  s.ID(),
+				StatedAt:   statedAt,
+				UpdatedAt:  now,
+			})
+			continue
+		}
+		f := *facts[i]
+		switch {
+		case strings.EqualFold(f.Value, value):
+			f.Confidence = max(f.Confidence, x.Confidence)
+			for _, id := range sources {
+				if !slices.Contains(f.Sources, id) {
+					f.Sources = append(f.Sources, id)
+				}
+			}
+			if statedAt.After(f.StatedAt) {
+				f.StatedAt, f.SessionID = statedAt, s.ID()
+			}
+		case statedAt.After(f.StatedAt):
+			log.Printf("User %s's %s changed from %q to %q", k.userID, key, f.Value, value)
+			f.Replaced = append(slices.Clone(f.Replaced), f.Value)
+			f.Value, f.Confidence, f.Sources = value, x.Confidence, sources
+			f.StatedAt, f.SessionID = statedAt, s.ID()
+		default:
+			// An older session said otherwise; what was said last stands.
+			continue
+		}
+		f.UpdatedAt = now
+		facts[i] = &f
+	}
+
+	return m.commit(ctx, k, facts, m.edits)
+}
+
+// List returns the user's facts. Each memory's ID is the fact's ID.
+func (m *FactMemory) List(ctx context.Context, appName, userID string) ([]MemoryRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []MemoryRecord
+	for _, f := range m.facts[textKey{appName, userID}] {
+		records = append(records, MemoryRecord{ID: f.ID, Text: f.Text(), Author: "user", Timestamp: f.StatedAt, SessionID: f.SessionID})
+	}
+	slices.SortFunc(records, func(a, b MemoryRecord) int { return a.Timestamp.Compare(b.Timestamp) })
+	return records, nil
+}
+
+// Delete forgets the fact, and the events it came from, so that adding
+// their session again doesn't bring it back.
+func (m *FactMemory) Delete(ctx context.Context, appName, userID, id string) error {
+	return m.change(ctx, textKey{appName, userID}, id, func(f *Fact, edits *memoryEdits) *Fact {
+		for _, src := range f.Sources {
+			edits.forget(src)
+		}
+		return nil
+	})
+}
+
+// Update sets the fact's value to text, or to what follows "user's <key>
+// is" in text. The correction counts as the latest statement of the fact,
+// so nothing said before it can undo it.
+func (m *FactMemory) Update(ctx context.Context, appName, userID, id, text string) error {
+	return m.change(ctx, textKey{appName, userID}, id, func(f *Fact, _ *memoryEdits) *Fact {
+		value := strings.TrimSpace(text)
+		if v, ok := strings.CutPrefix(value, fmt.Sprintf("user's %s is ", f.Key)); ok {
+			value = strings.TrimSpace(v)
+		}
+		nf := *f
+		if !strings.EqualFold(nf.Value, value) {
+			nf.Replaced = append(slices.Clone(nf.Replaced), nf.Value)
+		}
+		nf.Value, nf.Confidence = value, 1
+		nf.StatedAt, nf.UpdatedAt = time.Now(), time.Now()
+		return &nf
+	})
+}
+
+// change replaces the user's fact id with what fn returns, or removes it if
+// fn returns nil, and saves and publishes the change. fn may also record
+// the change in edits.
+func (m *FactMemory) change(ctx context.Context, k textKey, id string, fn func(*Fact, *memoryEdits) *Fact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.facts[k], func(f *Fact) bool { return f.ID == id })
+	if i < 0 {
+		return errNoMemory
+	}
+	edits := m.edits.clone()
+	facts := slices.Clone(m.facts[k])
+	if nf := fn(facts[i], &edits); nf != nil {
+		facts[i] = nf
+	} else {
+		facts = slices.Delete(facts, i, i+1)
+	}
+	return m.commit(ctx, k, facts, edits)
+}
+
+// Wipe forgets all the user's facts, and everything said before now.
+func (m *FactMemory) Wipe(ctx context.Context, appName, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	n := len(m.facts[k])
+	edits := m.edits.clone()
+	edits.wipe(appName, userID, time.Now())
+	if err := m.commit(ctx, k, nil, edits); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// commit makes facts the user's facts and edits the edits, saves them and
+// publishes the facts. If they can't be saved, nothing changes. m.mu must
+// be held.
+func (m *FactMemory) commit(ctx context.Context, k textKey, facts []*Fact, edits memoryEdits) error {
+	oldFacts, oldEdits := m.facts[k], m.edits
+	m.facts[k], m.edits = facts, edits
+	if err := m.save(); err != nil {
+		m.facts[k], m.edits = oldFacts, oldEdits
+		return err
+	}
+	return m.publish(ctx, k)
+}
+
+// Search searches the user's facts.
+func (m *FactMemory) Search(ctx context.Context, req *memory.SearchRequest) (*memory.SearchResponse, error) {
+	return m.store.Search(ctx, req)
+}
+
+// publish adds the user's facts to the store, as one session with an event
+// for each fact, replacing what was there.
+func (m *FactMemory) publish(ctx context.Context, k textKey) error {
+	m.sessions.Delete(ctx, &session.DeleteRequest{AppName: k.appName, UserID: k.userID, SessionID: factsSessionID})
+	created, err := m.sessions.Create(ctx, &session.CreateRequest{AppName: k.appName, UserID: k.userID, SessionID: factsSessionID})
+	if err != nil {
+		return err
+	}
+	s := created.Session
+	for _, f := range m.facts[k] {
+		ev := session.NewEvent(factsSessionID)
+		ev.ID, ev.Timestamp, ev.Author = f.ID, f.StatedAt, "user"
+		ev.LLMResponse.Content = genai.NewContentFromText(f.Text(), genai.RoleUser)
+		if err := m.sessions.AppendEvent(ctx, s, ev); err != nil {
+			return err
+		}
+	}
+	return m.store.AddSession(ctx, s)
+}
+
+// save writes every user's facts to the file. m.mu must be held.
+func (m *FactMemory) save() error {
+	if m.path == "" {
+		return nil
+	}
+	file := factFile{Edits: m.edits}
+	for _, facts := range m.facts {
+		file.Facts = append(file.Facts, facts...)
+	}
+	slices.SortFunc(file.Facts, func(a, b *Fact) int {
+		return cmp.Or(cmp.Compare(a.AppName, b.AppName), cmp.Compare(a.UserID, b.UserID), cmp.Compare(a.Key, b.Key))
+	})
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, b)
+}
+
+// normalizeKey lower-cases key and collapses its spaces, so "Favorite
+// Color" and "favorite  color" are the same fact.
+func normalizeKey(key string) string {
+	return strings.Join(strings.Fields(strings.ToLower(key)), " ")
+}
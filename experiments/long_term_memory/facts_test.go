@@ -0,0 +1,271 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"iter"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// factModel is a scripted extractor. Each user line of the conversation
+// that reads "key=value confidence [sources]" states a fact. sources is a
+// comma-separated list of event IDs, where "self" is the line's own event;
+// it defaults to "self". It records every prompt.
+type factModel struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+var factLine = regexp.MustCompile(`(?m)^\[([^\]]+)\] user: ([^=\n]*)=(\S*) ([0-9.]+)(?: (\S+))?$`)
+
+func (*factModel) Name() string { return "facts" }
+
+func (m *factModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	var prompt string
+	for _, p := range req.Contents[len(req.Contents)-1].Parts {
+		prompt += p.Text
+	}
+	m.mu.Lock()
+	m.prompts = append(m.prompts, prompt)
+	m.mu.Unlock()
+
+	facts := []extractedFact{}
+	for _, match := range factLine.FindAllStringSubmatch(prompt, -1) {
+		confidence, _ := strconv.ParseFloat(match[4], 64)
+		sources := []string{}
+		for _, id := range strings.Split(cmp.Or(match[5], "self"), ",") {
+			if id == "self" {
+				id = match[1]
+			}
+			sources = append(sources, id)
+		}
+		facts = append(facts, extractedFact{Key: match[2], Value: match[3], Confidence: confidence, Sources: sources})
+	}
+	b, _ := json.Marshal(map[string]any{"facts": facts})
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(&model.LLMResponse{Content: genai.NewContentFromText(string(b), genai.RoleModel)}, nil)
+	}
+}
+
+func (m *factModel) lastPrompt() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prompts[len(m.prompts)-1]
+}
+
+// factEnv is a FactMemory with a scripted extractor.
+type factEnv struct {
+	*checkEnv
+	facts *FactMemory
+	llm   *factModel
+}
+
+func newFactEnv(t *testing.T, minConfidence float64) *factEnv {
+	t.Helper()
+	llm := &factModel{}
+	extractor, err := NewFactExtractor(llm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenTextMemory("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenFactMemory(t.Context(), "", extractor, store, minConfidence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &factEnv{checkEnv: &checkEnv{mem: m, sessions: session.InMemoryService()}, facts: m, llm: llm}
+}
+
+// say creates a session in which the user says each line, and the agent
+// answers "noted", without adding it to memory.
+func (e *factEnv) say(t *testing.T, lines ...string) session.Session {
+	t.Helper()
+	resp, err := e.sessions.Create(t.Context(), &session.CreateRequest{AppName: checkApp, UserID: checkUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := resp.Session
+	for _, line := range lines {
+		if s, err = e.append(t.Context(), s, line, "noted"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func (e *factEnv) add(t *testing.T, s session.Session) {
+	t.Helper()
+	if err := e.facts.AddSession(t.Context(), s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// known returns the user's facts by key.
+func (e *factEnv) known() map[string]Fact {
+	e.facts.mu.Lock()
+	defer e.facts.mu.Unlock()
+	known := make(map[string]Fact)
+	for _, f := range e.facts.facts[textKey{checkApp, checkUser}] {
+		known[f.Key] = *f
+	}
+	return known
+}
+
+func TestFactMemoryReconciles(t *testing.T) {
+	env := newFactEnv(t, 0.6)
+	older := env.say(t, "favorite color=blue 0.9")
+	confirming := env.say(t, "Favorite  Color=Blue 0.7")
+	changing := env.say(t, "favorite color=green 0.8")
+	id := func(s session.Session) string { return s.Events().At(0).ID }
+	at := func(s session.Session) string { return s.Events().At(0).Timestamp.String() }
+
+	type want struct {
+		value      string
+		confidence float64
+		sources    []string
+		session    session.Session
+		replaced   []string
+	}
+	check := func(t *testing.T, w want) {
+		t.Helper()
+		f, ok := env.known()["favorite color"]
+		if !ok {
+			t.Fatalf("no favorite color in %v", env.known())
+		}
+		if f.Value != w.value || f.Confidence != w.confidence || !reflect.DeepEqual(f.Sources, w.sources) ||
+			f.SessionID != w.session.ID() || f.StatedAt.String() != at(w.session) || !reflect.DeepEqual(f.Replaced, w.replaced) {
+			t.Errorf("got %+v, want %+v", f, w)
+		}
+		if n := len(env.known()); n != 1 {
+			t.Errorf("got %d facts, want 1", n)
+		}
+	}
+
+	t.Run("new key", func(t *testing.T) {
+		env.add(t, older)
+		check(t, want{"blue", 0.9, []string{id(older)}, older, nil})
+		if err := env.expect(t.Context(), checkApp, checkUser, "color", []string{"user's favorite color is blue"}); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("same value confirms", func(t *testing.T) {
+		env.add(t, confirming)
+		// The known fact is in the prompt, so its key can be reused.
+		if !strings.Contains(env.llm.lastPrompt(), "- favorite color: blue\n") {
+			t.Errorf("the prompt did not list the known fact:\n%s", env.llm.lastPrompt())
+		}
+		check(t, want{"blue", 0.9, []string{id(older), id(confirming)}, confirming, nil})
+	})
+	t.Run("later value replaces", func(t *testing.T) {
+		env.add(t, changing)
+		check(t, want{"green", 0.8, []string{id(changing)}, changing, []string{"blue"}})
+		if err := env.expect(t.Context(), checkApp, checkUser, "color", []string{"user's favorite color is green"}); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("older session does not override", func(t *testing.T) {
+		env.add(t, older)
+		env.add(t, confirming)
+		check(t, want{"green", 0.8, []string{id(changing)}, changing, []string{"blue"}})
+	})
+	t.Run("adding again only confirms", func(t *testing.T) {
+		env.add(t, changing)
+		check(t, want{"green", 0.8, []string{id(changing)}, changing, []string{"blue"}})
+	})
+}
+
+func TestFactMemoryMinConfidence(t *testing.T) {
+	env := newFactEnv(t, 0.6)
+	env.add(t, env.say(t,
+		"pet=cat 0.6",
+		"home city=paris 0.59",
+		"=nothing 0.9",
+		"job= 0.9",
+	))
+	known := env.known()
+	if _, ok := known["pet"]; !ok || len(known) != 1 {
+		t.Errorf("got %v, want only the pet, at exactly the cutoff", known)
+	}
+
+	// A confident restatement of a dropped fact is kept.
+	env.add(t, env.say(t, "home city=paris 0.95"))
+	if f := env.known()["home city"]; f.Value != "paris" || f.Confidence != 0.95 {
+		t.Errorf("got %+v, want paris at 0.95", f)
+	}
+}
+
+func TestFactMemorySources(t *testing.T) {
+	env := newFactEnv(t, 0.5)
+	other := env.say(t, "pet=dog 0.9")
+	otherID := other.Events().At(0).ID
+
+	s := env.say(t,
+		"pet=cat 0.9 self,"+otherID+",self",
+		"home city=paris 0.9 "+otherID,
+		"job=baker 0.9 no-such-event",
+	)
+	env.add(t, s)
+	known := env.known()
+	// Sources in other sessions, or no session, don't count, and a fact
+	// with none left is dropped.
+	if f := known["pet"]; !reflect.DeepEqual(f.Sources, []string{s.Events().At(0).ID}) {
+		t.Errorf("got pet %+v, want only its own source, once", f)
+	}
+	if len(known) != 1 {
+		t.Errorf("got %v, want only the pet", known)
+	}
+}
+
+func TestFactMemoryForgottenSources(t *testing.T) {
+	env := newFactEnv(t, 0.5)
+	s := env.say(t, "pet=cat 0.9")
+	env.add(t, s)
+	if err := env.facts.Delete(t.Context(), checkApp, checkUser, env.known()["pet"].ID); err != nil {
+		t.Fatal(err)
+	}
+	// Adding its session again doesn't bring it back...
+	env.add(t, s)
+	if known := env.known(); len(known) != 0 {
+		t.Errorf("got %v after forgetting, want nothing", known)
+	}
+	// ...but saying it again does.
+	env.add(t, env.say(t, "pet=cat 0.9"))
+	if f, ok := env.known()["pet"]; !ok || f.Value != "cat" {
+		t.Errorf("got %v, want the restated pet", env.known())
+	}
+
+	// Nothing said before a wipe is a source.
+	if _, err := env.facts.Wipe(t.Context(), checkApp, checkUser); err != nil {
+		t.Fatal(err)
+	}
+	env.add(t, s)
+	if known := env.known(); len(known) != 0 {
+		t.Errorf("got %v after the wipe, want nothing", known)
+	}
+}
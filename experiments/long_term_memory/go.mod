@@ -5,6 +5,7 @@ go 1.25.2
 replace google.golang.org/adk => /Users/ghchinoy/dev/github/adk-go
 
 require (
+	github.com/google/uuid v1.6.0
 	google.golang.org/adk v0.0.0-00010101000000-000000000000
 	google.golang.org/genai v1.34.0
 )
@@ -19,7 +20,6 @@ require (
 	github.com/google/go-cmp v0.7.0 // indirect
 	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/google/s2a-go v0.1.9 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.6 // indirect
 	github.com/googleapis/gax-go/v2 v2.15.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
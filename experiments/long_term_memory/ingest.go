@@ -0,0 +1,304 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+)
+
+// IngestOptions says when an IngestingService adds a session to memory.
+// CloseSession and Close always do.
+type IngestOptions struct {
+	// OnTurnEnd adds the session when the agent gives its final response
+	// to a message.
+	OnTurnEnd bool
+	// IdleAfter, if not zero, adds the session once no event has been
+	// appended to it for this long.
+	IdleAfter time.Duration
+}
+
+// IngestingService is a session.Service that adds its sessions to a
+// memory.Service by itself, so the program doesn't have to re-fetch each
+// session and call AddSession.
+//
+// It always adds the session as stored, fetched again with Get, never the
+// copy a caller holds. A session with no new events since it was last
+// added is skipped, so closing a session that was just added at the end of
+// a turn doesn't add it again.
+//
+// Sessions are added in the background, one at a time per session, so a
+// slow memory service holds up neither the turn nor other sessions.
+type IngestingService struct {
+	session.Service
+	memory memory.Service
+	opts   IngestOptions
+
+	// wg counts the ingestions running in the background.
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[sessionKey]*ingestState
+	closed   bool
+}
+
+// maxRememberedSessions bounds how many sessions with nothing pending are
+// remembered, to skip adding them again unchanged. Past it, those added
+// longest ago are forgotten; adding one of them again only repeats work.
+const maxRememberedSessions = 1000
+
+type sessionKey struct {
+	appName, userID, sessionID string
+}
+
+type ingestState struct {
+	// mu serializes adding the session, so it is never added twice at
+	// once. It guards lastEventID and addedAt.
+	mu sync.Mutex
+	// lastEventID is the ID of the last event when the session was last
+	// added to memory, at addedAt.
+	lastEventID string
+	addedAt     time.Time
+
+	// The rest is guarded by IngestingService.mu.
+
+	// idle fires IdleAfter after the last event. idleGen tells the current
+	// timer from one that was reset just as it fired.
+	idle    *time.Timer
+	idleGen int
+	// busy counts the ingestions using the state; it isn't pruned while
+	// they do.
+	busy int
+}
+
+var _ session.Service = (*IngestingService)(nil)
+
+// NewIngestingService wraps sessions so that they are added to mem as opts
+// says.
+func NewIngestingService(sessions session.Service, mem memory.Service, opts IngestOptions) *IngestingService {
+	return &IngestingService{
+		Service:  sessions,
+		memory:   mem,
+		opts:     opts,
+		sessions: make(map[sessionKey]*ingestState),
+	}
+}
+
+func keyOf(s session.Session) sessionKey {
+	return sessionKey{s.AppName(), s.UserID(), s.ID()}
+}
+
+func (s *IngestingService) AppendEvent(ctx context.Context, sess session.Session, ev *session.Event) error {
+	if err := s.Service.AppendEvent(ctx, sess, ev); err != nil {
+		return err
+	}
+	if ev.Partial {
+		return nil
+	}
+	k := keyOf(sess)
+	if s.opts.IdleAfter > 0 {
+		s.resetIdle(k)
+	}
+	if s.opts.OnTurnEnd && ev.Author != "user" && ev.IsFinalResponse() {
+		// The event is stored, so a failure to remember it only costs the
+		// memory, not the turn.
+		s.background(context.WithoutCancel(ctx), k)
+	}
+	return nil
+}
+
+// background adds the session k to memory without waiting for it. Once
+// the service is closed, it adds it before returning instead.
+func (s *IngestingService) background(ctx context.Context, k sessionKey) {
+	s.mu.Lock()
+	closed := s.closed
+	if !closed {
+		s.wg.Add(1)
+	}
+	s.mu.Unlock()
+	if closed {
+		if err := s.ingest(ctx, k); err != nil {
+			log.Printf("Adding session %s to memory: %v", k.sessionID, err)
+		}
+		return
+	}
+	go func() {
+		defer s.wg.Done()
+		if err := s.ingest(ctx, k); err != nil {
+			log.Printf("Adding session %s to memory: %v", k.sessionID, err)
+		}
+	}()
+}
+
+func (s *IngestingService) resetIdle(k sessionKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	st := s.state(k)
+	if st.idle != nil {
+		st.idle.Stop()
+	}
+	st.idleGen++
+	gen := st.idleGen
+	st.idle = time.AfterFunc(s.opts.IdleAfter, func() { s.wentIdle(k, gen) })
+}
+
+// wentIdle adds the session k to memory when its idle timer of generation
+// gen fires, unless the timer was since reset or stopped. Once the service
+// is closed, Close adds it instead.
+func (s *IngestingService) wentIdle(k sessionKey, gen int) {
+	s.mu.Lock()
+	st, ok := s.sessions[k]
+	if s.closed || !ok || st.idle == nil || st.idleGen != gen {
+		s.mu.Unlock()
+		return
+	}
+	st.idle = nil
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+	if err := s.ingest(context.Background(), k); err != nil {
+		log.Printf("Adding idle session %s to memory: %v", k.sessionID, err)
+	}
+}
+
+// state returns the state for k, creating it. s.mu must be held.
+func (s *IngestingService) state(k sessionKey) *ingestState {
+	st, ok := s.sessions[k]
+	if !ok {
+		st = &ingestState{}
+		s.sessions[k] = st
+	}
+	return st
+}
+
+// prune forgets the sessions with nothing pending that were added longest
+// ago, once more than maxRememberedSessions are remembered. s.mu must be
+// held.
+func (s *IngestingService) prune() {
+	if len(s.sessions) <= maxRememberedSessions {
+		return
+	}
+	var done []sessionKey
+	for k, st := range s.sessions {
+		// Nobody holds st.mu while busy is zero, and s.mu keeps it so.
+		if st.idle == nil && st.busy == 0 {
+			done = append(done, k)
+		}
+	}
+	slices.SortFunc(done, func(a, b sessionKey) int {
+		return s.sessions[a].addedAt.Compare(s.sessions[b].addedAt)
+	})
+	// Down to half, so pruning doesn't run again on the next add.
+	n := min(len(s.sessions)-maxRememberedSessions/2, len(done))
+	for _, k := range done[:n] {
+		delete(s.sessions, k)
+	}
+}
+
+// ingest adds the stored session k to memory, unless it hasn't changed
+// since it was last added.
+func (s *IngestingService) ingest(ctx context.Context, k sessionKey) error {
+	s.mu.Lock()
+	st := s.state(k)
+	st.busy++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		st.busy--
+		s.prune()
+		s.mu.Unlock()
+	}()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	resp, err := s.Service.Get(ctx, &session.GetRequest{AppName: k.appName, UserID: k.userID, SessionID: k.sessionID})
+	if err != nil {
+		return err
+	}
+	events := resp.Session.Events()
+	if events.Len() == 0 {
+		return nil
+	}
+	last := events.At(events.Len() - 1).ID
+	if st.lastEventID == last {
+		return nil
+	}
+	if err := s.memory.AddSession(ctx, resp.Session); err != nil {
+		return err
+	}
+	st.lastEventID, st.addedAt = last, time.Now()
+	return nil
+}
+
+// CloseSession adds the session to memory now and stops watching it for
+// idleness. Call it when a conversation is over.
+func (s *IngestingService) CloseSession(ctx context.Context, appName, userID, sessionID string) error {
+	k := sessionKey{appName, userID, sessionID}
+	s.stopIdle(k)
+	return s.ingest(ctx, k)
+}
+
+// Delete deletes the session. What was already added to memory stays.
+func (s *IngestingService) Delete(ctx context.Context, req *session.DeleteRequest) error {
+	k := sessionKey{req.AppName, req.UserID, req.SessionID}
+	s.stopIdle(k)
+	s.mu.Lock()
+	delete(s.sessions, k)
+	s.mu.Unlock()
+	return s.Service.Delete(ctx, req)
+}
+
+func (s *IngestingService) stopIdle(k sessionKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.sessions[k]; ok && st.idle != nil {
+		st.idle.Stop()
+		st.idle = nil
+	}
+}
+
+// Close waits for the sessions being added in the background, then adds
+// every session still waiting to go idle to memory, and stops the idle
+// timers. Call it before the program exits.
+func (s *IngestingService) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	var waiting []sessionKey
+	for k, st := range s.sessions {
+		if st.idle != nil {
+			st.idle.Stop()
+			waiting = append(waiting, k)
+		}
+		st.idle = nil
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	var errs []error
+	for _, k := range waiting {
+		errs = append(errs, s.ingest(ctx, k))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,265 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// recordingMemory sends every session it is asked to add on added.
+type recordingMemory struct {
+	memory.Service
+	added chan session.Session
+	// release, if not nil, holds AddSession until it is closed.
+	release chan struct{}
+}
+
+func newRecordingMemory() *recordingMemory {
+	return &recordingMemory{added: make(chan session.Session, 2*maxRememberedSessions)}
+}
+
+func (m *recordingMemory) AddSession(ctx context.Context, s session.Session) error {
+	m.added <- s
+	if m.release != nil {
+		<-m.release
+	}
+	return nil
+}
+
+// next waits for the next session to be added and returns how many events
+// it had.
+func (m *recordingMemory) next(t *testing.T) (string, int) {
+	t.Helper()
+	select {
+	case s := <-m.added:
+		return s.ID(), s.Events().Len()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no session was added")
+		return "", 0
+	}
+}
+
+// none checks that no session is added within a while.
+func (m *recordingMemory) none(t *testing.T) {
+	t.Helper()
+	select {
+	case s := <-m.added:
+		t.Errorf("session %s was added with %d events, want it skipped", s.ID(), s.Events().Len())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// newIngestEnv returns an IngestingService over a fresh in-memory session
+// service, and one of its sessions.
+func newIngestEnv(t *testing.T, mem memory.Service, opts IngestOptions) (*IngestingService, session.Session) {
+	t.Helper()
+	s := NewIngestingService(session.InMemoryService(), mem, opts)
+	t.Cleanup(func() { s.Close(context.Background()) })
+	return s, newIngestSession(t, s)
+}
+
+func newIngestSession(t *testing.T, s *IngestingService) session.Session {
+	t.Helper()
+	resp, err := s.Create(t.Context(), &session.CreateRequest{AppName: checkApp, UserID: checkUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Session
+}
+
+// say appends an event from author with text. It may be called from
+// another goroutine.
+func say(t *testing.T, s *IngestingService, sess session.Session, author, text string, partial bool) {
+	t.Helper()
+	ev := session.NewEvent("turn")
+	ev.Author = author
+	role := genai.Role(genai.RoleModel)
+	if author == "user" {
+		role = genai.RoleUser
+	}
+	ev.LLMResponse.Content = genai.NewContentFromText(text, role)
+	ev.Partial = partial
+	if err := s.AppendEvent(t.Context(), sess, ev); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIngestOnTurnEnd(t *testing.T) {
+	mem := newRecordingMemory()
+	s, sess := newIngestEnv(t, mem, IngestOptions{OnTurnEnd: true})
+
+	say(t, s, sess, "user", "my favorite color is blue", false)
+	say(t, s, sess, "memory_agent", "Not", true)
+	mem.none(t)
+	say(t, s, sess, "memory_agent", "Noted.", false)
+	if id, n := mem.next(t); id != sess.ID() || n != 2 {
+		t.Errorf("added session %s with %d events, want %s as stored, with 2", id, n, sess.ID())
+	}
+
+	// Closing it right after its turn adds nothing.
+	if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+		t.Fatal(err)
+	}
+	mem.none(t)
+
+	say(t, s, sess, "user", "and green", false)
+	say(t, s, sess, "memory_agent", "Noted too.", false)
+	if _, n := mem.next(t); n != 4 {
+		t.Errorf("added the session with %d events, want 4", n)
+	}
+}
+
+func TestIngestOnTurnEndInBackground(t *testing.T) {
+	mem := newRecordingMemory()
+	mem.release = make(chan struct{})
+	s, first := newIngestEnv(t, mem, IngestOptions{OnTurnEnd: true})
+	second := newIngestSession(t, s)
+
+	// Neither turn waits for memory, and one session being added doesn't
+	// hold up another.
+	done := make(chan struct{})
+	go func() {
+		say(t, s, first, "memory_agent", "Noted.", false)
+		say(t, s, second, "memory_agent", "Noted.", false)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the turns waited for memory")
+	}
+	got := map[string]bool{}
+	for range 2 {
+		id, _ := mem.next(t)
+		got[id] = true
+	}
+	if !got[first.ID()] || !got[second.ID()] {
+		t.Errorf("added %v, want both sessions at once", got)
+	}
+
+	// Close waits for them.
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while sessions were being added")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(mem.release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIngestWhenIdle(t *testing.T) {
+	mem := newRecordingMemory()
+	s, sess := newIngestEnv(t, mem, IngestOptions{IdleAfter: 30 * time.Millisecond})
+
+	say(t, s, sess, "user", "my favorite color is blue", false)
+	say(t, s, sess, "memory_agent", "Noted.", false)
+	// Added once, after the last event, not once per event.
+	if _, n := mem.next(t); n != 2 {
+		t.Errorf("added the session with %d events, want 2", n)
+	}
+	mem.none(t)
+
+	// Closing it once it was added idle adds nothing.
+	if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+		t.Fatal(err)
+	}
+	mem.none(t)
+}
+
+func TestIngestCloseSession(t *testing.T) {
+	mem := newRecordingMemory()
+	s, sess := newIngestEnv(t, mem, IngestOptions{IdleAfter: time.Hour})
+
+	say(t, s, sess, "user", "my favorite color is blue", false)
+	if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, n := mem.next(t); n != 1 {
+		t.Errorf("added the session with %d events, want 1", n)
+	}
+	if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+		t.Fatal(err)
+	}
+	mem.none(t)
+
+	// A closed session is no longer waiting to go idle.
+	if err := s.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	mem.none(t)
+}
+
+func TestIngestCloseOnExit(t *testing.T) {
+	mem := newRecordingMemory()
+	s, sess := newIngestEnv(t, mem, IngestOptions{IdleAfter: time.Hour})
+	say(t, s, sess, "user", "my favorite color is blue", false)
+	mem.none(t)
+
+	if err := s.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	// Only the session waiting to go idle.
+	if id, n := mem.next(t); id != sess.ID() || n != 1 {
+		t.Errorf("added session %s with %d events, want %s with 1", id, n, sess.ID())
+	}
+	mem.none(t)
+
+	// After Close, a turn's end adds the session before returning.
+	s.opts.OnTurnEnd = true
+	say(t, s, sess, "memory_agent", "Noted.", false)
+	select {
+	case <-mem.added:
+	default:
+		t.Error("the session was not added after Close")
+	}
+}
+
+func TestIngestForgetsSessions(t *testing.T) {
+	mem := newRecordingMemory()
+	s, sess := newIngestEnv(t, mem, IngestOptions{})
+
+	say(t, s, sess, "user", "hello", false)
+	if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+		t.Fatal(err)
+	}
+	mem.next(t)
+	if err := s.Delete(t.Context(), &session.DeleteRequest{AppName: checkApp, UserID: checkUser, SessionID: sess.ID()}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.sessions); n != 0 {
+		t.Errorf("%d sessions remembered after Delete, want none", n)
+	}
+
+	for range maxRememberedSessions + 1 {
+		sess := newIngestSession(t, s)
+		say(t, s, sess, "user", "hello", false)
+		if err := s.CloseSession(t.Context(), checkApp, checkUser, sess.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.sessions); n > maxRememberedSessions {
+		t.Errorf("%d sessions remembered, want at most %d", n, maxRememberedSessions)
+	}
+}
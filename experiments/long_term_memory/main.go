@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
@@ -41,7 +43,7 @@ type RecallResult struct {
 
 func recall(ctx tool.Context, args RecallArgs) RecallResult {
 	fmt.Printf("  [Tool] Recalling memory for query: '%s'\n", args.Query)
-	resp, err := ctx.SearchMemory(context.Background(), args.Query)
+	resp, err := ctx.SearchMemory(ctx, args.Query)
 	if err != nil {
 		fmt.Printf("  [Tool] Error searching memory: %v\n", err)
 		return RecallResult{Memories: []string{fmt.Sprintf("Error searching memory: %v", err)}}
@@ -71,21 +73,23 @@ func recall(ctx tool.Context, args RecallArgs) RecallResult {
 	return RecallResult{Memories: memories}
 }
 
+const appName = "memory_experiment"
+
 func main() {
 	ctx := context.Background()
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	if projectID == "" {
-		log.Fatal("GOOGLE_CLOUD_PROJECT environment variable must be set")
+	// "memory list|forget|correct|wipe" shows and changes what is
+	// remembered about a user.
+	if len(os.Args) > 1 && os.Args[1] == "memory" {
+		if err := runMemoryCLI(ctx, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	location := os.Getenv("GOOGLE_CLOUD_LOCATION")
 
 	// 1. Initialize Services
-	cfg := &genai.ClientConfig{
-		Backend: genai.BackendVertexAI,
-		Project: projectID,
-	}
-	if location != "" {
-		cfg.Location = location
+	cfg := clientConfig()
+	if cfg.Project == "" {
+		log.Fatal("GOOGLE_CLOUD_PROJECT environment variable must be set")
 	}
 
 	model, err := gemini.NewModel(ctx, "gemini-2.5-flash", cfg)
@@ -93,8 +97,26 @@ func main() {
 		log.Fatal(err)
 	}
 
-	memService := memory.InMemoryService()
-	sessionService := session.InMemoryService()
+	extractFacts := factsEnabled()
+	var extractor *FactExtractor
+	if extractFacts {
+		if extractor, err = NewFactExtractor(model); err != nil {
+			log.Fatal(err)
+		}
+	}
+	memService, err := openMemory(ctx, cfg, extractor)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Sessions are added to memory at the end of every turn, and after five
+	// idle minutes in case a turn never finishes. Extracting facts takes a
+	// model call, so then sessions are only added once they are over: when
+	// they go idle or are closed.
+	sessionService := NewIngestingService(session.InMemoryService(), memService, IngestOptions{
+		OnTurnEnd: !extractFacts,
+		IdleAfter: 5 * time.Minute,
+	})
+	defer sessionService.Close(ctx)
 
 	// 2. Define Tools
 	recallTool, err := functiontool.New(functiontool.Config{
@@ -105,21 +127,47 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// 3. Define Agent
-	myAgent, err := llmagent.New(llmagent.Config{
-		Name:  "memory_agent",
-		Model: model,
-		Tools: []tool.Tool{recallTool},
-		Instruction: `You have a memory of past conversations.
+	tools := []tool.Tool{recallTool}
+	instruction := `You have a memory of past conversations.
 Use the 'recall' tool to find information from previous sessions if you don't know the answer immediately.
-Always check your memory before saying you don't know something about the user.`,
-	})
+Always check your memory before saying you don't know something about the user.`
+	// Memory services that support it let the user see, forget and
+	// correct what is remembered about them.
+	if managed, ok := memService.(ManagedMemory); ok {
+		memoryTools, err := newMemoryTools(managed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tools = append(tools, memoryTools...)
+		instruction += `
+When the user asks what you know about them, use 'list_memories'. When they ask you to forget something, or say something you remember is wrong, find it with 'list_memories' and use 'forget_memory' or 'correct_memory'.`
+	}
+
+	// 3. Define Agent
+	agentCfg := llmagent.Config{
+		Name:        "memory_agent",
+		Model:       model,
+		Tools:       tools,
+		Instruction: instruction,
+	}
+	// With MEMORY_PRELOAD=on, memories that match the user's message are
+	// put in the instruction before each turn, within MEMORY_PRELOAD_TOKENS
+	// tokens, so the agent needn't call recall.
+	if os.Getenv("MEMORY_PRELOAD") == "on" {
+		opts := PreloadOptions{TopK: 5}
+		if s := os.Getenv("MEMORY_PRELOAD_TOKENS"); s != "" {
+			if opts.MaxTokens, err = strconv.Atoi(s); err != nil {
+				log.Fatalf("MEMORY_PRELOAD_TOKENS: %v", err)
+			}
+		}
+		agentCfg.BeforeModelCallbacks = []llmagent.BeforeModelCallback{NewMemoryPreloader(memService, opts)}
+	}
+	myAgent, err := llmagent.New(agentCfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// 4. Initialize Runner
-	appName := "memory_experiment"
 	r, err := runner.New(runner.Config{
 		AppName:        appName,
 		Agent:          myAgent,
@@ -145,20 +193,10 @@ Always check your memory before saying you don't know something about the user.`
 
 	runTurn(ctx, r, session1ID, userID, "my favorite color is blue")
 
-	// Manually ingest session 1 into memory.
-	// CRITICAL: Must re-fetch the session to get the latest events!
-	fmt.Println("  [System] Re-fetching Session 1 to get latest events...")
-	session1UpdatedResp, err := sessionService.Get(ctx, &session.GetRequest{
-		AppName:   appName,
-		UserID:    userID,
-		SessionID: session1ID,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("  [System] Ingesting Session 1 into memory...")
-	if err := memService.AddSession(ctx, session1UpdatedResp.Session); err != nil {
+	// Closing Session 1 adds it to memory, unless it was already added
+	// when the agent answered and nothing has happened since.
+	fmt.Println("  [System] Closing Session 1...")
+	if err := sessionService.CloseSession(ctx, appName, userID, session1ID); err != nil {
 		log.Fatal(err)
 	}
 
@@ -173,7 +211,118 @@ Always check your memory before saying you don't know something about the user.`
 	}
 
 	// This should trigger the 'recall' tool because the information is in a *different* session.
-	runTurn(ctx, r, session2Resp.Session.ID(), userID, "what is my favorite color")
+	// The question shares no keywords with the answer; only a search by
+	// meaning finds it.
+	runTurn(ctx, r, session2Resp.Session.ID(), userID, "what hue do I like best")
+}
+
+// clientConfig is the Vertex AI configuration from $GOOGLE_CLOUD_PROJECT
+// and $GOOGLE_CLOUD_LOCATION.
+func clientConfig() *genai.ClientConfig {
+	cfg := &genai.ClientConfig{
+		Backend: genai.BackendVertexAI,
+		Project: os.Getenv("GOOGLE_CLOUD_PROJECT"),
+	}
+	if location := os.Getenv("GOOGLE_CLOUD_LOCATION"); location != "" {
+		cfg.Location = location
+	}
+	return cfg
+}
+
+// factsEnabled reports whether facts are remembered rather than sessions:
+// unless $MEMORY_FACTS is "off".
+func factsEnabled() bool {
+	return os.Getenv("MEMORY_FACTS") != "off"
+}
+
+// openMemory opens the memory service newMemoryService picks. If facts are
+// enabled, it wraps it so that what is remembered is not the sessions
+// themselves but the facts extractor finds in them, kept in
+// $MEMORY_FACTS_FILE or memory_facts.json. extractor may be nil if no
+// sessions will be added.
+func openMemory(ctx context.Context, cfg *genai.ClientConfig, extractor *FactExtractor) (memory.Service, error) {
+	mem, err := newMemoryService(ctx, cfg)
+	if err != nil || !factsEnabled() {
+		return mem, err
+	}
+	path := os.Getenv("MEMORY_FACTS_FILE")
+	if path == "" {
+		path = "memory_facts.json"
+	}
+	return OpenFactMemory(ctx, path, extractor, mem, 0.6)
+}
+
+// runMemoryCLI runs the "memory" subcommand against the memory service the
+// agent would use.
+func runMemoryCLI(ctx context.Context, args []string) error {
+	mem, err := openMemory(ctx, clientConfig(), nil)
+	if err != nil {
+		return err
+	}
+	managed, ok := mem.(ManagedMemory)
+	if !ok {
+		return fmt.Errorf("the %T memory service can't be managed; use MEMORY_BACKEND=vector or text", mem)
+	}
+	return runMemoryCommand(ctx, managed, appName, args, os.Stdout)
+}
+
+// newMemoryService opens the memory service $MEMORY_BACKEND names:
+//
+//   - "vector", the default, searches by meaning. Its index is in the
+//     directory $MEMORY_INDEX, or memory_index. $EMBEDDER picks the embedder:
+//     "gemini", the default, uses $EMBEDDING_MODEL or text-embedding-004;
+//     "hashing" needs no model but only matches shared words.
+//     $MEMORY_MIN_SCORE overrides the lowest similarity a memory needs to
+//     be recalled.
+//   - "text" searches by keyword, ranked by BM25. Its memories are kept
+//     in the directory $MEMORY_INDEX, or memory_text.
+//   - "inmemory" is ADK's keyword search, forgotten on exit.
+func newMemoryService(ctx context.Context, cfg *genai.ClientConfig) (memory.Service, error) {
+	path := os.Getenv("MEMORY_INDEX")
+	switch b := os.Getenv("MEMORY_BACKEND"); b {
+	case "", "vector":
+	case "text":
+		if path == "" {
+			path = "memory_text"
+		}
+		return OpenTextMemory(path, 5)
+	case "inmemory":
+		return memory.InMemoryService(), nil
+	default:
+		return nil, fmt.Errorf("unknown MEMORY_BACKEND %q; want vector, text or inmemory", b)
+	}
+	if path == "" {
+		path = "memory_index"
+	}
+
+	var embedder Embedder
+	var minScore float64
+	switch e := os.Getenv("EMBEDDER"); e {
+	case "", "gemini":
+		client, err := genai.NewClient(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		embedModel := os.Getenv("EMBEDDING_MODEL")
+		if embedModel == "" {
+			embedModel = "text-embedding-004"
+		}
+		embedder = GeminiEmbedder{Client: client, Model: embedModel}
+		// Even unrelated texts score 0.3 to 0.4 with Gemini embeddings.
+		minScore = 0.5
+	case "hashing":
+		embedder = HashingEmbedder{Dim: 512}
+		minScore = 0.2
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDER %q; want gemini or hashing", e)
+	}
+	if s := os.Getenv("MEMORY_MIN_SCORE"); s != "" {
+		var err error
+		if minScore, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("MEMORY_MIN_SCORE: %w", err)
+		}
+	}
+	return OpenVectorMemory(path, embedder, VectorOptions{TopK: 5, MinScore: minScore})
 }
 
 func runTurn(ctx context.Context, r *runner.Runner, sessionID, userID, prompt string) {
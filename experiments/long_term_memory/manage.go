@@ -0,0 +1,254 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+)
+
+// ManagedMemory is a memory.Service whose memories can be listed, changed
+// and deleted one at a time, and wiped for a user.
+//
+// Changes stick: adding a session again, as the ingesting session service
+// does while a conversation goes on, doesn't bring back a memory that was
+// deleted or undo one that was corrected, and a wipe covers everything
+// said up to it.
+type ManagedMemory interface {
+	memory.Service
+	// List returns all of the user's memories, oldest first.
+	List(ctx context.Context, appName, userID string) ([]MemoryRecord, error)
+	// Delete forgets the memory with the ID.
+	Delete(ctx context.Context, appName, userID, id string) error
+	// Update replaces the text of the memory with the ID.
+	Update(ctx context.Context, appName, userID, id, text string) error
+	// Wipe forgets all of the user's memories and returns how many there
+	// were.
+	Wipe(ctx context.Context, appName, userID string) (int, error)
+}
+
+// MemoryRecord is a memory as ManagedMemory lists it.
+type MemoryRecord struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	SessionID string    `json:"session_id,omitempty"`
+}
+
+// errNoMemory is returned for an ID the user has no memory with.
+var errNoMemory = errors.New("no memory with that ID")
+
+// memoryEdits are the changes made to memories by hand. They are saved
+// with the memories, but kept apart from them, so that they can be
+// applied again whenever a session is added again.
+type memoryEdits struct {
+	// Forgotten holds the IDs of deleted memories.
+	Forgotten map[string]bool `json:"forgotten,omitempty"`
+	// Corrected maps the IDs of corrected memories to their new text.
+	Corrected map[string]string `json:"corrected,omitempty"`
+	// WipedAt is when each user, by app and user ID, was last wiped.
+	WipedAt map[string]time.Time `json:"wiped_at,omitempty"`
+}
+
+func wipeKey(appName, userID string) string {
+	return appName + "/" + userID
+}
+
+// apply returns the text to remember for the memory id, said at t, or
+// false if it must not be remembered at all.
+func (e *memoryEdits) apply(appName, userID, id string, t time.Time, text string) (string, bool) {
+	if e.Forgotten[id] {
+		return "", false
+	}
+	if w, ok := e.WipedAt[wipeKey(appName, userID)]; ok && !t.After(w) {
+		return "", false
+	}
+	if c, ok := e.Corrected[id]; ok {
+		return c, true
+	}
+	return text, true
+}
+
+func (e *memoryEdits) forget(id string) {
+	if e.Forgotten == nil {
+		e.Forgotten = make(map[string]bool)
+	}
+	e.Forgotten[id] = true
+	delete(e.Corrected, id)
+}
+
+func (e *memoryEdits) correct(id, text string) {
+	if e.Corrected == nil {
+		e.Corrected = make(map[string]string)
+	}
+	e.Corrected[id] = text
+}
+
+func (e *memoryEdits) wipe(appName, userID string, t time.Time) {
+	if e.WipedAt == nil {
+		e.WipedAt = make(map[string]time.Time)
+	}
+	e.WipedAt[wipeKey(appName, userID)] = t
+}
+
+func (e memoryEdits) clone() memoryEdits {
+	return memoryEdits{
+		Forgotten: maps.Clone(e.Forgotten),
+		Corrected: maps.Clone(e.Corrected),
+		WipedAt:   maps.Clone(e.WipedAt),
+	}
+}
+
+type ListMemoriesArgs struct{}
+
+type ListMemoriesResult struct {
+	Memories []MemoryRecord `json:"memories"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type ForgetMemoryArgs struct {
+	ID string `json:"id" jsonschema:"The ID of the memory to forget, from list_memories."`
+}
+
+type CorrectMemoryArgs struct {
+	ID   string `json:"id" jsonschema:"The ID of the memory to correct, from list_memories."`
+	Text string `json:"text" jsonschema:"What the memory should say instead."`
+}
+
+type ManageMemoryResult struct {
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// newMemoryTools returns the tools that let the user see and change what
+// is remembered about them.
+func newMemoryTools(mem ManagedMemory) ([]tool.Tool, error) {
+	list, err := functiontool.New(functiontool.Config{
+		Name:        "list_memories",
+		Description: "Lists everything remembered about the user, with the ID of each memory. Use this when the user asks what you know about them, and to find the ID of a memory to forget or correct.",
+	}, func(ctx tool.Context, _ ListMemoriesArgs) ListMemoriesResult {
+		fmt.Println("  [Tool] Listing memories")
+		records, err := mem.List(ctx, ctx.AppName(), ctx.UserID())
+		if err != nil {
+			return ListMemoriesResult{Error: err.Error()}
+		}
+		return ListMemoriesResult{Memories: records}
+	})
+	if err != nil {
+		return nil, err
+	}
+	forget, err := functiontool.New(functiontool.Config{
+		Name:        "forget_memory",
+		Description: "Forgets a memory for good. Use this only when the user asks you to forget something.",
+	}, func(ctx tool.Context, args ForgetMemoryArgs) ManageMemoryResult {
+		fmt.Printf("  [Tool] Forgetting memory %s\n", args.ID)
+		if err := mem.Delete(ctx, ctx.AppName(), ctx.UserID(), args.ID); err != nil {
+			return ManageMemoryResult{Error: err.Error()}
+		}
+		return ManageMemoryResult{Status: "forgotten"}
+	})
+	if err != nil {
+		return nil, err
+	}
+	correct, err := functiontool.New(functiontool.Config{
+		Name:        "correct_memory",
+		Description: "Replaces what a memory says. Use this when the user says something remembered about them is wrong.",
+	}, func(ctx tool.Context, args CorrectMemoryArgs) ManageMemoryResult {
+		fmt.Printf("  [Tool] Correcting memory %s\n", args.ID)
+		if strings.TrimSpace(args.Text) == "" {
+			return ManageMemoryResult{Error: "the corrected text is empty; use forget_memory to forget a memory"}
+		}
+		if err := mem.Update(ctx, ctx.AppName(), ctx.UserID(), args.ID, args.Text); err != nil {
+			return ManageMemoryResult{Error: err.Error()}
+		}
+		return ManageMemoryResult{Status: "corrected"}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []tool.Tool{list, forget, correct}, nil
+}
+
+// runMemoryCommand runs "memory list", "memory forget", "memory correct"
+// or "memory wipe" against mem.
+func runMemoryCommand(ctx context.Context, mem ManagedMemory, appName string, args []string, out io.Writer) error {
+	const usage = "usage: memory list|forget|correct|wipe -user id [-app name] [-id id] [-text text]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd := args[0]
+	fs := flag.NewFlagSet("memory "+cmd, flag.ContinueOnError)
+	user := fs.String("user", "", "the user whose memories to manage")
+	app := fs.String("app", appName, "the app the memories belong to")
+	id := fs.String("id", "", "the memory to forget or correct")
+	text := fs.String("text", "", "the corrected text")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *user == "" {
+		return errors.New("memory " + cmd + ": -user is required")
+	}
+
+	switch cmd {
+	case "list":
+		records, err := mem.List(ctx, *app, *user)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDATE\tAUTHOR\tTEXT")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.Timestamp.Format(time.DateTime), r.Author, r.Text)
+		}
+		return w.Flush()
+	case "forget":
+		if *id == "" {
+			return errors.New("memory forget: -id is required")
+		}
+		if err := mem.Delete(ctx, *app, *user, *id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Forgot memory %s.\n", *id)
+	case "correct":
+		if *id == "" || strings.TrimSpace(*text) == "" {
+			return errors.New("memory correct: -id and -text are required")
+		}
+		if err := mem.Update(ctx, *app, *user, *id, *text); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Corrected memory %s.\n", *id)
+	case "wipe":
+		n, err := mem.Wipe(ctx, *app, *user)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Forgot all %d memories of user %s in %s.\n", n, *user, *app)
+	default:
+		return errors.New(usage)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+)
+
+// newManageEnv returns a text memory with two memories of checkUser's, and
+// one each of another user's and of checkUser's in another app.
+func newManageEnv(t *testing.T) (*TextMemory, session.Session) {
+	t.Helper()
+	m, err := OpenTextMemory("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	s, err := env.add(t.Context(), checkApp, checkUser, "my cat is called Tom", "noted, Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.add(t.Context(), checkApp, "someone_else", "my dog is called Rex"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.add(t.Context(), "other_app", checkUser, "my fish is called Nemo"); err != nil {
+		t.Fatal(err)
+	}
+	return m, s
+}
+
+func memoryCommand(t *testing.T, m ManagedMemory, args ...string) (string, error) {
+	t.Helper()
+	var out strings.Builder
+	err := runMemoryCommand(t.Context(), m, checkApp, args, &out)
+	return out.String(), err
+}
+
+func TestMemoryCommandArgs(t *testing.T) {
+	m, s := newManageEnv(t)
+	id := s.Events().At(0).ID
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "usage: memory list|forget|correct|wipe"},
+		{[]string{"show", "-user", checkUser}, "usage: memory list|forget|correct|wipe"},
+		{[]string{"list", "-bogus"}, "flag provided but not defined: -bogus"},
+		{[]string{"list"}, "memory list: -user is required"},
+		{[]string{"wipe", "-app", checkApp}, "memory wipe: -user is required"},
+		{[]string{"forget", "-user", checkUser}, "memory forget: -id is required"},
+		{[]string{"correct", "-user", checkUser, "-text", "Tim"}, "memory correct: -id and -text are required"},
+		{[]string{"correct", "-user", checkUser, "-id", id}, "memory correct: -id and -text are required"},
+		{[]string{"correct", "-user", checkUser, "-id", id, "-text", "  "}, "memory correct: -id and -text are required"},
+		{[]string{"forget", "-user", checkUser, "-id", "no-such-id"}, errNoMemory.Error()},
+		{[]string{"forget", "-user", "someone_else", "-id", id}, errNoMemory.Error()},
+		{[]string{"correct", "-user", checkUser, "-app", "other_app", "-id", id, "-text", "Tim"}, errNoMemory.Error()},
+	} {
+		out, err := memoryCommand(t, m, tc.args...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("memory %q: got error %v, want %q", tc.args, err, tc.want)
+		}
+		if out != "" {
+			t.Errorf("memory %q: printed %q, want nothing", tc.args, out)
+		}
+	}
+	// Nothing was changed.
+	if got := listedTexts(t, m, checkApp, checkUser); !reflect.DeepEqual(got, []string{"my cat is called Tom", "noted, Tom"}) {
+		t.Errorf("after the errors, got %q", got)
+	}
+}
+
+func listedTexts(t *testing.T, m ManagedMemory, appName, userID string) []string {
+	t.Helper()
+	records, err := m.List(t.Context(), appName, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, r := range records {
+		texts = append(texts, r.Text)
+	}
+	return texts
+}
+
+func TestMemoryCommandList(t *testing.T) {
+	m, s := newManageEnv(t)
+	out, err := memoryCommand(t, m, "list", "-user", checkUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want a header and the user's 2 memories in this app:\n%s", len(lines), out)
+	}
+	if got := strings.Fields(lines[0]); !reflect.DeepEqual(got, []string{"ID", "DATE", "AUTHOR", "TEXT"}) {
+		t.Errorf("got header %q", lines[0])
+	}
+	// One row per memory, oldest first, with the columns lined up.
+	column := strings.Index(lines[0], "TEXT")
+	for i, line := range lines[1:] {
+		ev := s.Events().At(i)
+		f := strings.Fields(line)
+		if len(f) < 5 || f[0] != ev.ID || f[1]+" "+f[2] != ev.Timestamp.Format(time.DateTime) || f[3] != ev.Author {
+			t.Errorf("row %d: got %q, want %s %s %s", i, line, ev.ID, ev.Timestamp.Format(time.DateTime), ev.Author)
+		}
+		if text := ev.Content.Parts[0].Text; strings.Index(line, text) != column {
+			t.Errorf("row %d: got %q, want %q under TEXT", i, line, text)
+		}
+	}
+
+	out, err = memoryCommand(t, m, "list", "-user", checkUser, "-app", "other_app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "my fish is called Nemo") || strings.Count(out, "\n") != 2 {
+		t.Errorf("listing another app got:\n%s", out)
+	}
+
+	// A user with no memories gets only the header.
+	out, err = memoryCommand(t, m, "list", "-user", "nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(out); !reflect.DeepEqual(got, []string{"ID", "DATE", "AUTHOR", "TEXT"}) {
+		t.Errorf("listing a user with no memories got %q", out)
+	}
+}
+
+func TestMemoryCommandChanges(t *testing.T) {
+	m, s := newManageEnv(t)
+	said, noted := s.Events().At(0).ID, s.Events().At(1).ID
+
+	for _, tc := range []struct {
+		args []string
+		out  string
+		want []string
+	}{
+		{
+			[]string{"correct", "-user", checkUser, "-id", said, "-text", "my cat is called Tim"},
+			"Corrected memory " + said + ".\n",
+			[]string{"my cat is called Tim", "noted, Tom"},
+		},
+		{
+			[]string{"forget", "-user", checkUser, "-id", noted},
+			"Forgot memory " + noted + ".\n",
+			[]string{"my cat is called Tim"},
+		},
+		{
+			[]string{"wipe", "-user", checkUser},
+			"Forgot all 1 memories of user check_user in check_app.\n",
+			nil,
+		},
+		{
+			[]string{"wipe", "-user", checkUser},
+			"Forgot all 0 memories of user check_user in check_app.\n",
+			nil,
+		},
+	} {
+		out, err := memoryCommand(t, m, tc.args...)
+		if err != nil {
+			t.Fatalf("memory %q: %v", tc.args, err)
+		}
+		if out != tc.out {
+			t.Errorf("memory %q: printed %q, want %q", tc.args, out, tc.out)
+		}
+		if got := listedTexts(t, m, checkApp, checkUser); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("after memory %q: got %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// Only the user's memories in the app were wiped.
+	out, err := memoryCommand(t, m, "wipe", "-user", "someone_else", "-app", checkApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Forgot all 1 memories of user someone_else in check_app.\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	if got := listedTexts(t, m, "other_app", checkUser); !reflect.DeepEqual(got, []string{"my fish is called Nemo"}) {
+		t.Errorf("the other app's memories: got %q", got)
+	}
+}
+
+// memoryToolContext is the part of a tool.Context the memory tools use,
+// for a call made for userID.
+type memoryToolContext struct {
+	tool.Context // nil; calling anything not overridden panics
+	ctx          context.Context
+	userID       string
+}
+
+func (c *memoryToolContext) Deadline() (time.Time, bool) { return c.ctx.Deadline() }
+func (c *memoryToolContext) Done() <-chan struct{}       { return c.ctx.Done() }
+func (c *memoryToolContext) Err() error                  { return c.ctx.Err() }
+func (c *memoryToolContext) Value(key any) any           { return c.ctx.Value(key) }
+func (c *memoryToolContext) AppName() string             { return checkApp }
+func (c *memoryToolContext) UserID() string              { return c.userID }
+
+// runMemoryTool calls the named memory tool for userID.
+func runMemoryTool(t *testing.T, m ManagedMemory, userID, name string, args map[string]any) map[string]any {
+	t.Helper()
+	tools, err := newMemoryTools(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tl := range tools {
+		if tl.Name() != name {
+			continue
+		}
+		run := tl.(interface {
+			Run(tool.Context, any) (map[string]any, error)
+		})
+		out, err := run.Run(&memoryToolContext{ctx: t.Context(), userID: userID}, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	t.Fatalf("no tool named %s", name)
+	return nil
+}
+
+func TestMemoryToolsKeepToTheUser(t *testing.T) {
+	m, s := newManageEnv(t)
+	said := s.Events().At(0).ID
+
+	// Another user can't see, forget or correct the memory by its ID.
+	out := runMemoryTool(t, m, "someone_else", "list_memories", map[string]any{})
+	if got, _ := out["memories"].([]any); len(got) != 1 || strings.Contains(fmt.Sprint(got), said) {
+		t.Errorf("someone else listed %v, want only their own memory", out)
+	}
+	for _, tc := range []struct {
+		name string
+		args map[string]any
+	}{
+		{"forget_memory", map[string]any{"id": said}},
+		{"correct_memory", map[string]any{"id": said, "text": "my cat is called Tim"}},
+	} {
+		out := runMemoryTool(t, m, "someone_else", tc.name, tc.args)
+		if out["error"] != errNoMemory.Error() || out["status"] != nil {
+			t.Errorf("%s on another user's memory: got %v, want error %q", tc.name, out, errNoMemory)
+		}
+	}
+	if got := listedTexts(t, m, checkApp, checkUser); !reflect.DeepEqual(got, []string{"my cat is called Tom", "noted, Tom"}) {
+		t.Errorf("after someone else's calls, got %q", got)
+	}
+
+	// The user can.
+	out = runMemoryTool(t, m, checkUser, "list_memories", map[string]any{})
+	if got, _ := out["memories"].([]any); len(got) != 2 || !strings.Contains(fmt.Sprint(got), said) {
+		t.Errorf("listed %v, want the user's 2 memories", out)
+	}
+	if out := runMemoryTool(t, m, checkUser, "correct_memory", map[string]any{"id": said, "text": " "}); !strings.Contains(fmt.Sprint(out["error"]), "the corrected text is empty") {
+		t.Errorf("correcting to nothing: got %v", out)
+	}
+	if out := runMemoryTool(t, m, checkUser, "correct_memory", map[string]any{"id": said, "text": "my cat is called Tim"}); out["status"] != "corrected" {
+		t.Errorf("correcting: got %v", out)
+	}
+	if out := runMemoryTool(t, m, checkUser, "forget_memory", map[string]any{"id": s.Events().At(1).ID}); out["status"] != "forgotten" {
+		t.Errorf("forgetting: got %v", out)
+	}
+	if got := listedTexts(t, m, checkApp, checkUser); !reflect.DeepEqual(got, []string{"my cat is called Tim"}) {
+		t.Errorf("after the user's calls, got %q", got)
+	}
+}
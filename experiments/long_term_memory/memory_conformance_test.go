@@ -0,0 +1,420 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// memoryBackend makes a memory.Service to check. open is called once per
+// check with a fresh directory from t.TempDir; a backend that keeps its memories in that
+// directory must find them again when opened on it a second time.
+type memoryBackend struct {
+	name       string
+	open       func(dir string) (memory.Service, error)
+	persistent bool
+}
+
+// memoryBackends are the memory services TestMemoryConformance checks.
+var memoryBackends = []memoryBackend{
+	{
+		name: "inmemory",
+		open: func(string) (memory.Service, error) { return memory.InMemoryService(), nil },
+	},
+	{
+		name: "text",
+		open: func(dir string) (memory.Service, error) {
+			return OpenTextMemory(filepath.Join(dir, "memory_text"), 0)
+		},
+		persistent: true,
+	},
+	{
+		name: "vector (hashing embedder)",
+		open: func(dir string) (memory.Service, error) {
+			return OpenVectorMemory(filepath.Join(dir, "memory_index"), HashingEmbedder{Dim: 512}, VectorOptions{MinScore: 0.2})
+		},
+		persistent: true,
+	},
+}
+
+// memoryCheck is something every memory.Service must do.
+type memoryCheck struct {
+	name string
+	run  func(ctx context.Context, c *checkEnv) error
+}
+
+// checkEnv is what a memoryCheck runs against: the service, and sessions
+// to add to it.
+type checkEnv struct {
+	mem      memory.Service
+	sessions session.Service
+	reopen   func() (memory.Service, error) // nil unless persistent
+}
+
+const (
+	checkApp  = "check_app"
+	checkUser = "check_user"
+)
+
+var memoryChecks = []memoryCheck{
+	{"an empty memory finds nothing", func(ctx context.Context, c *checkEnv) error {
+		return c.expect(ctx, checkApp, checkUser, "color", nil)
+	}},
+	{"finds an event with its author and time", func(ctx context.Context, c *checkEnv) error {
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue", "noted")
+		if err != nil {
+			return err
+		}
+		res, err := c.mem.Search(ctx, &memory.SearchRequest{AppName: checkApp, UserID: checkUser, Query: "color"})
+		if err != nil {
+			return err
+		}
+		ev := s.Events().At(0)
+		for _, m := range res.Memories {
+			if entryText(m) != "my favorite color is blue" {
+				continue
+			}
+			if m.Author != ev.Author || !m.Timestamp.Equal(ev.Timestamp) {
+				return fmt.Errorf("got author %q at %v, want %q at %v", m.Author, m.Timestamp, ev.Author, ev.Timestamp)
+			}
+			return nil
+		}
+		return fmt.Errorf("got %q, want the event about color", entryTexts(res.Memories))
+	}},
+	{"finds nothing for an unrelated query", func(ctx context.Context, c *checkEnv) error {
+		if _, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue"); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "zebra", nil)
+	}},
+	{"keeps apps and users apart", func(ctx context.Context, c *checkEnv) error {
+		if _, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue"); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, "someone_else", "color", nil); err != nil {
+			return fmt.Errorf("another user: %w", err)
+		}
+		if err := c.expect(ctx, "another_app", checkUser, "color", nil); err != nil {
+			return fmt.Errorf("another app: %w", err)
+		}
+		return nil
+	}},
+	{"adding a session again does not duplicate it", func(ctx context.Context, c *checkEnv) error {
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if err := c.mem.AddSession(ctx, s); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "color", []string{"my favorite color is blue"})
+	}},
+	{"adding a session again adds its new events", func(ctx context.Context, c *checkEnv) error {
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if s, err = c.append(ctx, s, "my dog is named rex"); err != nil {
+			return err
+		}
+		if err := c.mem.AddSession(ctx, s); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, checkUser, "dog", []string{"my dog is named rex"}); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "color", []string{"my favorite color is blue"})
+	}},
+	{"adding a session keeps the others", func(ctx context.Context, c *checkEnv) error {
+		if _, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue"); err != nil {
+			return err
+		}
+		if _, err := c.add(ctx, checkApp, checkUser, "i live in paris"); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, checkUser, "paris", []string{"i live in paris"}); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "color", []string{"my favorite color is blue"})
+	}},
+	{"remembers after reopening", func(ctx context.Context, c *checkEnv) error {
+		if c.reopen == nil {
+			return errSkipCheck
+		}
+		if _, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue"); err != nil {
+			return err
+		}
+		mem, err := c.reopen()
+		if err != nil {
+			return err
+		}
+		c.mem = mem
+		return c.expect(ctx, checkApp, checkUser, "color", []string{"my favorite color is blue"})
+	}},
+	{"lists memories with their IDs", func(ctx context.Context, c *checkEnv) error {
+		mem, err := c.managed()
+		if err != nil {
+			return err
+		}
+		if _, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue"); err != nil {
+			return err
+		}
+		id, err := c.find(ctx, mem, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			return errors.New("a memory has no ID")
+		}
+		records, err := mem.List(ctx, checkApp, "someone_else")
+		if err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			return fmt.Errorf("another user has %d memories, want none", len(records))
+		}
+		return nil
+	}},
+	{"a forgotten memory stays forgotten", func(ctx context.Context, c *checkEnv) error {
+		mem, err := c.managed()
+		if err != nil {
+			return err
+		}
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue", "i live in paris")
+		if err != nil {
+			return err
+		}
+		id, err := c.find(ctx, mem, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if err := mem.Delete(ctx, checkApp, checkUser, id); err != nil {
+			return err
+		}
+		if err := mem.AddSession(ctx, s); err != nil {
+			return err
+		}
+		if err := c.reopenIfPersistent(); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, checkUser, "color", nil); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "paris", []string{"i live in paris"})
+	}},
+	{"a corrected memory stays corrected", func(ctx context.Context, c *checkEnv) error {
+		mem, err := c.managed()
+		if err != nil {
+			return err
+		}
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		id, err := c.find(ctx, mem, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if err := mem.Update(ctx, checkApp, checkUser, id, "my favorite color is green"); err != nil {
+			return err
+		}
+		if err := mem.AddSession(ctx, s); err != nil {
+			return err
+		}
+		if err := c.reopenIfPersistent(); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, checkUser, "color", []string{"my favorite color is green"})
+	}},
+	{"a wipe forgets what was said before it", func(ctx context.Context, c *checkEnv) error {
+		mem, err := c.managed()
+		if err != nil {
+			return err
+		}
+		s, err := c.add(ctx, checkApp, checkUser, "my favorite color is blue")
+		if err != nil {
+			return err
+		}
+		if _, err := c.add(ctx, checkApp, "someone_else", "my favorite color is red"); err != nil {
+			return err
+		}
+		if n, err := mem.Wipe(ctx, checkApp, checkUser); err != nil {
+			return err
+		} else if n != 1 {
+			return fmt.Errorf("wiped %d memories, want 1", n)
+		}
+		if s, err = c.append(ctx, s, "my dog is named rex"); err != nil {
+			return err
+		}
+		if err := mem.AddSession(ctx, s); err != nil {
+			return err
+		}
+		if err := c.reopenIfPersistent(); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, checkUser, "color", nil); err != nil {
+			return err
+		}
+		if err := c.expect(ctx, checkApp, checkUser, "dog", []string{"my dog is named rex"}); err != nil {
+			return err
+		}
+		return c.expect(ctx, checkApp, "someone_else", "color", []string{"my favorite color is red"})
+	}},
+}
+
+var errSkipCheck = errors.New("skipped")
+
+// managed returns the service as a ManagedMemory, or errSkipCheck if it
+// isn't one.
+func (c *checkEnv) managed() (ManagedMemory, error) {
+	mem, ok := c.mem.(ManagedMemory)
+	if !ok {
+		return nil, errSkipCheck
+	}
+	return mem, nil
+}
+
+// find returns the ID of the user's memory with the text.
+func (c *checkEnv) find(ctx context.Context, mem ManagedMemory, text string) (string, error) {
+	records, err := mem.List(ctx, checkApp, checkUser)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, r := range records {
+		if r.Text == text {
+			return r.ID, nil
+		}
+		texts = append(texts, r.Text)
+	}
+	return "", fmt.Errorf("listed %q, want a memory %q", texts, text)
+}
+
+// reopenIfPersistent reopens the service, if it is persistent, so that a
+// check sees what was saved rather than what was kept in memory.
+func (c *checkEnv) reopenIfPersistent() error {
+	if c.reopen == nil {
+		return nil
+	}
+	mem, err := c.reopen()
+	if err != nil {
+		return err
+	}
+	c.mem = mem
+	return nil
+}
+
+// add creates a session with an event for each text, alternating between
+// the user and the agent, and adds it to memory.
+func (c *checkEnv) add(ctx context.Context, appName, userID string, texts ...string) (session.Session, error) {
+	resp, err := c.sessions.Create(ctx, &session.CreateRequest{AppName: appName, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.append(ctx, resp.Session, texts...)
+	if err != nil {
+		return nil, err
+	}
+	return s, c.mem.AddSession(ctx, s)
+}
+
+// append appends an event for each text to s and returns it as stored.
+func (c *checkEnv) append(ctx context.Context, s session.Session, texts ...string) (session.Session, error) {
+	for _, text := range texts {
+		ev := session.NewEvent("check")
+		ev.Author = "user"
+		role := genai.Role(genai.RoleUser)
+		if s.Events().Len()%2 == 1 {
+			ev.Author, role = "memory_agent", genai.RoleModel
+		}
+		ev.LLMResponse.Content = genai.NewContentFromText(text, role)
+		if err := c.sessions.AppendEvent(ctx, s, ev); err != nil {
+			return nil, err
+		}
+		resp, err := c.sessions.Get(ctx, &session.GetRequest{AppName: s.AppName(), UserID: s.UserID(), SessionID: s.ID()})
+		if err != nil {
+			return nil, err
+		}
+		s = resp.Session
+	}
+	return s, nil
+}
+
+// expect checks that searching for query finds exactly the events with
+// texts want, in any order.
+func (c *checkEnv) expect(ctx context.Context, appName, userID, query string, want []string) error {
+	res, err := c.mem.Search(ctx, &memory.SearchRequest{AppName: appName, UserID: userID, Query: query})
+	if err != nil {
+		return err
+	}
+	got := entryTexts(res.Memories)
+	if len(got) != len(want) {
+		return fmt.Errorf("searching for %q: got %q, want %q", query, got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			found = found || g == w
+		}
+		if !found {
+			return fmt.Errorf("searching for %q: got %q, want %q", query, got, want)
+		}
+	}
+	return nil
+}
+
+func entryTexts(es []memory.Entry) []string {
+	texts := make([]string, len(es))
+	for i, e := range es {
+		texts[i] = entryText(e)
+	}
+	return texts
+}
+
+// TestMemoryConformance runs every check against every backend.
+func TestMemoryConformance(t *testing.T) {
+	for _, b := range memoryBackends {
+		t.Run(b.name, func(t *testing.T) {
+			for _, chk := range memoryChecks {
+				t.Run(chk.name, func(t *testing.T) {
+					dir := t.TempDir()
+					mem, err := b.open(dir)
+					if err != nil {
+						t.Fatal(err)
+					}
+					env := &checkEnv{mem: mem, sessions: session.InMemoryService()}
+					if b.persistent {
+						env.reopen = func() (memory.Service, error) { return b.open(dir) }
+					}
+					err = chk.run(t.Context(), env)
+					if errors.Is(err, errSkipCheck) {
+						t.Skip("not supported by this service")
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// PreloadOptions configures a memory preloader.
+type PreloadOptions struct {
+	// TopK is the most memories preloaded. The default is 5.
+	TopK int
+	// MaxTokens is roughly how many tokens the preloaded memories may take
+	// up. Memories that would go over are left out. The default is 500.
+	MaxTokens int
+}
+
+// preloader puts the memories that match the user's message into the
+// system instruction before the model is called, so the model can use
+// them without calling recall.
+type preloader struct {
+	memory memory.Service
+	opts   PreloadOptions
+
+	// mu guards last, the memories found for each session's current
+	// invocation, so that memory is searched once per turn rather than
+	// once per model call.
+	mu   sync.Mutex
+	last map[sessionKey]preloaded
+}
+
+type preloaded struct {
+	invocationID string
+	block        string
+}
+
+// NewMemoryPreloader returns a BeforeModelCallback that searches mem with
+// the user's message at the start of each turn and adds the best matches
+// to the system instruction, each with a [memory N] marker for the model to
+// cite.
+func NewMemoryPreloader(mem memory.Service, opts PreloadOptions) llmagent.BeforeModelCallback {
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 500
+	}
+	p := &preloader{memory: mem, opts: opts, last: make(map[sessionKey]preloaded)}
+	return p.beforeModel
+}
+
+func (p *preloader) beforeModel(ctx agent.CallbackContext, req *model.LLMRequest) (*model.LLMResponse, error) {
+	k := sessionKey{ctx.AppName(), ctx.UserID(), ctx.SessionID()}
+	p.mu.Lock()
+	pre, ok := p.last[k]
+	p.mu.Unlock()
+	if !ok || pre.invocationID != ctx.InvocationID() {
+		pre = preloaded{invocationID: ctx.InvocationID(), block: p.search(ctx)}
+		p.mu.Lock()
+		p.last[k] = pre
+		p.mu.Unlock()
+	}
+	if pre.block == "" {
+		return nil, nil
+	}
+	if req.Config == nil {
+		req.Config = &genai.GenerateContentConfig{}
+	}
+	if req.Config.SystemInstruction == nil {
+		req.Config.SystemInstruction = genai.NewContentFromText(pre.block, genai.RoleUser)
+	} else {
+		req.Config.SystemInstruction.Parts = append(req.Config.SystemInstruction.Parts, genai.NewPartFromText(pre.block))
+	}
+	return nil, nil
+}
+
+// search returns the instruction block of memories that match the user's
+// message, or "" if there are none. A failed search only costs the
+// preload; the model can still call recall.
+func (p *preloader) search(ctx agent.CallbackContext) string {
+	var query []string
+	if c := ctx.UserContent(); c != nil {
+		for _, part := range c.Parts {
+			if part.Text != "" {
+				query = append(query, part.Text)
+			}
+		}
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	resp, err := p.memory.Search(ctx, &memory.SearchRequest{
+		AppName: ctx.AppName(),
+		UserID:  ctx.UserID(),
+		Query:   strings.Join(query, " "),
+	})
+	if err != nil {
+		log.Printf("Preloading memories: %v", err)
+		return ""
+	}
+
+	var lines []string
+	budget := p.opts.MaxTokens
+	for _, m := range resp.Memories {
+		if len(lines) == p.opts.TopK {
+			break
+		}
+		text := entryText(m)
+		if text == "" {
+			continue
+		}
+		line := fmt.Sprintf("[memory %d] (%s, %s) %s", len(lines)+1, m.Author, m.Timestamp.Format("2006-01-02"), text)
+		if cost := estimateTokens(line); cost <= budget {
+			budget -= cost
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	fmt.Printf("  [Memory] Preloaded memories: %d\n", len(lines))
+	return "These memories from earlier conversations with the user match their latest message. " +
+		"If they answer it, use them without calling recall, and cite each one you use by its marker, such as [memory 1].\n\n" +
+		strings.Join(lines, "\n")
+}
+
+// estimateTokens guesses how many tokens text takes: about one for every
+// four bytes.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// entryText is the text of a memory's parts.
+func entryText(e memory.Entry) string {
+	if e.Content == nil {
+		return ""
+	}
+	var text []string
+	for _, p := range e.Content.Parts {
+		text = append(text, p.Text)
+	}
+	return strings.Join(text, " ")
+}
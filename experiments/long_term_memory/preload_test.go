@@ -0,0 +1,177 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"iter"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+func TestPreloadAnswersWithoutRecall(t *testing.T) {
+	run := runPreloadScenario(t, true)
+	if run.recalls > 0 {
+		t.Errorf("the model called recall %d times, want none", run.recalls)
+	}
+	if !hasLine(run.instruction, "[memory 1] (", "my favorite color is blue") {
+		t.Errorf("got instruction %q, want the memory about color marked [memory 1]", run.instruction)
+	}
+	if !strings.Contains(run.answer, "blue") || !strings.Contains(run.answer, "[memory 1]") {
+		t.Errorf("got answer %q, want blue cited as [memory 1]", run.answer)
+	}
+}
+
+func TestWithoutPreloadTheModelCallsRecall(t *testing.T) {
+	run := runPreloadScenario(t, false)
+	if run.recalls == 0 {
+		t.Error("the model did not call recall")
+	}
+	if strings.Contains(run.instruction, "[memory 1]") {
+		t.Errorf("got instruction %q, want no memories in it", run.instruction)
+	}
+}
+
+// preloadRun is what happened when the scripted model was asked a question.
+type preloadRun struct {
+	recalls     int    // recall calls the model made
+	instruction string // the system instruction of its first request
+	answer      string
+}
+
+// runPreloadScenario remembers "my favorite color is blue" from one
+// session, and asks "what is my favorite color" in another.
+func runPreloadScenario(t *testing.T, preload bool) preloadRun {
+	t.Helper()
+	ctx := t.Context()
+	mem, err := OpenTextMemory("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &checkEnv{mem: mem, sessions: session.InMemoryService()}
+	if _, err := env.add(ctx, checkApp, checkUser, "my favorite color is blue", "noted"); err != nil {
+		t.Fatal(err)
+	}
+
+	recallStub, err := functiontool.New(functiontool.Config{Name: "recall", Description: "Recalls information from previous conversations."},
+		func(tool.Context, RecallArgs) RecallResult { return RecallResult{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm := &scriptedModel{}
+	cfg := llmagent.Config{Name: "memory_agent", Model: llm, Tools: []tool.Tool{recallStub}}
+	if preload {
+		cfg.BeforeModelCallbacks = []llmagent.BeforeModelCallback{NewMemoryPreloader(mem, PreloadOptions{})}
+	}
+	a, err := llmagent.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(runner.Config{AppName: checkApp, Agent: a, SessionService: env.sessions, MemoryService: mem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := env.sessions.Create(ctx, &session.CreateRequest{AppName: checkApp, UserID: checkUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var run preloadRun
+	msg := genai.NewContentFromText("what is my favorite color", genai.RoleUser)
+	for ev, err := range r.Run(ctx, checkUser, created.Session.ID(), msg, agent.RunConfig{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.LLMResponse.Content != nil {
+			for _, p := range ev.LLMResponse.Content.Parts {
+				if p.FunctionCall != nil && p.FunctionCall.Name == "recall" {
+					run.recalls++
+				}
+			}
+		}
+		if ev.IsFinalResponse() {
+			run.answer = eventText(ev)
+		}
+	}
+	run.instruction = llm.firstInstruction()
+	return run
+}
+
+// hasLine reports whether text has a line with the prefix and suffix.
+func hasLine(text, prefix, suffix string) bool {
+	for line := range strings.Lines(text) {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, prefix) && strings.HasSuffix(line, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptedModel answers from the memories in its system instruction, or
+// else calls recall, and then answers from what recall returned. It
+// records the system instruction of every request.
+type scriptedModel struct {
+	mu           sync.Mutex
+	instructions []string
+}
+
+func (*scriptedModel) Name() string { return "scripted" }
+
+func (m *scriptedModel) firstInstruction() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.instructions) == 0 {
+		return ""
+	}
+	return m.instructions[0]
+}
+
+func (m *scriptedModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	var system string
+	if req.Config != nil && req.Config.SystemInstruction != nil {
+		for _, p := range req.Config.SystemInstruction.Parts {
+			system += p.Text
+		}
+	}
+	m.mu.Lock()
+	m.instructions = append(m.instructions, system)
+	m.mu.Unlock()
+
+	var content *genai.Content
+	switch last := req.Contents[len(req.Contents)-1]; {
+	case hasLine(system, "[memory 1] (", "blue"):
+		content = genai.NewContentFromText("Your favorite color is blue [memory 1].", genai.RoleModel)
+	case len(last.Parts) > 0 && last.Parts[0].FunctionResponse != nil:
+		content = genai.NewContentFromText("I could not find it.", genai.RoleModel)
+	default:
+		content = &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+			genai.NewPartFromFunctionCall("recall", map[string]any{"query": "favorite color"}),
+		}}
+	}
+	return func(yield func(*model.LLMResponse, error) bool) {
+		yield(&model.LLMResponse{Content: content}, nil)
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// BM25 parameters: bm25K1 is how quickly repeating a word stops adding to
+// the score, and bm25B how much long texts are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// TextMemory is a memory.Service that ranks events by full-text search
+// with BM25, and keeps them in a file so they survive restarts.
+//
+// Each app and user has its own partition: its own inverted index and its
+// own word statistics, so one user's memories never affect another's
+// search. Each partition is saved in a file of its own, so a change
+// rewrites only that user's file. The files hold only the events; the
+// index is rebuilt from them when they are opened.
+type TextMemory struct {
+	dir   string
+	limit int
+
+	mu         sync.RWMutex
+	partitions map[textKey]*textPartition
+}
+
+var _ ManagedMemory = (*TextMemory)(nil)
+
+type textKey struct {
+	appName, userID string
+}
+
+type textDoc struct {
+	// AppName and UserID are saved once for the whole partition.
+	AppName   string    `json:"-"`
+	UserID    string    `json:"-"`
+	SessionID string    `json:"session_id"`
+	EventID   string    `json:"event_id"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+
+	terms map[string]int // how often each word appears
+	len   int            // the number of words
+}
+
+// textPartition is the inverted index of one app and user, and the edits
+// made to their memories.
+type textPartition struct {
+	sessions map[string][]*textDoc
+	postings map[string]map[*textDoc]struct{}
+	docs     int
+	words    int
+	edits    memoryEdits
+}
+
+// textIndex is the file a user's partition is saved in.
+type textIndex struct {
+	AppName string      `json:"app_name"`
+	UserID  string      `json:"user_id"`
+	Docs    []*textDoc  `json:"docs"`
+	Edits   memoryEdits `json:"edits"`
+}
+
+// OpenTextMemory opens the memories saved in the directory dir, or starts
+// with none if there is nothing there yet. An empty dir keeps them in
+// memory only. Search returns at most limit memories, or 10 if limit is
+// not positive.
+func OpenTextMemory(dir string, limit int) (*TextMemory, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	m := &TextMemory{dir: dir, limit: limit, partitions: make(map[textKey]*textPartition)}
+	err := readPartitions(dir, func(path string, b []byte) error {
+		var idx textIndex
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return err
+		}
+		p := m.partition(textKey{idx.AppName, idx.UserID})
+		for _, d := range idx.Docs {
+			d.AppName, d.UserID = idx.AppName, idx.UserID
+			d.index()
+			p.add(d)
+		}
+		p.edits = idx.Edits
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening memory files: %w", err)
+	}
+	return m, nil
+}
+
+// AddSession replaces what is remembered of the session with its current
+// events. Each memory's ID is the ID of its event.
+func (m *TextMemory) AddSession(ctx context.Context, s session.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{s.AppName(), s.UserID()}
+	p := m.partition(k)
+	var docs []*textDoc
+	for ev := range s.Events().All() {
+		text, ok := p.edits.apply(s.AppName(), s.UserID(), ev.ID, ev.Timestamp, eventText(ev))
+		if !ok {
+			continue
+		}
+		d := &textDoc{
+			AppName:   s.AppName(),
+			UserID:    s.UserID(),
+			SessionID: s.ID(),
+			EventID:   ev.ID,
+			Author:    ev.Author,
+			Timestamp: ev.Timestamp,
+			Text:      text,
+		}
+		if d.index(); d.len > 0 {
+			docs = append(docs, d)
+		}
+	}
+
+	old := p.replace(s.ID(), docs)
+	if err := m.save(k); err != nil {
+		// Put back what is in the file, so memory and disk agree.
+		p.replace(s.ID(), old)
+		return err
+	}
+	return nil
+}
+
+func (m *TextMemory) List(ctx context.Context, appName, userID string) ([]MemoryRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var records []MemoryRecord
+	if p, ok := m.partitions[textKey{appName, userID}]; ok {
+		for _, docs := range p.sessions {
+			for _, d := range docs {
+				records = append(records, MemoryRecord{ID: d.EventID, Text: d.Text, Author: d.Author, Timestamp: d.Timestamp, SessionID: d.SessionID})
+			}
+		}
+	}
+	slices.SortFunc(records, func(a, b MemoryRecord) int { return a.Timestamp.Compare(b.Timestamp) })
+	return records, nil
+}
+
+func (m *TextMemory) Delete(ctx context.Context, appName, userID, id string) error {
+	return m.edit(appName, userID, id, func(d *textDoc, edits *memoryEdits) *textDoc {
+		edits.forget(id)
+		return nil
+	})
+}
+
+func (m *TextMemory) Update(ctx context.Context, appName, userID, id, text string) error {
+	return m.edit(appName, userID, id, func(d *textDoc, edits *memoryEdits) *textDoc {
+		edits.correct(id, text)
+		nd := *d
+		nd.Text = text
+		nd.index()
+		return &nd
+	})
+}
+
+// edit replaces the user's memory id with what fn returns, or removes it
+// if fn returns nil, and saves the change. fn also records the change in
+// edits.
+func (m *TextMemory) edit(appName, userID, id string, fn func(*textDoc, *memoryEdits) *textDoc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	p, ok := m.partitions[k]
+	if !ok {
+		return errNoMemory
+	}
+	for sid, docs := range p.sessions {
+		i := slices.IndexFunc(docs, func(d *textDoc) bool { return d.EventID == id })
+		if i < 0 {
+			continue
+		}
+		oldEdits := p.edits
+		edits := p.edits.clone()
+		next := slices.Clone(docs)
+		if nd := fn(docs[i], &edits); nd != nil {
+			next[i] = nd
+		} else {
+			next = slices.Delete(next, i, i+1)
+		}
+		old := p.replace(sid, next)
+		p.edits = edits
+		if err := m.save(k); err != nil {
+			p.edits = oldEdits
+			p.replace(sid, old)
+			return err
+		}
+		return nil
+	}
+	return errNoMemory
+}
+
+func (m *TextMemory) Wipe(ctx context.Context, appName, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	old, ok := m.partitions[k]
+	edits := memoryEdits{}
+	if ok {
+		edits = old.edits.clone()
+	}
+	edits.wipe(appName, userID, time.Now())
+	delete(m.partitions, k)
+	m.partition(k).edits = edits
+	if err := m.save(k); err != nil {
+		delete(m.partitions, k)
+		if ok {
+			m.partitions[k] = old
+		}
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+	return old.docs, nil
+}
+
+// Search returns the user's events that best match the query by BM25,
+// best first. Events that share no word with the query are left out.
+func (m *TextMemory) Search(ctx context.Context, req *memory.SearchRequest) (*memory.SearchResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := &memory.SearchResponse{}
+	p, ok := m.partitions[textKey{req.AppName, req.UserID}]
+	if !ok || p.docs == 0 {
+		return res, nil
+	}
+
+	avgLen := float64(p.words) / float64(p.docs)
+	scores := make(map[*textDoc]float64)
+	seen := make(map[string]bool)
+	for _, t := range textWords(req.Query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		df := float64(len(p.postings[t]))
+		idf := math.Log(1 + (float64(p.docs)-df+0.5)/(df+0.5))
+		for d := range p.postings[t] {
+			tf := float64(d.terms[t])
+			scores[d] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(d.len)/avgLen))
+		}
+	}
+
+	ranked := make([]*textDoc, 0, len(scores))
+	for d := range scores {
+		ranked = append(ranked, d)
+	}
+	slices.SortFunc(ranked, func(a, b *textDoc) int {
+		if c := cmp.Compare(scores[b], scores[a]); c != 0 {
+			return c
+		}
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	for _, d := range ranked[:min(len(ranked), m.limit)] {
+		res.Memories = append(res.Memories, d.entry())
+	}
+	return res, nil
+}
+
+// partition returns the partition for k, creating it. m.mu must be held
+// unless m is still being opened.
+func (m *TextMemory) partition(k textKey) *textPartition {
+	p, ok := m.partitions[k]
+	if !ok {
+		p = &textPartition{
+			sessions: make(map[string][]*textDoc),
+			postings: make(map[string]map[*textDoc]struct{}),
+		}
+		m.partitions[k] = p
+	}
+	return p
+}
+
+func (p *textPartition) add(d *textDoc) {
+	p.sessions[d.SessionID] = append(p.sessions[d.SessionID], d)
+	for t := range d.terms {
+		if p.postings[t] == nil {
+			p.postings[t] = make(map[*textDoc]struct{})
+		}
+		p.postings[t][d] = struct{}{}
+	}
+	p.docs++
+	p.words += d.len
+}
+
+// replace replaces the documents of the session id with docs, and returns
+// the ones it had.
+func (p *textPartition) replace(id string, docs []*textDoc) []*textDoc {
+	old := p.sessions[id]
+	for _, d := range old {
+		for t := range d.terms {
+			delete(p.postings[t], d)
+			if len(p.postings[t]) == 0 {
+				delete(p.postings, t)
+			}
+		}
+		p.docs--
+		p.words -= d.len
+	}
+	delete(p.sessions, id)
+	for _, d := range docs {
+		p.add(d)
+	}
+	return old
+}
+
+// index counts the words of d.Text.
+func (d *textDoc) index() {
+	words := textWords(d.Text)
+	d.terms = make(map[string]int, len(words))
+	for _, w := range words {
+		d.terms[w]++
+	}
+	d.len = len(words)
+}
+
+func (d *textDoc) entry() memory.Entry {
+	role := genai.Role(genai.RoleModel)
+	if d.Author == "user" {
+		role = genai.RoleUser
+	}
+	return memory.Entry{
+		Content:   genai.NewContentFromText(d.Text, role),
+		Author:    d.Author,
+		Timestamp: d.Timestamp,
+	}
+}
+
+// save writes the partition of the user k to their file. m.mu must be
+// held.
+func (m *TextMemory) save(k textKey) error {
+	if m.dir == "" {
+		return nil
+	}
+	idx := textIndex{AppName: k.appName, UserID: k.userID}
+	if p, ok := m.partitions[k]; ok {
+		idx.Edits = p.edits
+		for _, docs := range p.sessions {
+			idx.Docs = append(idx.Docs, docs...)
+		}
+	}
+	// The same memories always make the same file.
+	slices.SortFunc(idx.Docs, func(a, b *textDoc) int {
+		return cmp.Or(
+			cmp.Compare(a.SessionID, b.SessionID),
+			a.Timestamp.Compare(b.Timestamp),
+			cmp.Compare(a.EventID, b.EventID),
+		)
+	})
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(partitionFile(m.dir, k), b)
+}
+
+// stopWords are too common to say anything about what a text is about.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"do": true, "does": true, "for": true, "from": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "what": true, "with": true, "you": true, "your": true,
+}
+
+// textWords splits text into lower-case words, leaving out stop words.
+func textWords(text string) []string {
+	var words []string
+	for _, w := range splitWords(text) {
+		if !stopWords[w] {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// splitWords splits text into lower-case words at anything that is not a
+// letter or a digit.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/session"
+)
+
+func TestTextMemoryRanksByBM25(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		docs  []string // one session each, in order
+		query string
+		want  []string
+	}{
+		{
+			// "zebra" is in one memory, "cat" in three, so one zebra
+			// counts for more than two cats.
+			name:  "rarer term first",
+			docs:  []string{"cat cat", "cat fish", "cat bird", "zebra"},
+			query: "cat zebra",
+			want:  []string{"zebra", "cat cat", "cat bird", "cat fish"},
+		},
+		{
+			name:  "shorter first",
+			docs:  []string{"zebra runs across the wide open plain", "zebra stripes", "lion"},
+			query: "zebra",
+			want:  []string{"zebra stripes", "zebra runs across the wide open plain"},
+		},
+		{
+			name:  "rarer and shorter first",
+			docs:  []string{"cat sat on the mat all afternoon long", "cat naps", "zebra grazes on the plain all afternoon long", "zebra"},
+			query: "cat zebra",
+			want:  []string{"zebra", "cat naps", "zebra grazes on the plain all afternoon long", "cat sat on the mat all afternoon long"},
+		},
+		{
+			name:  "newer first on a tie",
+			docs:  []string{"zebra", "zebra", "lion"},
+			query: "zebra",
+			want:  []string{"zebra", "zebra"},
+		},
+		{
+			name:  "stop words ignored",
+			docs:  []string{"what is my cat", "my cat is a tabby"},
+			query: "what is my",
+			want:  []string{},
+		},
+		{
+			name:  "repeated query words count once",
+			docs:  []string{"cat", "cat fish cat"},
+			query: "cat cat cat",
+			want:  []string{"cat", "cat fish cat"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := OpenTextMemory("", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+			for _, d := range tc.docs {
+				if _, err := env.add(t.Context(), checkApp, checkUser, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Another user's memories don't change the ranking.
+			if _, err := env.add(t.Context(), checkApp, "someone_else", "zebra zebra", "zebra"); err != nil {
+				t.Fatal(err)
+			}
+			if got := search(t, m, checkUser, tc.query); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("searching for %q: got %q, want %q", tc.query, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTextMemoryLimit(t *testing.T) {
+	m, err := OpenTextMemory("", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	if _, err := env.add(t.Context(), checkApp, checkUser, "zebra", "zebra stripes", "zebra grazing on the plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, m, checkUser, "zebra"); !reflect.DeepEqual(got, []string{"zebra", "zebra stripes"}) {
+		t.Errorf("got %q, want the best two", got)
+	}
+}
+
+func TestTextMemorySavesOnlyTheUsersFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "memory_text")
+	m, err := OpenTextMemory(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	if _, err := env.add(t.Context(), checkApp, "someone_else", "zebra stripes"); err != nil {
+		t.Fatal(err)
+	}
+	theirs := partitionFile(dir, textKey{checkApp, "someone_else"})
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(theirs, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := env.add(t.Context(), checkApp, checkUser, "my cat naps", "noted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(t.Context(), checkApp, checkUser, s.Events().At(1).ID); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(theirs); err != nil || !fi.ModTime().Equal(past) {
+		t.Errorf("another user's file was written: %v", err)
+	}
+	b, err := os.ReadFile(partitionFile(dir, textKey{checkApp, checkUser}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "zebra") {
+		t.Errorf("the user's file holds another user's memory: %s", b)
+	}
+
+	// Each user's memories and edits come back, and the forgotten memory
+	// stays forgotten when the session is added again.
+	if env.mem, err = OpenTextMemory(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.mem.AddSession(t.Context(), s); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.expect(t.Context(), checkApp, checkUser, "cat noted", []string{"my cat naps"}); err != nil {
+		t.Error(err)
+	}
+	if err := env.expect(t.Context(), checkApp, "someone_else", "zebra", []string{"zebra stripes"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,453 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// VectorOptions configures a VectorMemory.
+type VectorOptions struct {
+	// ChunkWords is the most words in a chunk. Longer events are split
+	// into chunks that overlap by a quarter. The default is 200.
+	ChunkWords int
+	// TopK is the most memories a search returns. The default is 5.
+	TopK int
+	// MinScore is the cosine similarity a chunk needs to be returned at
+	// all, from -1 to 1.
+	MinScore float64
+}
+
+// VectorMemory is a memory.Service that searches by meaning rather than
+// by keyword. It splits each session's events into chunks, embeds them,
+// and returns the chunks closest to the query.
+//
+// The index is kept in memory and, if it has a directory, saved to disk
+// after every change, so memories outlive the program. Each app and user
+// has a file of their own there, and a change rewrites only theirs.
+type VectorMemory struct {
+	embedder Embedder
+	dir      string
+	opts     VectorOptions
+
+	mu         sync.RWMutex
+	partitions map[textKey]*vectorPartition
+}
+
+var _ ManagedMemory = (*VectorMemory)(nil)
+
+// vectorPartition is the index of one app and user.
+type vectorPartition struct {
+	chunks []vectorChunk
+	edits  memoryEdits
+}
+
+type vectorChunk struct {
+	// ID is the ID of the chunk's event, followed by ":" and the chunk's
+	// number if the event has more than one.
+	ID        string    `json:"id"`
+	AppName   string    `json:"app_name"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"session_id"`
+	EventID   string    `json:"event_id"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+	Vector    []float32 `json:"vector"`
+}
+
+// vectorIndex is the file a user's partition is saved in.
+type vectorIndex struct {
+	Embedder string        `json:"embedder"`
+	AppName  string        `json:"app_name"`
+	UserID   string        `json:"user_id"`
+	Chunks   []vectorChunk `json:"chunks"`
+	Edits    memoryEdits   `json:"edits"`
+}
+
+// OpenVectorMemory opens the index in the directory dir, or starts a new
+// one if there is nothing there yet. An empty dir keeps the index in
+// memory only.
+func OpenVectorMemory(dir string, embedder Embedder, opts VectorOptions) (*VectorMemory, error) {
+	if opts.ChunkWords <= 0 {
+		opts.ChunkWords = 200
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 5
+	}
+	m := &VectorMemory{embedder: embedder, dir: dir, opts: opts, partitions: make(map[textKey]*vectorPartition)}
+	err := readPartitions(dir, func(path string, b []byte) error {
+		var idx vectorIndex
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return err
+		}
+		if idx.Embedder != embedder.Name() {
+			return fmt.Errorf("built with %s, not %s; use that embedder or start a new index", idx.Embedder, embedder.Name())
+		}
+		m.partitions[textKey{idx.AppName, idx.UserID}] = &vectorPartition{chunks: idx.Chunks, edits: idx.Edits}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opening memory index: %w", err)
+	}
+	return m, nil
+}
+
+// partition returns the partition for k, creating it. m.mu must be held
+// for writing.
+func (m *VectorMemory) partition(k textKey) *vectorPartition {
+	p, ok := m.partitions[k]
+	if !ok {
+		p = &vectorPartition{}
+		m.partitions[k] = p
+	}
+	return p
+}
+
+// AddSession replaces the session's chunks with its current events. Chunks
+// that are already in the index keep their vectors, so adding a session
+// again as it grows only embeds what is new.
+func (m *VectorMemory) AddSession(ctx context.Context, s session.Session) error {
+	k := textKey{s.AppName(), s.UserID()}
+	var chunks []vectorChunk
+	for ev := range s.Events().All() {
+		texts := chunkWords(eventText(ev), m.opts.ChunkWords)
+		for i, c := range texts {
+			id := ev.ID
+			if len(texts) > 1 {
+				id = fmt.Sprintf("%s:%d", ev.ID, i+1)
+			}
+			chunks = append(chunks, vectorChunk{
+				ID:        id,
+				AppName:   s.AppName(),
+				UserID:    s.UserID(),
+				SessionID: s.ID(),
+				EventID:   ev.ID,
+				Author:    ev.Author,
+				Timestamp: ev.Timestamp,
+				Text:      c,
+			})
+		}
+	}
+
+	known := make(map[string][]float32)
+	m.mu.RLock()
+	if p := m.partitions[k]; p != nil {
+		chunks = applyEdits(p.edits, chunks)
+		for _, c := range p.chunks {
+			if c.SessionID == s.ID() {
+				known[c.Text] = c.Vector
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	var texts []string
+	var missing []int
+	for i := range chunks {
+		if v, ok := known[chunks[i].Text]; ok {
+			chunks[i].Vector = v
+		} else {
+			texts = append(texts, chunks[i].Text)
+			missing = append(missing, i)
+		}
+	}
+	if len(texts) > 0 {
+		vecs, err := m.embedder.Embed(ctx, EmbedDocument, texts)
+		if err != nil {
+			return err
+		}
+		for j, i := range missing {
+			chunks[i].Vector = vecs[j]
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.partition(k)
+	// Leave out anything forgotten, wiped or corrected while embedding.
+	chunks = slices.DeleteFunc(chunks, func(c vectorChunk) bool {
+		text, ok := p.edits.apply(c.AppName, c.UserID, c.ID, c.Timestamp, c.Text)
+		return !ok || text != c.Text
+	})
+	next := slices.DeleteFunc(slices.Clone(p.chunks), func(c vectorChunk) bool { return c.SessionID == s.ID() })
+	next = append(next, chunks...)
+	if err := m.save(k, next, p.edits); err != nil {
+		return err
+	}
+	p.chunks = next
+	return nil
+}
+
+// applyEdits drops the chunks that were forgotten or wiped, and corrects
+// the ones that were corrected.
+func applyEdits(edits memoryEdits, chunks []vectorChunk) []vectorChunk {
+	var out []vectorChunk
+	for _, c := range chunks {
+		text, ok := edits.apply(c.AppName, c.UserID, c.ID, c.Timestamp, c.Text)
+		if ok {
+			c.Text = text
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (m *VectorMemory) List(ctx context.Context, appName, userID string) ([]MemoryRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var records []MemoryRecord
+	if p := m.partitions[textKey{appName, userID}]; p != nil {
+		for _, c := range p.chunks {
+			records = append(records, MemoryRecord{ID: c.ID, Text: c.Text, Author: c.Author, Timestamp: c.Timestamp, SessionID: c.SessionID})
+		}
+	}
+	slices.SortStableFunc(records, func(a, b MemoryRecord) int { return a.Timestamp.Compare(b.Timestamp) })
+	return records, nil
+}
+
+func (m *VectorMemory) Delete(ctx context.Context, appName, userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	p, i := m.find(k, id)
+	if i < 0 {
+		return errNoMemory
+	}
+	edits := p.edits.clone()
+	edits.forget(id)
+	next := slices.Delete(slices.Clone(p.chunks), i, i+1)
+	if err := m.save(k, next, edits); err != nil {
+		return err
+	}
+	p.chunks, p.edits = next, edits
+	return nil
+}
+
+func (m *VectorMemory) Update(ctx context.Context, appName, userID, id, text string) error {
+	vecs, err := m.embedder.Embed(ctx, EmbedDocument, []string{text})
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	p, i := m.find(k, id)
+	if i < 0 {
+		return errNoMemory
+	}
+	edits := p.edits.clone()
+	edits.correct(id, text)
+	next := slices.Clone(p.chunks)
+	next[i].Text, next[i].Vector = text, vecs[0]
+	if err := m.save(k, next, edits); err != nil {
+		return err
+	}
+	p.chunks, p.edits = next, edits
+	return nil
+}
+
+func (m *VectorMemory) Wipe(ctx context.Context, appName, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := textKey{appName, userID}
+	p := m.partition(k)
+	edits := p.edits.clone()
+	edits.wipe(appName, userID, time.Now())
+	if err := m.save(k, nil, edits); err != nil {
+		return 0, err
+	}
+	n := len(p.chunks)
+	p.chunks, p.edits = nil, edits
+	return n, nil
+}
+
+// find returns the user's partition and the index in it of chunk id, or
+// -1. m.mu must be held.
+func (m *VectorMemory) find(k textKey, id string) (*vectorPartition, int) {
+	p := m.partitions[k]
+	if p == nil {
+		return nil, -1
+	}
+	return p, slices.IndexFunc(p.chunks, func(c vectorChunk) bool { return c.ID == id })
+}
+
+// Search returns the user's TopK chunks closest to the query, best first,
+// leaving out any that score below MinScore.
+func (m *VectorMemory) Search(ctx context.Context, req *memory.SearchRequest) (*memory.SearchResponse, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return &memory.SearchResponse{}, nil
+	}
+	vecs, err := m.embedder.Embed(ctx, EmbedQuery, []string{req.Query})
+	if err != nil {
+		return nil, err
+	}
+	q := vecs[0]
+
+	type hit struct {
+		chunk vectorChunk
+		score float64
+	}
+	var hits []hit
+	m.mu.RLock()
+	if p := m.partitions[textKey{req.AppName, req.UserID}]; p != nil {
+		for _, c := range p.chunks {
+			if len(c.Vector) != len(q) {
+				continue
+			}
+			if score := dot(q, c.Vector); score >= m.opts.MinScore {
+				hits = append(hits, hit{c, score})
+			}
+		}
+	}
+	m.mu.RUnlock()
+	slices.SortStableFunc(hits, func(a, b hit) int { return cmp.Compare(b.score, a.score) })
+
+	res := &memory.SearchResponse{}
+	for _, h := range hits[:min(len(hits), m.opts.TopK)] {
+		res.Memories = append(res.Memories, h.chunk.entry())
+	}
+	return res, nil
+}
+
+func (c vectorChunk) entry() memory.Entry {
+	role := genai.Role(genai.RoleModel)
+	if c.Author == "user" {
+		role = genai.RoleUser
+	}
+	return memory.Entry{
+		Content:   genai.NewContentFromText(c.Text, role),
+		Author:    c.Author,
+		Timestamp: c.Timestamp,
+	}
+}
+
+// save writes the chunks and edits of the user k to their file. It writes
+// a new file and renames it over the old one, so a crash never leaves half
+// an index.
+func (m *VectorMemory) save(k textKey, chunks []vectorChunk, edits memoryEdits) error {
+	if m.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(vectorIndex{Embedder: m.embedder.Name(), AppName: k.appName, UserID: k.userID, Chunks: chunks, Edits: edits})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(partitionFile(m.dir, k), b)
+}
+
+// partitionFile is the file under dir in which the memories of the app and
+// user k are kept. Each name is escaped and prefixed, so that every ID,
+// even "" or "..", makes a name of its own.
+func partitionFile(dir string, k textKey) string {
+	return filepath.Join(dir, "_"+url.PathEscape(k.appName), "_"+url.PathEscape(k.userID)+".json")
+}
+
+// readPartitions calls fn with the path and contents of each partition
+// file under dir. An empty dir, or one that doesn't exist yet, has none.
+func readPartitions(dir string, fn func(path string, b []byte) error) error {
+	if dir == "" {
+		return nil
+	}
+	fi, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "_*", "_*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := fn(path, b); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with b.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("saving %s: %w", path, err)
+	}
+	return nil
+}
+
+// chunkWords splits text into chunks of at most n words. Each chunk
+// after the first repeats the last quarter of the one before, so a
+// sentence cut in two is still whole in one of them.
+func chunkWords(text string, n int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) <= n {
+		return []string{strings.Join(words, " ")}
+	}
+	step := max(n-n/4, 1)
+	var chunks []string
+	for start := 0; ; start += step {
+		end := min(start+n, len(words))
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			return chunks
+		}
+	}
+}
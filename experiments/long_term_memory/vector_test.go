@@ -0,0 +1,293 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/memory"
+	"google.golang.org/adk/session"
+)
+
+// stubEmbedder returns fixed vectors, and counts what it embeds. A text it
+// has no vector for gets one at right angles to all of them.
+type stubEmbedder struct {
+	vectors map[string][]float32
+
+	mu       sync.Mutex
+	calls    int
+	embedded []string // the documents embedded, in order
+}
+
+// stubVectors has the query "q" and documents at decreasing similarity to
+// it: 1, 0.8, 0 and -1.
+var stubVectors = map[string][]float32{
+	"q":     {1, 0, 0},
+	"alpha": {1, 0, 0},
+	"beta":  {0.8, 0.6, 0},
+	"gamma": {0, 1, 0},
+	"delta": {-1, 0, 0},
+}
+
+func (*stubEmbedder) Name() string { return "stub" }
+
+func (e *stubEmbedder) Embed(ctx context.Context, task EmbedTask, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls++
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		v, ok := e.vectors[text]
+		if !ok {
+			v = []float32{0, 0, 1}
+		}
+		vecs[i] = slices.Clone(v)
+		if task == EmbedDocument {
+			e.embedded = append(e.embedded, text)
+		}
+	}
+	return vecs, nil
+}
+
+// took returns what was embedded since it was last called.
+func (e *stubEmbedder) took() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	texts := e.embedded
+	e.embedded = nil
+	return texts
+}
+
+func openStubMemory(t *testing.T, dir string, opts VectorOptions) (*VectorMemory, *stubEmbedder) {
+	t.Helper()
+	e := &stubEmbedder{vectors: stubVectors}
+	m, err := OpenVectorMemory(dir, e, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, e
+}
+
+func search(t *testing.T, m memory.Service, userID, query string) []string {
+	t.Helper()
+	res, err := m.Search(t.Context(), &memory.SearchRequest{AppName: checkApp, UserID: userID, Query: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entryTexts(res.Memories)
+}
+
+func TestVectorSearchRanks(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts VectorOptions
+		want []string
+	}{
+		{"best first", VectorOptions{MinScore: -1}, []string{"alpha", "beta", "gamma", "delta"}},
+		{"top k", VectorOptions{TopK: 2, MinScore: -1}, []string{"alpha", "beta"}},
+		{"min score", VectorOptions{MinScore: 0.5}, []string{"alpha", "beta"}},
+		{"min score is inclusive", VectorOptions{MinScore: 0}, []string{"alpha", "beta", "gamma"}},
+		{"nothing close enough", VectorOptions{MinScore: 1.5}, []string{}},
+		{"default min score", VectorOptions{}, []string{"alpha", "beta", "gamma"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := openStubMemory(t, "", tc.opts)
+			env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+			if _, err := env.add(t.Context(), checkApp, checkUser, "gamma", "delta", "beta", "alpha"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := env.add(t.Context(), checkApp, "someone_else", "alpha"); err != nil {
+				t.Fatal(err)
+			}
+			if got := search(t, m, checkUser, "q"); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChunkWords(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		n    int
+		want []string
+	}{
+		{"", 4, nil},
+		{"  ", 4, nil},
+		{"one two  three", 4, []string{"one two three"}},
+		{"1 2 3 4", 4, []string{"1 2 3 4"}},
+		// Each chunk repeats the last quarter of the one before.
+		{"1 2 3 4 5 6 7 8 9 10", 4, []string{"1 2 3 4", "4 5 6 7", "7 8 9 10"}},
+		{"1 2 3 4 5 6 7 8 9 10 11 12", 8, []string{"1 2 3 4 5 6 7 8", "7 8 9 10 11 12"}},
+		{"1 2 3", 1, []string{"1", "2", "3"}},
+	} {
+		if got := chunkWords(tc.text, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("chunkWords(%q, %d) = %q, want %q", tc.text, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestVectorSplitsLongEvents(t *testing.T) {
+	m, e := openStubMemory(t, "", VectorOptions{ChunkWords: 4, MinScore: -1})
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	s, err := env.add(t.Context(), checkApp, checkUser, "alpha beta gamma delta alpha beta gamma", "gamma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.took(), []string{"alpha beta gamma delta", "delta alpha beta gamma", "gamma"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("embedded %q, want %q", got, want)
+	}
+
+	records, err := m.List(t.Context(), checkApp, checkUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, short := s.Events().At(0).ID, s.Events().At(1).ID
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	if want := []string{long + ":1", long + ":2", short}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got memories %q, want %q", ids, want)
+	}
+}
+
+func TestVectorReusesVectors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "index")
+	m, e := openStubMemory(t, dir, VectorOptions{})
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	s, err := env.add(t.Context(), checkApp, checkUser, "alpha", "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.took(); len(got) != 2 {
+		t.Errorf("embedded %q, want both events", got)
+	}
+
+	// Adding it again unchanged doesn't call the embedder; as it grows,
+	// only what is new is embedded.
+	calls := e.calls
+	if err := m.AddSession(t.Context(), s); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.took(); len(got) != 0 || e.calls != calls {
+		t.Errorf("embedded %q again in %d calls, want nothing", got, e.calls-calls)
+	}
+	if s, err = env.append(t.Context(), s, "gamma"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddSession(t.Context(), s); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.took(); !reflect.DeepEqual(got, []string{"gamma"}) {
+		t.Errorf("embedded %q, want only the new event", got)
+	}
+
+	// The vectors are saved with the index.
+	m, e = openStubMemory(t, dir, VectorOptions{})
+	env.mem = m
+	if err := m.AddSession(t.Context(), s); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.took(); len(got) != 0 {
+		t.Errorf("embedded %q after reopening, want nothing", got)
+	}
+	if got := search(t, m, checkUser, "q"); !reflect.DeepEqual(got, []string{"alpha", "beta", "gamma"}) {
+		t.Errorf("after reopening, got %q", got)
+	}
+
+	// The same text in another session is embedded for that session.
+	if _, err := env.add(t.Context(), checkApp, checkUser, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.took(); !reflect.DeepEqual(got, []string{"alpha"}) {
+		t.Errorf("embedded %q, want the other session's event", got)
+	}
+}
+
+func TestVectorSavesOnlyTheUsersFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "index")
+	m, _ := openStubMemory(t, dir, VectorOptions{})
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	if _, err := env.add(t.Context(), checkApp, "someone_else", "delta"); err != nil {
+		t.Fatal(err)
+	}
+	theirs := partitionFile(dir, textKey{checkApp, "someone_else"})
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(theirs, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.add(t.Context(), checkApp, checkUser, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wipe(t.Context(), checkApp, checkUser); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(theirs); err != nil || !fi.ModTime().Equal(past) {
+		t.Errorf("another user's file was written: %v", err)
+	}
+	b, err := os.ReadFile(partitionFile(dir, textKey{checkApp, checkUser}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "delta") {
+		t.Errorf("the user's file holds another user's memory: %s", b)
+	}
+
+	// Odd IDs still get files of their own.
+	for _, id := range []string{".", "..", "a/b", "a%2Fb", "_x"} {
+		if _, err := env.add(t.Context(), checkApp, id, "alpha"); err != nil {
+			t.Fatalf("user %q: %v", id, err)
+		}
+	}
+	m, _ = openStubMemory(t, dir, VectorOptions{MinScore: -1})
+	for _, id := range []string{".", "..", "a/b", "a%2Fb", "_x"} {
+		if got := search(t, m, id, "q"); !reflect.DeepEqual(got, []string{"alpha"}) {
+			t.Errorf("user %q: got %q after reopening", id, got)
+		}
+	}
+	if got := search(t, m, "someone_else", "q"); !reflect.DeepEqual(got, []string{"delta"}) {
+		t.Errorf("someone_else: got %q after reopening", got)
+	}
+}
+
+func TestOpenVectorMemoryRejects(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "index")
+	m, _ := openStubMemory(t, dir, VectorOptions{})
+	env := &checkEnv{mem: m, sessions: session.InMemoryService()}
+	if _, err := env.add(t.Context(), checkApp, checkUser, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenVectorMemory(dir, HashingEmbedder{Dim: 8}, VectorOptions{}); err == nil || !strings.Contains(err.Error(), "built with stub, not hashing-8") {
+		t.Errorf("another embedder: got %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "memory_index.json")
+	if err := os.WriteFile(file, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenVectorMemory(file, &stubEmbedder{}, VectorOptions{}); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("a file: got %v", err)
+	}
+}
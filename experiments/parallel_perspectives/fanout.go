@@ -0,0 +1,472 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// FailurePolicy decides how a fan-out reacts when some branches fail.
+type FailurePolicy string
+
+const (
+	// FailFast cancels the remaining branches as soon as one branch errors or
+	// times out, and reports the run as failed.
+	FailFast FailurePolicy = "fail_fast"
+	// BestEffort lets every branch finish and reports whatever succeeded. The
+	// run only fails if no branch succeeded at all.
+	BestEffort FailurePolicy = "best_effort"
+	// Quorum succeeds as soon as FanOutConfig.Quorum branches succeed; the
+	// remaining branches are cancelled.
+	Quorum FailurePolicy = "quorum"
+)
+
+// BranchStatus is the final state of a single branch.
+type BranchStatus string
+
+const (
+	BranchSucceeded BranchStatus = "succeeded"
+	BranchTimedOut  BranchStatus = "timed_out"
+	BranchErrored   BranchStatus = "errored"
+	BranchCancelled BranchStatus = "cancelled"
+)
+
+// OutputMode controls how branch events are ordered on the way out of a
+// fan-out. Execution is concurrent in every mode; only delivery changes.
+type OutputMode string
+
+const (
+	// OutputAsProduced forwards events, including streamed partial tokens, in
+	// whatever order the branches produce them. This matches parallelagent.
+	OutputAsProduced OutputMode = "as_produced"
+	// OutputGrouped buffers each branch's answers and emits them as one
+	// block under an author header, in the declared sub-agent order. Tool
+	// calls and responses are forwarded at once, because the runner only
+	// stores what is yielded and a branch's next model request is built from
+	// the session.
+	OutputGrouped OutputMode = "grouped"
+	// OutputLanes emits each complete message as soon as its branch finishes
+	// it, prefixed with an author label. Streamed partial tokens are dropped
+	// so that two branches never interleave mid-message.
+	OutputLanes OutputMode = "lanes"
+)
+
+// BranchOutcome records how one sub-agent finished.
+type BranchOutcome struct {
+	Agent    string        `json:"agent"`
+	Status   BranchStatus  `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// FanOutConfig configures a fan-out agent.
+type FanOutConfig struct {
+	// Basic agent setup. Run must be nil.
+	AgentConfig agent.Config
+	// BranchTimeout is the deadline applied to each sub-agent individually.
+	// Zero means no per-branch deadline.
+	BranchTimeout time.Duration
+	// Policy decides when the run as a whole is considered failed.
+	// Defaults to BestEffort.
+	Policy FailurePolicy
+	// Quorum is the number of successful branches required by the Quorum
+	// policy.
+	Quorum int
+	// Output controls the order in which branch events are emitted.
+	// Defaults to OutputAsProduced.
+	Output OutputMode
+}
+
+// NewFanOut returns a workflow agent that, like parallelagent, runs all of
+// its sub-agents concurrently on isolated branches. Unlike parallelagent, a
+// slow or failing sub-agent does not take the whole run down with it: each
+// branch gets its own deadline, the configured FailurePolicy decides the
+// overall result, and a final report event lists what happened to every
+// branch.
+func NewFanOut(cfg FanOutConfig) (agent.Agent, error) {
+	if cfg.AgentConfig.Run != nil {
+		return nil, fmt.Errorf("fan-out agent doesn't allow custom Run implementations")
+	}
+	if cfg.Policy == "" {
+		cfg.Policy = BestEffort
+	}
+	if cfg.Output == "" {
+		cfg.Output = OutputAsProduced
+	}
+	switch cfg.Output {
+	case OutputAsProduced, OutputGrouped, OutputLanes:
+	default:
+		return nil, fmt.Errorf("unknown output mode %q", cfg.Output)
+	}
+	switch cfg.Policy {
+	case FailFast, BestEffort:
+	case Quorum:
+		if cfg.Quorum <= 0 || cfg.Quorum > len(cfg.AgentConfig.SubAgents) {
+			return nil, fmt.Errorf("quorum must be between 1 and %d, got %d", len(cfg.AgentConfig.SubAgents), cfg.Quorum)
+		}
+	default:
+		return nil, fmt.Errorf("unknown failure policy %q", cfg.Policy)
+	}
+
+	f := &fanOut{cfg: cfg}
+	cfg.AgentConfig.Run = f.run
+	return agent.New(cfg.AgentConfig)
+}
+
+type fanOut struct {
+	cfg FanOutConfig
+}
+
+// branchResult carries either an event produced by a branch or, once the
+// branch is done, its outcome.
+type branchResult struct {
+	index   int
+	event   *session.Event
+	outcome *BranchOutcome
+	// handled is closed once event has been passed on, or held back. The
+	// branch waits for it, as it would for yield, so that the runner has
+	// stored the event before the branch builds its next model request.
+	handled chan struct{}
+}
+
+func (f *fanOut) run(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+	return func(yield func(*session.Event, error) bool) {
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		subAgents := ctx.Agent().SubAgents()
+		results := make(chan branchResult)
+
+		var wg sync.WaitGroup
+		for i, sa := range subAgents {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f.runBranch(runCtx, ctx, i, sa, results)
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		outcomes := make([]BranchOutcome, len(subAgents))
+		done := make([]bool, len(subAgents))
+		buffered := make([][]*session.Event, len(subAgents))
+		next := 0 // first branch not yet flushed in OutputGrouped mode
+		succeeded, failed := 0, 0
+		stopped := false
+		emit := func(events ...*session.Event) {
+			for _, ev := range events {
+				if stopped {
+					return
+				}
+				if !yield(ev, nil) {
+					stopped = true
+					cancel()
+				}
+			}
+		}
+
+		// Always drain the channel so every branch goroutine can exit.
+		for res := range results {
+			if res.event != nil {
+				ev := res.event
+				switch {
+				case f.cfg.Output == OutputAsProduced:
+					emit(ev)
+				case ev.LLMResponse.Partial:
+					// Drop streamed chunks; the model's aggregated, non-partial
+					// message follows and is the one we emit.
+				case f.cfg.Output == OutputLanes:
+					if hasText(ev) {
+						emit(authorHeaderEvent(ctx, subAgents[res.index].Name()))
+					}
+					emit(ev)
+				case hasFunctionParts(ev):
+					emit(ev)
+				default:
+					buffered[res.index] = append(buffered[res.index], ev)
+				}
+				close(res.handled)
+				continue
+			}
+
+			outcomes[res.index] = *res.outcome
+			done[res.index] = true
+			for f.cfg.Output == OutputGrouped && next < len(subAgents) && done[next] {
+				emit(f.groupEvents(ctx, subAgents[next].Name(), buffered[next])...)
+				buffered[next] = nil
+				next++
+			}
+			switch res.outcome.Status {
+			case BranchSucceeded:
+				succeeded++
+				if f.cfg.Policy == Quorum && succeeded == f.cfg.Quorum {
+					cancel()
+				}
+			case BranchTimedOut, BranchErrored:
+				failed++
+				if f.cfg.Policy == FailFast {
+					cancel()
+				}
+			}
+		}
+		if stopped {
+			return
+		}
+
+		if !yield(f.reportEvent(ctx, outcomes), nil) {
+			return
+		}
+		if err := f.verdict(succeeded, failed); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// runBranch runs one sub-agent under its own deadline and sends its events,
+// followed by exactly one outcome, to results.
+func (f *fanOut) runBranch(parent context.Context, ctx agent.InvocationContext, index int, subAgent agent.Agent, results chan<- branchResult) {
+	branchCtx, cancel := context.WithCancel(parent)
+	if f.cfg.BranchTimeout > 0 {
+		branchCtx, cancel = context.WithTimeout(parent, f.cfg.BranchTimeout)
+	}
+	defer cancel()
+
+	branch := fmt.Sprintf("%s.%s", ctx.Agent().Name(), subAgent.Name())
+	if ctx.Branch() != "" {
+		branch = fmt.Sprintf("%s.%s", ctx.Branch(), branch)
+	}
+	subCtx := newBranchContext(branchCtx, ctx, subAgent, branch)
+
+	// The sub-agent runs in its own goroutine so that a model which ignores
+	// context cancellation still cannot hold the branch past its deadline.
+	type step struct {
+		event   *session.Event
+		err     error
+		handled chan struct{}
+	}
+	steps := make(chan step)
+	go func() {
+		defer close(steps)
+		for event, err := range subAgent.Run(subCtx) {
+			handled := make(chan struct{})
+			select {
+			case steps <- step{event, err, handled}:
+			case <-branchCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			if event == nil {
+				continue
+			}
+			select {
+			case <-handled:
+			case <-branchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	var runErr error
+loop:
+	for {
+		select {
+		case s, ok := <-steps:
+			if !ok {
+				break loop
+			}
+			if s.err != nil {
+				runErr = s.err
+				break loop
+			}
+			if s.event != nil {
+				results <- branchResult{index: index, event: s.event, handled: s.handled}
+			}
+		case <-branchCtx.Done():
+			break loop
+		}
+	}
+
+	outcome := &BranchOutcome{
+		Agent:    subAgent.Name(),
+		Status:   BranchSucceeded,
+		Duration: time.Since(start),
+	}
+	switch {
+	case parent.Err() != nil:
+		outcome.Status = BranchCancelled
+	case errors.Is(branchCtx.Err(), context.DeadlineExceeded):
+		outcome.Status = BranchTimedOut
+		outcome.Error = fmt.Sprintf("no result within %s", f.cfg.BranchTimeout)
+	case runErr != nil:
+		outcome.Status = BranchErrored
+		outcome.Error = runErr.Error()
+	}
+	results <- branchResult{index: index, outcome: outcome}
+}
+
+// verdict applies the failure policy to the final branch counts.
+func (f *fanOut) verdict(succeeded, failed int) error {
+	switch f.cfg.Policy {
+	case FailFast:
+		if failed > 0 {
+			return fmt.Errorf("%s: %d branch(es) failed", f.cfg.AgentConfig.Name, failed)
+		}
+	case Quorum:
+		if succeeded < f.cfg.Quorum {
+			return fmt.Errorf("%s: quorum not reached: %d of %d required branches succeeded", f.cfg.AgentConfig.Name, succeeded, f.cfg.Quorum)
+		}
+	default:
+		if succeeded == 0 {
+			return fmt.Errorf("%s: no branch succeeded", f.cfg.AgentConfig.Name)
+		}
+	}
+	return nil
+}
+
+// reportEvent builds the final event listing the outcome of every branch,
+// both as readable text and as structured CustomMetadata.
+func (f *fanOut) reportEvent(ctx agent.InvocationContext, outcomes []BranchOutcome) *session.Event {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n[%s] branch report (%s):\n", ctx.Agent().Name(), f.cfg.Policy)
+	branches := make([]map[string]any, len(outcomes))
+	for i, o := range outcomes {
+		fmt.Fprintf(&b, "  - %s: %s (%s)", o.Agent, o.Status, o.Duration.Round(time.Millisecond))
+		if o.Error != "" {
+			fmt.Fprintf(&b, ": %s", o.Error)
+		}
+		b.WriteString("\n")
+		branches[i] = map[string]any{
+			"agent":       o.Agent,
+			"status":      string(o.Status),
+			"error":       o.Error,
+			"duration_ms": o.Duration.Milliseconds(),
+		}
+	}
+
+	ev := session.NewEvent(ctx.InvocationID())
+	ev.Author = ctx.Agent().Name()
+	ev.Branch = ctx.Branch()
+	ev.LLMResponse = model.LLMResponse{
+		Content:        genai.NewContentFromText(b.String(), genai.RoleModel),
+		CustomMetadata: map[string]any{"branches": branches},
+	}
+	return ev
+}
+
+// groupEvents returns a branch's buffered events preceded by a single author
+// header, or nothing if the branch produced no events.
+func (f *fanOut) groupEvents(ctx agent.InvocationContext, author string, events []*session.Event) []*session.Event {
+	if len(events) == 0 {
+		return nil
+	}
+	return append([]*session.Event{authorHeaderEvent(ctx, author)}, events...)
+}
+
+// authorHeaderEvent returns an author label such as "[optimist]: ". It is
+// marked partial so the runner shows it but does not store it in session
+// history, where later agents would otherwise see it.
+func authorHeaderEvent(ctx agent.InvocationContext, author string) *session.Event {
+	ev := session.NewEvent(ctx.InvocationID())
+	ev.Author = ctx.Agent().Name()
+	ev.Branch = ctx.Branch()
+	ev.LLMResponse = model.LLMResponse{
+		Content: genai.NewContentFromText(fmt.Sprintf("\n[%s]: ", author), genai.RoleModel),
+		Partial: true,
+	}
+	return ev
+}
+
+// hasText reports whether ev carries any text to display.
+func hasText(ev *session.Event) bool {
+	if ev.LLMResponse.Content == nil {
+		return false
+	}
+	for _, p := range ev.LLMResponse.Content.Parts {
+		if p.Text != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFunctionParts reports whether ev calls a tool or carries a tool's
+// response.
+func hasFunctionParts(ev *session.Event) bool {
+	if ev.LLMResponse.Content == nil {
+		return false
+	}
+	for _, p := range ev.LLMResponse.Content.Parts {
+		if p.FunctionCall != nil || p.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// branchContext is the invocation context handed to a single branch. It
+// carries the branch's own deadline, agent and branch name while sharing
+// session, artifacts and memory with the parent invocation.
+type branchContext struct {
+	agent.InvocationContext
+
+	ctx    context.Context
+	agent  agent.Agent
+	branch string
+
+	mu    sync.Mutex
+	ended bool
+}
+
+func newBranchContext(ctx context.Context, parent agent.InvocationContext, a agent.Agent, branch string) *branchContext {
+	return &branchContext{InvocationContext: parent, ctx: ctx, agent: a, branch: branch}
+}
+
+func (c *branchContext) Deadline() (time.Time, bool) { return c.ctx.Deadline() }
+func (c *branchContext) Done() <-chan struct{}       { return c.ctx.Done() }
+func (c *branchContext) Err() error                  { return c.ctx.Err() }
+func (c *branchContext) Value(key any) any           { return c.ctx.Value(key) }
+
+func (c *branchContext) Agent() agent.Agent { return c.agent }
+func (c *branchContext) Branch() string     { return c.branch }
+
+// EndInvocation only ends this branch; sibling branches keep running.
+func (c *branchContext) EndInvocation() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ended = true
+}
+
+func (c *branchContext) Ended() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ended
+}
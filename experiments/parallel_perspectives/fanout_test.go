@@ -0,0 +1,372 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/adk/tool"
+	"google.golang.org/adk/tool/functiontool"
+	"google.golang.org/genai"
+)
+
+// fakeModel answers with its name after delay, or fails with err.
+type fakeModel struct {
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (m *fakeModel) Name() string { return m.name }
+
+func (m *fakeModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			yield(nil, ctx.Err())
+			return
+		}
+		if m.err != nil {
+			yield(nil, m.err)
+			return
+		}
+		yield(&model.LLMResponse{Content: genai.NewContentFromText("take from "+m.name, genai.RoleModel)}, nil)
+	}
+}
+
+// runFanOut runs a fan-out over one sub-agent per model and returns the
+// status of each branch from the report event, and the run's error.
+func runFanOut(t *testing.T, cfg FanOutConfig, models ...*fakeModel) (map[string]BranchStatus, error) {
+	t.Helper()
+	for _, m := range models {
+		a, err := llmagent.New(llmagent.Config{Name: m.name, Model: m})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.AgentConfig.SubAgents = append(cfg.AgentConfig.SubAgents, a)
+	}
+	return runFanOutAgents(t, cfg)
+}
+
+// runFanOutAgents is runFanOut with cfg's sub-agents already set.
+func runFanOutAgents(t *testing.T, cfg FanOutConfig) (map[string]BranchStatus, error) {
+	t.Helper()
+	statuses, _, err := runFanOutEvents(t, cfg)
+	return statuses, err
+}
+
+// runFanOutEvents is runFanOutAgents that also returns every event the run
+// yielded, in order.
+func runFanOutEvents(t *testing.T, cfg FanOutConfig) (map[string]BranchStatus, []*session.Event, error) {
+	t.Helper()
+	cfg.AgentConfig.Name = "fan_out"
+	fo, err := NewFanOut(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := t.Context()
+	sessions := session.InMemoryService()
+	created, err := sessions.Create(ctx, &session.CreateRequest{AppName: "test", UserID: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(runner.Config{AppName: "test", Agent: fo, SessionService: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses map[string]BranchStatus
+	var events []*session.Event
+	var runErr error
+	msg := genai.NewContentFromText("topic", genai.RoleUser)
+	for ev, err := range r.Run(ctx, "user", created.Session.ID(), msg, agent.RunConfig{}) {
+		if err != nil {
+			runErr = err
+			continue
+		}
+		events = append(events, ev)
+		branches, ok := ev.CustomMetadata["branches"].([]map[string]any)
+		if !ok {
+			continue
+		}
+		statuses = make(map[string]BranchStatus)
+		for _, b := range branches {
+			statuses[b["agent"].(string)] = BranchStatus(b["status"].(string))
+		}
+	}
+	if statuses == nil {
+		t.Fatal("no branch report event")
+	}
+	return statuses, events, runErr
+}
+
+func checkStatuses(t *testing.T, got, want map[string]BranchStatus) {
+	t.Helper()
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("branch %s: got status %q, want %q", name, got[name], w)
+		}
+	}
+}
+
+func TestFanOutBestEffort(t *testing.T) {
+	got, err := runFanOut(t, FanOutConfig{Policy: BestEffort, BranchTimeout: 100 * time.Millisecond},
+		&fakeModel{name: "fast"},
+		&fakeModel{name: "broken", err: errors.New("boom")},
+		&fakeModel{name: "slow", delay: 5 * time.Second},
+	)
+	if err != nil {
+		t.Errorf("got error %v, want none because one branch succeeded", err)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{
+		"fast":   BranchSucceeded,
+		"broken": BranchErrored,
+		"slow":   BranchTimedOut,
+	})
+}
+
+func TestFanOutBestEffortNothingSucceeded(t *testing.T) {
+	got, err := runFanOut(t, FanOutConfig{Policy: BestEffort},
+		&fakeModel{name: "broken", err: errors.New("boom")},
+	)
+	if err == nil || !strings.Contains(err.Error(), "no branch succeeded") {
+		t.Errorf("got error %v, want no branch succeeded", err)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{"broken": BranchErrored})
+}
+
+func TestFanOutFailFast(t *testing.T) {
+	start := time.Now()
+	got, err := runFanOut(t, FanOutConfig{Policy: FailFast},
+		&fakeModel{name: "broken", err: errors.New("boom")},
+		&fakeModel{name: "slow", delay: 5 * time.Second},
+	)
+	if err == nil {
+		t.Error("got no error, want the run to fail")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %s, want the slow branch cancelled", d)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{
+		"broken": BranchErrored,
+		"slow":   BranchCancelled,
+	})
+}
+
+func TestFanOutQuorum(t *testing.T) {
+	start := time.Now()
+	got, err := runFanOut(t, FanOutConfig{Policy: Quorum, Quorum: 2},
+		&fakeModel{name: "first"},
+		&fakeModel{name: "second", delay: 10 * time.Millisecond},
+		&fakeModel{name: "slow", delay: 5 * time.Second},
+	)
+	if err != nil {
+		t.Errorf("got error %v, want none", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %s, want the slow branch cancelled once the quorum was reached", d)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{
+		"first":  BranchSucceeded,
+		"second": BranchSucceeded,
+		"slow":   BranchCancelled,
+	})
+}
+
+func TestFanOutQuorumNotReached(t *testing.T) {
+	got, err := runFanOut(t, FanOutConfig{Policy: Quorum, Quorum: 2, BranchTimeout: 100 * time.Millisecond},
+		&fakeModel{name: "fast"},
+		&fakeModel{name: "broken", err: errors.New("boom")},
+		&fakeModel{name: "slow", delay: 5 * time.Second},
+	)
+	if err == nil || !strings.Contains(err.Error(), "quorum not reached") {
+		t.Errorf("got error %v, want quorum not reached", err)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{
+		"fast":   BranchSucceeded,
+		"broken": BranchErrored,
+		"slow":   BranchTimedOut,
+	})
+}
+
+func TestFanOutBranchTimeout(t *testing.T) {
+	// The timeout fires even for a sub-agent that ignores cancellation.
+	stubborn, err := agent.New(agent.Config{
+		Name: "slow",
+		Run: func(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+			return func(yield func(*session.Event, error) bool) {
+				time.Sleep(time.Second)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got, err := runFanOutAgents(t, FanOutConfig{
+		AgentConfig:   agent.Config{SubAgents: []agent.Agent{stubborn}},
+		Policy:        FailFast,
+		BranchTimeout: 50 * time.Millisecond,
+	})
+	if err == nil {
+		t.Error("got no error, want the timed-out branch to fail the run")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("took %s, want the branch to give up after its timeout", d)
+	}
+	checkStatuses(t, got, map[string]BranchStatus{"slow": BranchTimedOut})
+}
+
+// texts returns the text of each event that has any, with the author
+// headers trimmed, such as "[slow]: " and "take from slow".
+func texts(events []*session.Event) []string {
+	var out []string
+	for _, ev := range events {
+		if !hasText(ev) || ev.CustomMetadata["branches"] != nil {
+			continue
+		}
+		var b strings.Builder
+		for _, p := range ev.LLMResponse.Content.Parts {
+			b.WriteString(p.Text)
+		}
+		out = append(out, strings.TrimSpace(b.String()))
+	}
+	return out
+}
+
+func TestFanOutOutputOrder(t *testing.T) {
+	for _, tc := range []struct {
+		mode OutputMode
+		want []string
+	}{
+		// Declared order, although slow finishes last.
+		{OutputGrouped, []string{"[slow]:", "take from slow", "[fast]:", "take from fast"}},
+		// Finishing order.
+		{OutputLanes, []string{"[fast]:", "take from fast", "[slow]:", "take from slow"}},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			var cfg FanOutConfig
+			cfg.Output = tc.mode
+			for _, m := range []*fakeModel{{name: "slow", delay: 100 * time.Millisecond}, {name: "fast"}} {
+				a, err := llmagent.New(llmagent.Config{Name: m.name, Model: m})
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg.AgentConfig.SubAgents = append(cfg.AgentConfig.SubAgents, a)
+			}
+			_, events, err := runFanOutEvents(t, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(events); !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// toolModel calls lookup once, then answers after delay. It records
+// whether its second request carried the call and the tool's response.
+type toolModel struct {
+	name  string
+	delay time.Duration
+
+	mu      sync.Mutex
+	calls   int
+	history bool
+}
+
+func (m *toolModel) Name() string { return m.name }
+
+func (m *toolModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	var called, answered bool
+	for _, c := range req.Contents {
+		for _, p := range c.Parts {
+			called = called || p.FunctionCall != nil
+			answered = answered || p.FunctionResponse != nil
+		}
+	}
+	m.mu.Lock()
+	m.calls++
+	if m.calls > 1 {
+		m.history = called && answered
+	}
+	m.mu.Unlock()
+	return func(yield func(*model.LLMResponse, error) bool) {
+		if !answered {
+			yield(&model.LLMResponse{Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+				genai.NewPartFromFunctionCall("lookup", map[string]any{}),
+			}}}, nil)
+			return
+		}
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			yield(nil, ctx.Err())
+			return
+		}
+		yield(&model.LLMResponse{Content: genai.NewContentFromText("take from "+m.name, genai.RoleModel)}, nil)
+	}
+}
+
+func TestFanOutGroupedKeepsToolHistory(t *testing.T) {
+	lookup, err := functiontool.New(functiontool.Config{Name: "lookup", Description: "Looks something up."},
+		func(tool.Context, struct{}) map[string]any { return map[string]any{"found": "data"} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	researcher := &toolModel{name: "researcher", delay: 50 * time.Millisecond}
+	a, err := llmagent.New(llmagent.Config{Name: researcher.name, Model: researcher, Tools: []tool.Tool{lookup}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, events, err := runFanOutEvents(t, FanOutConfig{
+		AgentConfig: agent.Config{SubAgents: []agent.Agent{a}},
+		Output:      OutputGrouped,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if researcher.calls != 2 || !researcher.history {
+		t.Errorf("got %d model calls, history %v; want the second call to see the tool call and its response", researcher.calls, researcher.history)
+	}
+	// The tool events come first, then the grouped answer.
+	var kinds []string
+	for _, ev := range events {
+		switch {
+		case hasFunctionParts(ev):
+			kinds = append(kinds, "tool")
+		case hasText(ev) && ev.CustomMetadata["branches"] == nil:
+			kinds = append(kinds, "text")
+		}
+	}
+	if want := []string{"tool", "tool", "text", "text"}; !slices.Equal(kinds, want) {
+		t.Errorf("got events %q, want %q", kinds, want)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// Contestant is one persona whose answer the judge compares.
+type Contestant struct {
+	// Agent is the persona's agent name.
+	Agent string
+	// OutputKey is the state key the persona writes its answer to.
+	OutputKey string
+	// Spec is the model the persona ran on, shown to the judge.
+	Spec ModelSpec
+}
+
+// newJudge returns an agent that reads every contestant's answer from state
+// and compares them, naming the model behind each one. Placed after a
+// fan-out in a sequential workflow, it turns a debate into a side-by-side
+// model benchmark. The workflow should clear the answers at the start of
+// each turn with clearAnswers.
+func newJudge(m model.LLM, spec ModelSpec, contestants []Contestant) (agent.Agent, error) {
+	return llmagent.New(llmagent.Config{
+		Name:                  "judge",
+		Description:           "Compares the answers of the other agents and the models behind them.",
+		Model:                 m,
+		GenerateContentConfig: spec.GenerateContentConfig(),
+		InstructionProvider: func(ctx agent.ReadonlyContext) (string, error) {
+			var b strings.Builder
+			b.WriteString("You are an impartial judge. Several agents answered the user's topic, " +
+				"each backed by a different model. Score each answer from 1 to 10 for clarity, " +
+				"persuasiveness and relevance to its assigned perspective, then state which model " +
+				"did best and why, in a few sentences. Judge the quality of the argument, not " +
+				"whether you agree with it.\n\nAnswers:\n")
+			for _, c := range contestants {
+				answer := "(no answer: the agent failed or timed out)"
+				if v, err := ctx.ReadonlyState().Get(c.OutputKey); err == nil && v != "" {
+					answer = fmt.Sprint(v)
+				}
+				fmt.Fprintf(&b, "\n### %s (model: %s)\n%s\n", c.Agent, c.Spec, answer)
+			}
+			return b.String(), nil
+		},
+	})
+}
+
+// clearAnswers returns a callback that empties every contestant's OutputKey.
+// Answers stay in state from one turn to the next, so without it a persona
+// that fails or times out would be judged on its answer to an earlier topic.
+func clearAnswers(contestants []Contestant) agent.BeforeAgentCallback {
+	return func(ctx agent.CallbackContext) (*genai.Content, error) {
+		for _, c := range contestants {
+			if err := ctx.State().Set(c.OutputKey, ""); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+}
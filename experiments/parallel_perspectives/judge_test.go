@@ -0,0 +1,128 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/agent/workflowagents/sequentialagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// instructionModel records the system instruction of every request.
+type instructionModel struct {
+	instructions []string
+}
+
+func (m *instructionModel) Name() string { return "judge" }
+
+func (m *instructionModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		var b strings.Builder
+		if req.Config != nil && req.Config.SystemInstruction != nil {
+			for _, p := range req.Config.SystemInstruction.Parts {
+				b.WriteString(p.Text)
+			}
+		}
+		m.instructions = append(m.instructions, b.String())
+		yield(&model.LLMResponse{Content: genai.NewContentFromText("scores", genai.RoleModel)}, nil)
+	}
+}
+
+func TestJudgeIgnoresAnswersFromEarlierTurns(t *testing.T) {
+	optimistModel := &fakeModel{name: "optimist"}
+	pessimistModel := &fakeModel{name: "pessimist"}
+	judgeModel := &instructionModel{}
+
+	var personas []agent.Agent
+	var contestants []Contestant
+	for _, m := range []*fakeModel{optimistModel, pessimistModel} {
+		a, err := llmagent.New(llmagent.Config{Name: m.name, Model: m, OutputKey: m.name + "_take"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		personas = append(personas, a)
+		contestants = append(contestants, Contestant{Agent: m.name, OutputKey: m.name + "_take"})
+	}
+	team, err := NewFanOut(FanOutConfig{
+		AgentConfig: agent.Config{Name: "debate_team", SubAgents: personas},
+		Policy:      BestEffort,
+		Output:      OutputGrouped,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	judge, err := newJudge(judgeModel, ModelSpec{}, contestants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := sequentialagent.New(sequentialagent.Config{
+		AgentConfig: agent.Config{
+			Name:                 "judged_debate",
+			SubAgents:            []agent.Agent{team, judge},
+			BeforeAgentCallbacks: []agent.BeforeAgentCallback{clearAnswers(contestants)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := t.Context()
+	sessions := session.InMemoryService()
+	created, err := sessions.Create(ctx, &session.CreateRequest{AppName: "test", UserID: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(runner.Config{AppName: "test", Agent: root, SessionService: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	turn := func(topic string) {
+		t.Helper()
+		msg := genai.NewContentFromText(topic, genai.RoleUser)
+		for _, err := range r.Run(ctx, "user", created.Session.ID(), msg, agent.RunConfig{}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	turn("remote work")
+	if got := judgeModel.instructions[0]; !strings.Contains(got, "take from optimist") || !strings.Contains(got, "take from pessimist") {
+		t.Fatalf("first turn: got instruction %q, want both takes", got)
+	}
+
+	// The pessimist fails on the second topic; its first take must not be
+	// judged as its answer.
+	pessimistModel.err = errors.New("model down")
+	turn("four-day week")
+	got := judgeModel.instructions[len(judgeModel.instructions)-1]
+	if !strings.Contains(got, "take from optimist") {
+		t.Errorf("second turn: got instruction %q, want the optimist's take", got)
+	}
+	if strings.Contains(got, "take from pessimist") || !strings.Contains(got, "### pessimist (model: ") ||
+		!strings.Contains(got, "(no answer: the agent failed or timed out)") {
+		t.Errorf("second turn: got instruction %q, want the pessimist's answer reported missing", got)
+	}
+}
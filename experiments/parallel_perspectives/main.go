@@ -18,61 +18,136 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/agent/llmagent"
-	"google.golang.org/adk/agent/workflowagents/parallelagent"
+	"google.golang.org/adk/agent/workflowagents/sequentialagent"
 	"google.golang.org/adk/cmd/launcher/adk"
 	"google.golang.org/adk/cmd/launcher/full"
-	"google.golang.org/adk/model/gemini"
+	"google.golang.org/adk/model"
 	"google.golang.org/adk/server/restapi/services"
-	"google.golang.org/genai"
 )
 
 func main() {
 	ctx := context.Background()
-	model, err := gemini.NewModel(ctx, "gemini-2.5-flash", &genai.ClientConfig{
-		Backend:  genai.BackendVertexAI,
-		Project:  os.Getenv("GOOGLE_CLOUD_PROJECT"),
-		Location: os.Getenv("GOOGLE_CLOUD_LOCATION"),
+
+	// Fanning out multiplies the request rate, which quickly runs into Vertex
+	// AI quota (HTTP 429). Every model below is wrapped by the same limiter,
+	// so all agents share one set of concurrency slots and per-minute
+	// budgets, and transient errors are retried with exponential backoff.
+	limiter := NewLimiter(LimiterConfig{
+		MaxConcurrent:     4,
+		RequestsPerMinute: 60,
+		TokensPerMinute:   200_000,
+		MaxRetries:        4,
 	})
-	if err != nil {
-		log.Fatal(err)
+
+	// Each persona can run on its own model so we can compare them side by
+	// side. The model is read from an environment variable holding a model
+	// spec (see models.go), e.g.
+	//   OPTIMIST_MODEL=gemini-2.5-pro?temperature=1.2
+	//   PESSIMIST_MODEL=gemini-2.5-flash-lite
+	// Unset variables fall back to gemini-2.5-flash.
+	newPersonaModel := func(envKey string) (model.LLM, ModelSpec) {
+		m, spec, err := modelFromEnv(ctx, envKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return limiter.Wrap(m), spec
 	}
+	defaultLLM, defaultSpec := newPersonaModel("DEFAULT_MODEL")
+	optimistLLM, optimistSpec := newPersonaModel("OPTIMIST_MODEL")
+	pessimistLLM, pessimistSpec := newPersonaModel("PESSIMIST_MODEL")
+	judgeLLM, judgeSpec := newPersonaModel("JUDGE_MODEL")
 
 	optimist, err := llmagent.New(llmagent.Config{
-		Name:        "optimist",
-		Model:       model,
-		Instruction: "You are an eternal optimist. Give a short, positive take on the user's topic.",
+		Name:                  "optimist",
+		Model:                 optimistLLM,
+		GenerateContentConfig: optimistSpec.GenerateContentConfig(),
+		Instruction:           "You are an eternal optimist. Give a short, positive take on the user's topic.",
+		OutputKey:             "optimist_take",
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	pessimist, err := llmagent.New(llmagent.Config{
-		Name:        "pessimist",
-		Model:       model,
-		Instruction: "You are a grumpy pessimist. Give a short, negative take on the user's topic.",
+		Name:                  "pessimist",
+		Model:                 pessimistLLM,
+		GenerateContentConfig: pessimistSpec.GenerateContentConfig(),
+		Instruction:           "You are a grumpy pessimist. Give a short, negative take on the user's topic.",
+		OutputKey:             "pessimist_take",
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// The Orchestrator: Parallel Agent
-	// It will run both agents at the same time.
-	orchestrator, err := parallelagent.New(parallelagent.Config{
+	// The Orchestrator: Fan-out Agent
+	// It runs both agents at the same time, like parallelagent, but gives each
+	// branch its own deadline. If one persona hangs or errors, we still get the
+	// other's take plus a report saying what happened to each branch.
+	// OutputGrouped buffers each persona's answer and prints them one after
+	// the other, in the order listed in SubAgents, instead of interleaving.
+	orchestrator, err := NewFanOut(FanOutConfig{
 		AgentConfig: agent.Config{
 			Name:        "debate_team",
 			Description: "Gets two opposing viewpoints on a topic.",
 			SubAgents:   []agent.Agent{optimist, pessimist},
 		},
+		BranchTimeout: 30 * time.Second,
+		Policy:        BestEffort,
+		Output:        OutputGrouped,
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// The judge reads both takes from state and compares the models behind
+	// them, turning the debate into a side-by-side benchmark.
+	contestants := []Contestant{
+		{Agent: "optimist", OutputKey: "optimist_take", Spec: optimistSpec},
+		{Agent: "pessimist", OutputKey: "pessimist_take", Spec: pessimistSpec},
+	}
+	judge, err := newJudge(judgeLLM, judgeSpec, contestants)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	judgedDebate, err := sequentialagent.New(sequentialagent.Config{
+		AgentConfig: agent.Config{
+			Name:        "judged_debate",
+			Description: "Runs the debate team, then has a judge compare the answers.",
+			SubAgents:   []agent.Agent{orchestrator, judge},
+			// Forget the previous turn's takes, so the judge never scores
+			// a stale one in place of a persona that failed this time.
+			BeforeAgentCallbacks: []agent.BeforeAgentCallback{clearAnswers(contestants)},
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A second workflow: fan out over a dynamic list of stakeholders instead
+	// of a fixed pair of personas. See stakeholders.go.
+	review, err := newStakeholderReview(defaultLLM, defaultSpec.GenerateContentConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Both workflows are available in web mode. Console mode runs the root
+	// agent, which is judged_debate unless PERSPECTIVES_ROOT=stakeholder_review.
+	root, other := judgedDebate, review
+	if os.Getenv("PERSPECTIVES_ROOT") == review.Name() {
+		root, other = review, judgedDebate
+	}
+	loader, err := services.NewMultiAgentLoader(root, other)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	config := &adk.Config{
-		AgentLoader: services.NewSingleAgentLoader(orchestrator),
+		AgentLoader: loader,
 	}
 	l := full.NewLauncher()
 
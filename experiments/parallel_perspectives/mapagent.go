@@ -0,0 +1,261 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/session"
+)
+
+// MapConfig configures a map agent.
+type MapConfig struct {
+	// Basic agent setup. Run and SubAgents must be empty: the sub-agents are
+	// created at run time from Template.
+	AgentConfig agent.Config
+	// ItemsKey is the session state key holding the list to fan out over.
+	// The value may be a []string, a []any, or a JSON array encoded as a
+	// string, which is what an llmagent with an OutputSchema and OutputKey
+	// stores.
+	ItemsKey string
+	// Template creates the sub-agent for the item at index. Agent names must
+	// be unique across items; the index can be used to tell apart items that
+	// would otherwise get the same name.
+	Template func(index int, item string) (agent.Agent, error)
+	// MaxConcurrency caps how many item agents run at once. Zero means no
+	// limit.
+	MaxConcurrency int
+	// OutputKey is the session state key that receives the results, one
+	// MapResult per item in input order.
+	OutputKey string
+}
+
+// MapResult is the outcome of running the templated agent for one item.
+type MapResult struct {
+	Item   string `json:"item"`
+	Agent  string `json:"agent"`
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewMap returns a workflow agent that reads a list from session state,
+// instantiates Template once per item and runs the resulting agents
+// concurrently on isolated branches. Each agent's final text is collected
+// into OutputKey so a later agent can reduce the results.
+func NewMap(cfg MapConfig) (agent.Agent, error) {
+	if cfg.AgentConfig.Run != nil {
+		return nil, fmt.Errorf("map agent doesn't allow custom Run implementations")
+	}
+	if len(cfg.AgentConfig.SubAgents) > 0 {
+		return nil, fmt.Errorf("map agent creates its sub-agents from Template; SubAgents must be empty")
+	}
+	if cfg.ItemsKey == "" || cfg.OutputKey == "" {
+		return nil, fmt.Errorf("map agent requires ItemsKey and OutputKey")
+	}
+	if cfg.Template == nil {
+		return nil, fmt.Errorf("map agent requires a Template")
+	}
+
+	m := &mapAgent{cfg: cfg}
+	cfg.AgentConfig.Run = m.run
+	return agent.New(cfg.AgentConfig)
+}
+
+type mapAgent struct {
+	cfg MapConfig
+}
+
+func (m *mapAgent) run(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
+	return func(yield func(*session.Event, error) bool) {
+		raw, err := ctx.Session().State().Get(m.cfg.ItemsKey)
+		if err != nil {
+			yield(nil, fmt.Errorf("%s: reading %q from state: %w", ctx.Agent().Name(), m.cfg.ItemsKey, err))
+			return
+		}
+		items, err := parseItems(raw)
+		if err != nil {
+			yield(nil, fmt.Errorf("%s: %q is not a list: %w", ctx.Agent().Name(), m.cfg.ItemsKey, err))
+			return
+		}
+
+		agents := make([]agent.Agent, len(items))
+		seen := make(map[string]bool)
+		for i, item := range items {
+			a, err := m.cfg.Template(i, item)
+			if err != nil {
+				yield(nil, fmt.Errorf("%s: creating agent for %q: %w", ctx.Agent().Name(), item, err))
+				return
+			}
+			if seen[a.Name()] {
+				yield(nil, fmt.Errorf("%s: duplicate agent name %q for item %q", ctx.Agent().Name(), a.Name(), item))
+				return
+			}
+			seen[a.Name()] = true
+			agents[i] = a
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var sem chan struct{}
+		if m.cfg.MaxConcurrency > 0 {
+			sem = make(chan struct{}, m.cfg.MaxConcurrency)
+		}
+
+		type itemEvent struct {
+			index int
+			event *session.Event
+		}
+		events := make(chan itemEvent)
+		results := make([]MapResult, len(items))
+
+		var wg sync.WaitGroup
+		for i, a := range agents {
+			results[i] = MapResult{Item: items[i], Agent: a.Name()}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sem != nil {
+					select {
+					case sem <- struct{}{}:
+						defer func() { <-sem }()
+					case <-runCtx.Done():
+						results[i].Error = runCtx.Err().Error()
+						return
+					}
+				}
+
+				branch := fmt.Sprintf("%s.%s", ctx.Agent().Name(), a.Name())
+				if ctx.Branch() != "" {
+					branch = fmt.Sprintf("%s.%s", ctx.Branch(), branch)
+				}
+				for ev, err := range a.Run(newBranchContext(runCtx, ctx, a, branch)) {
+					if err != nil {
+						results[i].Error = err.Error()
+						return
+					}
+					if ev == nil {
+						continue
+					}
+					if !ev.LLMResponse.Partial && ev.Author == a.Name() && hasText(ev) {
+						results[i].Output = eventText(ev)
+					}
+					select {
+					case events <- itemEvent{index: i, event: ev}:
+					case <-runCtx.Done():
+						results[i].Error = runCtx.Err().Error()
+						return
+					}
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(events)
+		}()
+
+		// Items run concurrently, so emit complete messages in labelled lanes
+		// rather than interleaving streamed tokens from different items.
+		stopped := false
+		for ie := range events {
+			if stopped || ie.event.LLMResponse.Partial {
+				continue
+			}
+			if hasText(ie.event) && !yield(authorHeaderEvent(ctx, agents[ie.index].Name()), nil) {
+				stopped = true
+				cancel()
+				continue
+			}
+			if !yield(ie.event, nil) {
+				stopped = true
+				cancel()
+			}
+		}
+		if stopped {
+			return
+		}
+
+		// The results are recorded through a state delta so that the runner
+		// persists them with the session like any other state change.
+		list := make([]any, len(results))
+		for i, r := range results {
+			list[i] = map[string]any{
+				"item":   r.Item,
+				"agent":  r.Agent,
+				"output": r.Output,
+				"error":  r.Error,
+			}
+		}
+		ev := session.NewEvent(ctx.InvocationID())
+		ev.Author = ctx.Agent().Name()
+		ev.Branch = ctx.Branch()
+		ev.Actions.StateDelta = map[string]any{m.cfg.OutputKey: list}
+		yield(ev, nil)
+	}
+}
+
+// parseItems normalises the supported list representations into strings.
+// Non-string elements are re-encoded as JSON so templates still see them.
+func parseItems(raw any) ([]string, error) {
+	switch v := raw.(type) {
+	case []string:
+		return v, nil
+	case []any:
+		items := make([]string, len(v))
+		for i, e := range v {
+			if s, ok := e.(string); ok {
+				items[i] = s
+				continue
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = string(b)
+		}
+		return items, nil
+	case string:
+		// Models sometimes wrap JSON output in a Markdown code fence.
+		s := strings.TrimSpace(v)
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSuffix(s, "```")
+		var list []any
+		if err := json.Unmarshal([]byte(s), &list); err != nil {
+			return nil, err
+		}
+		return parseItems(list)
+	default:
+		return nil, fmt.Errorf("unsupported type %T", raw)
+	}
+}
+
+// eventText concatenates the text parts of an event.
+func eventText(ev *session.Event) string {
+	if ev.LLMResponse.Content == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range ev.LLMResponse.Content.Parts {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
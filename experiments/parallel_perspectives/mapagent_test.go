@@ -0,0 +1,211 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/runner"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+)
+
+// runMap runs a map agent over items, stored under "items", and returns the
+// events it yielded, the results it stored under "results", and the run's
+// error.
+func runMap(t *testing.T, cfg MapConfig, items any) ([]*session.Event, []any, error) {
+	t.Helper()
+	cfg.AgentConfig.Name = "panel"
+	cfg.ItemsKey, cfg.OutputKey = "items", "results"
+	m, err := NewMap(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := t.Context()
+	sessions := session.InMemoryService()
+	created, err := sessions.Create(ctx, &session.CreateRequest{AppName: "test", UserID: "user", State: map[string]any{"items": items}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.New(runner.Config{AppName: "test", Agent: m, SessionService: sessions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []*session.Event
+	var runErr error
+	msg := genai.NewContentFromText("topic", genai.RoleUser)
+	for ev, err := range r.Run(ctx, "user", created.Session.ID(), msg, agent.RunConfig{}) {
+		if err != nil {
+			runErr = err
+			continue
+		}
+		events = append(events, ev)
+	}
+
+	got, err := sessions.Get(ctx, &session.GetRequest{AppName: "test", UserID: "user", SessionID: created.Session.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := got.Session.State().Get("results")
+	list, _ := results.([]any)
+	return events, list, runErr
+}
+
+// modelPerItem is a Template that gives each item an agent named after it,
+// answering through a fakeModel from models, or a quick one by default.
+func modelPerItem(models map[string]*fakeModel) func(int, string) (agent.Agent, error) {
+	return func(_ int, item string) (agent.Agent, error) {
+		m := models[item]
+		if m == nil {
+			m = &fakeModel{name: item}
+		}
+		return llmagent.New(llmagent.Config{Name: item, Model: m})
+	}
+}
+
+func TestMapCollectsResultsInInputOrder(t *testing.T) {
+	events, results, err := runMap(t, MapConfig{
+		Template: modelPerItem(map[string]*fakeModel{
+			"slow":   {name: "slow", delay: 50 * time.Millisecond},
+			"broken": {name: "broken", err: errors.New("model down")},
+		}),
+	}, []string{"slow", "fast", "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lanes follow the finishing order; the broken item has no lane.
+	if got, want := texts(events), []string{"[fast]:", "take from fast", "[slow]:", "take from slow"}; !slices.Equal(got, want) {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	want := []map[string]any{
+		{"item": "slow", "agent": "slow", "output": "take from slow", "error": ""},
+		{"item": "fast", "agent": "fast", "output": "take from fast", "error": ""},
+		{"item": "broken", "agent": "broken", "output": ""},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %v", len(results), len(want), results)
+	}
+	for i, w := range want {
+		r, _ := results[i].(map[string]any)
+		for k, v := range w {
+			if r[k] != v {
+				t.Errorf("result %d: got %s %q, want %q", i, k, r[k], v)
+			}
+		}
+	}
+	if r, _ := results[2].(map[string]any); !strings.Contains(r["error"].(string), "model down") {
+		t.Errorf("got error %q for the broken item, want the model's error", r["error"])
+	}
+}
+
+func TestMapMaxConcurrency(t *testing.T) {
+	// Two slots for three items: the third starts only when one of the
+	// first two is done, so it finishes last although it is the fastest.
+	events, results, err := runMap(t, MapConfig{
+		MaxConcurrency: 2,
+		Template: modelPerItem(map[string]*fakeModel{
+			"a": {name: "a", delay: 50 * time.Millisecond},
+			"b": {name: "b", delay: 50 * time.Millisecond},
+			"c": {name: "c", delay: 10 * time.Millisecond},
+		}),
+	}, `["a", "b", "c"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if got := texts(events); len(got) != 6 || got[5] != "take from c" {
+		t.Errorf("got output %q, want c to answer last", got)
+	}
+}
+
+func TestMapItemsFromModelOutput(t *testing.T) {
+	_, results, err := runMap(t, MapConfig{Template: modelPerItem(nil)}, "```json\n[\"a\", \"b\"]\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	for _, r := range results {
+		items = append(items, r.(map[string]any)["item"].(string))
+	}
+	if !slices.Equal(items, []string{"a", "b"}) {
+		t.Errorf("got items %q, want [a b]", items)
+	}
+}
+
+func TestMapNameCollisions(t *testing.T) {
+	t.Run("persona names", func(t *testing.T) {
+		model := &fakeModel{name: "persona"}
+		events, results, err := runMap(t, MapConfig{
+			Template: func(i int, stakeholder string) (agent.Agent, error) {
+				return llmagent.New(llmagent.Config{Name: personaName(i, stakeholder), Model: model})
+			},
+		}, []string{"R&D", "R/D"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var agents []string
+		for _, r := range results {
+			agents = append(agents, r.(map[string]any)["agent"].(string))
+		}
+		if !slices.Equal(agents, []string{"r_d_1", "r_d_2"}) {
+			t.Errorf("got agents %q, want [r_d_1 r_d_2]", agents)
+		}
+		if got := len(texts(events)); got != 4 {
+			t.Errorf("got %d text events, want a header and an answer for each", got)
+		}
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		_, _, err := runMap(t, MapConfig{
+			Template: func(int, string) (agent.Agent, error) {
+				return llmagent.New(llmagent.Config{Name: "same", Model: &fakeModel{name: "same"}})
+			},
+		}, []string{"a", "b"})
+		if err == nil || !strings.Contains(err.Error(), `duplicate agent name "same"`) {
+			t.Errorf("got error %v, want a duplicate name error", err)
+		}
+	})
+}
+
+func TestPersonaName(t *testing.T) {
+	for _, tc := range []struct {
+		index int
+		label string
+		want  string
+	}{
+		{0, "Head of Sales", "head_of_sales_1"},
+		{1, "  R&D  ", "r_d_2"},
+		{2, "R/D", "r_d_3"},
+		{0, "user", "user_1"},
+		{4, "!!!", "stakeholder_5"},
+		{0, "Ops -- EU", "ops_eu_1"},
+	} {
+		if got := personaName(tc.index, tc.label); got != tc.want {
+			t.Errorf("personaName(%d, %q) = %q, want %q", tc.index, tc.label, got, tc.want)
+		}
+	}
+}
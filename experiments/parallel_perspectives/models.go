@@ -0,0 +1,154 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/model/gemini"
+	"google.golang.org/genai"
+)
+
+const defaultModel = "gemini-2.5-flash"
+
+// ModelSpec selects the backend, model and sampling settings for one agent.
+//
+// It is written as "[backend:]model[?key=value&...]", for example:
+//
+//	gemini-2.5-flash
+//	gemini:gemini-2.5-pro?temperature=0.2
+//	openai:llama3.1:8b?base_url=http://localhost:11434/v1
+//
+// The backend defaults to "gemini". Supported keys are "temperature",
+// "location" for Vertex AI (to reach a model in another region) and
+// "base_url" for the "openai" backend, which speaks the OpenAI Chat
+// Completions API to servers such as llama.cpp, Ollama or vLLM.
+type ModelSpec struct {
+	Backend     string
+	Model       string
+	Temperature *float32
+	Location    string
+	BaseURL     string
+}
+
+// ParseModelSpec parses a spec string as described on ModelSpec. An empty
+// string selects the default Gemini model.
+func ParseModelSpec(s string) (ModelSpec, error) {
+	spec := ModelSpec{Backend: "gemini", Model: defaultModel}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return spec, nil
+	}
+
+	name, rawQuery, _ := strings.Cut(s, "?")
+	if backend, rest, ok := strings.Cut(name, ":"); ok {
+		spec.Backend, name = backend, rest
+	}
+	if name != "" {
+		spec.Model = name
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return spec, fmt.Errorf("model spec %q: %w", s, err)
+	}
+	for key, values := range query {
+		v := values[len(values)-1]
+		switch key {
+		case "temperature":
+			t, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return spec, fmt.Errorf("model spec %q: invalid temperature %q", s, v)
+			}
+			spec.Temperature = genai.Ptr(float32(t))
+		case "location":
+			spec.Location = v
+		case "base_url":
+			spec.BaseURL = v
+		default:
+			return spec, fmt.Errorf("model spec %q: unknown option %q", s, key)
+		}
+	}
+	return spec, nil
+}
+
+// String returns a short label for reports, e.g. "gemini:gemini-2.5-pro@0.2".
+func (s ModelSpec) String() string {
+	label := s.Backend + ":" + s.Model
+	if s.Temperature != nil {
+		label += "@" + strconv.FormatFloat(float64(*s.Temperature), 'g', -1, 32)
+	}
+	return label
+}
+
+// GenerateContentConfig returns the per-agent sampling settings, or nil if
+// the spec does not override any.
+func (s ModelSpec) GenerateContentConfig() *genai.GenerateContentConfig {
+	if s.Temperature == nil {
+		return nil
+	}
+	return &genai.GenerateContentConfig{Temperature: s.Temperature}
+}
+
+// NewModel creates the model described by spec.
+func NewModel(ctx context.Context, spec ModelSpec) (model.LLM, error) {
+	switch spec.Backend {
+	case "gemini":
+		location := spec.Location
+		if location == "" {
+			location = os.Getenv("GOOGLE_CLOUD_LOCATION")
+		}
+		return gemini.NewModel(ctx, spec.Model, &genai.ClientConfig{
+			Backend:  genai.BackendVertexAI,
+			Project:  os.Getenv("GOOGLE_CLOUD_PROJECT"),
+			Location: location,
+		})
+	case "openai":
+		baseURL := spec.BaseURL
+		if baseURL == "" {
+			baseURL = os.Getenv("OPENAI_BASE_URL")
+		}
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+		return NewOpenAIModel(OpenAIConfig{
+			BaseURL: baseURL,
+			Model:   spec.Model,
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported model backend %q", spec.Backend)
+	}
+}
+
+// modelFromEnv reads a ModelSpec from the environment variable key and
+// creates the model, returning both so callers can label results.
+func modelFromEnv(ctx context.Context, key string) (model.LLM, ModelSpec, error) {
+	spec, err := ParseModelSpec(os.Getenv(key))
+	if err != nil {
+		return nil, spec, fmt.Errorf("%s: %w", key, err)
+	}
+	m, err := NewModel(ctx, spec)
+	if err != nil {
+		return nil, spec, fmt.Errorf("%s: %w", key, err)
+	}
+	return m, spec, nil
+}
@@ -0,0 +1,513 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// OpenAIConfig configures a model served over the OpenAI Chat Completions
+// API, such as a local llama.cpp, Ollama or vLLM server.
+type OpenAIConfig struct {
+	// BaseURL is the API root, e.g. "http://localhost:11434/v1" for Ollama.
+	// "/chat/completions" is appended to it.
+	BaseURL string
+	// Model is the model name the server expects, e.g. "llama3.1:8b".
+	Model string
+	// APIKey is sent as a bearer token if set. Local servers usually ignore
+	// it.
+	APIKey string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewOpenAIModel returns a model.LLM that talks to an OpenAI-compatible
+// Chat Completions endpoint. Text, system instructions, sampling settings
+// and function calling are mapped to and from their genai equivalents, and
+// streaming uses server-sent events.
+func NewOpenAIModel(cfg OpenAIConfig) (model.LLM, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("openai model: BaseURL is required")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("openai model: Model is required")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &openAIModel{cfg: cfg}, nil
+}
+
+type openAIModel struct {
+	cfg OpenAIConfig
+}
+
+func (m *openAIModel) Name() string {
+	return m.cfg.Model
+}
+
+func (m *openAIModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		body, err := m.buildRequest(req, stream)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		resp, err := m.post(ctx, body)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if !stream {
+			var out chatResponse
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				yield(nil, fmt.Errorf("openai model: decoding response: %w", err))
+				return
+			}
+			if out.Error != nil {
+				yield(nil, out.Error)
+				return
+			}
+			if len(out.Choices) == 0 {
+				yield(nil, fmt.Errorf("openai model: empty response"))
+				return
+			}
+			yield(toLLMResponse(out.Choices[0].Message, out.Choices[0].FinishReason, out.Usage), nil)
+			return
+		}
+
+		for r, err := range readStream(resp.Body) {
+			if !yield(r, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *openAIModel) post(ctx context.Context, body []byte) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(m.cfg.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if m.cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+	}
+	resp, err := m.cfg.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("openai model: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		// Reuse genai.APIError so callers such as the rate limiter can
+		// recognise retryable status codes regardless of backend.
+		return nil, genai.APIError{Code: resp.StatusCode, Status: resp.Status, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// Chat Completions wire types. Only the fields we use are declared.
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Tools          []chatTool      `json:"tools,omitempty"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	TopP           *float32        `json:"top_p,omitempty"`
+	MaxTokens      int32           `json:"max_tokens,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+}
+
+// responseFormat requests JSON output, optionally constrained by a schema.
+type responseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *jsonSchemaSpec `json:"json_schema,omitempty"`
+}
+
+type jsonSchemaSpec struct {
+	Name   string `json:"name"`
+	Schema any    `json:"schema"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type toolCall struct {
+	Index    int    `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatUsage struct {
+	PromptTokens     int32 `json:"prompt_tokens"`
+	CompletionTokens int32 `json:"completion_tokens"`
+	TotalTokens      int32 `json:"total_tokens"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		Delta        chatMessage `json:"delta"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+	// Error is set instead of Choices by servers that report a failure in
+	// the body, or in the middle of a stream.
+	Error *chatError `json:"error"`
+}
+
+type chatError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (e *chatError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("openai model: %s: %s", e.Type, e.Message)
+	}
+	return "openai model: " + e.Message
+}
+
+// buildRequest translates an LLMRequest into a Chat Completions request.
+func (m *openAIModel) buildRequest(req *model.LLMRequest, stream bool) ([]byte, error) {
+	out := chatRequest{Model: m.cfg.Model, Stream: stream}
+	if stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+
+	if cfg := req.Config; cfg != nil {
+		if text := contentText(cfg.SystemInstruction); text != "" {
+			out.Messages = append(out.Messages, chatMessage{Role: "system", Content: text})
+		}
+		out.Temperature = cfg.Temperature
+		out.TopP = cfg.TopP
+		out.MaxTokens = cfg.MaxOutputTokens
+		out.Stop = cfg.StopSequences
+		if cfg.ResponseMIMEType == "application/json" {
+			out.ResponseFormat = &responseFormat{Type: "json_object"}
+			if cfg.ResponseSchema != nil {
+				schema, err := schemaJSON(cfg.ResponseSchema)
+				if err != nil {
+					return nil, fmt.Errorf("openai model: response schema: %w", err)
+				}
+				out.ResponseFormat = &responseFormat{Type: "json_schema", JSONSchema: &jsonSchemaSpec{Name: "response", Schema: schema}}
+			}
+		}
+		for _, t := range cfg.Tools {
+			if t == nil {
+				continue
+			}
+			for _, decl := range t.FunctionDeclarations {
+				params, err := declParameters(decl)
+				if err != nil {
+					return nil, fmt.Errorf("openai model: tool %q: %w", decl.Name, err)
+				}
+				out.Tools = append(out.Tools, chatTool{
+					Type:     "function",
+					Function: toolFunction{Name: decl.Name, Description: decl.Description, Parameters: params},
+				})
+			}
+		}
+	}
+
+	for _, c := range req.Contents {
+		msgs, err := toChatMessages(c)
+		if err != nil {
+			return nil, err
+		}
+		out.Messages = append(out.Messages, msgs...)
+	}
+	if len(out.Messages) == 0 || out.Messages[len(out.Messages)-1].Role == "system" {
+		out.Messages = append(out.Messages, chatMessage{Role: "user", Content: "Handle the requests as specified in the system instruction."})
+	}
+	return json.Marshal(out)
+}
+
+// toChatMessages maps one genai.Content to Chat Completions messages. A
+// model turn becomes an assistant message (with tool_calls for function
+// calls); each function response becomes its own "tool" message.
+func toChatMessages(c *genai.Content) ([]chatMessage, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var msgs []chatMessage
+	if c.Role == genai.RoleModel {
+		msg := chatMessage{Role: "assistant"}
+		for _, p := range c.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				args, err := json.Marshal(p.FunctionCall.Args)
+				if err != nil {
+					return nil, err
+				}
+				tc := toolCall{ID: p.FunctionCall.ID, Type: "function"}
+				tc.Function.Name = p.FunctionCall.Name
+				tc.Function.Arguments = string(args)
+				msg.ToolCalls = append(msg.ToolCalls, tc)
+			case p.Text != "" && !p.Thought:
+				msg.Content += p.Text
+			}
+		}
+		return append(msgs, msg), nil
+	}
+
+	var text strings.Builder
+	for _, p := range c.Parts {
+		switch {
+		case p.FunctionResponse != nil:
+			resp, err := json.Marshal(p.FunctionResponse.Response)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, chatMessage{Role: "tool", ToolCallID: p.FunctionResponse.ID, Content: string(resp)})
+		case p.Text != "":
+			text.WriteString(p.Text)
+		}
+	}
+	if text.Len() > 0 {
+		msgs = append(msgs, chatMessage{Role: "user", Content: text.String()})
+	}
+	return msgs, nil
+}
+
+// declParameters returns the JSON Schema for a function's parameters.
+func declParameters(decl *genai.FunctionDeclaration) (any, error) {
+	if decl.ParametersJsonSchema != nil {
+		return decl.ParametersJsonSchema, nil
+	}
+	if decl.Parameters == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}, nil
+	}
+	return schemaJSON(decl.Parameters)
+}
+
+// schemaJSON converts a genai.Schema to plain JSON Schema. genai uses
+// upper-case type names ("STRING"), which OpenAI servers reject.
+func schemaJSON(s *genai.Schema) (any, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var schema any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return nil, err
+	}
+	lowerSchemaTypes(schema)
+	return schema, nil
+}
+
+func lowerSchemaTypes(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "type" {
+				v[k] = strings.ToLower(s)
+				continue
+			}
+			lowerSchemaTypes(e)
+		}
+	case []any:
+		for _, e := range v {
+			lowerSchemaTypes(e)
+		}
+	}
+}
+
+// toLLMResponse maps a complete assistant message to an LLMResponse.
+func toLLMResponse(msg chatMessage, finishReason string, usage *chatUsage) *model.LLMResponse {
+	content := &genai.Content{Role: genai.RoleModel}
+	if msg.Content != "" {
+		content.Parts = append(content.Parts, genai.NewPartFromText(msg.Content))
+	}
+	for _, tc := range msg.ToolCalls {
+		args := map[string]any{}
+		if tc.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				// Small local models sometimes emit malformed JSON; pass the
+				// raw string through so the tool can report a useful error.
+				args = map[string]any{"_raw_arguments": tc.Function.Arguments}
+			}
+		}
+		id := tc.ID
+		if id == "" {
+			id = "call_" + uuid.NewString()
+		}
+		content.Parts = append(content.Parts, &genai.Part{
+			FunctionCall: &genai.FunctionCall{ID: id, Name: tc.Function.Name, Args: args},
+		})
+	}
+
+	resp := &model.LLMResponse{
+		Content:      content,
+		FinishReason: toFinishReason(finishReason),
+		TurnComplete: true,
+	}
+	if usage != nil {
+		resp.UsageMetadata = &genai.GenerateContentResponseUsageMetadata{
+			PromptTokenCount:     usage.PromptTokens,
+			CandidatesTokenCount: usage.CompletionTokens,
+			TotalTokenCount:      usage.TotalTokens,
+		}
+	}
+	return resp
+}
+
+func toFinishReason(reason string) genai.FinishReason {
+	switch reason {
+	case "", "stop", "tool_calls", "function_call":
+		return genai.FinishReasonStop
+	case "length":
+		return genai.FinishReasonMaxTokens
+	case "content_filter":
+		return genai.FinishReasonSafety
+	default:
+		return genai.FinishReasonOther
+	}
+}
+
+// readStream parses a server-sent event stream of chat completion chunks.
+// Text deltas are yielded as partial responses, matching the Gemini model;
+// once the stream ends, a single complete response carries the aggregated
+// text, any tool calls and the token usage.
+func readStream(r io.Reader) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		var (
+			full         chatMessage
+			calls        = map[int]*toolCall{}
+			order        []int
+			finishReason string
+			usage        *chatUsage
+		)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				break
+			}
+
+			var chunk chatResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				yield(nil, fmt.Errorf("openai model: decoding stream chunk: %w", err))
+				return
+			}
+			if chunk.Error != nil {
+				yield(nil, chunk.Error)
+				return
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			choice := chunk.Choices[0]
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			for _, d := range choice.Delta.ToolCalls {
+				tc, ok := calls[d.Index]
+				if !ok {
+					tc = &toolCall{Index: d.Index}
+					calls[d.Index] = tc
+					order = append(order, d.Index)
+				}
+				if d.ID != "" {
+					tc.ID = d.ID
+				}
+				if d.Function.Name != "" {
+					tc.Function.Name = d.Function.Name
+				}
+				tc.Function.Arguments += d.Function.Arguments
+			}
+			if text := choice.Delta.Content; text != "" {
+				full.Content += text
+				if !yield(&model.LLMResponse{
+					Content: genai.NewContentFromText(text, genai.RoleModel),
+					Partial: true,
+				}, nil) {
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, fmt.Errorf("openai model: reading stream: %w", err))
+			return
+		}
+
+		for _, i := range order {
+			full.ToolCalls = append(full.ToolCalls, *calls[i])
+		}
+		yield(toLLMResponse(full, finishReason, usage), nil)
+	}
+}
+
+// contentText concatenates the text parts of c.
+func contentText(c *genai.Content) string {
+	if c == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range c.Parts {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
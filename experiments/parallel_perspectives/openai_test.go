@@ -0,0 +1,263 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// openAIServer is a stand-in Chat Completions server. It records the last
+// request and answers with respond.
+type openAIServer struct {
+	*httptest.Server
+	last chatRequest
+}
+
+func newOpenAIServer(t *testing.T, respond func(w http.ResponseWriter)) (*openAIServer, model.LLM) {
+	t.Helper()
+	s := &openAIServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&s.last); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		respond(w)
+	}))
+	t.Cleanup(s.Close)
+	m, err := NewOpenAIModel(OpenAIConfig{BaseURL: s.URL + "/v1", Model: "local-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, m
+}
+
+// sse writes chunks as server-sent events, followed by [DONE].
+func sse(chunks ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func reply(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+func generate(t *testing.T, m model.LLM, req *model.LLMRequest, stream bool) ([]*model.LLMResponse, error) {
+	var resps []*model.LLMResponse
+	for r, err := range m.GenerateContent(t.Context(), req, stream) {
+		if err != nil {
+			return resps, err
+		}
+		resps = append(resps, r)
+	}
+	return resps, nil
+}
+
+func userRequest(text string) *model.LLMRequest {
+	return &model.LLMRequest{Contents: []*genai.Content{genai.NewContentFromText(text, genai.RoleUser)}}
+}
+
+func TestOpenAIStreamsText(t *testing.T) {
+	srv, m := newOpenAIServer(t, sse(
+		`{"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"choices":[{"delta":{"content":"lo"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+	))
+	resps, err := generate(t, m, userRequest("hi"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !srv.last.Stream || srv.last.Model != "local-model" {
+		t.Errorf("got request stream=%v model=%q, want a stream for local-model", srv.last.Stream, srv.last.Model)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("got %d responses, want two partial ones and a final one", len(resps))
+	}
+	for i, want := range []string{"Hel", "lo"} {
+		if !resps[i].Partial || contentText(resps[i].Content) != want {
+			t.Errorf("response %d: got partial=%v %q, want partial %q", i, resps[i].Partial, contentText(resps[i].Content), want)
+		}
+	}
+	final := resps[2]
+	if final.Partial || contentText(final.Content) != "Hello" {
+		t.Errorf("final response: got partial=%v %q, want complete %q", final.Partial, contentText(final.Content), "Hello")
+	}
+	if final.UsageMetadata == nil || final.UsageMetadata.TotalTokenCount != 5 {
+		t.Errorf("final response: got usage %+v, want 5 tokens in total", final.UsageMetadata)
+	}
+}
+
+func TestOpenAIStreamsToolCalls(t *testing.T) {
+	// The arguments of the first call arrive in pieces, interleaved with the
+	// second call.
+	_, m := newOpenAIServer(t, sse(
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Par"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"is\"}"}},{"index":1,"function":{"arguments":"{}"}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+	))
+	resps, err := generate(t, m, userRequest("weather and time in Paris?"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 1 {
+		t.Fatalf("got %d responses, want one with the tool calls", len(resps))
+	}
+	var got []*genai.FunctionCall
+	for _, p := range resps[0].Content.Parts {
+		if p.FunctionCall != nil {
+			got = append(got, p.FunctionCall)
+		}
+	}
+	want := []*genai.FunctionCall{
+		{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}},
+		{ID: "call_2", Name: "get_time", Args: map[string]any{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got function calls %s, want %s", jsonString(got), jsonString(want))
+	}
+}
+
+func TestOpenAISendsFunctionResponsesAsToolMessages(t *testing.T) {
+	srv, m := newOpenAIServer(t, reply(http.StatusOK, `{"choices":[{"message":{"role":"assistant","content":"It is sunny."},"finish_reason":"stop"}]}`))
+	req := &model.LLMRequest{
+		Config: &genai.GenerateContentConfig{SystemInstruction: genai.NewContentFromText("Be brief.", genai.RoleUser)},
+		Contents: []*genai.Content{
+			genai.NewContentFromText("weather in Paris?", genai.RoleUser),
+			{Role: genai.RoleModel, Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{ID: "call_1", Name: "get_weather", Args: map[string]any{"city": "Paris"}}}}},
+			{Role: genai.RoleUser, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "call_1", Name: "get_weather", Response: map[string]any{"sky": "sunny"}}}}},
+		},
+	}
+	resps, err := generate(t, m, req, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != 1 || contentText(resps[0].Content) != "It is sunny." {
+		t.Errorf("got %s, want one response saying it is sunny", jsonString(resps))
+	}
+
+	msgs := srv.last.Messages
+	var roles []string
+	for _, msg := range msgs {
+		roles = append(roles, msg.Role)
+	}
+	if want := []string{"system", "user", "assistant", "tool"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("got message roles %q, want %q", roles, want)
+	}
+	call := msgs[2].ToolCalls
+	if len(call) != 1 || call[0].ID != "call_1" || call[0].Function.Name != "get_weather" || call[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("got assistant tool calls %s, want get_weather for Paris with ID call_1", jsonString(call))
+	}
+	if tool := msgs[3]; tool.ToolCallID != "call_1" || tool.Content != `{"sky":"sunny"}` {
+		t.Errorf("got tool message %s, want the response to call_1", jsonString(tool))
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		respond func(w http.ResponseWriter)
+		stream  bool
+		code    int // the genai.APIError code, if the error must be one
+		want    string
+	}{
+		{
+			name:    "rate limited",
+			respond: reply(http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`),
+			code:    http.StatusTooManyRequests,
+			want:    "slow down",
+		},
+		{
+			name:    "server error while streaming",
+			respond: reply(http.StatusInternalServerError, "model crashed"),
+			stream:  true,
+			code:    http.StatusInternalServerError,
+			want:    "model crashed",
+		},
+		{
+			name:    "not found",
+			respond: reply(http.StatusNotFound, `{"error":{"message":"model 'local-model' not found"}}`),
+			code:    http.StatusNotFound,
+			want:    "not found",
+		},
+		{
+			name:    "error body with status 200",
+			respond: reply(http.StatusOK, `{"error":{"message":"context length exceeded","type":"invalid_request_error"}}`),
+			want:    "invalid_request_error: context length exceeded",
+		},
+		{
+			name: "error in the middle of a stream",
+			respond: sse(
+				`{"choices":[{"delta":{"content":"Hel"}}]}`,
+				`{"error":{"message":"out of memory"}}`,
+			),
+			stream: true,
+			want:   "out of memory",
+		},
+		{
+			name:    "malformed stream chunk",
+			respond: sse(`{"choices":[`),
+			stream:  true,
+			want:    "decoding stream chunk",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, m := newOpenAIServer(t, tc.respond)
+			_, err := generate(t, m, userRequest("hi"), tc.stream)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got error %v, want one mentioning %q", err, tc.want)
+			}
+			if tc.code == 0 {
+				return
+			}
+			var apiErr genai.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != tc.code {
+				t.Errorf("got %T %v, want a genai.APIError with code %d", err, err, tc.code)
+			}
+			if retry := tc.code == http.StatusTooManyRequests || tc.code == http.StatusInternalServerError; isRetryable(err) != retry {
+				t.Errorf("got isRetryable %v, want %v", isRetryable(err), retry)
+			}
+		})
+	}
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,300 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// LimiterConfig configures a Limiter. Zero values disable the corresponding
+// limit.
+type LimiterConfig struct {
+	// MaxConcurrent caps the number of in-flight model requests.
+	MaxConcurrent int
+	// RequestsPerMinute is the request budget, refilled continuously.
+	RequestsPerMinute int
+	// TokensPerMinute is the token budget, refilled continuously. Requests
+	// are charged an estimate up front, corrected with the real usage
+	// reported by the model once the response arrives.
+	TokensPerMinute int
+
+	// MaxRetries is how many times a request failing with a retryable error
+	// (429, 500, 503, 504) is retried.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry. It doubles on every
+	// attempt, up to MaxBackoff, with random jitter. Defaults to 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the retry delay. Defaults to 30s.
+	MaxBackoff time.Duration
+}
+
+// Limiter throttles model requests. A single Limiter is meant to be shared by
+// every model in an experiment, so that all agents draw from the same
+// concurrency slots and per-minute budgets that the backend enforces.
+type Limiter struct {
+	cfg      LimiterConfig
+	slots    chan struct{}
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// NewLimiter returns a Limiter for the given configuration.
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	l := &Limiter{cfg: cfg}
+	if cfg.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	if cfg.RequestsPerMinute > 0 {
+		l.requests = newTokenBucket(cfg.RequestsPerMinute)
+	}
+	if cfg.TokensPerMinute > 0 {
+		l.tokens = newTokenBucket(cfg.TokensPerMinute)
+	}
+	return l
+}
+
+// Wrap returns a model.LLM that sends every request through l.
+func (l *Limiter) Wrap(m model.LLM) model.LLM {
+	return &limitedModel{LLM: m, limiter: l}
+}
+
+// acquire blocks until a request estimated at tokens may be sent. The
+// returned release function must be called exactly once with the number of
+// tokens the request actually used (0 if unknown).
+func (l *Limiter) acquire(ctx context.Context, tokens int) (release func(used int), err error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	freeSlot := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	if l.requests != nil {
+		if _, err := l.requests.take(ctx, 1); err != nil {
+			freeSlot()
+			return nil, err
+		}
+	}
+	charged := 0
+	if l.tokens != nil {
+		if charged, err = l.tokens.take(ctx, tokens); err != nil {
+			// The request is never sent, so it mustn't count against RPM.
+			if l.requests != nil {
+				l.requests.adjust(1)
+			}
+			freeSlot()
+			return nil, err
+		}
+	}
+	return func(used int) {
+		// Settle against what was actually charged, which is less than
+		// the estimate if take clamped it to the bucket's capacity.
+		if l.tokens != nil && used > 0 {
+			l.tokens.adjust(charged - used)
+		}
+		freeSlot()
+	}, nil
+}
+
+// backoff returns the delay before retry number attempt (0-based), using
+// exponential growth with jitter in [d/2, d).
+func (l *Limiter) backoff(attempt int) time.Duration {
+	d := l.cfg.InitialBackoff << attempt
+	if d <= 0 || d > l.cfg.MaxBackoff {
+		d = l.cfg.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+type limitedModel struct {
+	model.LLM
+	limiter *Limiter
+}
+
+func (m *limitedModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		estimate := estimateTokens(req)
+		for attempt := 0; ; attempt++ {
+			release, err := m.limiter.acquire(ctx, estimate)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			used, yielded := 0, false
+			var retryErr error
+			for resp, err := range m.LLM.GenerateContent(ctx, req, stream) {
+				if err != nil {
+					// Only retry before anything reached the caller; otherwise
+					// a streamed answer would be repeated.
+					if !yielded && attempt < m.limiter.cfg.MaxRetries && isRetryable(err) {
+						retryErr = err
+						break
+					}
+					release(used)
+					yield(nil, err)
+					return
+				}
+				if resp.UsageMetadata != nil {
+					used = int(resp.UsageMetadata.TotalTokenCount)
+				}
+				yielded = true
+				if !yield(resp, nil) {
+					release(used)
+					return
+				}
+			}
+			release(used)
+			if retryErr == nil {
+				return
+			}
+
+			delay := m.limiter.backoff(attempt)
+			log.Printf("model %s: %v; retrying in %s (attempt %d/%d)", m.Name(), retryErr, delay.Round(time.Millisecond), attempt+1, m.limiter.cfg.MaxRetries)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				yield(nil, ctx.Err())
+				return
+			}
+		}
+	}
+}
+
+// isRetryable reports whether err is a transient backend error.
+func isRetryable(err error) bool {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		var apiErrPtr *genai.APIError
+		if !errors.As(err, &apiErrPtr) || apiErrPtr == nil {
+			return false
+		}
+		apiErr = *apiErrPtr
+	}
+	switch apiErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// estimateTokens gives a rough token count for req using the common
+// four-characters-per-token rule, plus the requested output budget.
+func estimateTokens(req *model.LLMRequest) int {
+	chars := 0
+	count := func(c *genai.Content) {
+		if c == nil {
+			return
+		}
+		for _, p := range c.Parts {
+			chars += len(p.Text)
+		}
+	}
+	for _, c := range req.Contents {
+		count(c)
+	}
+	output := 0
+	if req.Config != nil {
+		count(req.Config.SystemInstruction)
+		output = int(req.Config.MaxOutputTokens)
+	}
+	n := chars/4 + output
+	return max(n, 1)
+}
+
+// tokenBucket is a continuously refilled budget of perMinute units.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64 // units per second
+	level    float64
+	last     time.Time
+
+	// now and after are time.Now and time.After, replaced in tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		level:    float64(perMinute),
+		last:     time.Now(),
+		now:      time.Now,
+		after:    time.After,
+	}
+}
+
+// take blocks until n units are available, removes them and returns how many
+// it removed. Requests larger than the bucket are clamped to its capacity so
+// they can eventually run.
+func (b *tokenBucket) take(ctx context.Context, n int) (int, error) {
+	want := min(n, int(b.capacity))
+	for {
+		b.mu.Lock()
+		b.refill()
+		if b.level >= float64(want) {
+			b.level -= float64(want)
+			b.mu.Unlock()
+			return want, nil
+		}
+		wait := time.Duration((float64(want) - b.level) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-b.after(wait):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// adjust returns delta units to the bucket (or charges them, if negative),
+// e.g. once the real token usage of a request is known.
+func (b *tokenBucket) adjust(delta int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.level = min(b.level+float64(delta), b.capacity)
+}
+
+func (b *tokenBucket) refill() {
+	now := b.now()
+	b.level = min(b.level+now.Sub(b.last).Seconds()*b.rate, b.capacity)
+	b.last = now
+}
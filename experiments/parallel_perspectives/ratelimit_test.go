@@ -0,0 +1,277 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// fakeClock drives a tokenBucket. Every wait advances the clock by the
+// requested duration at once, unless hold is set, in which case waits never
+// end.
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	waited time.Duration
+	hold   bool
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hold {
+		return nil
+	}
+	c.t = c.t.Add(d)
+	c.waited += d
+	ch := make(chan time.Time, 1)
+	ch <- c.t
+	return ch
+}
+
+// useClock makes the buckets of l run on a new fake clock.
+func useClock(l *Limiter) *fakeClock {
+	c := &fakeClock{t: time.Unix(0, 0)}
+	for _, b := range []*tokenBucket{l.requests, l.tokens} {
+		if b != nil {
+			b.now, b.after, b.last = c.now, c.after, c.t
+		}
+	}
+	return c
+}
+
+func level(b *tokenBucket) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.level
+}
+
+func TestLimiterTokenAccounting(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		estimate  int
+		used      int
+		wantTaken float64 // after acquire
+		wantLeft  float64 // after release
+	}{
+		{"used less than estimated", 20, 5, 40, 55},
+		{"used more than estimated", 20, 30, 40, 30},
+		{"usage unknown", 20, 0, 40, 40},
+		// The estimate is clamped to the capacity of 60, so only the 60
+		// charged may be refunded, not the 100 estimated.
+		{"clamped estimate", 100, 10, 0, 50},
+		// Usage beyond what was charged is still owed.
+		{"clamped estimate, all used", 100, 100, 0, -40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(LimiterConfig{TokensPerMinute: 60})
+			useClock(l)
+			release, err := l.acquire(t.Context(), tc.estimate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := level(l.tokens); got != tc.wantTaken {
+				t.Errorf("after acquire: got level %v, want %v", got, tc.wantTaken)
+			}
+			release(tc.used)
+			if got := level(l.tokens); got != tc.wantLeft {
+				t.Errorf("after release: got level %v, want %v", got, tc.wantLeft)
+			}
+		})
+	}
+}
+
+func TestLimiterWaitsForRefill(t *testing.T) {
+	l := NewLimiter(LimiterConfig{RequestsPerMinute: 60, TokensPerMinute: 60})
+	clock := useClock(l)
+	release, err := l.acquire(t.Context(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(60)
+
+	// The bucket refills at one token a second.
+	release, err = l.acquire(t.Context(), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(30)
+	if clock.waited != 30*time.Second {
+		t.Errorf("waited %s, want 30s", clock.waited)
+	}
+}
+
+func TestLimiterCancelledWait(t *testing.T) {
+	l := NewLimiter(LimiterConfig{RequestsPerMinute: 60, TokensPerMinute: 60, MaxConcurrent: 1})
+	clock := useClock(l)
+	release, err := l.acquire(t.Context(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(60)
+
+	clock.hold = true
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := l.acquire(ctx, 30); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	// The request was never sent: it costs neither a request nor tokens,
+	// and its concurrency slot is free again.
+	if got := level(l.requests); got != 59 {
+		t.Errorf("got %v requests left, want 59", got)
+	}
+	if got := level(l.tokens); got != 0 {
+		t.Errorf("got %v tokens left, want 0", got)
+	}
+	if len(l.slots) != 0 {
+		t.Errorf("%d slots still taken, want none", len(l.slots))
+	}
+}
+
+func TestLimiterMaxConcurrent(t *testing.T) {
+	l := NewLimiter(LimiterConfig{MaxConcurrent: 1})
+	release, err := l.acquire(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second request: got %v, want it to wait for the slot", err)
+	}
+
+	release(0)
+	release, err = l.acquire(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	release(0)
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l := NewLimiter(LimiterConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 5 * time.Second},
+		{70, 5 * time.Second}, // the shift overflows
+	} {
+		for range 20 {
+			if d := l.backoff(tc.attempt); d < tc.max/2 || d > tc.max {
+				t.Errorf("attempt %d: got %s, want between %s and %s", tc.attempt, d, tc.max/2, tc.max)
+			}
+		}
+	}
+}
+
+// flakyModel fails with the errors in errs, one per call, then answers. If
+// failAfterText is set, it fails after streaming a first response.
+type flakyModel struct {
+	errs          []error
+	failAfterText bool
+	calls         int
+}
+
+func (m *flakyModel) Name() string { return "flaky" }
+
+func (m *flakyModel) GenerateContent(ctx context.Context, req *model.LLMRequest, stream bool) iter.Seq2[*model.LLMResponse, error] {
+	return func(yield func(*model.LLMResponse, error) bool) {
+		m.calls++
+		if m.calls <= len(m.errs) {
+			if m.failAfterText && !yield(&model.LLMResponse{Content: genai.NewContentFromText("partial", genai.RoleModel), Partial: true}, nil) {
+				return
+			}
+			yield(nil, m.errs[m.calls-1])
+			return
+		}
+		yield(&model.LLMResponse{
+			Content:       genai.NewContentFromText("done", genai.RoleModel),
+			UsageMetadata: &genai.GenerateContentResponseUsageMetadata{TotalTokenCount: 7},
+		}, nil)
+	}
+}
+
+func TestLimiterRetries(t *testing.T) {
+	unavailable := genai.APIError{Code: http.StatusServiceUnavailable, Message: "overloaded"}
+	tooMany := &genai.APIError{Code: http.StatusTooManyRequests, Message: "quota"}
+	badRequest := genai.APIError{Code: http.StatusBadRequest, Message: "bad request"}
+
+	for _, tc := range []struct {
+		name          string
+		maxRetries    int
+		model         *flakyModel
+		wantCalls     int
+		wantErr       bool
+		wantResponses int
+	}{
+		{"recovers", 2, &flakyModel{errs: []error{unavailable, tooMany}}, 3, false, 1},
+		{"gives up", 1, &flakyModel{errs: []error{unavailable, unavailable}}, 2, true, 0},
+		{"not retryable", 2, &flakyModel{errs: []error{badRequest}}, 1, true, 0},
+		{"after output", 2, &flakyModel{errs: []error{unavailable}, failAfterText: true}, 1, true, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLimiter(LimiterConfig{
+				MaxConcurrent:  1,
+				MaxRetries:     tc.maxRetries,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			})
+			var responses int
+			var gotErr error
+			for resp, err := range l.Wrap(tc.model).GenerateContent(t.Context(), &model.LLMRequest{}, false) {
+				if err != nil {
+					gotErr = err
+					continue
+				}
+				if resp != nil {
+					responses++
+				}
+			}
+			if tc.model.calls != tc.wantCalls {
+				t.Errorf("got %d calls, want %d", tc.model.calls, tc.wantCalls)
+			}
+			if (gotErr != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %t", gotErr, tc.wantErr)
+			}
+			if responses != tc.wantResponses {
+				t.Errorf("got %d responses, want %d", responses, tc.wantResponses)
+			}
+			if len(l.slots) != 0 {
+				t.Errorf("%d slots still taken, want none", len(l.slots))
+			}
+		})
+	}
+}
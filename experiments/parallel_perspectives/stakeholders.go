@@ -0,0 +1,134 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/adk/agent"
+	"google.golang.org/adk/agent/llmagent"
+	"google.golang.org/adk/agent/workflowagents/sequentialagent"
+	"google.golang.org/adk/model"
+	"google.golang.org/genai"
+)
+
+// newStakeholderReview builds a plan -> map -> reduce pipeline:
+//  1. The planner lists the stakeholders affected by the user's topic.
+//  2. The map agent creates one persona per stakeholder and runs them
+//     concurrently.
+//  3. The moderator reads every persona's view from state and summarizes.
+func newStakeholderReview(m model.LLM, genCfg *genai.GenerateContentConfig) (agent.Agent, error) {
+	planner, err := llmagent.New(llmagent.Config{
+		Name:                  "planner",
+		Model:                 m,
+		GenerateContentConfig: genCfg,
+		Instruction: "List the three to five stakeholders most affected by the user's topic " +
+			"(for example: CFO, engineer, customer). Reply with the list only.",
+		OutputSchema: &genai.Schema{
+			Type:  genai.TypeArray,
+			Items: &genai.Schema{Type: genai.TypeString},
+		},
+		OutputKey: "stakeholders",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	panel, err := NewMap(MapConfig{
+		AgentConfig: agent.Config{
+			Name:        "stakeholder_panel",
+			Description: "Gets one perspective per stakeholder.",
+		},
+		ItemsKey:       "stakeholders",
+		MaxConcurrency: 3,
+		OutputKey:      "stakeholder_views",
+		Template: func(i int, stakeholder string) (agent.Agent, error) {
+			return llmagent.New(llmagent.Config{
+				Name:                  personaName(i, stakeholder),
+				Model:                 m,
+				GenerateContentConfig: genCfg,
+				Instruction: fmt.Sprintf("You are the %s. Give a short take on the user's topic "+
+					"from your own point of view: what you gain, what you lose, what worries you.", stakeholder),
+			})
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	moderator, err := llmagent.New(llmagent.Config{
+		Name:                  "moderator",
+		Model:                 m,
+		GenerateContentConfig: genCfg,
+		InstructionProvider:   moderatorInstruction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sequentialagent.New(sequentialagent.Config{
+		AgentConfig: agent.Config{
+			Name:        "stakeholder_review",
+			Description: "Finds the stakeholders for a topic and gathers each one's perspective.",
+			SubAgents:   []agent.Agent{planner, panel, moderator},
+		},
+	})
+}
+
+// moderatorInstruction renders the map agent's results into the moderator's
+// instruction. A plain {stakeholder_views} placeholder would print the raw Go
+// value, so we format the list ourselves.
+func moderatorInstruction(ctx agent.ReadonlyContext) (string, error) {
+	var b strings.Builder
+	b.WriteString("You are a neutral moderator. Summarize where the stakeholders agree, " +
+		"where they conflict, and what a fair compromise looks like.\n\nStakeholder views:\n")
+
+	views, err := ctx.ReadonlyState().Get("stakeholder_views")
+	if err != nil {
+		return "", fmt.Errorf("no stakeholder views in state: %w", err)
+	}
+	list, _ := views.([]any)
+	for _, v := range list {
+		view, _ := v.(map[string]any)
+		if e, _ := view["error"].(string); e != "" {
+			fmt.Fprintf(&b, "- %v: (no answer: %s)\n", view["item"], e)
+			continue
+		}
+		fmt.Fprintf(&b, "- %v: %v\n", view["item"], view["output"])
+	}
+	return b.String(), nil
+}
+
+// personaName turns the free-form stakeholder label at index into a valid
+// agent name, e.g. "Head of Sales" at index 0 -> "head_of_sales_1". The
+// position suffix keeps labels that normalise alike, such as "R&D" and
+// "R/D", from colliding.
+func personaName(index int, label string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(label)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "_")
+	if name == "" {
+		name = "stakeholder"
+	}
+	return fmt.Sprintf("%s_%d", name, index+1)
+}